@@ -0,0 +1,122 @@
+package common
+
+import (
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/money"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// thai holds the Thai translation of each message in constants. English
+// needs no entries: the messages are written in English.
+var thai = map[string]string{
+	ct.ErrInvalidFormatReq:     "รูปแบบคำขอไม่ถูกต้อง",
+	ct.ErrMessageThenZero:      "รายได้ต้องมากกว่าศูนย์",
+	ct.ErrMesssageWhtInvalid:   "ภาษีหัก ณ ที่จ่ายไม่ถูกต้อง ต้องอยู่ระหว่าง 0 ถึงรายได้ทั้งหมด",
+	ct.ErrMessageTaxInvalid:    "คำขอคำนวณภาษีไม่ถูกต้อง",
+	ct.ErrMessageInternal:      "เกิดข้อผิดพลาดภายในระบบ",
+	ct.ErrMsgAllowanceType:     "ไม่พบประเภทค่าลดหย่อน",
+	ct.ErrMsgAllowanceThenZero: "จำนวนค่าลดหย่อนต้องไม่ติดลบ",
+	ct.ErrMsgAllowanceThenMin:  "ค่าลดหย่อนต้องไม่น้อยกว่าค่าต่ำสุดของค่าลดหย่อนประเภทนั้น",
+	ct.ErrMsgDatabaseError:     "ฐานข้อมูลผิดพลาด",
+	ct.ErrMsgInvalidDeduct:     "ประเภทค่าลดหย่อนไม่ถูกต้อง",
+	ct.ErrMsgDeductNotFound:    "ไม่พบประเภทค่าลดหย่อน",
+	ct.ErrMsgNotDeductSupport:  "ไม่รองรับการตั้งค่าค่าลดหย่อนประเภทนี้",
+	ct.ErrMsgUpdateNotSuccess:  "บันทึกข้อมูลลงฐานข้อมูลไม่สำเร็จ",
+	ct.ErrMsgValidateMinAmt:    "จำนวนค่าลดหย่อนต้องมากกว่าหรือเท่ากับ %v",
+	ct.ErrMsgValidateMaxAmt:    "จำนวนค่าลดหย่อนต้องน้อยกว่าหรือเท่ากับ %v",
+	ct.ErrMsgInvalidPathParam:  "พารามิเตอร์ในพาธไม่ถูกต้อง",
+	ct.ErrMsgTaxYearInvalid:    "ปีภาษีไม่ถูกต้อง ต้องไม่เกินปีปัจจุบัน",
+	ct.ErrMsgTaxRatesNotFound:  "ไม่พบอัตราภาษีของปีภาษี %v",
+	ct.ErrMsgTaxRateNotFound:   "ไม่พบขั้นอัตราภาษี",
+	ct.ErrMsgTaxRateInvalidID:  "รหัสขั้นอัตราภาษีไม่ถูกต้อง",
+	ct.ErrMsgTaxRateLevel:      "ต้องระบุชื่อขั้นอัตราภาษี",
+	ct.ErrMsgTaxRateInvalid:    "อัตราภาษีต้องอยู่ระหว่าง 0 ถึง 100",
+	ct.ErrMsgTaxRateSplit:      "ขั้นอัตราภาษีใหม่ต้องสิ้นสุดที่เดียวกับขั้นที่ถูกแบ่ง",
+	ct.ErrMsgTaxRatesFirstMin:  "ขั้นอัตราภาษีแรกต้องเริ่มที่ 0",
+	ct.ErrMsgTaxRatesRange:     "รายได้สูงสุดของขั้นอัตราภาษีต้องไม่น้อยกว่ารายได้ต่ำสุด",
+	ct.ErrMsgTaxRatesOverlap:   "ขั้นอัตราภาษีต้องไม่ซ้อนทับกัน",
+	ct.ErrMsgTaxRatesGap:       "ขั้นอัตราภาษีต้องต่อเนื่องกัน แต่ละขั้นต้องเริ่มถัดจากขั้นก่อนหน้า 1 บาท",
+	ct.ErrMsgTaxRatesOrder:     "อัตราภาษีต้องไม่ลดลงเมื่อรายได้สูงขึ้น",
+	ct.ErrMsgTaxRatesOpenEnded: "ขั้นอัตราภาษีสุดท้ายต้องไม่มีรายได้สูงสุด",
+	ct.ErrMsgTaxRatesChanged:   "ขั้นอัตราภาษีถูกแก้ไขไปแล้วในระหว่างนี้ กรุณาโหลดใหม่แล้วลองอีกครั้ง",
+	ct.ErrMsgAllowanceExists:   "มีประเภทค่าลดหย่อนหรือชื่อที่ใช้ตอบกลับนี้อยู่แล้ว",
+	ct.ErrMsgAllowanceName:     "ประเภทค่าลดหย่อนต้องประกอบด้วยตัวอักษรภาษาอังกฤษพิมพ์เล็ก ตัวเลข และขีดกลางเท่านั้น",
+	ct.ErrMsgAllowanceRespName: "ชื่อที่ใช้ตอบกลับต้องประกอบด้วยตัวอักษรภาษาอังกฤษและตัวเลข และขึ้นต้นด้วยตัวอักษร",
+	ct.ErrMsgAllowanceLimits:   "จำนวนค่าลดหย่อนต้องเป็นไปตาม 0 <= ต่ำสุด <= วงเงิน <= สูงสุด",
+	ct.ErrMsgAllowanceCapRule:  "เงื่อนไขเพดานค่าลดหย่อนต้องเป็น flat, percent_of_gross หรือ percent_of_net",
+	ct.ErrMsgAllowanceCapPct:   "เปอร์เซ็นต์เพดานค่าลดหย่อนต้องมากกว่า 0 และไม่เกิน 100 สำหรับเพดานแบบเปอร์เซ็นต์",
+	ct.ErrMsgFieldValidation:   "ข้อมูล '%v' ไม่ผ่านการตรวจสอบ '%v'",
+
+	ct.ErrMsgCsvInvaildFormat:   "รูปแบบไฟล์ไม่ถูกต้อง กรุณาตรวจสอบรูปแบบไฟล์",
+	ct.ErrMsgFileNoUpload:       "ไม่พบไฟล์ที่อัปโหลด",
+	ct.ErrMsgReadCsvFailed:      "อ่านไฟล์ csv ไม่สำเร็จ",
+	ct.ErrInvalidIncomeCsv:      "รายได้ไม่ใช่ตัวเลขที่ถูกต้องในบรรทัดที่ %v",
+	ct.ErrInvalidWHTCsv:         "ภาษีหัก ณ ที่จ่ายไม่ใช่ตัวเลขที่ถูกต้องในบรรทัดที่ %v",
+	ct.ErrInvalidAllowanceCsv:   "%v ไม่ใช่ตัวเลขที่ถูกต้องในบรรทัดที่ %v",
+	ct.ErrMsgCsvColumn:          "ไม่รู้จักคอลัมน์ %v คอลัมน์ต้องเป็น totalIncome, wht, id หรือประเภทค่าลดหย่อน",
+	ct.ErrMsgCsvColumnMissing:   "ไม่พบคอลัมน์ที่จำเป็น %v",
+	ct.ErrMsgCsvDuplicateColumn: "คอลัมน์ %v ซ้ำกัน",
+	ct.ErrMsgCsvMode:            "โหมดต้องเป็น strict หรือ lenient",
+	ct.ErrMsgFormat:             "รูปแบบต้องเป็น json, ndjson, csv หรือ xlsx",
+	ct.ErrMsgCsvTooLarge:        "ไฟล์ที่อัปโหลดต้องมีขนาดไม่เกิน %v ไบต์",
+	ct.ErrMsgCsvTooManyRows:     "ไฟล์ csv ต้องมีไม่เกิน %v แถว",
+	ct.ErrMsgTaxJobNotFound:     "ไม่พบงานคำนวณภาษี",
+	ct.ErrMsgTaxJobNotFinished:  "งานคำนวณภาษียังไม่เสร็จ",
+	ct.ErrMsgTaxJobFailed:       "งานคำนวณภาษีล้มเหลว ดูรายละเอียดข้อผิดพลาดที่งาน",
+	ct.ErrMsgTaxJobRowErrors:    "คำนวณภาษีไม่ได้ %v แถว",
+	ct.ErrMsgTaxJobClaimLost:    "งานคำนวณภาษีถูกเครื่องอื่นรับไปทำแล้ว",
+
+	ct.ErrMsgSnapshotNotFound:     "ไม่พบสแนปช็อตการตั้งค่า %v",
+	ct.ErrMsgCalculationNotFound:  "ไม่พบประวัติการคำนวณ",
+	ct.ErrMsgCalculationInvalidID: "รหัสการคำนวณไม่ถูกต้อง",
+	ct.ErrMsgSnapshotInvalidID:    "รหัสสแนปช็อตการตั้งค่าไม่ถูกต้อง",
+	ct.ErrMsgPageLimit:            "limit ต้องอยู่ระหว่าง 1 ถึง %v",
+	ct.ErrMsgPageOffset:           "offset ต้องไม่ติดลบ",
+	ct.ErrMsgDateInvalid:          "วันที่ต้องอยู่ในรูปแบบ YYYY-MM-DD หรือ RFC 3339",
+	ct.ErrMsgDateRange:            "from ต้องไม่อยู่หลัง to",
+	ct.ErrMsgAmountInvalid:        "จำนวนเงินต้องเป็นตัวเลขทศนิยม",
+	ct.ErrMsgIncomeRange:          "minIncome ต้องไม่มากกว่า maxIncome",
+
+	ct.ErrMsgAdminUsername:     "ชื่อผู้ใช้ต้องมี 3 ถึง 50 ตัวอักษร ประกอบด้วยตัวอักษร ตัวเลข '.' '_' หรือ '-'",
+	ct.ErrMsgAdminPassword:     "รหัสผ่านต้องยาว %v ถึง %v ไบต์",
+	ct.ErrMsgAdminUserExists:   "มีผู้ดูแลระบบชื่อนี้อยู่แล้ว",
+	ct.ErrMsgAdminUserNotFound: "ไม่พบผู้ดูแลระบบ",
+	ct.ErrMsgAdminUserSelf:     "ไม่สามารถลบหรือปิดใช้งานบัญชีของตนเอง หรือถอนบทบาท user-admin ของตนเองได้",
+	ct.ErrMsgAdminRole:         "บทบาทต้องเป็นหนึ่งใน %v",
+	ct.ErrMsgForbidden:         "บทบาทของคุณไม่มีสิทธิ์ทำรายการนี้",
+
+	ct.ErrMsgCredentials:        "API key หรือโทเคนไม่ถูกต้อง หมดอายุ หรือถูกเพิกถอนแล้ว",
+	ct.ErrMsgCredentialsMissing: "ต้องระบุ API key หรือ bearer token",
+	ct.ErrMsgScope:              "ข้อมูลยืนยันตัวตนของคุณไม่มีสิทธิ์ %v",
+	ct.ErrMsgAPIKeyClient:       "ชื่อไคลเอนต์ต้องมี 3 ถึง 50 ตัวอักษร ประกอบด้วยตัวอักษร ตัวเลข '.' '_' หรือ '-'",
+	ct.ErrMsgAPIKeyScopes:       "สิทธิ์ต้องเป็นอย่างน้อยหนึ่งใน %v",
+	ct.ErrMsgAPIKeyNotFound:     "ไม่พบ API key",
+	ct.ErrMsgAPIKeyInvalidID:    "รหัส API key ไม่ถูกต้อง",
+	ct.ErrMsgRateLimited:        "มีคำขอมากเกินไป กรุณาลองใหม่ในอีก %v วินาที",
+
+	ct.LevelAndAbove: "%v ขึ้นไป",
+}
+
+func init() {
+	for key, msg := range thai {
+		if err := message.SetString(language.Thai, key, msg); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// LevelLabel names the tax bracket from min to max in lang, e.g.
+// "150,001-500,000", or "2,000,001 and above" when max is nil.
+func LevelLabel(lang language.Tag, min money.Amount, max *money.Amount) string {
+	if max == nil {
+		return Msg(lang, ct.LevelAndAbove, min)
+	}
+	return Msg(lang, ct.LevelRange, min, *max)
+}
+
+// amountNumber formats a for the message printer.
+func amountNumber(a money.Amount) number.Formatter {
+	return number.Decimal(a.Float64(), number.MaxFractionDigits(2))
+}
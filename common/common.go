@@ -1,17 +1,57 @@
 package common
 
 import (
+	"strconv"
+
+	"github.com/kanawat2566/assessment-tax/money"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
-	"golang.org/x/text/number"
 )
 
-func MsgWithNumber(msg string, num float64) string {
-	p := message.NewPrinter(language.English)
-	n := number.Decimal(num, number.MaxFractionDigits(1))
-	return p.Sprintf(msg+" %v", n)
+// Languages are the languages messages are translated to. The first one is
+// used when a client asks for none of them.
+var Languages = []language.Tag{language.English, language.Thai}
+
+var matcher = language.NewMatcher(Languages)
+
+// MatchLanguage picks one of Languages for an Accept-Language header. An
+// empty header gives language.Und, meaning the client has no preference.
+func MatchLanguage(acceptLanguage string) language.Tag {
+	if acceptLanguage == "" {
+		return language.Und
+	}
+	tags, _, _ := language.ParseAcceptLanguage(acceptLanguage)
+	_, i, _ := matcher.Match(tags...)
+	return Languages[i]
+}
+
+// Msg formats msg, one of the messages in constants, in lang. Amounts are
+// grouped and keep up to two decimals; ints such as years and line numbers
+// are printed as they are.
+func Msg(lang language.Tag, msg string, args ...interface{}) string {
+	if lang == language.Und {
+		lang = Languages[0]
+	}
+	p := message.NewPrinter(lang)
+
+	fmtArgs := make([]interface{}, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case int:
+			fmtArgs[i] = strconv.Itoa(v)
+		case money.Amount:
+			fmtArgs[i] = amountNumber(v)
+		default:
+			fmtArgs[i] = v
+		}
+	}
+	return p.Sprintf(msg, fmtArgs...)
 }
 
 func MsgWithInt(msg string, num int) string {
-	return MsgWithNumber(msg, float64(num))
+	return Msg(language.English, msg, num)
+}
+
+func MsgWithAmount(msg string, amt money.Amount) string {
+	return Msg(language.English, msg, amt)
 }
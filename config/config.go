@@ -0,0 +1,289 @@
+// Package config is the configuration of the service. It is read once at
+// startup, from lowest to highest precedence, from defaults, an optional YAML
+// file named by CONFIG_FILE, a .env file and the environment, so the same
+// binary can be tuned per environment without a rebuild.
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Server    Server    `yaml:"server"`
+	Database  Database  `yaml:"database"`
+	Upload    Upload    `yaml:"upload"`
+	Jobs      Jobs      `yaml:"jobs"`
+	Auth      Auth      `yaml:"auth"`
+	RateLimit RateLimit `yaml:"rateLimit"`
+}
+
+type Server struct {
+	Port            int           `yaml:"port" env:"PORT"`
+	ReadTimeout     time.Duration `yaml:"readTimeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout    time.Duration `yaml:"writeTimeout" env:"SERVER_WRITE_TIMEOUT"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+}
+
+// Database is the Postgres database. Zero pool sizes, lifetime and idle time
+// leave the database/sql defaults, i.e. no limit.
+//
+// At startup the database is tried ConnectAttempts times before giving up,
+// waiting ConnectBackoff after the first failure and twice as long after each
+// next one, but never longer than ConnectMaxBackoff. Unless MigrateOnStart is
+// turned off, the schema is then migrated to the latest version; otherwise
+// the migrate command does it.
+type Database struct {
+	URL               string        `yaml:"url" env:"DATABASE_URL"`
+	MaxOpenConns      int           `yaml:"maxOpenConns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns      int           `yaml:"maxIdleConns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime   time.Duration `yaml:"connMaxLifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime   time.Duration `yaml:"connMaxIdleTime" env:"DB_CONN_MAX_IDLE_TIME"`
+	ConnectAttempts   int           `yaml:"connectAttempts" env:"DB_CONNECT_ATTEMPTS"`
+	ConnectBackoff    time.Duration `yaml:"connectBackoff" env:"DB_CONNECT_BACKOFF"`
+	ConnectMaxBackoff time.Duration `yaml:"connectMaxBackoff" env:"DB_CONNECT_MAX_BACKOFF"`
+	MigrateOnStart    bool          `yaml:"migrateOnStart" env:"DB_MIGRATE_ON_START"`
+}
+
+// Upload limits a CSV upload.
+type Upload struct {
+	MaxBytes int64 `yaml:"maxBytes" env:"CSV_MAX_UPLOAD_BYTES"`
+	MaxRows  int   `yaml:"maxRows" env:"CSV_MAX_ROWS"`
+}
+
+// Jobs are the bulk calculation workers. DrainTimeout is how long shutdown
+// waits for running jobs before handing them back to the queue.
+type Jobs struct {
+	Workers      int           `yaml:"workers" env:"JOB_WORKERS"`
+	DrainTimeout time.Duration `yaml:"drainTimeout" env:"JOB_DRAIN_TIMEOUT"`
+}
+
+// Auth is how callers sign in. The first admin user is created from
+// AdminUsername and AdminPassword while there is none; the password has no
+// default and must be set with the username. JWTs are accepted only
+// with a JWKSFile; until ClientAuthRequired, calculations without
+// credentials are let in.
+type Auth struct {
+	AdminUsername      string `yaml:"adminUsername" env:"ADMIN_USERNAME"`
+	AdminPassword      string `yaml:"adminPassword" env:"ADMIN_PASSWORD"`
+	ClientAuthRequired bool   `yaml:"clientAuthRequired" env:"CLIENT_AUTH_REQUIRED"`
+	JWKSFile           string `yaml:"jwksFile" env:"JWT_JWKS_FILE"`
+	JWTIssuer          string `yaml:"jwtIssuer" env:"JWT_ISSUER"`
+	JWTAudience        string `yaml:"jwtAudience" env:"JWT_AUDIENCE"`
+}
+
+// RateLimit is the limit of each class of requests, and where the token
+// buckets are kept: "memory" for one replica, "postgres" for many.
+//
+// CalculateQuota and BulkQuota cap each caller of those classes to Requests
+// per fixed Window on top of the limit, e.g. "10000/24h" a day from midnight
+// UTC. AuthFailures limits failed sign-ins per client IP.
+type RateLimit struct {
+	Store          string `yaml:"store" env:"RATE_LIMIT_STORE"`
+	Calculate      Limit  `yaml:"calculate" env:"RATE_LIMIT_CALCULATE"`
+	Bulk           Limit  `yaml:"bulk" env:"RATE_LIMIT_BULK"`
+	Admin          Limit  `yaml:"admin" env:"RATE_LIMIT_ADMIN"`
+	CalculateQuota Limit  `yaml:"calculateQuota" env:"RATE_LIMIT_CALCULATE_QUOTA"`
+	BulkQuota      Limit  `yaml:"bulkQuota" env:"RATE_LIMIT_BULK_QUOTA"`
+	AuthFailures   Limit  `yaml:"authFailures" env:"RATE_LIMIT_AUTH_FAILURES"`
+}
+
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+// Limit is Requests per Window, written e.g. "60/1m", or no limit at all,
+// written "off", when Requests is zero.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+var _ encoding.TextUnmarshaler = (*Limit)(nil)
+
+func (l *Limit) UnmarshalText(b []byte) error {
+	s := string(b)
+	if s == "off" {
+		*l = Limit{}
+		return nil
+	}
+	requests, window, _ := strings.Cut(s, "/")
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 1 {
+		return fmt.Errorf("limit should be requests/window, e.g. 60/1m, or off: %q", s)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("limit should be requests/window, e.g. 60/1m, or off: %q", s)
+	}
+	*l = Limit{Requests: n, Window: d}
+	return nil
+}
+
+func (l Limit) String() string {
+	if l.Requests == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%v", l.Requests, l.Window)
+}
+
+// Default is the configuration before any file or variable is read.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:            8080,
+			ReadTimeout:     30 * time.Second,
+			WriteTimeout:    5 * time.Minute,
+			ShutdownTimeout: 10 * time.Second,
+		},
+		Database: Database{
+			MaxOpenConns:      20,
+			MaxIdleConns:      10,
+			ConnMaxLifetime:   30 * time.Minute,
+			ConnMaxIdleTime:   5 * time.Minute,
+			ConnectAttempts:   10,
+			ConnectBackoff:    500 * time.Millisecond,
+			ConnectMaxBackoff: 10 * time.Second,
+			MigrateOnStart:    true,
+		},
+		Upload: Upload{MaxBytes: 200 << 20, MaxRows: 500000},
+		Jobs:   Jobs{Workers: 2, DrainTimeout: 30 * time.Second},
+		RateLimit: RateLimit{
+			Store:     StoreMemory,
+			Calculate: Limit{Requests: 60, Window: time.Minute},
+			Bulk:      Limit{Requests: 10, Window: time.Minute},
+			Admin:     Limit{Requests: 120, Window: time.Minute},
+			// CalculateQuota and BulkQuota stay off: a quota is a business decision
+			AuthFailures: Limit{Requests: 20, Window: 15 * time.Minute},
+		},
+	}
+}
+
+// Load reads the configuration. Variables in .env fill in those the
+// environment does not set; a missing .env or CONFIG_FILE is no error, a
+// broken one is.
+func Load() (Config, error) {
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, fmt.Errorf("config: .env: %w", err)
+	}
+	return LoadFrom(os.Getenv("CONFIG_FILE"), os.LookupEnv)
+}
+
+// LoadFrom reads the configuration from the YAML file at path, unless path is
+// empty, and from the variables lookupEnv finds.
+func LoadFrom(path string, lookupEnv func(string) (string, bool)) (Config, error) {
+	c := Default()
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("config: %w", err)
+		}
+		defer f.Close()
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		if err := dec.Decode(&c); err != nil {
+			return Config{}, fmt.Errorf("config: %s: %w", path, err)
+		}
+	}
+	if err := fromEnv(reflect.ValueOf(&c).Elem(), lookupEnv); err != nil {
+		return Config{}, fmt.Errorf("config: %w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, fmt.Errorf("config: %w", err)
+	}
+	return c, nil
+}
+
+// fromEnv sets the fields of v with an env tag from the variables that are
+// set, going into nested structs.
+func fromEnv(v reflect.Value, lookupEnv func(string) (string, bool)) error {
+	for i := 0; i < v.NumField(); i++ {
+		field, f := v.Type().Field(i), v.Field(i)
+		key := field.Tag.Get("env")
+		if key == "" {
+			if f.Kind() == reflect.Struct {
+				if err := fromEnv(f, lookupEnv); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		s, ok := lookupEnv(key)
+		if !ok {
+			continue
+		}
+		if err := setField(f, s); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func setField(f reflect.Value, s string) error {
+	if u, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	switch f.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+	case string:
+		f.SetString(s)
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case int, int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	default:
+		return fmt.Errorf("unsupported type %v", f.Type())
+	}
+	return nil
+}
+
+// Validate reports every setting that is out of range.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(c.Server.Port > 0 && c.Server.Port < 1<<16, "server.port should be 1 to 65535, not %d", c.Server.Port)
+	check(c.Server.ReadTimeout > 0, "server.readTimeout should be positive")
+	check(c.Server.WriteTimeout > 0, "server.writeTimeout should be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdownTimeout should be positive")
+	check(c.Database.URL != "", "database.url (DATABASE_URL) is required")
+	check(c.Database.MaxOpenConns >= 0, "database.maxOpenConns should not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.maxIdleConns should not be negative")
+	check(c.Database.ConnMaxLifetime >= 0, "database.connMaxLifetime should not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.connMaxIdleTime should not be negative")
+	check(c.Database.ConnectAttempts > 0, "database.connectAttempts should be positive")
+	check(c.Database.ConnectBackoff > 0, "database.connectBackoff should be positive")
+	check(c.Database.ConnectMaxBackoff >= c.Database.ConnectBackoff, "database.connectMaxBackoff should not be less than database.connectBackoff")
+	check(c.Upload.MaxBytes > 0, "upload.maxBytes should be positive")
+	check(c.Upload.MaxRows > 0, "upload.maxRows should be positive")
+	check(c.Jobs.Workers > 0, "jobs.workers should be positive")
+	check(c.Jobs.DrainTimeout > 0, "jobs.drainTimeout should be positive")
+	check(c.RateLimit.Store == StoreMemory || c.RateLimit.Store == StorePostgres, "rateLimit.store should be %s or %s, not %q", StoreMemory, StorePostgres, c.RateLimit.Store)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,116 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kanawat2566/assessment-tax/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, body string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(body), 0o600))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	c, err := config.LoadFrom("", env(map[string]string{"DATABASE_URL": "postgres://db"}))
+
+	assert.Nil(t, err)
+	expected := config.Default()
+	expected.Database.URL = "postgres://db"
+	assert.Equal(t, expected, c)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  port: 9090
+  writeTimeout: 2m
+database:
+  url: postgres://file
+  maxOpenConns: 50
+rateLimit:
+  store: postgres
+  calculate: 100/1s
+  admin: "off"
+  calculateQuota: 10000/24h
+`)
+
+	c, err := config.LoadFrom(path, env(map[string]string{
+		"PORT":                     "7070",
+		"CSV_MAX_ROWS":             "1000",
+		"CLIENT_AUTH_REQUIRED":     "true",
+		"RATE_LIMIT_BULK":          "5/1h",
+		"RATE_LIMIT_AUTH_FAILURES": "off",
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 7070, c.Server.Port, "The environment should override the file")
+	assert.Equal(t, 2*time.Minute, c.Server.WriteTimeout, "The file should override the default")
+	assert.Equal(t, 30*time.Second, c.Server.ReadTimeout, "A setting left out should keep its default")
+	expectedDB := config.Default().Database
+	expectedDB.URL, expectedDB.MaxOpenConns = "postgres://file", 50
+	assert.Equal(t, expectedDB, c.Database)
+	assert.Equal(t, 1000, c.Upload.MaxRows)
+	assert.True(t, c.Auth.ClientAuthRequired)
+	assert.Equal(t, config.RateLimit{
+		Store:          config.StorePostgres,
+		Calculate:      config.Limit{Requests: 100, Window: time.Second},
+		Bulk:           config.Limit{Requests: 5, Window: time.Hour},
+		Admin:          config.Limit{},
+		CalculateQuota: config.Limit{Requests: 10000, Window: 24 * time.Hour},
+		AuthFailures:   config.Limit{},
+	}, c.RateLimit)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	cases := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		expected []string
+	}{
+		{
+			name:     "given out of range settings should report all of them",
+			env:      map[string]string{"PORT": "70000", "JOB_WORKERS": "0", "RATE_LIMIT_STORE": "redis"},
+			expected: []string{"server.port", "database.url", "jobs.workers", "rateLimit.store"},
+		},
+		{name: "given malformed variable should name it", env: map[string]string{"DATABASE_URL": "x", "SERVER_READ_TIMEOUT": "soon"}, expected: []string{"SERVER_READ_TIMEOUT"}},
+		{name: "given backoff above its maximum should fail", env: map[string]string{"DATABASE_URL": "x", "DB_CONNECT_BACKOFF": "1m"}, expected: []string{"database.connectMaxBackoff"}},
+		{name: "given malformed limit should fail", env: map[string]string{"DATABASE_URL": "x", "RATE_LIMIT_BULK": "ten"}, expected: []string{"RATE_LIMIT_BULK"}},
+		{name: "given unknown setting in the file should fail", file: "server:\n  prot: 80\n", env: map[string]string{"DATABASE_URL": "x"}, expected: []string{"prot"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := ""
+			if tc.file != "" {
+				path = writeFile(t, tc.file)
+			}
+
+			_, err := config.LoadFrom(path, env(tc.env))
+
+			assert.NotNil(t, err)
+			for _, s := range tc.expected {
+				assert.Contains(t, err.Error(), s)
+			}
+		})
+	}
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	_, err := config.LoadFrom(filepath.Join(t.TempDir(), "missing.yaml"), env(map[string]string{"DATABASE_URL": "x"}))
+
+	assert.NotNil(t, err, "A file named by CONFIG_FILE should exist")
+}
@@ -1,16 +1,12 @@
 package constants
 
-const (
-	UserAuth string = "adminTax"
-	PassAuth string = "admin!"
+import "github.com/kanawat2566/assessment-tax/money"
 
+const (
 	Personal  string = "personal"
 	Donation  string = "donation"
 	K_Receipt string = "k-receipt"
 
-	AllowanceDefault  float64 = 60000.00
-	MaximumWHTPercent float64 = 5.00
-
 	ErrInvalidFormatReq     string = "Error: Invalid format request."
 	ErrMessageThenZero      string = "Income should be greater than zero."
 	ErrMesssageWhtInvalid   string = "Withholding tax is invalid. It should be between 0 and total income."
@@ -24,37 +20,206 @@ const (
 	ErrMsgDeductNotFound    string = "Deduction type not found"
 	ErrMsgNotDeductSupport  string = "Not Supported Deduction type"
 	ErrMsgUpdateNotSuccess  string = "Failed to update data in database"
-	ErrMsgValidateMinAmt    string = "Deduction amount must be greater or equal to"
-	ErrMsgValidateMaxAmt    string = "Deduction amount should be less than or equal to"
+	ErrMsgValidateMinAmt    string = "Deduction amount must be greater or equal to %v"
+	ErrMsgValidateMaxAmt    string = "Deduction amount should be less than or equal to %v"
 	ErrMsgInvalidPathParam  string = "Invalid path param"
+	ErrMsgTaxYearInvalid    string = "Tax year is invalid. It should not be later than the current year."
+	ErrMsgTaxRatesNotFound  string = "Tax rates not found for tax year %v"
+	ErrMsgTaxRateNotFound   string = "Tax rate not found"
+	ErrMsgTaxRateInvalidID  string = "Tax rate id is invalid"
+	ErrMsgTaxRateLevel      string = "Tax rate level is required."
+	ErrMsgTaxRateInvalid    string = "Tax rate should be between 0 and 100."
+	ErrMsgTaxRateSplit      string = "A new tax bracket must end where the bracket it starts in ends."
+	ErrMsgTaxRatesFirstMin  string = "The first tax bracket must start at 0."
+	ErrMsgTaxRatesRange     string = "Tax bracket maximum income must not be less than its minimum income."
+	ErrMsgTaxRatesOverlap   string = "Tax brackets must not overlap."
+	ErrMsgTaxRatesGap       string = "Tax brackets must be contiguous; each bracket must start 1 baht after the previous one ends."
+	ErrMsgTaxRatesOrder     string = "Tax rates must not decrease as income increases."
+	ErrMsgTaxRatesOpenEnded string = "The last tax bracket must be open-ended."
+	ErrMsgTaxRatesChanged   string = "Tax brackets were changed in the meantime; reload them and try again."
+	ErrMsgAllowanceExists   string = "Allowance type or response name already exists"
+	ErrMsgAllowanceName     string = "Allowance type should contain only lowercase letters, digits and hyphens."
+	ErrMsgAllowanceRespName string = "Allowance response name should contain only letters and digits, starting with a letter."
+	ErrMsgAllowanceLimits   string = "Allowance amounts should satisfy 0 <= minimum <= limit <= maximum."
+	ErrMsgAllowanceCapRule  string = "Allowance cap rule should be flat, percent_of_gross or percent_of_net."
+	ErrMsgAllowanceCapPct   string = "Allowance cap percent should be greater than 0 and at most 100 for percentage cap rules."
+	ErrMsgFieldValidation   string = "Field '%v' failed validation for '%v'"
+
+	ErrMsgCsvInvaildFormat   string = "format is wrong, please check your format."
+	ErrMsgFileNoUpload       string = "No file uploaded"
+	ErrMsgReadCsvFailed      string = "Failed to read csv file"
+	ErrInvalidIncomeCsv      string = "Invalid income number in line %v"
+	ErrInvalidWHTCsv         string = "Invalid WHT number in line %v"
+	ErrInvalidAllowanceCsv   string = "Invalid %v number in line %v"
+	ErrMsgCsvColumn          string = "Unknown column %v. Columns should be totalIncome, wht, id or an allowance type."
+	ErrMsgCsvColumnMissing   string = "Missing required column %v"
+	ErrMsgCsvDuplicateColumn string = "Duplicate column %v"
+	ErrMsgCsvMode            string = "Mode should be strict or lenient."
+	ErrMsgFormat             string = "Format should be json, ndjson, csv or xlsx."
+	ErrMsgCsvTooLarge        string = "Uploaded file should not be larger than %v bytes."
+	ErrMsgCsvTooManyRows     string = "CSV file should not have more than %v rows."
+	ErrMsgTaxJobNotFound     string = "Tax job not found"
+	ErrMsgTaxJobNotFinished  string = "Tax job has not finished yet"
+	ErrMsgTaxJobFailed       string = "Tax job failed, see the job for its error"
+	ErrMsgTaxJobRowErrors    string = "%v rows could not be calculated"
+	ErrMsgTaxJobClaimLost    string = "Tax job was taken over by another worker"
 
-	ErrMsgCsvInvaildFormat string = "format is wrong, please check your format."
-	ErrMsgFileNoUpload     string = "No file uploaded"
-	ErrMsgReadCsvFailed    string = "Failed to read csv file"
-	ErrInvalidIncomeCsv    string = "Invalid income number in line"
-	ErrInvalidWHTCsv       string = "Invalid WHT number in line"
-	ErrInvalidDonationCsv  string = "Invalid donation number in line"
+	ErrMsgSnapshotNotFound     string = "Config snapshot %v not found"
+	ErrMsgCalculationNotFound  string = "Calculation not found"
+	ErrMsgCalculationInvalidID string = "Calculation id is invalid"
+	ErrMsgSnapshotInvalidID    string = "Config snapshot id is invalid"
+	ErrMsgPageLimit            string = "Limit should be between 1 and %v."
+	ErrMsgPageOffset           string = "Offset should not be negative."
+	ErrMsgDateInvalid          string = "Date should be YYYY-MM-DD or RFC 3339."
+	ErrMsgDateRange            string = "from should not be after to."
+	ErrMsgAmountInvalid        string = "Amount should be a decimal number."
+	ErrMsgIncomeRange          string = "minIncome should not be more than maxIncome."
+
+	ErrMsgAdminUsername     string = "Username should be 3 to 50 letters, digits, '.', '_' or '-'."
+	ErrMsgAdminPassword     string = "Password should be %v to %v bytes long."
+	ErrMsgAdminUserExists   string = "Admin user already exists"
+	ErrMsgAdminUserNotFound string = "Admin user not found"
+	ErrMsgAdminUserSelf     string = "You cannot delete or disable your own account or take user-admin away from it."
+	ErrMsgAdminRole         string = "Roles should be among %v."
+	ErrMsgForbidden         string = "Your roles do not allow this request."
+
+	ErrMsgCredentials        string = "API key or token is invalid, expired or revoked."
+	ErrMsgCredentialsMissing string = "An API key or bearer token is required."
+	ErrMsgScope              string = "Your credentials do not grant the %v scope."
+	ErrMsgAPIKeyClient       string = "Client should be 3 to 50 letters, digits, '.', '_' or '-'."
+	ErrMsgAPIKeyScopes       string = "Scopes should be one or more of %v."
+	ErrMsgAPIKeyNotFound     string = "API key not found"
+	ErrMsgAPIKeyInvalidID    string = "API key id is invalid"
+	ErrMsgRateLimited        string = "Too many requests, retry in %v seconds."
+
+	LevelRange    string = "%v-%v"
+	LevelAndAbove string = "%v and above"
 
 	PathParamUploadCsv string = "upload-csv"
+	CsvModeStrict      string = "strict"
+	CsvModeLenient     string = "lenient"
+
+	MIMEApplicationNDJSON string = "application/x-ndjson"
+	MIMETextCSV           string = "text/csv"
+
+	// Formats of bulk calculation results, see the format query parameter.
+	FormatJSON   string = "json"
+	FormatNDJSON string = "ndjson"
+	FormatCSV    string = "csv"
+	FormatXLSX   string = "xlsx"
+
+	JobQueued  string = "queued"
+	JobRunning string = "running"
+	JobDone    string = "done"
+	JobFailed  string = "failed"
+
+	// Page sizes of the calculation history.
+	CalculationsPageSize    int = 50
+	CalculationsMaxPageSize int = 500
+
+	// Page sizes of the audit log.
+	AuditPageSize    int = 50
+	AuditMaxPageSize int = 500
+
+	// Actions of the audit log.
+	AuditDeductionUpdate string = "deduction.update"
+	AuditAllowanceCreate string = "allowance.create"
+	AuditTaxRateCreate   string = "tax_rate.create"
+	AuditTaxRateUpdate   string = "tax_rate.update"
+	AuditTaxRateDelete   string = "tax_rate.delete"
+	AuditUserCreate      string = "admin_user.create"
+	AuditUserUpdate      string = "admin_user.update"
+	AuditUserDelete      string = "admin_user.delete"
+	AuditAPIKeyCreate    string = "api_key.create"
+	AuditAPIKeyRevoke    string = "api_key.revoke"
+
+	// AuditSystem is the audit user of writes made by the service itself,
+	// e.g. creating the first admin at startup.
+	AuditSystem string = "system"
+
+	// Lengths of an admin password. bcrypt ignores anything past 72 bytes.
+	AdminPasswordMinLength int = 12
+	AdminPasswordMaxLength int = 72
+
+	// Roles of admin users. Each admin route lets in the roles that need it,
+	// so a support user can be given viewer and auditor to read the config
+	// and the audit log without being able to change either.
+	RoleViewer       string = "viewer"
+	RoleConfigEditor string = "config-editor"
+	RoleBracketAdmin string = "bracket-admin"
+	RoleAuditor      string = "auditor"
+	RoleUserAdmin    string = "user-admin"
+
+	// Scopes of service callers, granted to API keys and JWTs. A caller with
+	// the admin scope stands for every role but user-admin, so credentials
+	// cannot be used to issue more credentials or to manage users.
+	ScopeCalculate  string = "calculate"
+	ScopeBulkUpload string = "bulk-upload"
+	ScopeAdmin      string = "admin"
+
+	// APIKeyPrefix starts every API key, so a leaked key is easy to spot. A
+	// key is sent in HeaderAPIKey or as a bearer token.
+	APIKeyPrefix string = "atx_"
+	HeaderAPIKey string = "X-API-Key"
+	// ClientUserPrefix starts the audit user of a write made by a service
+	// caller, e.g. "client:payroll". Usernames cannot hold a colon.
+	ClientUserPrefix string = "client:"
+
+	// Echo context keys of the authenticated admin user and their roles, and
+	// of the service caller.
+	ContextUser   string = "user"
+	ContextRoles  string = "roles"
+	ContextClient string = "client"
+
+	// Classes of rate limits, each with its own limit, see config.RateLimit.
+	// RateLimitAuthFailures counts failed sign-ins per client IP.
+	RateLimitCalculate    string = "calculate"
+	RateLimitBulk         string = "bulk"
+	RateLimitAdmin        string = "admin"
+	RateLimitAuthFailures string = "auth_failures"
+
+	// Rate limit headers, see draft-ietf-httpapi-ratelimit-headers.
+	HeaderRateLimitLimit     string = "RateLimit-Limit"
+	HeaderRateLimitRemaining string = "RateLimit-Remaining"
+	HeaderRateLimitReset     string = "RateLimit-Reset"
+	HeaderRateLimitPolicy    string = "RateLimit-Policy"
+
+	// Statuses of the health checks, and the checks /readyz makes.
+	HealthOK          string = "ok"
+	HealthUnavailable string = "unavailable"
+	CheckDatabase     string = "database"
+	CheckConfig       string = "config"
+
+	CapFlat           string = "flat"
+	CapPercentOfGross string = "percent_of_gross"
+	CapPercentOfNet   string = "percent_of_net"
+
+	// Reasons for the amount allowed for an allowance claim. A claim cut by a
+	// percentage cap uses the cap rule itself as its reason.
+	ReasonClaimed        string = "claimed"
+	ReasonAutoClaimed    string = "auto_claimed"
+	ReasonAllowanceLimit string = "allowance_limit"
+	ReasonGroupLimit     string = "group_limit"
 )
 
-var AllowanceTypes = map[string]string{
-	"donation":  Donation,
-	"k-receipt": K_Receipt,
-	"personal":  Personal,
-}
+// Roles are all the roles of admin users, in the order they are listed.
+var Roles = []string{RoleViewer, RoleConfigEditor, RoleBracketAdmin, RoleAuditor, RoleUserAdmin}
 
-type Deduction struct {
-	Type   string
-	Name   string
-	Amount float64
-	MinAmt float64
-	MaxAmt float64
-}
+// Scopes are all the scopes of service callers.
+var Scopes = []string{ScopeCalculate, ScopeBulkUpload, ScopeAdmin}
 
-var Deductions = map[string]Deduction{
-	Personal:  {Type: Personal, Name: "personalDeduction"},
-	K_Receipt: {Type: K_Receipt, Name: "kReceipt"},
+// Actor is who makes an admin write: the authenticated user and the id of the
+// request, for the audit log.
+type Actor struct {
+	User      string
+	RequestID string
 }
 
-var CsvFomatFile = []string{"totalIncome", "wht", "donation"}
+type Deduction struct {
+	Type    string
+	Name    string
+	TaxYear int
+	Amount  money.Amount
+	MinAmt  money.Amount
+	MaxAmt  money.Amount
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/labstack/echo/v4"
+)
+
+func (h *taxHandler) ListAllowances(c echo.Context) error {
+	taxYear, err := queryTaxYear(c)
+	if err != nil {
+		return err
+	}
+
+	res, err := h.serv.ListAllowances(taxYear)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *taxHandler) CreateAllowance(c echo.Context) error {
+	rq := new(md.AllowanceConfig)
+	if err := BindWithValidate(c, rq); err != nil {
+		return err
+	}
+
+	res, err := h.serv.CreateAllowance(*rq, actor(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, res)
+}
@@ -0,0 +1,59 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/handlers"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAllowanceHandler(t *testing.T) {
+	mockService := &MockTaxService{}
+	handler := handlers.NewHandler(mockService)
+
+	e := echo.New()
+	body := `{"allowanceType": "life-insurance", "responseName": "lifeInsurance", "taxYear": 2024, "adminConfigurable": true, "maxAmount": 100000, "limitAmount": 100000}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/allowances", RequestBody(json.RawMessage(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+
+	err := handler.CreateAllowance(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	expected := models.AllowanceConfig{
+		AllowanceType:     "life-insurance",
+		ResponseName:      "lifeInsurance",
+		TaxYear:           2024,
+		AdminConfigurable: true,
+		MaxAmount:         money.Baht(100000),
+		LimitAmount:       money.Baht(100000),
+	}
+	assert.Equal(t, expected, mockService.awcCreated)
+	var response models.AllowanceConfig
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, expected, response)
+}
+
+func TestCreateAllowanceHandler_ServiceError(t *testing.T) {
+	handler := handlers.NewHandler(&MockTaxService{awcErr: services.ErrAllowanceExists})
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/admin/allowances", RequestBody(models.AllowanceConfig{AllowanceType: ct.Donation}))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+
+	err := handler.CreateAllowance(ctx)
+
+	assert.ErrorIs(t, err, services.ErrAllowanceExists)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+)
+
+type auditHandler struct {
+	serv services.AuditService
+}
+
+func NewAuditHandler(s services.AuditService) *auditHandler {
+	return &auditHandler{serv: s}
+}
+
+// maxRequestIDLen is the length of audit_log.request_id.
+const maxRequestIDLen = 100
+
+// actor returns who makes the request: the user the auth middleware stored
+// under ct.ContextUser and the request id, as sent in X-Request-ID or
+// generated by the request id middleware. A client can send any id, so it is
+// cut to fit the audit log rather than failing the change it audits.
+func actor(c echo.Context) ct.Actor {
+	user, _ := c.Get(ct.ContextUser).(string)
+	id := c.Response().Header().Get(echo.HeaderXRequestID)
+	if id == "" {
+		id = c.Request().Header.Get(echo.HeaderXRequestID)
+	}
+	id = strings.ToValidUTF8(id, "")
+	if r := []rune(id); len(r) > maxRequestIDLen {
+		id = string(r[:maxRequestIDLen])
+	}
+	return ct.Actor{User: user, RequestID: id}
+}
+
+// ListAuditEntries returns a page of the audit log, the latest first. It can
+// be filtered by user, action and target, and by when the change was made
+// with from and to; limit and offset select the page.
+func (h *auditHandler) ListAuditEntries(c echo.Context) error {
+	q := md.AuditQuery{User: c.QueryParam("user"), Action: c.QueryParam("action"), Target: c.QueryParam("target")}
+	var err error
+	if q.From, err = queryTime(c, "from", false); err != nil {
+		return err
+	}
+	if q.To, err = queryTime(c, "to", true); err != nil {
+		return err
+	}
+	if q.Limit, err = queryInt(c, "limit"); err != nil {
+		return err
+	}
+	if q.Offset, err = queryInt(c, "offset"); err != nil {
+		return err
+	}
+
+	res, err := h.serv.ListAuditEntries(q)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, res)
+}
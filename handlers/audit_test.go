@@ -0,0 +1,65 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/handlers"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockAuditService struct {
+	res   models.AuditResponse
+	err   error
+	query models.AuditQuery
+}
+
+func (m *MockAuditService) ListAuditEntries(q models.AuditQuery) (models.AuditResponse, error) {
+	m.query = q
+	return m.res, m.err
+}
+
+func TestListAuditEntries(t *testing.T) {
+	t.Run("given filters should pass them to the service", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit?user=adminTax&action=deduction.update&target=personal&from=2024-03-01&to=2024-03-01&limit=10", nil)
+		rec := httptest.NewRecorder()
+		ctx := e.NewContext(req, rec)
+		created := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+		mockService := &MockAuditService{res: models.AuditResponse{Total: 1, Limit: 10, Entries: []models.AuditEntry{{
+			ID: 4, CreatedAt: created, User: "adminTax", RequestID: "req-1", Action: ct.AuditDeductionUpdate, Target: ct.Personal,
+			OldValue: []byte(`{"limit_allowance": 60000.00}`), NewValue: []byte(`{"limit_allowance": 70000.00}`),
+		}}}}
+
+		err := handlers.NewAuditHandler(mockService).ListAuditEntries(ctx)
+
+		assert.Nil(t, err)
+		assert.Equal(t, models.AuditQuery{
+			User:   "adminTax",
+			Action: ct.AuditDeductionUpdate,
+			Target: ct.Personal,
+			From:   time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			To:     time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+			Limit:  10,
+		}, mockService.query)
+		assert.JSONEq(t, `{"entries": [{"id": 4, "createdAt": "2024-03-01T09:00:00Z", "user": "adminTax", "requestId": "req-1",
+			"action": "deduction.update", "target": "personal", "oldValue": {"limit_allowance": 60000.00}, "newValue": {"limit_allowance": 70000.00}}],
+			"total": 1, "limit": 10, "offset": 0}`, rec.Body.String())
+	})
+
+	t.Run("given invalid date should fail", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit?from=yesterday", nil)
+		ctx := e.NewContext(req, httptest.NewRecorder())
+
+		err := handlers.NewAuditHandler(&MockAuditService{}).ListAuditEntries(ctx)
+
+		assert.ErrorIs(t, err, services.ErrInvalidField)
+	})
+}
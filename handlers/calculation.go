@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+)
+
+type calculationHandler struct {
+	serv services.CalculationService
+}
+
+func NewCalculationHandler(s services.CalculationService) *calculationHandler {
+	return &calculationHandler{serv: s}
+}
+
+// ListCalculations returns a page of past calculations, the latest first.
+// They can be filtered by when they were made with from and to, and by total
+// income with minIncome and maxIncome; limit and offset select the page.
+func (h *calculationHandler) ListCalculations(c echo.Context) error {
+	q, err := queryCalculations(c)
+	if err != nil {
+		return err
+	}
+
+	res, err := h.serv.ListCalculations(q)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *calculationHandler) GetCalculation(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return services.ErrCalculationInvalidID
+	}
+
+	res, err := h.serv.GetCalculation(id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func queryCalculations(c echo.Context) (md.CalculationQuery, error) {
+	var q md.CalculationQuery
+	var err error
+	if q.From, err = queryTime(c, "from", false); err != nil {
+		return q, err
+	}
+	if q.To, err = queryTime(c, "to", true); err != nil {
+		return q, err
+	}
+	if q.MinIncome, err = queryAmount(c, "minIncome"); err != nil {
+		return q, err
+	}
+	if q.MaxIncome, err = queryAmount(c, "maxIncome"); err != nil {
+		return q, err
+	}
+	if q.Limit, err = queryInt(c, "limit"); err != nil {
+		return q, err
+	}
+	if q.Offset, err = queryInt(c, "offset"); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// queryTime reads an optional RFC 3339 time or YYYY-MM-DD date in UTC. A date
+// stands for the start of the day, or with end for the start of the next day
+// so that the whole day is included.
+func queryTime(c echo.Context, name string, end bool) (time.Time, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	d, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, services.ErrInvalidField.WithMessage(ct.ErrMsgDateInvalid).WithField(name)
+	}
+	if end {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d, nil
+}
+
+func queryAmount(c echo.Context, name string) (*money.Amount, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return nil, nil
+	}
+	amt, err := money.Parse(v)
+	if err != nil {
+		return nil, services.ErrInvalidField.WithMessage(ct.ErrMsgAmountInvalid).WithField(name)
+	}
+	return &amt, nil
+}
+
+func queryInt(c echo.Context, name string) (int, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, services.ErrInvalidField.WithField(name)
+	}
+	return n, nil
+}
@@ -0,0 +1,126 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kanawat2566/assessment-tax/handlers"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockCalculationService struct {
+	query   models.CalculationQuery
+	list    models.CalculationsResponse
+	calc    models.Calculation
+	err     error
+	askedID int64
+}
+
+func (m *MockCalculationService) ListCalculations(q models.CalculationQuery) (models.CalculationsResponse, error) {
+	m.query = q
+	return m.list, m.err
+}
+
+func (m *MockCalculationService) GetCalculation(id int64) (models.Calculation, error) {
+	m.askedID = id
+	return m.calc, m.err
+}
+
+func calculationContext(target, id string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	if id != "" {
+		ctx.SetPath("/admin/calculations/:id")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+	}
+	return ctx, rec
+}
+
+func TestListCalculations(t *testing.T) {
+	t.Run("given filters should pass them on", func(t *testing.T) {
+		ctx, rec := calculationContext("/admin/calculations?from=2024-01-01&to=2024-01-31&minIncome=100000&maxIncome=500000.50&limit=20&offset=40", "")
+		mockService := &MockCalculationService{list: models.CalculationsResponse{Calculations: []models.Calculation{}, Total: 0, Limit: 20, Offset: 40}}
+
+		err := handlers.NewCalculationHandler(mockService).ListCalculations(ctx)
+
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"calculations": [], "total": 0, "limit": 20, "offset": 40}`, rec.Body.String())
+		min, max := money.Baht(100000), money.Satang(50000050)
+		assert.Equal(t, models.CalculationQuery{
+			From:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:        time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			MinIncome: &min,
+			MaxIncome: &max,
+			Limit:     20,
+			Offset:    40,
+		}, mockService.query, "A to date should include the whole day")
+	})
+
+	t.Run("given RFC 3339 time should keep it as is", func(t *testing.T) {
+		ctx, _ := calculationContext("/admin/calculations?to=2024-01-31T12:00:00%2B07:00", "")
+		mockService := &MockCalculationService{}
+
+		err := handlers.NewCalculationHandler(mockService).ListCalculations(ctx)
+
+		assert.Nil(t, err)
+		assert.True(t, time.Date(2024, 1, 31, 5, 0, 0, 0, time.UTC).Equal(mockService.query.To))
+	})
+
+	cases := []struct {
+		name   string
+		target string
+		field  string
+	}{
+		{name: "given invalid date should fail", target: "/admin/calculations?from=01/02/2024", field: "from"},
+		{name: "given invalid income should fail", target: "/admin/calculations?maxIncome=lots", field: "maxIncome"},
+		{name: "given invalid limit should fail", target: "/admin/calculations?limit=ten", field: "limit"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, _ := calculationContext(tc.target, "")
+
+			err := handlers.NewCalculationHandler(&MockCalculationService{}).ListCalculations(ctx)
+
+			assert.ErrorIs(t, err, services.ErrInvalidField)
+			assert.Equal(t, tc.field, err.(*services.Error).Field)
+		})
+	}
+}
+
+func TestGetCalculation(t *testing.T) {
+	t.Run("given id should return the calculation", func(t *testing.T) {
+		ctx, rec := calculationContext("/", "7")
+		created := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+		mockService := &MockCalculationService{calc: models.Calculation{
+			ID: 7, CreatedAt: created, TaxYear: 2024, SnapshotID: 3,
+			Request:  models.TaxRequest{TotalIncome: money.Baht(500000)},
+			Response: models.TaxResponse{Tax: money.Baht(29000), CalculationID: 7},
+		}}
+
+		err := handlers.NewCalculationHandler(mockService).GetCalculation(ctx)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(7), mockService.askedID)
+		assert.JSONEq(t, `{"id": 7, "createdAt": "2024-03-01T09:00:00Z", "taxYear": 2024, "snapshotId": 3,
+			"request": {"totalIncome": 500000, "wht": 0, "allowances": null, "taxYear": 0},
+			"response": {"tax": 29000, "taxRefund": 0, "taxableIncome": 0, "taxLevel": null, "calculationId": 7, "snapshotId": 0}}`, rec.Body.String())
+	})
+
+	t.Run("given invalid id should fail", func(t *testing.T) {
+		ctx, _ := calculationContext("/", "abc")
+
+		err := handlers.NewCalculationHandler(&MockCalculationService{}).GetCalculation(ctx)
+
+		assert.ErrorIs(t, err, services.ErrCalculationInvalidID)
+	})
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+)
+
+type clientHandler struct {
+	serv services.ClientService
+}
+
+func NewClientHandler(s services.ClientService) *clientHandler {
+	return &clientHandler{serv: s}
+}
+
+// adminScopeRoles are the roles of a service caller with the admin scope.
+var adminScopeRoles = slices.DeleteFunc(slices.Clone(ct.Roles), func(r string) bool {
+	return r == ct.RoleUserAdmin
+})
+
+// ClientAuth returns middleware that lets in service callers whose API key or
+// JWT grants a scope, and stores the caller's name under ct.ContextClient.
+// When optional is true, requests without any credentials are let in as
+// well, so callers can move to credentials before they are required;
+// credentials that are sent are always checked.
+func ClientAuth(s services.ClientService, optional bool) func(scope string) echo.MiddlewareFunc {
+	return func(scope string) echo.MiddlewareFunc {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				cl, err := authenticateClient(s, c)
+				if err != nil {
+					return err
+				}
+				if cl == nil {
+					if optional {
+						return next(c)
+					}
+					return unauthorized(c, services.ErrCredentialsMissing)
+				}
+				if !slices.Contains(cl.Scopes, scope) {
+					return services.ErrScope.WithArgs(scope)
+				}
+				c.Set(ct.ContextClient, cl.Name)
+				return next(c)
+			}
+		}
+	}
+}
+
+// AdminAuth lets in admin users signed in with HTTP Basic, as BasicAuth does,
+// and service callers whose credentials grant the admin scope. A caller is
+// audited as ct.ClientUserPrefix and its name.
+func AdminAuth(users services.UserService, clients services.ClientService) echo.MiddlewareFunc {
+	basic := BasicAuth(users)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withBasic := basic(next)
+		return func(c echo.Context) error {
+			cl, err := authenticateClient(clients, c)
+			if err != nil {
+				return err
+			}
+			if cl == nil {
+				return withBasic(c)
+			}
+			if !slices.Contains(cl.Scopes, ct.ScopeAdmin) {
+				return services.ErrScope.WithArgs(ct.ScopeAdmin)
+			}
+			c.Set(ct.ContextClient, cl.Name)
+			c.Set(ct.ContextUser, ct.ClientUserPrefix+cl.Name)
+			c.Set(ct.ContextRoles, adminScopeRoles)
+			return next(c)
+		}
+	}
+}
+
+// authenticateClient signs in the service caller of a request from its API
+// key header or its bearer token, which is an API key or a JWT. It returns nil
+// without an error when the request carries neither.
+func authenticateClient(s services.ClientService, c echo.Context) (*md.Client, error) {
+	cred := c.Request().Header.Get(ct.HeaderAPIKey)
+	if cred == "" {
+		scheme, token, ok := strings.Cut(c.Request().Header.Get(echo.HeaderAuthorization), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return nil, nil
+		}
+		cred = strings.TrimSpace(token)
+	}
+
+	var cl *md.Client
+	var err error
+	if strings.HasPrefix(cred, ct.APIKeyPrefix) {
+		cl, err = s.AuthenticateAPIKey(cred)
+	} else {
+		cl, err = s.AuthenticateToken(cred)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cl == nil {
+		return nil, unauthorized(c, services.ErrCredentials)
+	}
+	return cl, nil
+}
+
+// unauthorized tells the caller to send a bearer token and returns err.
+func unauthorized(c echo.Context, err error) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+	return err
+}
+
+func (h *clientHandler) ListAPIKeys(c echo.Context) error {
+	res, err := h.serv.ListAPIKeys()
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// CreateAPIKey issues a key to a client. The response is the only place the
+// key is ever shown.
+func (h *clientHandler) CreateAPIKey(c echo.Context) error {
+	rq := new(md.APIKeyRequest)
+	if err := BindWithValidate(c, rq); err != nil {
+		return err
+	}
+
+	res, err := h.serv.CreateAPIKey(*rq, actor(c))
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return c.JSON(http.StatusCreated, res)
+}
+
+func (h *clientHandler) RevokeAPIKey(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return services.ErrAPIKeyInvalidID
+	}
+
+	if err := h.serv.RevokeAPIKey(id, actor(c)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
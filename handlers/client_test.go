@@ -0,0 +1,202 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/handlers"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// MockClientService knows the API key "atx_payroll" with the calculate scope
+// and the token "mobile-token" with the admin scope.
+type MockClientService struct {
+	created models.APIKeyCreated
+	err     error
+	request models.APIKeyRequest
+	revoked int64
+	actor   ct.Actor
+}
+
+func (m *MockClientService) AuthenticateAPIKey(key string) (*models.Client, error) {
+	if key != "atx_payroll" {
+		return nil, m.err
+	}
+	return &models.Client{Name: "payroll", Scopes: []string{ct.ScopeCalculate}}, m.err
+}
+
+func (m *MockClientService) AuthenticateToken(token string) (*models.Client, error) {
+	if token != "mobile-token" {
+		return nil, m.err
+	}
+	return &models.Client{Name: "mobile", Scopes: []string{ct.ScopeAdmin}}, m.err
+}
+
+func (m *MockClientService) ListAPIKeys() (models.APIKeysResponse, error) {
+	return models.APIKeysResponse{Keys: []models.APIKey{m.created.APIKey}}, m.err
+}
+
+func (m *MockClientService) CreateAPIKey(req models.APIKeyRequest, by ct.Actor) (models.APIKeyCreated, error) {
+	m.request, m.actor = req, by
+	return m.created, m.err
+}
+
+func (m *MockClientService) RevokeAPIKey(id int64, by ct.Actor) error {
+	m.revoked, m.actor = id, by
+	return m.err
+}
+
+func TestClientAuth(t *testing.T) {
+	cases := []struct {
+		name     string
+		optional bool
+		header   string
+		value    string
+		expected error
+	}{
+		{name: "given API key header with the scope should let in", header: ct.HeaderAPIKey, value: "atx_payroll"},
+		{name: "given API key as bearer token should let in", header: echo.HeaderAuthorization, value: "Bearer atx_payroll"},
+		{name: "given JWT without the scope should refuse", header: echo.HeaderAuthorization, value: "Bearer mobile-token", expected: services.ErrScope},
+		{name: "given revoked API key should refuse", header: ct.HeaderAPIKey, value: "atx_revoked", expected: services.ErrCredentials},
+		{name: "given invalid credentials should refuse even when optional", optional: true, header: echo.HeaderAuthorization, value: "Bearer forged", expected: services.ErrCredentials},
+		{name: "given no credentials should refuse", expected: services.ErrCredentialsMissing},
+		{name: "given no credentials should let in when optional", optional: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/tax/calculations", nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			next := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+
+			err := handlers.ClientAuth(&MockClientService{}, tc.optional)(ct.ScopeCalculate)(next)(ctx)
+
+			if tc.expected != nil {
+				assert.ErrorIs(t, err, tc.expected)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			if tc.header != "" {
+				assert.Equal(t, "payroll", ctx.Get(ct.ContextClient), "The caller should be known to the rate limit")
+			}
+		})
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	cases := []struct {
+		name     string
+		sign     func(r *http.Request)
+		expected int
+		user     string
+	}{
+		{name: "given admin user should let in", sign: func(r *http.Request) { r.SetBasicAuth("adminTax", "correct-horse-battery") }, expected: http.StatusOK, user: "adminTax"},
+		{name: "given client with admin scope should let in as the client", sign: func(r *http.Request) { r.Header.Set(echo.HeaderAuthorization, "Bearer mobile-token") }, expected: http.StatusOK, user: "client:mobile"},
+		{name: "given client without admin scope should refuse", sign: func(r *http.Request) { r.Header.Set(ct.HeaderAPIKey, "atx_payroll") }, expected: http.StatusForbidden},
+		{name: "given nothing should ask for basic auth", sign: func(r *http.Request) {}, expected: http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			e.HTTPErrorHandler = handlers.ErrorHandler
+			e.GET("/admin/audit", func(c echo.Context) error {
+				return c.String(http.StatusOK, c.Get(ct.ContextUser).(string))
+			}, handlers.AdminAuth(&MockUserService{}, &MockClientService{}), handlers.RequireRole(ct.RoleViewer))
+			req := httptest.NewRequest(http.MethodGet, "/admin/audit", nil)
+			tc.sign(req)
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expected, rec.Code)
+			if tc.user != "" {
+				assert.Equal(t, tc.user, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("given client with admin scope should not manage users", func(t *testing.T) {
+		e := echo.New()
+		e.HTTPErrorHandler = handlers.ErrorHandler
+		e.POST("/admin/api-keys", func(c echo.Context) error {
+			return c.NoContent(http.StatusCreated)
+		}, handlers.AdminAuth(&MockUserService{}, &MockClientService{}), handlers.RequireRole(ct.RoleUserAdmin))
+		req := httptest.NewRequest(http.MethodPost, "/admin/api-keys", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer mobile-token")
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code, "Credentials should not issue more credentials")
+	})
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/admin/api-keys", strings.NewReader(`{"client": "payroll", "scopes": ["calculate"]}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.Set(ct.ContextUser, "adminTax")
+	mockService := &MockClientService{created: models.APIKeyCreated{
+		APIKey: models.APIKey{ID: 3, Client: "payroll", Prefix: "atx_Zk3q9Hc1", Scopes: []string{ct.ScopeCalculate}},
+		Key:    "atx_Zk3q9Hc1secret",
+	}}
+
+	err := handlers.NewClientHandler(mockService).CreateAPIKey(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+	assert.Equal(t, models.APIKeyRequest{Client: "payroll", Scopes: []string{ct.ScopeCalculate}}, mockService.request)
+	assert.Equal(t, ct.Actor{User: "adminTax", RequestID: "req-1"}, mockService.actor)
+	assert.JSONEq(t, `{"id": 3, "client": "payroll", "prefix": "atx_Zk3q9Hc1", "scopes": ["calculate"], "createdAt": "0001-01-01T00:00:00Z", "key": "atx_Zk3q9Hc1secret"}`, rec.Body.String())
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	cases := []struct {
+		name     string
+		id       string
+		err      error
+		expected error
+	}{
+		{name: "given key should revoke it", id: "3"},
+		{name: "given invalid id should fail", id: "abc", expected: services.ErrAPIKeyInvalidID},
+		{name: "given unknown key should fail", id: "9", err: services.ErrAPIKeyNotFound, expected: services.ErrAPIKeyNotFound},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(httptest.NewRequest(http.MethodDelete, "/admin/api-keys/"+tc.id, nil), rec)
+			ctx.SetParamNames("id")
+			ctx.SetParamValues(tc.id)
+			mockService := &MockClientService{err: tc.err}
+
+			err := handlers.NewClientHandler(mockService).RevokeAPIKey(ctx)
+
+			if tc.expected != nil {
+				assert.ErrorIs(t, err, tc.expected)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+			assert.Equal(t, int64(3), mockService.revoked)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+)
+
+var statusOfKind = map[services.Kind]int{
+	services.KindInternal:        http.StatusInternalServerError,
+	services.KindInvalid:         http.StatusBadRequest,
+	services.KindNotFound:        http.StatusNotFound,
+	services.KindConflict:        http.StatusConflict,
+	services.KindUnprocessable:   http.StatusUnprocessableEntity,
+	services.KindTooLarge:        http.StatusRequestEntityTooLarge,
+	services.KindForbidden:       http.StatusForbidden,
+	services.KindUnauthorized:    http.StatusUnauthorized,
+	services.KindTooManyRequests: http.StatusTooManyRequests,
+}
+
+// ErrorHandler is the Echo HTTPErrorHandler. Every error is rendered as the
+// same JSON envelope, a services.Error: service errors keep their code, Echo's
+// own errors (404 routes, 401 from basic auth, ...) get a code from their
+// status, and anything else is logged and hidden behind a 500. Messages are in
+// the language asked for by Accept-Language.
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status, body := errorResponse(err)
+	body = body.Localize(requestLanguage(c))
+	if status == http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, body)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+func errorResponse(err error) (int, *services.Error) {
+	var se *services.Error
+	if errors.As(err, &se) {
+		status, ok := statusOfKind[se.Kind]
+		if !ok {
+			status = http.StatusInternalServerError
+		}
+		return status, se
+	}
+
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		msg := he.Message
+		if e, ok := msg.(error); ok {
+			msg = e.Error()
+		}
+		// the message is not one of ours, so keep any % out of Localize
+		return he.Code, &services.Error{Code: statusCode(he.Code), Message: strings.ReplaceAll(fmt.Sprint(msg), "%", "%%")}
+	}
+
+	return http.StatusInternalServerError, services.ErrInternal
+}
+
+// statusCode turns an HTTP status into an error code, e.g. 404 into
+// "not_found".
+func statusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
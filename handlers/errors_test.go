@@ -0,0 +1,91 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/handlers"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorHandler(t *testing.T) {
+	cases := []struct {
+		name       string
+		lang       string
+		err        error
+		statusCode int
+		body       string
+	}{
+		{
+			name:       "given rule violation should respond 422 with code and field",
+			err:        services.ErrWHTInvalid,
+			statusCode: http.StatusUnprocessableEntity,
+			body:       `{"code": "wht_invalid", "message": "` + ct.ErrMesssageWhtInvalid + `", "field": "wht"}`,
+		},
+		{
+			name:       "given csv error should respond 400 with line",
+			err:        services.ErrCsvWHT.WithArgs(3).AtLine(3),
+			statusCode: http.StatusBadRequest,
+			body:       `{"code": "csv_invalid_wht", "message": "Invalid WHT number in line 3", "field": "wht", "line": 3}`,
+		},
+		{
+			name:       "given thai accept language should translate message",
+			lang:       "th-TH,th;q=0.9,en;q=0.8",
+			err:        services.ErrDeductionBelowMin.WithArgs(money.Baht(10001)),
+			statusCode: http.StatusUnprocessableEntity,
+			body:       `{"code": "deduction_below_minimum", "message": "จำนวนค่าลดหย่อนต้องมากกว่าหรือเท่ากับ 10,001", "field": "amount"}`,
+		},
+		{
+			name:       "given unsupported accept language should fall back to english",
+			lang:       "fr",
+			err:        services.ErrDeductionBelowMin.WithArgs(money.Baht(10001)),
+			statusCode: http.StatusUnprocessableEntity,
+			body:       `{"code": "deduction_below_minimum", "message": "Deduction amount must be greater or equal to 10,001", "field": "amount"}`,
+		},
+		{
+			name:       "given missing tax rate should respond 404",
+			err:        services.ErrTaxRateNotFound,
+			statusCode: http.StatusNotFound,
+			body:       `{"code": "tax_rate_not_found", "message": "` + ct.ErrMsgTaxRateNotFound + `", "field": "id"}`,
+		},
+		{
+			name:       "given role not allowed should respond 403",
+			err:        services.ErrForbidden,
+			statusCode: http.StatusForbidden,
+			body:       `{"code": "forbidden", "message": "` + ct.ErrMsgForbidden + `"}`,
+		},
+		{
+			name:       "given echo error wrapping an error should render its message",
+			err:        echo.NewHTTPError(http.StatusUnauthorized, errors.New("invalid basic auth")),
+			statusCode: http.StatusUnauthorized,
+			body:       `{"code": "unauthorized", "message": "invalid basic auth"}`,
+		},
+		{
+			name:       "given unknown error should hide it behind 500",
+			err:        errors.New("pq: connection refused"),
+			statusCode: http.StatusInternalServerError,
+			body:       `{"code": "internal", "message": "` + ct.ErrMessageInternal + `"}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Header.Set("Accept-Language", tc.lang)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+
+			handlers.ErrorHandler(tc.err, ctx)
+
+			assert.Equal(t, tc.statusCode, rec.Code)
+			assert.JSONEq(t, tc.body, rec.Body.String())
+		})
+	}
+}
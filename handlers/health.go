@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+)
+
+type healthHandler struct {
+	serv services.HealthService
+}
+
+func NewHealthHandler(s services.HealthService) *healthHandler {
+	return &healthHandler{serv: s}
+}
+
+// Healthz is the liveness probe. It answers as long as the process serves
+// requests at all, and checks nothing else, so a database outage does not
+// get the service restarted.
+func (h *healthHandler) Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, md.Health{Status: ct.HealthOK})
+}
+
+// Readyz is the readiness probe. It answers 503 Service Unavailable, with the
+// checks that failed, while the service cannot calculate taxes.
+func (h *healthHandler) Readyz(c echo.Context) error {
+	res := h.serv.Ready(c.Request().Context())
+	if res.Status != ct.HealthOK {
+		return c.JSON(http.StatusServiceUnavailable, res)
+	}
+	return c.JSON(http.StatusOK, res)
+}
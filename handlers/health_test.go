@@ -0,0 +1,71 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/handlers"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockHealthService struct {
+	res models.Health
+}
+
+func (m *MockHealthService) Ready(ctx context.Context) models.Health {
+	return m.res
+}
+
+func TestHealthz(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/healthz", nil), rec)
+	mockService := &MockHealthService{res: models.Health{Status: ct.HealthUnavailable}}
+
+	err := handlers.NewHealthHandler(mockService).Healthz(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code, "Liveness should not depend on the database")
+	assert.JSONEq(t, `{"status": "ok"}`, rec.Body.String())
+}
+
+func TestReadyz(t *testing.T) {
+	cases := []struct {
+		name         string
+		res          models.Health
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "given every check passing should be ready",
+			res:          models.Health{Status: ct.HealthOK, Checks: map[string]string{ct.CheckDatabase: ct.HealthOK, ct.CheckConfig: ct.HealthOK}},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"status": "ok", "checks": {"database": "ok", "config": "ok"}}`,
+		},
+		{
+			name:         "given a check failing should be unavailable",
+			res:          models.Health{Status: ct.HealthUnavailable, Checks: map[string]string{ct.CheckDatabase: ct.HealthUnavailable, ct.CheckConfig: ct.HealthOK}},
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: `{"status": "unavailable", "checks": {"database": "unavailable", "config": "ok"}}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)
+
+			err := handlers.NewHealthHandler(&MockHealthService{res: tc.res}).Readyz(ctx)
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+			assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/kanawat2566/assessment-tax/config"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+)
+
+type jobHandler struct {
+	serv        services.JobService
+	csvMaxBytes int64
+}
+
+func NewJobHandler(s services.JobService) *jobHandler {
+	return &jobHandler{serv: s, csvMaxBytes: config.Default().Upload.MaxBytes}
+}
+
+// WithMaxUpload sets the largest CSV upload, in bytes. Zero means no limit.
+func (h *jobHandler) WithMaxUpload(maxBytes int64) *jobHandler {
+	h.csvMaxBytes = maxBytes
+	return h
+}
+
+// SubmitTaxJob queues a CSV upload for calculation in the background and
+// answers 202 with the job to poll.
+func (h *jobHandler) SubmitTaxJob(c echo.Context) error {
+	strict, err := queryCsvMode(c)
+	if err != nil {
+		return err
+	}
+
+	src, err := UploadFromCsv(c, h.csvMaxBytes)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	job, err := h.serv.SubmitTaxJob(src, strict, requestLanguage(c))
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, "/tax/jobs/"+job.ID)
+	return c.JSON(http.StatusAccepted, job)
+}
+
+func (h *jobHandler) GetTaxJob(c echo.Context) error {
+	job, err := h.serv.GetTaxJob(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+// TaxJobResults streams the results of a finished job as JSON, or as NDJSON,
+// CSV or XLSX when asked for with ?format= or the Accept header.
+func (h *jobHandler) TaxJobResults(c echo.Context) error {
+	format, err := queryFormat(c)
+	if err != nil {
+		return err
+	}
+	id := c.Param("id")
+	return writeTaxes(c, format, func(yield func(md.Taxes, *services.Error) error) error {
+		return h.serv.TaxJobResults(id, yield)
+	})
+}
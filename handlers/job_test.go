@@ -0,0 +1,165 @@
+package handlers_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/handlers"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+type MockJobService struct {
+	job     models.TaxJob
+	err     error
+	rows    []csvRow
+	file    string
+	strict  bool
+	lang    language.Tag
+	askedID string
+}
+
+func (m *MockJobService) SubmitTaxJob(file io.Reader, strict bool, lang language.Tag) (models.TaxJob, error) {
+	b, _ := io.ReadAll(file)
+	m.file, m.strict, m.lang = string(b), strict, lang
+	return m.job, m.err
+}
+
+func (m *MockJobService) GetTaxJob(id string) (models.TaxJob, error) {
+	m.askedID = id
+	return m.job, m.err
+}
+
+func (m *MockJobService) TaxJobResults(id string, yield func(models.Taxes, *services.Error) error) error {
+	m.askedID = id
+	if m.err != nil {
+		return m.err
+	}
+	for _, row := range m.rows {
+		if err := yield(row.tax, row.err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func jobContext(method, target string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(method, target, nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetPath("/tax/jobs/:id")
+	ctx.SetParamNames("id")
+	ctx.SetParamValues("6f1c2a8e-3b4d-4e5f-8a9b-0c1d2e3f4a5b")
+	return ctx, rec
+}
+
+func TestSubmitTaxJob(t *testing.T) {
+	csv := "totalIncome\n500000\n"
+	ctx, rec := uploadCsvContext("?mode=strict", csv)
+	ctx.Request().Header.Set("Accept-Language", "th")
+	created := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	mockService := &MockJobService{job: models.TaxJob{ID: "6f1c2a8e-3b4d-4e5f-8a9b-0c1d2e3f4a5b", Status: ct.JobQueued, Mode: ct.CsvModeStrict, CreatedAt: created}}
+
+	err := handlers.NewJobHandler(mockService).SubmitTaxJob(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "/tax/jobs/6f1c2a8e-3b4d-4e5f-8a9b-0c1d2e3f4a5b", rec.Header().Get(echo.HeaderLocation))
+	assert.JSONEq(t, `{"id": "6f1c2a8e-3b4d-4e5f-8a9b-0c1d2e3f4a5b", "status": "queued", "mode": "strict", "progress": 0,
+		"processedRows": 0, "errorRows": 0, "createdAt": "2024-03-01T09:00:00Z"}`, rec.Body.String())
+	assert.Equal(t, csv, mockService.file)
+	assert.True(t, mockService.strict)
+	assert.Equal(t, language.Thai, mockService.lang)
+}
+
+func TestSubmitTaxJob_TooLarge(t *testing.T) {
+	ctx, _ := uploadCsvContext("", "totalIncome\n500000\n")
+
+	err := handlers.NewJobHandler(&MockJobService{}).WithMaxUpload(16).SubmitTaxJob(ctx)
+
+	assert.ErrorIs(t, err, services.ErrCsvTooLarge)
+}
+
+func TestGetTaxJob(t *testing.T) {
+	t.Run("given job should return its progress", func(t *testing.T) {
+		ctx, rec := jobContext(http.MethodGet, "/")
+		mockService := &MockJobService{job: models.TaxJob{ID: "6f1c2a8e-3b4d-4e5f-8a9b-0c1d2e3f4a5b", Status: ct.JobRunning, Progress: 40, ProcessedRows: 200}}
+
+		err := handlers.NewJobHandler(mockService).GetTaxJob(ctx)
+
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"progress":40`)
+		assert.Equal(t, "6f1c2a8e-3b4d-4e5f-8a9b-0c1d2e3f4a5b", mockService.askedID)
+	})
+
+	t.Run("given unknown job should return not found", func(t *testing.T) {
+		ctx, _ := jobContext(http.MethodGet, "/")
+
+		err := handlers.NewJobHandler(&MockJobService{err: services.ErrTaxJobNotFound}).GetTaxJob(ctx)
+
+		assert.ErrorIs(t, err, services.ErrTaxJobNotFound)
+	})
+}
+
+func TestTaxJobResults(t *testing.T) {
+	rows := []csvRow{
+		{tax: models.Taxes{ID: "E-01", TotalIncome: money.Baht(500000), Tax: money.Baht(29000)}},
+		{err: services.ErrWHTInvalid.AtLine(3)},
+	}
+	cases := []struct {
+		name        string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{
+			name:        "given no accept should return json",
+			contentType: echo.MIMEApplicationJSONCharsetUTF8,
+			body: `{"taxes":[{"id":"E-01","totalIncome":500000,"tax":29000,"taxRefund":0}
+],"errors":[{"code":"wht_invalid","message":"` + ct.ErrMesssageWhtInvalid + `","field":"wht","line":3}]
+}`,
+		},
+		{
+			name:        "given csv accept should return csv",
+			accept:      ct.MIMETextCSV,
+			contentType: "text/csv; charset=UTF-8",
+			body: "id,totalIncome,tax,taxRefund,line,errorCode,error\n" +
+				"E-01,500000.00,29000.00,0.00,,,\n" +
+				",,,,3,wht_invalid," + ct.ErrMesssageWhtInvalid + "\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, rec := jobContext(http.MethodGet, "/")
+			ctx.Request().Header.Set(echo.HeaderAccept, tc.accept)
+
+			err := handlers.NewJobHandler(&MockJobService{rows: rows}).TaxJobResults(ctx)
+
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tc.contentType, rec.Header().Get(echo.HeaderContentType))
+			assert.Equal(t, tc.body, rec.Body.String())
+		})
+	}
+}
+
+func TestTaxJobResults_NotFinished(t *testing.T) {
+	ctx, rec := jobContext(http.MethodGet, "/")
+
+	err := handlers.NewJobHandler(&MockJobService{err: services.ErrTaxJobNotFinished}).TaxJobResults(ctx)
+
+	assert.ErrorIs(t, err, services.ErrTaxJobNotFinished)
+	assert.False(t, ctx.Response().Committed, "Nothing should be sent before the error")
+	assert.Equal(t, 0, rec.Body.Len())
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+)
+
+// RateLimit returns middleware that limits a class of requests per caller:
+// the service caller or admin user signed in, or else the client IP. It goes
+// after the authentication of the route. Every response carries the
+// RateLimit headers, and a request over the limit or the quota of the class
+// gets a 429 with Retry-After. When the limits cannot be read, the request
+// is let through rather than failing with the store.
+func RateLimit(s services.RateLimitService) func(class string) echo.MiddlewareFunc {
+	return func(class string) echo.MiddlewareFunc {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				rl, err := s.Take(class, caller(c))
+				if err != nil {
+					c.Logger().Error(err)
+					return next(c)
+				}
+				if rl == nil {
+					return next(c)
+				}
+
+				if err := rateLimited(c, rl); err != nil {
+					return err
+				}
+				return next(c)
+			}
+		}
+	}
+}
+
+// LimitAuthFailures returns middleware that limits failed sign-ins per client
+// IP, as the class ct.RateLimitAuthFailures. It goes before any other
+// authentication, so guessing passwords, API keys or tokens is slowed down
+// even though the guesses never get as far as RateLimit. Only a request with
+// credentials that are refused uses up the limit, and once it is used up,
+// requests with credentials from that IP get a 429 without them being
+// checked. Requests without credentials pass untouched. As with RateLimit,
+// the request is let through when the limits cannot be read.
+func LimitAuthFailures(s services.RateLimitService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			h := c.Request().Header
+			if h.Get(echo.HeaderAuthorization) == "" && h.Get(ct.HeaderAPIKey) == "" {
+				return next(c)
+			}
+			key := "ip:" + c.RealIP()
+			rl, err := s.Peek(ct.RateLimitAuthFailures, key)
+			if err != nil {
+				c.Logger().Error(err)
+			} else if rl != nil && !rl.Allowed {
+				return rateLimited(c, rl)
+			}
+
+			err = next(c)
+			if isUnauthorized(err) {
+				if _, terr := s.Take(ct.RateLimitAuthFailures, key); terr != nil {
+					c.Logger().Error(terr)
+				}
+			}
+			return err
+		}
+	}
+}
+
+// rateLimited sets the RateLimit headers of rl, for the bucket or the quota,
+// whichever has fewer requests left, and returns services.ErrRateLimited
+// with Retry-After when rl refuses the request.
+func rateLimited(c echo.Context, rl *models.RateLimit) error {
+	var policies []string
+	shown := rl
+	for _, p := range []*models.RateLimit{rl, rl.Quota} {
+		if p == nil || p.Limit == 0 {
+			continue
+		}
+		policies = append(policies, fmt.Sprintf("%d;w=%d", p.Limit, seconds(p.Window)))
+		if shown.Limit == 0 || p.Remaining < shown.Remaining {
+			shown = p
+		}
+	}
+
+	h := c.Response().Header()
+	h.Set(ct.HeaderRateLimitLimit, strconv.Itoa(shown.Limit))
+	h.Set(ct.HeaderRateLimitRemaining, strconv.Itoa(shown.Remaining))
+	h.Set(ct.HeaderRateLimitReset, strconv.Itoa(seconds(shown.Reset)))
+	h.Set(ct.HeaderRateLimitPolicy, strings.Join(policies, ", "))
+	if !rl.Allowed {
+		retry := max(1, seconds(rl.RetryAfter))
+		h.Set(echo.HeaderRetryAfter, strconv.Itoa(retry))
+		return services.ErrRateLimited.WithArgs(retry)
+	}
+	return nil
+}
+
+// isUnauthorized reports whether err refuses a request for its credentials,
+// from ClientAuth, AdminAuth or BasicAuth.
+func isUnauthorized(err error) bool {
+	var se *services.Error
+	if errors.As(err, &se) {
+		return se.Kind == services.KindUnauthorized
+	}
+	var he *echo.HTTPError
+	return errors.As(err, &he) && he.Code == http.StatusUnauthorized
+}
+
+// caller is the key a request is rate limited by.
+func caller(c echo.Context) string {
+	if client, ok := c.Get(ct.ContextClient).(string); ok {
+		return "client:" + client
+	}
+	if user, ok := c.Get(ct.ContextUser).(string); ok {
+		return "user:" + user
+	}
+	return "ip:" + c.RealIP()
+}
+
+// seconds rounds d up to whole seconds.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,179 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/handlers"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockRateLimitService struct {
+	res   *models.RateLimit
+	err   error
+	class string
+	key   string
+	peek  *models.RateLimit
+	taken int
+}
+
+func (m *MockRateLimitService) Take(class, key string) (*models.RateLimit, error) {
+	m.class, m.key = class, key
+	m.taken++
+	return m.res, m.err
+}
+
+func (m *MockRateLimitService) Peek(class, key string) (*models.RateLimit, error) {
+	m.class, m.key = class, key
+	return m.peek, m.err
+}
+
+func TestRateLimit(t *testing.T) {
+	cases := []struct {
+		name     string
+		res      *models.RateLimit
+		err      error
+		status   int
+		headers  map[string]string
+		expected error
+	}{
+		{
+			name:   "given request within the limit should pass with headers",
+			res:    &models.RateLimit{Allowed: true, Limit: 60, Window: time.Minute, Remaining: 59, Reset: 900 * time.Millisecond},
+			status: http.StatusOK,
+			headers: map[string]string{
+				ct.HeaderRateLimitLimit: "60", ct.HeaderRateLimitRemaining: "59", ct.HeaderRateLimitReset: "1", ct.HeaderRateLimitPolicy: "60;w=60", echo.HeaderRetryAfter: "",
+			},
+		},
+		{
+			name:     "given request over the limit should refuse with Retry-After",
+			res:      &models.RateLimit{Limit: 10, Window: time.Minute, Reset: time.Minute, RetryAfter: 5500 * time.Millisecond},
+			headers:  map[string]string{ct.HeaderRateLimitRemaining: "0", ct.HeaderRateLimitReset: "60", echo.HeaderRetryAfter: "6"},
+			expected: services.ErrRateLimited,
+		},
+		{
+			name: "given quota closer to running out should show the quota",
+			res: &models.RateLimit{Allowed: true, Limit: 60, Window: time.Minute, Remaining: 59, Reset: time.Second,
+				Quota: &models.RateLimit{Allowed: true, Limit: 1000, Window: 24 * time.Hour, Remaining: 3, Reset: time.Hour}},
+			status: http.StatusOK,
+			headers: map[string]string{
+				ct.HeaderRateLimitLimit: "1000", ct.HeaderRateLimitRemaining: "3", ct.HeaderRateLimitReset: "3600", ct.HeaderRateLimitPolicy: "60;w=60, 1000;w=86400",
+			},
+		},
+		{
+			name: "given quota used up should refuse until the window is over",
+			res: &models.RateLimit{Limit: 60, Window: time.Minute, Remaining: 59, Reset: time.Second, RetryAfter: time.Hour,
+				Quota: &models.RateLimit{Limit: 1000, Window: 24 * time.Hour, Reset: time.Hour, RetryAfter: time.Hour}},
+			headers:  map[string]string{ct.HeaderRateLimitLimit: "1000", ct.HeaderRateLimitRemaining: "0", echo.HeaderRetryAfter: "3600"},
+			expected: services.ErrRateLimited,
+		},
+		{name: "given class without a limit should pass without headers", status: http.StatusOK, headers: map[string]string{ct.HeaderRateLimitLimit: ""}},
+		{name: "given store down should let the request through", err: services.ErrInternal, status: http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(httptest.NewRequest(http.MethodPost, "/tax/calculations", nil), rec)
+			next := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+
+			err := handlers.RateLimit(&MockRateLimitService{res: tc.res, err: tc.err})(ct.RateLimitCalculate)(next)(ctx)
+
+			if tc.expected != nil {
+				assert.ErrorIs(t, err, tc.expected)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.status, rec.Code)
+			}
+			for h, v := range tc.headers {
+				assert.Equal(t, v, rec.Header().Get(h), h)
+			}
+		})
+	}
+}
+
+func TestRateLimit_Caller(t *testing.T) {
+	cases := []struct {
+		name     string
+		set      map[string]string
+		expected string
+	}{
+		{name: "given service caller should limit the client", set: map[string]string{ct.ContextClient: "payroll", ct.ContextUser: "client:payroll"}, expected: "client:payroll"},
+		{name: "given admin user should limit the user", set: map[string]string{ct.ContextUser: "adminTax"}, expected: "user:adminTax"},
+		{name: "given no credentials should limit the client IP", expected: "ip:192.0.2.1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			ctx := e.NewContext(httptest.NewRequest(http.MethodPost, "/tax/calculations", nil), httptest.NewRecorder())
+			for k, v := range tc.set {
+				ctx.Set(k, v)
+			}
+			mockService := &MockRateLimitService{}
+
+			err := handlers.RateLimit(mockService)(ct.RateLimitBulk)(func(c echo.Context) error { return nil })(ctx)
+
+			assert.Nil(t, err)
+			assert.Equal(t, ct.RateLimitBulk, mockService.class)
+			assert.Equal(t, tc.expected, mockService.key)
+		})
+	}
+}
+
+func TestLimitAuthFailures(t *testing.T) {
+	refused := &models.RateLimit{Limit: 20, Window: 15 * time.Minute, Reset: 15 * time.Minute, RetryAfter: 45 * time.Second}
+	cases := []struct {
+		name     string
+		header   string
+		value    string
+		peek     *models.RateLimit
+		next     error
+		expected error
+		taken    int
+	}{
+		{name: "given refused API key should count the failure", header: ct.HeaderAPIKey, value: "tax_wrong", peek: &models.RateLimit{Allowed: true}, next: services.ErrCredentials, expected: services.ErrCredentials, taken: 1},
+		{name: "given refused Basic credentials should count the failure", header: echo.HeaderAuthorization, value: "Basic YWRtaW5UYXg6d3Jvbmc=", peek: &models.RateLimit{Allowed: true}, next: echo.ErrUnauthorized, expected: echo.ErrUnauthorized, taken: 1},
+		{name: "given accepted credentials should not count", header: echo.HeaderAuthorization, value: "Bearer token", peek: &models.RateLimit{Allowed: true}},
+		{name: "given credentials without the scope should not count", header: ct.HeaderAPIKey, value: "tax_key", peek: &models.RateLimit{Allowed: true}, next: services.ErrScope, expected: services.ErrScope},
+		{name: "given too many failures should refuse before checking", header: ct.HeaderAPIKey, value: "tax_guess", peek: refused, next: errors.New("should not be called"), expected: services.ErrRateLimited},
+		{name: "given no credentials should pass untouched", peek: refused},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/tax/calculations", nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			mockService := &MockRateLimitService{peek: tc.peek}
+
+			err := handlers.LimitAuthFailures(mockService)(func(c echo.Context) error { return tc.next })(ctx)
+
+			if tc.expected != nil {
+				assert.ErrorIs(t, err, tc.expected)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, tc.taken, mockService.taken)
+			if tc.taken > 0 {
+				assert.Equal(t, ct.RateLimitAuthFailures, mockService.class)
+				assert.Equal(t, "ip:192.0.2.1", mockService.key)
+			}
+			if errors.Is(err, services.ErrRateLimited) {
+				assert.Equal(t, "45", rec.Header().Get(echo.HeaderRetryAfter))
+			}
+		})
+	}
+}
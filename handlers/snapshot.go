@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+)
+
+// GetConfigSnapshot returns the config snapshot with the given id, or the
+// latest one for the id "latest".
+func (h *taxHandler) GetConfigSnapshot(c echo.Context) error {
+	var id int64
+	if p := c.Param("id"); p != "latest" {
+		var err error
+		if id, err = strconv.ParseInt(p, 10, 64); err != nil || id <= 0 {
+			return services.ErrSnapshotInvalidID
+		}
+	}
+
+	res, err := h.serv.GetConfigSnapshot(id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,65 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kanawat2566/assessment-tax/handlers"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func snapshotContext(id string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetPath("/admin/config-snapshots/:id")
+	ctx.SetParamNames("id")
+	ctx.SetParamValues(id)
+	return ctx, rec
+}
+
+func TestGetConfigSnapshot(t *testing.T) {
+	t.Run("given id should return the snapshot", func(t *testing.T) {
+		ctx, rec := snapshotContext("3")
+		mockService := &MockTaxService{snapshot: models.ConfigSnapshot{
+			ID:              3,
+			CreatedAt:       time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+			TaxRates:        []models.TaxRate{},
+			Allowances:      []models.AllowanceConfig{},
+			AllowanceGroups: []models.AllowanceGroup{{GroupName: "retirement", TaxYear: 2017, LimitAmount: money.Baht(500000)}},
+		}}
+
+		err := handlers.NewHandler(mockService).GetConfigSnapshot(ctx)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), mockService.snapshotID)
+		assert.JSONEq(t, `{"id": 3, "createdAt": "2024-03-01T09:00:00Z", "taxRates": [], "allowances": [],
+			"allowanceGroups": [{"groupName": "retirement", "taxYear": 2017, "limitAmount": 500000}]}`, rec.Body.String())
+	})
+
+	t.Run("given latest should ask for the latest", func(t *testing.T) {
+		ctx, rec := snapshotContext("latest")
+		mockService := &MockTaxService{}
+
+		err := handlers.NewHandler(mockService).GetConfigSnapshot(ctx)
+
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, int64(0), mockService.snapshotID)
+	})
+
+	t.Run("given invalid id should fail", func(t *testing.T) {
+		ctx, _ := snapshotContext("0")
+
+		err := handlers.NewHandler(&MockTaxService{}).GetConfigSnapshot(ctx)
+
+		assert.ErrorIs(t, err, services.ErrSnapshotInvalidID)
+	})
+}
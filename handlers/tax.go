@@ -1,16 +1,13 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/csv"
 	"errors"
 	"io"
+	"mime/multipart"
 	"net/http"
-	"reflect"
-	"strconv"
 
 	"github.com/go-playground/validator"
-	cm "github.com/kanawat2566/assessment-tax/common"
+	"github.com/kanawat2566/assessment-tax/config"
 	ct "github.com/kanawat2566/assessment-tax/constants"
 	md "github.com/kanawat2566/assessment-tax/model"
 	"github.com/kanawat2566/assessment-tax/services"
@@ -18,7 +15,9 @@ import (
 )
 
 type taxHandler struct {
-	serv services.TaxService
+	serv        services.TaxService
+	csvMaxBytes int64
+	csvMaxRows  int
 }
 
 type CustomValidator struct {
@@ -26,26 +25,36 @@ type CustomValidator struct {
 }
 
 func NewHandler(s services.TaxService) *taxHandler {
-	return &taxHandler{serv: s}
+	upload := config.Default().Upload
+	return &taxHandler{serv: s, csvMaxBytes: upload.MaxBytes, csvMaxRows: upload.MaxRows}
+}
+
+// WithCsvLimits sets the largest CSV upload, in bytes, and the most rows it
+// may have. Zero means no limit.
+func (h *taxHandler) WithCsvLimits(maxBytes int64, maxRows int) *taxHandler {
+	h.csvMaxBytes = maxBytes
+	h.csvMaxRows = maxRows
+	return h
 }
 
 func (h *taxHandler) CalculationsHandler(c echo.Context) error {
 	rq := new(md.TaxRequest)
 
 	if err := BindWithValidate(c, rq); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return err
 	}
+	rq.Lang = requestLanguage(c)
 
 	res, err := h.serv.TaxCalculations(*rq)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return err
 	}
 
 	if res.TaxRefund > 0 {
 		return c.JSON(http.StatusOK, res)
 	} else {
 
-		tax := md.TaxLevelReponse{Tax: res.Tax, TaxLevels: res.TaxLevels}
+		tax := md.TaxLevelReponse{Tax: res.Tax, TaxableIncome: res.TaxableIncome, TaxLevels: res.TaxLevels, Allowances: res.Allowances, CalculationID: res.CalculationID, SnapshotID: res.SnapshotID}
 		return c.JSON(http.StatusOK, tax)
 	}
 
@@ -55,19 +64,17 @@ func (h *taxHandler) Deductions(c echo.Context) error {
 	rq := new(md.DeductRequest)
 	d := c.Param("type")
 
-	dd := ct.Deductions[d]
-	if len(dd.Name) == 0 {
-		return echo.NewHTTPError(http.StatusBadRequest, ct.ErrMsgDeductNotFound)
-
+	if len(d) == 0 {
+		return services.ErrDeductionNotFound
 	}
 
 	if err := BindWithValidate(c, rq); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return err
 	}
 
-	res, err := h.serv.SetAdminDeductions(ct.Deduction{Type: dd.Type, Amount: rq.Amount})
+	res, err := h.serv.SetAdminDeductions(ct.Deduction{Type: d, TaxYear: rq.TaxYear, Amount: rq.Amount}, actor(c))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return err
 	}
 
 	response := map[string]interface{}{
@@ -76,86 +83,108 @@ func (h *taxHandler) Deductions(c echo.Context) error {
 	return c.JSON(http.StatusOK, response)
 }
 
+// CalFromUploadCsvHandler calculates the tax of each row of an uploaded CSV
+// file and streams the taxes back as JSON, or as NDJSON, CSV or XLSX when
+// asked for with ?format= or the Accept header. The CSV and XLSX files repeat
+// the uploaded columns next to the tax breakdown of each row. By default rows
+// with errors are reported next to the taxes of the other rows; with
+// ?mode=strict any row error fails the whole file. JSON only lists the first
+// row errors, see jsonTaxesWriter.
 func (h *taxHandler) CalFromUploadCsvHandler(c echo.Context) error {
 
 	uploadType := c.Param("uploadType")
 
 	if uploadType != ct.PathParamUploadCsv {
-		return echo.NewHTTPError(http.StatusBadRequest, errors.New(ct.ErrMsgInvalidPathParam))
+		return services.ErrInvalidPathParam.WithField("uploadType")
 	}
 
-	csv, err := UploadFromCsv(c)
+	strict, err := queryCsvMode(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+		return err
 	}
-
-	taxes, err := h.serv.TaxCalFromCsv(csv)
+	format, err := queryFormat(c)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
-	}
-
-	response := map[string]interface{}{
-		"taxes": taxes,
+		return err
 	}
 
-	return c.JSON(http.StatusOK, response)
-
-}
-
-func UploadFromCsv(c echo.Context) ([]md.TaxRequest, error) {
-
-	file, err := c.FormFile("taxFile")
+	src, err := UploadFromCsv(c, h.csvMaxBytes)
 	if err != nil {
-		return nil, errors.New(ct.ErrMsgFileNoUpload)
-	}
-	src, err := file.Open()
-	if err != nil {
-		return nil, errors.New(ct.ErrMsgReadCsvFailed)
+		return err
 	}
 	defer src.Close()
-
-	fileBytes, err := io.ReadAll(src)
-	if err != nil {
-		return nil, errors.New(ct.ErrMsgReadCsvFailed)
+	lang := requestLanguage(c)
+
+	var snapshotID int64
+	if strict {
+		// Every row is checked before the first tax is sent, since the status
+		// cannot be changed once it is. The file is then read a second time,
+		// for its taxes or its failed rows, under the same config snapshot so
+		// that it cannot come out differently.
+		snapshot, err := h.serv.GetConfigSnapshot(0)
+		if err != nil {
+			return err
+		}
+		snapshotID = snapshot.ID
+		var firstErr *services.Error
+		err = h.serv.TaxCalFromCsv(src, h.csvMaxRows, snapshotID, func(tax md.Taxes, rowErr *services.Error) error {
+			if rowErr != nil && firstErr == nil {
+				firstErr = rowErr
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return services.ErrReadCsvFailed
+		}
+		// the failed rows are read again rather than kept from the first read,
+		// so that a file with many of them is not held in memory
+		if firstErr != nil {
+			w := newTaxesWriter(c, format, statusOfKind[firstErr.Kind])
+			err := h.serv.TaxCalFromCsv(src, h.csvMaxRows, snapshotID, func(tax md.Taxes, rowErr *services.Error) error {
+				if rowErr == nil {
+					return nil
+				}
+				return w.rowError(tax, rowErr.Localize(lang))
+			})
+			if err != nil {
+				return err
+			}
+			return w.close()
+		}
 	}
 
-	reader := csv.NewReader(bytes.NewReader(fileBytes))
+	return writeTaxes(c, format, func(yield func(md.Taxes, *services.Error) error) error {
+		return h.serv.TaxCalFromCsv(src, h.csvMaxRows, snapshotID, func(tax md.Taxes, rowErr *services.Error) error {
+			if rowErr != nil {
+				rowErr = rowErr.Localize(lang)
+			}
+			return yield(tax, rowErr)
+		})
+	})
+}
 
-	header, err := reader.Read()
-	if !reflect.DeepEqual(header, ct.CsvFomatFile) {
-		return nil, errors.New(ct.ErrMsgCsvInvaildFormat)
+// UploadFromCsv opens the uploaded taxFile. A body larger than maxBytes is
+// rejected; zero means no limit. Large files are kept on disk rather than in
+// memory by the multipart reader.
+func UploadFromCsv(c echo.Context, maxBytes int64) (multipart.File, error) {
+	req := c.Request()
+	if maxBytes > 0 {
+		req.Body = http.MaxBytesReader(c.Response(), req.Body, maxBytes)
 	}
 
-	rows, err := reader.ReadAll()
+	file, err := c.FormFile("taxFile")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, services.ErrCsvTooLarge.WithArgs(int(tooLarge.Limit))
+	}
 	if err != nil {
-		return nil, errors.New(ct.ErrMsgCsvInvaildFormat)
+		return nil, services.ErrFileNoUpload
 	}
-
-	var taxReqs []md.TaxRequest
-	for i := 0; i < len(rows); i++ {
-		row := rows[i]
-		taxReq := md.TaxRequest{}
-		if len(row) != 3 {
-			return nil, errors.New(ct.ErrMsgCsvInvaildFormat)
-		}
-
-		if taxReq.TotalIncome, err = strconv.ParseFloat(row[0], 64); err != nil {
-			return nil, errors.New(cm.MsgWithInt(ct.ErrInvalidIncomeCsv, i+2))
-		}
-		if taxReq.WHT, err = strconv.ParseFloat(row[1], 64); err != nil {
-			return nil, errors.New(cm.MsgWithInt(ct.ErrInvalidWHTCsv, i+2))
-		}
-		var donation float64
-		if donation, err = strconv.ParseFloat(row[2], 64); err != nil {
-			return nil, errors.New(cm.MsgWithInt(ct.ErrInvalidDonationCsv, i+2))
-		}
-		taxReq.Allowances = []md.Allowance{
-			{AllowanceType: ct.Donation, Amount: donation},
-		}
-
-		taxReqs = append(taxReqs, taxReq)
+	src, err := file.Open()
+	if err != nil {
+		return nil, services.ErrReadCsvFailed
 	}
-
-	return taxReqs, nil
-
+	return src, nil
 }
@@ -11,9 +11,9 @@ import (
 	"strings"
 	"testing"
 
-	ct "github.com/kanawat2566/assessment-tax/constants"
 	md "github.com/kanawat2566/assessment-tax/model"
 	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -76,7 +76,7 @@ func TestPostTaxCalulation_Integration(t *testing.T) {
 							]
 						}`,
 			statusCode: http.StatusOK,
-			response:   md.TaxResponse{Tax: 29000},
+			response:   md.TaxResponse{Tax: money.Baht(29000)},
 		},
 		{
 			name: "Invalid Tax Calucations",
@@ -127,7 +127,7 @@ func TestAdminSetDedutions_Integration(t *testing.T) {
 						"amount": 60000.0
 					  }`,
 			statusCode: http.StatusOK,
-			response:   md.DeductResponse{PersonalDeduction: 60000},
+			response:   md.DeductResponse{PersonalDeduction: money.Baht(60000)},
 		},
 		{
 			name: "Invalid Tax Calucations",
@@ -136,7 +136,7 @@ func TestAdminSetDedutions_Integration(t *testing.T) {
 						"amountx": 50000.0
 						}`,
 			statusCode: http.StatusBadRequest,
-			response:   md.DeductResponse{PersonalDeduction: 0},
+			response:   md.DeductResponse{PersonalDeduction: money.Baht(0)},
 		},
 	}
 
@@ -148,7 +148,7 @@ func TestAdminSetDedutions_Integration(t *testing.T) {
 			body := strings.NewReader(tc.request)
 			req, _ := http.NewRequest("POST", uri(tc.url), body)
 
-			req.SetBasicAuth(ct.UserAuth, ct.PassAuth)
+			req.SetBasicAuth(os.Getenv("ADMIN_USERNAME"), os.Getenv("ADMIN_PASSWORD"))
 			req.Header.Add("Content-Type", "application/json")
 			req.Close = true
 
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+)
+
+func (h *taxHandler) ListTaxRates(c echo.Context) error {
+	taxYear, err := queryTaxYear(c)
+	if err != nil {
+		return err
+	}
+
+	res, err := h.serv.ListTaxRates(taxYear)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *taxHandler) CreateTaxRate(c echo.Context) error {
+	rq := new(md.TaxRate)
+	if err := BindWithValidate(c, rq); err != nil {
+		return err
+	}
+
+	res, err := h.serv.CreateTaxRate(*rq, actor(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, res)
+}
+
+func (h *taxHandler) UpdateTaxRate(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return services.ErrTaxRateInvalidID
+	}
+
+	rq := new(md.TaxRate)
+	if err := BindWithValidate(c, rq); err != nil {
+		return err
+	}
+	rq.ID = id
+
+	res, err := h.serv.UpdateTaxRate(*rq, actor(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *taxHandler) DeleteTaxRate(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return services.ErrTaxRateInvalidID
+	}
+
+	res, err := h.serv.DeleteTaxRate(id, actor(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,119 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/handlers"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func upTo(baht int64) *money.Amount {
+	m := money.Baht(baht)
+	return &m
+}
+
+var _taxRatesResp = models.TaxRatesResponse{
+	TaxYear: 2024,
+	TaxRates: []models.TaxRate{
+		{ID: 1, TaxYear: 2017, Level: "0-150,000", MinIncome: money.Baht(0), MaxIncome: upTo(150000), TaxRate: money.Percentage(0)},
+		{ID: 2, TaxYear: 2017, Level: "150,001 ขึ้นไป", MinIncome: money.Baht(150001), TaxRate: money.Percentage(10)},
+	},
+}
+
+func TestListTaxRatesHandler(t *testing.T) {
+	mockService := &MockTaxService{taxRatesResp: _taxRatesResp}
+	handler := handlers.NewHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/admin/tax-rates?taxYear=2024", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+
+	err := handler.ListTaxRates(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 2024, mockService.taxRateReq.TaxYear)
+	var response models.TaxRatesResponse
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, _taxRatesResp, response)
+}
+
+func TestListTaxRatesHandler_InvalidTaxYear(t *testing.T) {
+	handler := handlers.NewHandler(&MockTaxService{})
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/admin/tax-rates?taxYear=abc", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+
+	err := handler.ListTaxRates(ctx)
+
+	assert.ErrorIs(t, err, services.ErrInvalidField)
+	assert.EqualError(t, err, ct.ErrMsgTaxYearInvalid)
+}
+
+func TestCreateTaxRateHandler(t *testing.T) {
+	mockService := &MockTaxService{taxRatesResp: _taxRatesResp}
+	handler := handlers.NewHandler(mockService)
+
+	e := echo.New()
+	body := `{"taxYear": 2024, "level": "150,001 ขึ้นไป", "minIncome": 150001, "maxIncome": null, "taxRate": 10}`
+	req := httptest.NewRequest(http.MethodPost, "/admin/tax-rates", RequestBody(json.RawMessage(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+
+	err := handler.CreateTaxRate(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, models.TaxRate{TaxYear: 2024, Level: "150,001 ขึ้นไป", MinIncome: money.Baht(150001), TaxRate: money.Percentage(10)}, mockService.taxRateReq)
+}
+
+func TestUpdateTaxRateHandler(t *testing.T) {
+	mockService := &MockTaxService{taxRatesResp: _taxRatesResp}
+	handler := handlers.NewHandler(mockService)
+
+	e := echo.New()
+	body := `{"level": "0-150,000", "minIncome": 0, "maxIncome": 150000, "taxRate": 0}`
+	req := httptest.NewRequest(http.MethodPut, "/", RequestBody(json.RawMessage(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetPath("/admin/tax-rates/:id")
+	ctx.SetParamNames("id")
+	ctx.SetParamValues("1")
+
+	err := handler.UpdateTaxRate(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, mockService.taxRateReq.ID)
+}
+
+func TestDeleteTaxRateHandler_ServiceError(t *testing.T) {
+	mockService := &MockTaxService{taxRatesErr: services.ErrTaxRateNotFound}
+	handler := handlers.NewHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodDelete, "/", nil)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetPath("/admin/tax-rates/:id")
+	ctx.SetParamNames("id")
+	ctx.SetParamValues("9")
+
+	err := handler.DeleteTaxRate(ctx)
+
+	assert.ErrorIs(t, err, services.ErrTaxRateNotFound)
+	assert.Equal(t, 9, mockService.taxRateReq.ID)
+}
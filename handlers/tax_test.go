@@ -1,45 +1,106 @@
 package handlers_test
 
 import (
+	"archive/zip"
 	"bytes"
 	"encoding/json"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	ct "github.com/kanawat2566/assessment-tax/constants"
 	"github.com/kanawat2566/assessment-tax/handlers"
 	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/kanawat2566/assessment-tax/xlsx"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
 
 type MockTaxService struct {
-	taxResp    models.TaxResponse
-	taxErr     error
-	deductResp ct.Deduction
-	deductErr  error
-	taxCsv     []models.Taxes
-	fileCsv    string
-	taxCsvErr  error
+	taxResp      models.TaxResponse
+	taxErr       error
+	deductResp   ct.Deduction
+	deductErr    error
+	csvRows      []csvRow
+	csvErr       error
+	csvReads     int
+	csvSnapshots []int64
+	fileCsv      string
+	taxRatesResp models.TaxRatesResponse
+	taxRatesErr  error
+	taxRateReq   models.TaxRate
+	awcResp      models.AllowancesResponse
+	awcCreated   models.AllowanceConfig
+	awcErr       error
+	snapshot     models.ConfigSnapshot
+	snapshotErr  error
+	snapshotID   int64
+	actor        ct.Actor
 }
 
 func (m *MockTaxService) TaxCalculations(taxRequest models.TaxRequest) (models.TaxResponse, error) {
 	return m.taxResp, m.taxErr
 }
 
-func (m *MockTaxService) SetAdminDeductions(req ct.Deduction) (ct.Deduction, error) {
+func (m *MockTaxService) SetAdminDeductions(req ct.Deduction, by ct.Actor) (ct.Deduction, error) {
+	m.actor = by
 	return m.deductResp, m.deductErr
 }
-func (m *MockTaxService) TaxCalFromCsv(taxRequest []models.TaxRequest) ([]models.Taxes, error) {
-	return m.taxCsv, m.taxCsvErr
+
+// csvRow is what the mock yields for a CSV row: its tax or its error.
+type csvRow struct {
+	tax models.Taxes
+	err *services.Error
+}
+
+func (m *MockTaxService) TaxCalFromCsv(r io.Reader, maxRows int, snapshotID int64, yield func(models.Taxes, *services.Error) error) error {
+	b, _ := io.ReadAll(r)
+	m.fileCsv = string(b)
+	m.csvReads++
+	m.csvSnapshots = append(m.csvSnapshots, snapshotID)
+	for _, row := range m.csvRows {
+		if err := yield(row.tax, row.err); err != nil {
+			return err
+		}
+	}
+	return m.csvErr
+}
+func (m *MockTaxService) ListTaxRates(taxYear int) (models.TaxRatesResponse, error) {
+	m.taxRateReq = models.TaxRate{TaxYear: taxYear}
+	return m.taxRatesResp, m.taxRatesErr
+}
+func (m *MockTaxService) CreateTaxRate(rate models.TaxRate, by ct.Actor) (models.TaxRatesResponse, error) {
+	m.taxRateReq, m.actor = rate, by
+	return m.taxRatesResp, m.taxRatesErr
+}
+func (m *MockTaxService) UpdateTaxRate(rate models.TaxRate, by ct.Actor) (models.TaxRatesResponse, error) {
+	m.taxRateReq, m.actor = rate, by
+	return m.taxRatesResp, m.taxRatesErr
+}
+func (m *MockTaxService) DeleteTaxRate(id int, by ct.Actor) (models.TaxRatesResponse, error) {
+	m.taxRateReq, m.actor = models.TaxRate{ID: id}, by
+	return m.taxRatesResp, m.taxRatesErr
+}
+func (m *MockTaxService) ListAllowances(taxYear int) (models.AllowancesResponse, error) {
+	return m.awcResp, m.awcErr
+}
+func (m *MockTaxService) CreateAllowance(allowance models.AllowanceConfig, by ct.Actor) (models.AllowanceConfig, error) {
+	m.awcCreated, m.actor = allowance, by
+	return allowance, m.awcErr
+}
+func (m *MockTaxService) GetConfigSnapshot(id int64) (models.ConfigSnapshot, error) {
+	m.snapshotID = id
+	return m.snapshot, m.snapshotErr
 }
 func TestCalculationsHandler_ValidRequest(t *testing.T) {
 	// Create mock service
 	mockService := &MockTaxService{
-		taxResp: models.TaxResponse{Tax: 29000.0},
+		taxResp: models.TaxResponse{Tax: money.Baht(29000)},
 	}
 
 	// Create handler with mock service
@@ -47,8 +108,8 @@ func TestCalculationsHandler_ValidRequest(t *testing.T) {
 
 	// Create a valid tax request
 	taxRequest := models.TaxRequest{
-		TotalIncome: 500000,
-		WHT:         0,
+		TotalIncome: money.Baht(500000),
+		WHT:         money.Baht(0),
 	}
 
 	// Create a request object
@@ -80,18 +141,18 @@ func RequestBody(r interface{}) *bytes.Reader {
 func TestAdminDeductionHandler_ValidRequest(t *testing.T) {
 	// Create mock service
 	mockService := &MockTaxService{
-		deductResp: ct.Deduction{Name: "PersonalDeduction", Amount: 70000.0},
+		deductResp: ct.Deduction{Name: "PersonalDeduction", Amount: money.Baht(70000)},
 	}
 
 	// expected
-	ep := models.DeductResponse{PersonalDeduction: 70000.00}
+	ep := models.DeductResponse{PersonalDeduction: money.Baht(70000)}
 
 	// Create handler with mock service
 	handler := handlers.NewHandler(mockService)
 
 	// Create a valid tax request
 	rq := models.DeductRequest{
-		Amount: 70000.0,
+		Amount: money.Baht(70000),
 	}
 
 	// Create a request object
@@ -99,12 +160,14 @@ func TestAdminDeductionHandler_ValidRequest(t *testing.T) {
 	//e.Validator = &handlers.CustomValidator{Validator: validator.New()}
 	req := httptest.NewRequest(http.MethodPost, "/", RequestBody(rq))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
 
 	rec := httptest.NewRecorder()
 	ctx := e.NewContext(req, rec)
 	ctx.SetPath("admin/deductions/:type")
 	ctx.SetParamNames("type")
 	ctx.SetParamValues(ct.Personal)
+	ctx.Set(ct.ContextUser, "adminTax")
 
 	// Call the handler function
 	err := handler.Deductions(ctx)
@@ -116,6 +179,28 @@ func TestAdminDeductionHandler_ValidRequest(t *testing.T) {
 	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &response), "Response should be unmarshallable")
 	assert.Equal(t, ep.PersonalDeduction, response.PersonalDeduction, "Response should match mock service response")
 	assert.Equal(t, ep.KReceipt, response.KReceipt, "Response should match mock service response")
+	assert.Equal(t, ct.Actor{User: "adminTax", RequestID: "req-1"}, mockService.actor, "The change should be audited as the signed in admin")
+}
+
+func TestAdminDeductionHandler_LongRequestID(t *testing.T) {
+	mockService := &MockTaxService{deductResp: ct.Deduction{Name: "PersonalDeduction", Amount: money.Baht(70000)}}
+	handler := handlers.NewHandler(mockService)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", RequestBody(models.DeductRequest{Amount: money.Baht(70000)}))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderXRequestID, strings.Repeat("ก", 150))
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetPath("admin/deductions/:type")
+	ctx.SetParamNames("type")
+	ctx.SetParamValues(ct.Personal)
+	ctx.Set(ct.ContextUser, "adminTax")
+
+	err := handler.Deductions(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("ก", 100), mockService.actor.RequestID, "The request id should be cut to fit the audit log")
 }
 
 type taxResponse struct {
@@ -126,37 +211,19 @@ func TestCalFromUploadCsvHandler(t *testing.T) {
 	// Mock CSV data
 	validCsv := "totalIncome,wht,donation\n500000,0,0\n600000,40000,20000\n750000,50000,15000\n"
 	expected := []models.Taxes{
-		{Tax: 29000, TotalIncome: 500000},
-		{Tax: 29000, TotalIncome: 600000, TaxRefund: 2000},
-		{Tax: 11250, TotalIncome: 750000},
+		{Tax: money.Baht(29000), TotalIncome: money.Baht(500000)},
+		{Tax: money.Baht(29000), TotalIncome: money.Baht(600000), TaxRefund: money.Baht(2000)},
+		{Tax: money.Baht(11250), TotalIncome: money.Baht(750000)},
 	}
 	// Valid CSV test case
 	t.Run("ValidCSV", func(t *testing.T) {
 
-		mockService := &MockTaxService{
-			fileCsv: validCsv,
-			taxCsv:  expected,
+		mockService := &MockTaxService{}
+		for _, tax := range expected {
+			mockService.csvRows = append(mockService.csvRows, csvRow{tax: tax})
 		}
 
-		body := new(bytes.Buffer)
-		writer := multipart.NewWriter(body)
-		writer.WriteField("taxFile", "taxes.csv")
-		part, _ := writer.CreateFormFile("taxFile", "taxes.csv")
-		part.Write([]byte(validCsv))
-		writer.Close()
-
-		e := echo.New()
-		//e.Validator = &handlers.CustomValidator{Validator: validator.New()}
-		req := httptest.NewRequest(http.MethodPost, "/", body)
-		req.Header.Set("Content-Type", writer.FormDataContentType())
-
-		rec := httptest.NewRecorder()
-		ctx := e.NewContext(req, rec)
-		ctx.SetPath("tax/calculations/:uploadType")
-		ctx.SetParamNames("uploadType")
-		ctx.SetParamValues("upload-csv")
-		ctx.FormFile("taxFile")
-
+		ctx, rec := uploadCsvContext("", validCsv)
 		handler := handlers.NewHandler(mockService)
 
 		err := handler.CalFromUploadCsvHandler(ctx)
@@ -167,10 +234,280 @@ func TestCalFromUploadCsvHandler(t *testing.T) {
 		var response taxResponse
 		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &response), "Response should be unmarshallable")
 		assert.Equal(t, expected, response.Taxes, "Response should match mock service response")
+		assert.Equal(t, validCsv, mockService.fileCsv, "Uploaded file should be passed to the service")
+
+	})
+}
+
+func uploadCsvContext(query string, csv string) (echo.Context, *httptest.ResponseRecorder) {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("taxFile", "taxes.csv")
+	part.Write([]byte(csv))
+	writer.Close()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/"+query, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetPath("tax/calculations/:uploadType")
+	ctx.SetParamNames("uploadType")
+	ctx.SetParamValues("upload-csv")
+	return ctx, rec
+}
+
+func TestCalFromUploadCsvHandler_InvalidCsv(t *testing.T) {
+	ctx, rec := uploadCsvContext("", "wht\n0\n")
+
+	mockService := &MockTaxService{csvErr: services.ErrCsvColumnMissing.WithArgs("totalIncome")}
+	err := handlers.NewHandler(mockService).CalFromUploadCsvHandler(ctx)
+
+	assert.ErrorIs(t, err, services.ErrCsvColumnMissing)
+	assert.False(t, rec.Flushed || ctx.Response().Committed, "Nothing should be sent before the error")
+}
+
+func TestCalFromUploadCsvHandler_RowErrors(t *testing.T) {
+	rows := []csvRow{
+		{err: services.ErrCsvWHT.WithArgs(2).AtLine(2)},
+		{tax: models.Taxes{ID: "E-02", TotalIncome: money.Baht(500000), Tax: money.Baht(29000)}},
+		{err: services.ErrWHTInvalid.AtLine(4)},
+	}
+	cases := []struct {
+		name       string
+		query      string
+		accept     string
+		statusCode int
+		body       string
+		reads      int
+	}{
+		{
+			name:       "given lenient mode should return taxes of valid rows and row errors",
+			query:      "",
+			statusCode: http.StatusOK,
+			body: `{"taxes": [{"id": "E-02", "totalIncome": 500000, "tax": 29000, "taxRefund": 0}], "errors": [
+				{"code": "csv_invalid_wht", "message": "Invalid WHT number in line 2", "field": "wht", "line": 2},
+				{"code": "wht_invalid", "message": "` + ct.ErrMesssageWhtInvalid + `", "field": "wht", "line": 4}]}`,
+			reads: 1,
+		},
+		{
+			name:       "given strict mode should return only row errors",
+			query:      "?mode=strict",
+			statusCode: http.StatusBadRequest,
+			body: `{"taxes": [], "errors": [
+				{"code": "csv_invalid_wht", "message": "Invalid WHT number in line 2", "field": "wht", "line": 2},
+				{"code": "wht_invalid", "message": "` + ct.ErrMesssageWhtInvalid + `", "field": "wht", "line": 4}]}`,
+			reads: 2,
+		},
+		{
+			name:       "given ndjson accept should stream a line per row in file order",
+			query:      "",
+			accept:     ct.MIMEApplicationNDJSON,
+			statusCode: http.StatusOK,
+			body: `{"error":{"code":"csv_invalid_wht","message":"Invalid WHT number in line 2","field":"wht","line":2}}
+{"id":"E-02","totalIncome":500000,"tax":29000,"taxRefund":0}
+{"error":{"code":"wht_invalid","message":"` + ct.ErrMesssageWhtInvalid + `","field":"wht","line":4}}
+`,
+			reads: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, rec := uploadCsvContext(tc.query, "totalIncome,wht\n500000,abc\n")
+			ctx.Request().Header.Set(echo.HeaderAccept, tc.accept)
+			mockService := &MockTaxService{csvRows: rows}
+
+			err := handlers.NewHandler(mockService).CalFromUploadCsvHandler(ctx)
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.statusCode, rec.Code)
+			if tc.accept == ct.MIMEApplicationNDJSON {
+				assert.Equal(t, tc.body, rec.Body.String())
+			} else {
+				assert.JSONEq(t, tc.body, rec.Body.String())
+			}
+			assert.Equal(t, tc.reads, mockService.csvReads)
+		})
+	}
+}
+
+func TestCalFromUploadCsvHandler_ManyRowErrors(t *testing.T) {
+	rows := []csvRow{{tax: models.Taxes{ID: "E-01", TotalIncome: money.Baht(500000), Tax: money.Baht(29000)}}}
+	for line := 3; line < 1205; line++ {
+		rows = append(rows, csvRow{err: services.ErrWHTInvalid.AtLine(line)})
+	}
+	ctx, rec := uploadCsvContext("", "totalIncome,wht\n")
+
+	err := handlers.NewHandler(&MockTaxService{csvRows: rows}).CalFromUploadCsvHandler(ctx)
+
+	assert.Nil(t, err)
+	var res struct {
+		Taxes         []models.Taxes    `json:"taxes"`
+		Errors        []*services.Error `json:"errors"`
+		ErrorsOmitted int               `json:"errorsOmitted"`
+	}
+	if assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &res)) {
+		assert.Len(t, res.Taxes, 1)
+		assert.Len(t, res.Errors, 1000, "Only the first row errors should be kept")
+		assert.Equal(t, 1002, res.Errors[999].Line)
+		assert.Equal(t, 202, res.ErrorsOmitted)
+	}
+}
+
+func TestCalFromUploadCsvHandler_Export(t *testing.T) {
+	header := []string{"id", "totalIncome", "wht"}
+	rows := []csvRow{
+		{tax: models.Taxes{ID: "E-01", Input: &models.CsvRow{Header: header, Cells: []string{"E-01", "500000", "abc"}}},
+			err: services.ErrCsvWHT.WithArgs(2).AtLine(2)},
+		{tax: models.Taxes{ID: "E-02", TotalIncome: money.Baht(500000), Tax: money.Baht(29000), TaxableIncome: money.Baht(440000),
+			TaxLevels: []models.TaxLevel{{Level: "0-150,000"}, {Level: "150,001-500,000", Tax: money.Baht(29000)}},
+			Input:     &models.CsvRow{Header: header, Cells: []string{"E-02", "500000", "0"}}}},
+	}
+
+	t.Run("given csv format should repeat input columns with the tax breakdown", func(t *testing.T) {
+		ctx, rec := uploadCsvContext("?format=csv", "id,totalIncome,wht\n")
+		ctx.Request().Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+
+		err := handlers.NewHandler(&MockTaxService{csvRows: rows}).CalFromUploadCsvHandler(ctx)
+
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/csv; charset=UTF-8", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, `attachment; filename="taxes.csv"`, rec.Header().Get(echo.HeaderContentDisposition))
+		assert.Equal(t, "id,totalIncome,wht,tax,taxRefund,taxableIncome,\"0-150,000\",\"150,001-500,000\",line,errorCode,error\n"+
+			"E-01,500000,abc,,,,,,2,csv_invalid_wht,Invalid WHT number in line 2\n"+
+			"E-02,500000,0,29000.00,0.00,440000.00,0.00,29000.00,,,\n", rec.Body.String())
+	})
+
+	t.Run("given xlsx accept should return a spreadsheet", func(t *testing.T) {
+		ctx, rec := uploadCsvContext("", "id,totalIncome,wht\n")
+		ctx.Request().Header.Set(echo.HeaderAccept, xlsx.MIMEType)
+
+		err := handlers.NewHandler(&MockTaxService{csvRows: rows}).CalFromUploadCsvHandler(ctx)
+
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, xlsx.MIMEType, rec.Header().Get(echo.HeaderContentType))
+		zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+		if assert.Nil(t, err) {
+			f, _ := zr.Open("xl/worksheets/sheet1.xml")
+			sheet, _ := io.ReadAll(f)
+			assert.Contains(t, string(sheet), `<c><v>440000.00</v></c>`)
+		}
+	})
+
+	t.Run("given strict mode should return only the failed rows", func(t *testing.T) {
+		ctx, rec := uploadCsvContext("?mode=strict&format=csv", "id,totalIncome,wht\n")
+
+		err := handlers.NewHandler(&MockTaxService{csvRows: rows}).CalFromUploadCsvHandler(ctx)
+
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "id,totalIncome,wht,tax,taxRefund,taxableIncome,line,errorCode,error\n"+
+			"E-01,500000,abc,,,,2,csv_invalid_wht,Invalid WHT number in line 2\n", rec.Body.String())
+	})
+}
+
+func TestCalFromUploadCsvHandler_ExportFormulas(t *testing.T) {
+	header := []string{"id", "totalIncome", "=cmd"}
+	rows := []csvRow{
+		{tax: models.Taxes{ID: "=HYPERLINK(\"http://x\")", TotalIncome: money.Baht(500000), Tax: money.Baht(29000),
+			Input: &models.CsvRow{Header: header, Cells: []string{"=HYPERLINK(\"http://x\")", "500000", "@SUM(A1)"}}}},
+		{tax: models.Taxes{ID: "+1", Input: &models.CsvRow{Header: header, Cells: []string{"+1", "-2", "\tx"}}},
+			err: services.ErrCsvIncome.WithArgs(3).AtLine(3)},
+	}
+
+	t.Run("given csv format should defuse cells taken for formulas", func(t *testing.T) {
+		ctx, rec := uploadCsvContext("?format=csv", "id,totalIncome\n")
+
+		err := handlers.NewHandler(&MockTaxService{csvRows: rows}).CalFromUploadCsvHandler(ctx)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "id,totalIncome,'=cmd,tax,taxRefund,taxableIncome,line,errorCode,error\n"+
+			"\"'=HYPERLINK(\"\"http://x\"\")\",500000,'@SUM(A1),29000.00,0.00,0.00,,,\n"+
+			"'+1,'-2,'\tx,,,,3,csv_invalid_income,Invalid income number in line 3\n", rec.Body.String())
+	})
+
+	t.Run("given xlsx format should defuse cells taken for formulas", func(t *testing.T) {
+		ctx, rec := uploadCsvContext("?format=xlsx", "id,totalIncome\n")
 
+		err := handlers.NewHandler(&MockTaxService{csvRows: rows}).CalFromUploadCsvHandler(ctx)
+
+		assert.Nil(t, err)
+		zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+		if assert.Nil(t, err) {
+			f, _ := zr.Open("xl/worksheets/sheet1.xml")
+			sheet, _ := io.ReadAll(f)
+			assert.Contains(t, string(sheet), `>&#39;=HYPERLINK(&#34;http://x&#34;)</t>`)
+			assert.Contains(t, string(sheet), `>&#39;@SUM(A1)</t>`)
+			assert.NotContains(t, string(sheet), `">=`)
+		}
 	})
 }
 
-func (m *MockTaxService) FormFile(key string) (io.ReadCloser, error) {
-	return io.NopCloser(bytes.NewBufferString(m.fileCsv)), nil
+func TestCalFromUploadCsvHandler_InvalidFormat(t *testing.T) {
+	ctx, _ := uploadCsvContext("?format=pdf", "")
+
+	err := handlers.NewHandler(&MockTaxService{}).CalFromUploadCsvHandler(ctx)
+
+	assert.ErrorIs(t, err, services.ErrInvalidField)
+	assert.Equal(t, "format", err.(*services.Error).Field)
+}
+
+func TestCalFromUploadCsvHandler_StrictValid(t *testing.T) {
+	csv := "totalIncome\n500000\n"
+	ctx, rec := uploadCsvContext("?mode=strict", csv)
+	mockService := &MockTaxService{csvRows: []csvRow{{tax: models.Taxes{TotalIncome: money.Baht(500000), Tax: money.Baht(29000)}}}, snapshot: models.ConfigSnapshot{ID: 12}}
+
+	err := handlers.NewHandler(mockService).CalFromUploadCsvHandler(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"taxes": [{"totalIncome": 500000, "tax": 29000, "taxRefund": 0}]}`, rec.Body.String())
+	assert.Equal(t, 2, mockService.csvReads, "File should be checked before it is streamed")
+	assert.Equal(t, csv, mockService.fileCsv, "Second read should start from the beginning")
+	assert.Equal(t, []int64{12, 12}, mockService.csvSnapshots, "Both reads should be under the latest snapshot when the file came")
+}
+
+func TestCalFromUploadCsvHandler_StrictSnapshotError(t *testing.T) {
+	ctx, _ := uploadCsvContext("?mode=strict", "totalIncome\n500000\n")
+	mockService := &MockTaxService{snapshotErr: services.ErrInternal}
+
+	err := handlers.NewHandler(mockService).CalFromUploadCsvHandler(ctx)
+
+	assert.ErrorIs(t, err, services.ErrInternal)
+	assert.Zero(t, mockService.csvReads)
+}
+
+func TestCalFromUploadCsvHandler_ErrorAfterRows(t *testing.T) {
+	ctx, rec := uploadCsvContext("", "totalIncome\n500000\n")
+	mockService := &MockTaxService{
+		csvRows: []csvRow{{tax: models.Taxes{TotalIncome: money.Baht(500000), Tax: money.Baht(29000)}}},
+		csvErr:  services.ErrCsvTooManyRows.WithArgs(1).AtLine(3),
+	}
+
+	err := handlers.NewHandler(mockService).CalFromUploadCsvHandler(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"taxes": [{"totalIncome": 500000, "tax": 29000, "taxRefund": 0}], "errors": [
+		{"code": "csv_too_many_rows", "message": "CSV file should not have more than 1 rows.", "field": "taxFile", "line": 3}]}`, rec.Body.String())
+}
+
+func TestCalFromUploadCsvHandler_TooLarge(t *testing.T) {
+	ctx, _ := uploadCsvContext("", "totalIncome\n"+strings.Repeat("500000\n", 100))
+
+	err := handlers.NewHandler(&MockTaxService{}).WithCsvLimits(256, 0).CalFromUploadCsvHandler(ctx)
+
+	assert.ErrorIs(t, err, services.ErrCsvTooLarge)
+	assert.EqualError(t, err, "Uploaded file should not be larger than 256 bytes.")
+}
+
+func TestCalFromUploadCsvHandler_InvalidMode(t *testing.T) {
+	ctx, _ := uploadCsvContext("?mode=all", "")
+
+	err := handlers.NewHandler(&MockTaxService{}).CalFromUploadCsvHandler(ctx)
+
+	assert.ErrorIs(t, err, services.ErrInvalidField)
 }
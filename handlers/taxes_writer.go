@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/kanawat2566/assessment-tax/xlsx"
+	"github.com/labstack/echo/v4"
+)
+
+// taxesWriter streams the result of a CSV upload to the client row by row, so
+// a large file never has to be held in memory. The status is only sent with
+// the first row written, so an error before then can still get its own.
+type taxesWriter interface {
+	// tax writes the tax of a row.
+	tax(md.Taxes) error
+	// rowError writes the error a row was rejected with. The Taxes of the row
+	// has what is known of it, e.g. its ID and Input.
+	rowError(md.Taxes, *services.Error) error
+	// close finishes the response.
+	close() error
+}
+
+// taxesRow is a row of results: a tax, or the error the row was rejected with.
+type taxesRow struct {
+	tax md.Taxes
+	err *services.Error
+}
+
+// newTaxesWriter returns a writer of format, one of the ct.Format* values,
+// see queryFormat.
+func newTaxesWriter(c echo.Context, format string, status int) taxesWriter {
+	switch format {
+	case ct.FormatNDJSON:
+		return &ndjsonTaxesWriter{c: c, status: status}
+	case ct.FormatCSV:
+		return &tableTaxesWriter{c: c, status: status, contentType: ct.MIMETextCSV + "; charset=UTF-8", filename: "taxes.csv", newTable: newCsvTable}
+	case ct.FormatXLSX:
+		return &tableTaxesWriter{c: c, status: status, contentType: xlsx.MIMEType, filename: "taxes.xlsx", newTable: newXlsxTable}
+	}
+	return &jsonTaxesWriter{c: c, status: status}
+}
+
+// writeTaxes streams the rows yielded by run to the client in format with
+// status 200. An error from run before the first row is returned for
+// ErrorHandler to answer; after that the status is sent, so it is written as a
+// last row error.
+func writeTaxes(c echo.Context, format string, run func(yield func(md.Taxes, *services.Error) error) error) error {
+	w := newTaxesWriter(c, format, http.StatusOK)
+	err := run(func(tax md.Taxes, rowErr *services.Error) error {
+		if rowErr != nil {
+			return w.rowError(tax, rowErr)
+		}
+		return w.tax(tax)
+	})
+	if err != nil {
+		if !c.Response().Committed {
+			return err
+		}
+		status, e := errorResponse(err)
+		if status == http.StatusInternalServerError {
+			c.Logger().Error(err)
+		}
+		if err := w.rowError(md.Taxes{}, e.Localize(requestLanguage(c))); err != nil {
+			return err
+		}
+	}
+	return w.close()
+}
+
+// jsonMaxRowErrors is how many row errors a JSON response lists at most.
+const jsonMaxRowErrors = 1000
+
+// jsonTaxesWriter writes {"taxes": [...], "errors": [...]}. The taxes are
+// streamed; the row errors come after them, so they are kept until close.
+// To keep that bounded, only the first jsonMaxRowErrors are listed and the
+// rest are counted in "errorsOmitted". NDJSON, CSV and XLSX list every row
+// error, in file order.
+type jsonTaxesWriter struct {
+	c       echo.Context
+	status  int
+	enc     *json.Encoder
+	started bool
+	errs    []*services.Error
+	omitted int
+}
+
+func (w *jsonTaxesWriter) start() error {
+	if w.enc != nil {
+		return nil
+	}
+	res := w.c.Response()
+	res.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	res.WriteHeader(w.status)
+	w.enc = json.NewEncoder(res)
+	_, err := res.Write([]byte(`{"taxes":[`))
+	return err
+}
+
+func (w *jsonTaxesWriter) tax(t md.Taxes) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if w.started {
+		if _, err := w.c.Response().Write([]byte(",")); err != nil {
+			return err
+		}
+	}
+	w.started = true
+	return w.enc.Encode(t)
+}
+
+func (w *jsonTaxesWriter) rowError(_ md.Taxes, e *services.Error) error {
+	if len(w.errs) >= jsonMaxRowErrors {
+		w.omitted++
+		return nil
+	}
+	w.errs = append(w.errs, e)
+	return nil
+}
+
+func (w *jsonTaxesWriter) close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	res := w.c.Response()
+	if len(w.errs) == 0 {
+		_, err := res.Write([]byte(`]}`))
+		return err
+	}
+	if _, err := res.Write([]byte(`],"errors":`)); err != nil {
+		return err
+	}
+	if err := w.enc.Encode(w.errs); err != nil {
+		return err
+	}
+	if w.omitted > 0 {
+		_, err := fmt.Fprintf(res, `,"errorsOmitted":%d}`, w.omitted)
+		return err
+	}
+	_, err := res.Write([]byte(`}`))
+	return err
+}
+
+// ndjsonTaxesWriter writes one JSON object per line: a tax, or
+// {"error": {...}} for a row error, in file order.
+type ndjsonTaxesWriter struct {
+	c      echo.Context
+	status int
+	enc    *json.Encoder
+}
+
+type ndjsonRowError struct {
+	Error *services.Error `json:"error"`
+}
+
+func (w *ndjsonTaxesWriter) start() {
+	if w.enc != nil {
+		return
+	}
+	res := w.c.Response()
+	res.Header().Set(echo.HeaderContentType, ct.MIMEApplicationNDJSON)
+	res.WriteHeader(w.status)
+	w.enc = json.NewEncoder(res)
+}
+
+func (w *ndjsonTaxesWriter) tax(t md.Taxes) error {
+	w.start()
+	return w.enc.Encode(t)
+}
+
+func (w *ndjsonTaxesWriter) rowError(_ md.Taxes, e *services.Error) error {
+	w.start()
+	return w.enc.Encode(ndjsonRowError{Error: e})
+}
+
+func (w *ndjsonTaxesWriter) close() error {
+	w.start()
+	return nil
+}
+
+// table is a CSV or XLSX file written row by row.
+type table interface {
+	Write([]xlsx.Cell) error
+	Close() error
+}
+
+type csvTable struct {
+	w *csv.Writer
+}
+
+func newCsvTable(w io.Writer) table {
+	return &csvTable{w: csv.NewWriter(w)}
+}
+
+func (t *csvTable) Write(row []xlsx.Cell) error {
+	record := make([]string, len(row))
+	for i, c := range row {
+		record[i] = c.Value
+	}
+	return t.w.Write(record)
+}
+
+func (t *csvTable) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+func newXlsxTable(w io.Writer) table {
+	return xlsx.NewWriter(w)
+}
+
+// formulaPrefixes are the first characters that make a spreadsheet take a
+// cell for a formula.
+const formulaPrefixes = "=+-@\t\r"
+
+// text returns a text cell of s that a spreadsheet shows as it is. The
+// uploaded cells and the header come from the client, so a cell that would
+// be taken for a formula, e.g. =HYPERLINK(...), gets a leading ' to defuse
+// it, in CSV and XLSX alike.
+func text(s string) xlsx.Cell {
+	if s != "" && strings.ContainsRune(formulaPrefixes, rune(s[0])) {
+		s = "'" + s
+	}
+	return xlsx.Text(s)
+}
+
+// tableTaxesWriter writes a CSV or XLSX file with a row per CSV row, in file
+// order, for spreadsheets to import. When the rows have their Input, each row
+// repeats the uploaded cells followed by tax, taxRefund, taxableIncome and the
+// tax of each level; otherwise a row has id and totalIncome followed by tax
+// and taxRefund. A row error leaves the tax columns empty and fills in the
+// line, errorCode and error columns.
+//
+// The level columns are named after the levels of the first tax, so row
+// errors before it are kept until it comes.
+type tableTaxesWriter struct {
+	c           echo.Context
+	status      int
+	contentType string
+	filename    string
+	newTable    func(io.Writer) table
+
+	t       table
+	input   []string
+	levels  int
+	pending []taxesRow
+}
+
+var (
+	tableTaxesHeader     = []string{"id", "totalIncome"}
+	tableTaxColumns      = []string{"tax", "taxRefund"}
+	tableBreakdownColumn = "taxableIncome"
+	tableErrorColumns    = []string{"line", "errorCode", "error"}
+)
+
+// start sends the status and the header, taking the columns from first.
+func (w *tableTaxesWriter) start(first md.Taxes) error {
+	res := w.c.Response()
+	res.Header().Set(echo.HeaderContentType, w.contentType)
+	res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+w.filename+`"`)
+	res.WriteHeader(w.status)
+	w.t = w.newTable(res)
+
+	header := tableTaxesHeader
+	if first.Input != nil {
+		w.input = first.Input.Header
+		header = w.input
+	}
+	header = append(append([]string(nil), header...), tableTaxColumns...)
+	if w.input != nil {
+		header = append(header, tableBreakdownColumn)
+		for _, l := range first.TaxLevels {
+			header = append(header, l.Level)
+		}
+		w.levels = len(first.TaxLevels)
+	}
+	header = append(header, tableErrorColumns...)
+
+	cells := make([]xlsx.Cell, len(header))
+	for i, h := range header {
+		cells[i] = text(h)
+	}
+	if err := w.t.Write(cells); err != nil {
+		return err
+	}
+
+	pending := w.pending
+	w.pending = nil
+	for _, r := range pending {
+		if err := w.t.Write(w.row(r.tax, r.err)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// row returns the cells of a tax, or of a row error when e is set.
+func (w *tableTaxesWriter) row(t md.Taxes, e *services.Error) []xlsx.Cell {
+	var cells []xlsx.Cell
+	if w.input != nil {
+		cells = make([]xlsx.Cell, len(w.input))
+		if t.Input != nil {
+			for i := range cells {
+				if i < len(t.Input.Cells) {
+					cells[i] = text(t.Input.Cells[i])
+				}
+			}
+		}
+	} else {
+		cells = []xlsx.Cell{text(t.ID), xlsx.Number("")}
+		if e == nil {
+			cells[1] = xlsx.Number(t.TotalIncome.String())
+		}
+	}
+
+	amounts := len(tableTaxColumns)
+	if w.input != nil {
+		amounts += 1 + w.levels
+	}
+	if e != nil {
+		cells = append(cells, make([]xlsx.Cell, amounts)...)
+		line := xlsx.Number("")
+		if e.Line > 0 {
+			line = xlsx.Number(strconv.Itoa(e.Line))
+		}
+		return append(cells, line, text(e.Code), text(e.Message))
+	}
+
+	cells = append(cells, xlsx.Number(t.Tax.String()), xlsx.Number(t.TaxRefund.String()))
+	if w.input != nil {
+		cells = append(cells, xlsx.Number(t.TaxableIncome.String()))
+		for i := 0; i < w.levels; i++ {
+			cell := xlsx.Number("")
+			if i < len(t.TaxLevels) {
+				cell = xlsx.Number(t.TaxLevels[i].Tax.String())
+			}
+			cells = append(cells, cell)
+		}
+	}
+	return append(cells, make([]xlsx.Cell, len(tableErrorColumns))...)
+}
+
+func (w *tableTaxesWriter) tax(t md.Taxes) error {
+	if w.t == nil {
+		if err := w.start(t); err != nil {
+			return err
+		}
+	}
+	return w.t.Write(w.row(t, nil))
+}
+
+func (w *tableTaxesWriter) rowError(t md.Taxes, e *services.Error) error {
+	if w.t == nil {
+		if t.Input != nil {
+			w.pending = append(w.pending, taxesRow{tax: t, err: e})
+			return nil
+		}
+		if err := w.start(t); err != nil {
+			return err
+		}
+	}
+	return w.t.Write(w.row(t, e))
+}
+
+func (w *tableTaxesWriter) close() error {
+	if w.t == nil {
+		var first md.Taxes
+		if len(w.pending) > 0 {
+			first = w.pending[0].tax
+		}
+		if err := w.start(first); err != nil {
+			return err
+		}
+	}
+	return w.t.Close()
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type userHandler struct {
+	serv services.UserService
+}
+
+func NewUserHandler(s services.UserService) *userHandler {
+	return &userHandler{serv: s}
+}
+
+// BasicAuth lets in requests signed in as an enabled admin user and stores
+// the username under ct.ContextUser and the roles under ct.ContextRoles.
+func BasicAuth(s services.UserService) echo.MiddlewareFunc {
+	return middleware.BasicAuth(func(username, password string, c echo.Context) (bool, error) {
+		u, err := s.Authenticate(username, password)
+		if err != nil || u == nil {
+			return false, err
+		}
+		c.Set(ct.ContextUser, u.Username)
+		c.Set(ct.ContextRoles, u.Roles)
+		return true, nil
+	})
+}
+
+// RequireRole lets in users signed in with any of roles and refuses everyone
+// else with services.ErrForbidden. It goes after BasicAuth.
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			has, _ := c.Get(ct.ContextRoles).([]string)
+			for _, r := range has {
+				if slices.Contains(roles, r) {
+					return next(c)
+				}
+			}
+			return services.ErrForbidden
+		}
+	}
+}
+
+func (h *userHandler) ListAdminUsers(c echo.Context) error {
+	res, err := h.serv.ListAdminUsers()
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *userHandler) CreateAdminUser(c echo.Context) error {
+	rq := new(md.AdminUserRequest)
+	if err := BindWithValidate(c, rq); err != nil {
+		return err
+	}
+
+	res, err := h.serv.CreateAdminUser(*rq, actor(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, res)
+}
+
+func (h *userHandler) UpdateAdminUser(c echo.Context) error {
+	rq := new(md.AdminUserUpdate)
+	if err := BindWithValidate(c, rq); err != nil {
+		return err
+	}
+
+	res, err := h.serv.UpdateAdminUser(c.Param("username"), *rq, actor(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *userHandler) DeleteAdminUser(c echo.Context) error {
+	if err := h.serv.DeleteAdminUser(c.Param("username"), actor(c)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
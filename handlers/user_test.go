@@ -0,0 +1,184 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/handlers"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockUserService struct {
+	user    models.AdminUser
+	err     error
+	request models.AdminUserRequest
+	update  models.AdminUserUpdate
+	actor   ct.Actor
+}
+
+func (m *MockUserService) Authenticate(username, password string) (*models.AdminUser, error) {
+	if username != "adminTax" || password != "correct-horse-battery" {
+		return nil, m.err
+	}
+	return &models.AdminUser{Username: username, Roles: []string{ct.RoleViewer}}, m.err
+}
+
+func (m *MockUserService) BootstrapAdmin(username, password string) (bool, error) {
+	return false, m.err
+}
+
+func (m *MockUserService) ListAdminUsers() (models.AdminUsersResponse, error) {
+	return models.AdminUsersResponse{Users: []models.AdminUser{m.user}}, m.err
+}
+
+func (m *MockUserService) CreateAdminUser(rq models.AdminUserRequest, by ct.Actor) (models.AdminUser, error) {
+	m.request, m.actor = rq, by
+	return m.user, m.err
+}
+
+func (m *MockUserService) UpdateAdminUser(username string, u models.AdminUserUpdate, by ct.Actor) (models.AdminUser, error) {
+	m.update, m.actor = u, by
+	return m.user, m.err
+}
+
+func (m *MockUserService) DeleteAdminUser(username string, by ct.Actor) error {
+	m.actor = by
+	return m.err
+}
+
+func TestBasicAuth(t *testing.T) {
+	cases := []struct {
+		name     string
+		username string
+		password string
+		expected int
+	}{
+		{name: "given right credentials should let in", username: "adminTax", password: "correct-horse-battery", expected: http.StatusOK},
+		{name: "given wrong password should refuse", username: "adminTax", password: "wrong-horse-battery", expected: http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			e.GET("/admin", func(c echo.Context) error {
+				return c.String(http.StatusOK, c.Get(ct.ContextUser).(string))
+			}, handlers.BasicAuth(&MockUserService{}), handlers.RequireRole(ct.RoleViewer))
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.SetBasicAuth(tc.username, tc.password)
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expected, rec.Code)
+			if tc.expected == http.StatusOK {
+				assert.Equal(t, tc.username, rec.Body.String(), "The signed in user should be stored for the handler")
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	cases := []struct {
+		name     string
+		roles    interface{}
+		expected error
+	}{
+		{name: "given any of the roles should let in", roles: []string{ct.RoleViewer, ct.RoleAuditor}},
+		{name: "given none of the roles should refuse", roles: []string{ct.RoleViewer}, expected: services.ErrForbidden},
+		{name: "given no roles should refuse", roles: nil, expected: services.ErrForbidden},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(httptest.NewRequest(http.MethodGet, "/admin/audit", nil), rec)
+			ctx.Set(ct.ContextRoles, tc.roles)
+			next := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+
+			err := handlers.RequireRole(ct.RoleAuditor, ct.RoleUserAdmin)(next)(ctx)
+
+			if tc.expected != nil {
+				assert.ErrorIs(t, err, tc.expected)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+		})
+	}
+}
+
+func TestCreateAdminUser(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/admin/users", strings.NewReader(`{"username": "support", "password": "s3cret-passphrase"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.Set(ct.ContextUser, "adminTax")
+	mockService := &MockUserService{user: models.AdminUser{Username: "support"}}
+
+	err := handlers.NewUserHandler(mockService).CreateAdminUser(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, models.AdminUserRequest{Username: "support", Password: "s3cret-passphrase"}, mockService.request)
+	assert.Equal(t, ct.Actor{User: "adminTax", RequestID: "req-1"}, mockService.actor)
+	assert.NotContains(t, rec.Body.String(), "s3cret-passphrase", "The password should never be sent back")
+}
+
+func TestUpdateAdminUser(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/admin/users/support", strings.NewReader(`{"disabled": true}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	ctx := e.NewContext(req, rec)
+	ctx.SetPath("/admin/users/:username")
+	ctx.SetParamNames("username")
+	ctx.SetParamValues("support")
+	mockService := &MockUserService{user: models.AdminUser{Username: "support", Disabled: true}}
+
+	err := handlers.NewUserHandler(mockService).UpdateAdminUser(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, mockService.update.Password, "A password left out should be kept")
+	assert.True(t, *mockService.update.Disabled)
+}
+
+func TestDeleteAdminUser(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "given other user should delete it", expected: http.StatusNoContent},
+		{name: "given own account should fail", err: services.ErrAdminUserSelf},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodDelete, "/admin/users/support", nil)
+			rec := httptest.NewRecorder()
+			ctx := e.NewContext(req, rec)
+			ctx.SetParamNames("username")
+			ctx.SetParamValues("support")
+
+			err := handlers.NewUserHandler(&MockUserService{err: tc.err}).DeleteAdminUser(ctx)
+
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, rec.Code)
+		})
+	}
+}
@@ -1,44 +1,115 @@
 package handlers
 
 import (
-	"errors"
-	"fmt"
+	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/go-playground/validator"
+	cm "github.com/kanawat2566/assessment-tax/common"
 	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/kanawat2566/assessment-tax/xlsx"
 	"github.com/labstack/echo/v4"
+	"golang.org/x/text/language"
 )
 
 func validateInput(input interface{}) error {
 
 	validate := validator.New()
-	var msgs []string
 
 	err := validate.Struct(input)
 	if err != nil {
 
-		if validationErrs, ok := err.(validator.ValidationErrors); ok {
-			for _, e := range validationErrs {
-
-				fieldName := e.Field()
-				tagValue := e.Tag()
-				message := fmt.Sprintf("Field '%s' failed validation for '%s'", fieldName, tagValue)
-				msgs = append(msgs, message)
-			}
-			return errors.New(strings.Join(msgs, ",\n"))
+		if validationErrs, ok := err.(validator.ValidationErrors); ok && len(validationErrs) > 0 {
+			e := validationErrs[0]
+			fieldName := jsonFieldName(input, e.StructField())
+			return services.ErrInvalidField.
+				WithMessage(ct.ErrMsgFieldValidation, fieldName, e.Tag()).
+				WithField(fieldName)
 		}
 	}
 	return nil
 }
 
+// jsonFieldName returns the JSON name of the struct field of input, so an
+// error names the field the way the client sent it.
+func jsonFieldName(input interface{}, field string) string {
+	t := reflect.TypeOf(input)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if f, ok := t.FieldByName(field); ok {
+		if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" {
+			return name
+		}
+	}
+	return field
+}
+
 func BindWithValidate(c echo.Context, rq interface{}) error {
 
 	if err := c.Bind(rq); err != nil {
-		return errors.New(ct.ErrInvalidFormatReq)
+		return services.ErrInvalidRequest
 	}
 	if err := validateInput(rq); err != nil {
 		return err
 	}
 	return nil
 }
+
+// queryTaxYear reads the optional taxYear query parameter; zero means the
+// current tax year.
+func queryTaxYear(c echo.Context) (int, error) {
+	y := c.QueryParam("taxYear")
+	if y == "" {
+		return 0, nil
+	}
+	taxYear, err := strconv.Atoi(y)
+	if err != nil {
+		return 0, services.ErrInvalidField.WithMessage(ct.ErrMsgTaxYearInvalid).WithField("taxYear")
+	}
+	return taxYear, nil
+}
+
+// queryCsvMode reads the optional mode query parameter of a CSV upload and
+// reports whether it is strict. Lenient is the default.
+func queryCsvMode(c echo.Context) (bool, error) {
+	switch c.QueryParam("mode") {
+	case "", ct.CsvModeLenient:
+		return false, nil
+	case ct.CsvModeStrict:
+		return true, nil
+	}
+	return false, services.ErrInvalidField.WithMessage(ct.ErrMsgCsvMode).WithField("mode")
+}
+
+// queryFormat reads the format of bulk calculation results from the optional
+// format query parameter, or else from the Accept header: NDJSON, CSV or XLSX
+// when asked for, JSON otherwise.
+func queryFormat(c echo.Context) (string, error) {
+	switch f := c.QueryParam("format"); f {
+	case ct.FormatJSON, ct.FormatNDJSON, ct.FormatCSV, ct.FormatXLSX:
+		return f, nil
+	case "":
+	default:
+		return "", services.ErrInvalidField.WithMessage(ct.ErrMsgFormat).WithField("format")
+	}
+
+	accept := c.Request().Header.Get(echo.HeaderAccept)
+	switch {
+	case strings.Contains(accept, ct.MIMEApplicationNDJSON):
+		return ct.FormatNDJSON, nil
+	case strings.Contains(accept, ct.MIMETextCSV):
+		return ct.FormatCSV, nil
+	case strings.Contains(accept, xlsx.MIMEType):
+		return ct.FormatXLSX, nil
+	}
+	return ct.FormatJSON, nil
+}
+
+// requestLanguage is the language asked for by the Accept-Language header, or
+// language.Und when the client sent none.
+func requestLanguage(c echo.Context) language.Tag {
+	return cm.MatchLanguage(c.Request().Header.Get("Accept-Language"))
+}
@@ -0,0 +1,217 @@
+// Package jwt verifies JSON Web Tokens signed with HS256 or RS256 against a
+// local JSON Web Key Set. Only what service callers need is supported:
+// compact signed tokens carrying the registered claims and a scope.
+package jwt
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed  = errors.New("jwt: malformed token")
+	ErrUnknownKey = errors.New("jwt: unknown key")
+	ErrAlgorithm  = errors.New("jwt: algorithm does not match the key")
+	ErrSignature  = errors.New("jwt: invalid signature")
+	ErrExpired    = errors.New("jwt: token expired or not valid yet")
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+// Audience is the aud claim, which is either one string or an array of them.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = Audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// Claims are the claims of a token. Times are seconds since the epoch; a zero
+// NotBefore is no lower bound. Scope holds scopes separated by spaces.
+type Claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  Audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	IssuedAt  int64    `json:"iat"`
+	Scope     string   `json:"scope"`
+}
+
+// Scopes returns the scopes of the scope claim.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// key is a verification key of the set.
+type key struct {
+	alg    string
+	secret []byte
+	public *rsa.PublicKey
+}
+
+// KeySet holds verification keys by key id. A token names its key in the kid
+// header, so a caller whose key is removed from the set can no longer sign in.
+type KeySet struct {
+	keys map[string]key
+}
+
+// jwk is a JSON Web Key. Only the members of oct and RSA keys are read.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// LoadJWKS reads a key set from a JWKS file.
+func LoadJWKS(path string) (*KeySet, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(b)
+}
+
+// ParseJWKS reads a key set from JWKS JSON. oct keys verify HS256 and RSA
+// keys RS256; every key needs a kid.
+func ParseJWKS(b []byte) (*KeySet, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("jwt: invalid key set: %w", err)
+	}
+
+	ks := &KeySet{keys: make(map[string]key, len(set.Keys))}
+	for _, k := range set.Keys {
+		if k.Kid == "" {
+			return nil, errors.New("jwt: key without kid")
+		}
+		if _, ok := ks.keys[k.Kid]; ok {
+			return nil, fmt.Errorf("jwt: duplicate key %q", k.Kid)
+		}
+		parsed, err := parseKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: key %q: %w", k.Kid, err)
+		}
+		ks.keys[k.Kid] = parsed
+	}
+	return ks, nil
+}
+
+func parseKey(k jwk) (key, error) {
+	switch k.Kty {
+	case "oct":
+		if k.Alg != "" && k.Alg != HS256 {
+			return key{}, fmt.Errorf("unsupported alg %q", k.Alg)
+		}
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) < sha256.Size {
+			return key{}, errors.New("k should be at least 32 bytes of base64url")
+		}
+		return key{alg: HS256, secret: secret}, nil
+	case "RSA":
+		if k.Alg != "" && k.Alg != RS256 {
+			return key{}, fmt.Errorf("unsupported alg %q", k.Alg)
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil || len(n) == 0 {
+			return key{}, errors.New("invalid n")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return key{}, errors.New("invalid e")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < 2048 {
+			return key{}, errors.New("RSA keys should be at least 2048 bits")
+		}
+		return key{alg: RS256, public: pub}, nil
+	default:
+		return key{}, fmt.Errorf("unsupported kty %q", k.Kty)
+	}
+}
+
+// Verify checks the signature and the validity period of token at now and
+// returns its claims. Issuer and audience are left to the caller.
+func (ks *KeySet) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodePart(parts[0], &header); err != nil {
+		return nil, ErrMalformed
+	}
+	k, ok := ks.keys[header.Kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	// the key, not the token, decides the algorithm
+	if header.Alg != k.alg {
+		return nil, ErrAlgorithm
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if !k.verify([]byte(parts[0]+"."+parts[1]), sig) {
+		return nil, ErrSignature
+	}
+
+	var c Claims
+	if err := decodePart(parts[1], &c); err != nil {
+		return nil, ErrMalformed
+	}
+	if c.ExpiresAt == 0 || now.Unix() >= c.ExpiresAt || now.Unix() < c.NotBefore {
+		return nil, ErrExpired
+	}
+	return &c, nil
+}
+
+func (k key) verify(signed, sig []byte) bool {
+	if k.alg == HS256 {
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), sig)
+	}
+	sum := sha256.Sum256(signed)
+	return rsa.VerifyPKCS1v15(k.public, crypto.SHA256, sum[:], sig) == nil
+}
+
+func decodePart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,117 @@
+package jwt_test
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/kanawat2566/assessment-tax/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_now    = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	_secret = []byte("0123456789abcdef0123456789abcdef")
+	b64     = base64.RawURLEncoding.EncodeToString
+)
+
+// sign returns a token of claims with the given header, signed by sig.
+func sign(header, claims interface{}, sig func(signed []byte) []byte) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := b64(h) + "." + b64(c)
+	return signed + "." + b64(sig([]byte(signed)))
+}
+
+func hs256(secret []byte) func([]byte) []byte {
+	return func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+}
+
+func rs256(k *rsa.PrivateKey) func([]byte) []byte {
+	return func(signed []byte) []byte {
+		sum := sha256.Sum256(signed)
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+		return sig
+	}
+}
+
+func keySet(t *testing.T, rsaKey *rsa.PrivateKey) *jwt.KeySet {
+	ks, err := jwt.ParseJWKS([]byte(fmt.Sprintf(`{"keys": [
+		{"kty": "oct", "kid": "payroll", "alg": "HS256", "k": %q},
+		{"kty": "RSA", "kid": "mobile", "n": %q, "e": %q}
+	]}`, b64(_secret), b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()))))
+	assert.Nil(t, err)
+	return ks
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	ks := keySet(t, rsaKey)
+	claims := map[string]interface{}{"sub": "payroll", "aud": "assessment-tax", "exp": _now.Add(time.Minute).Unix(), "scope": "calculate bulk-upload"}
+
+	cases := []struct {
+		name     string
+		token    string
+		expected error
+	}{
+		{name: "given HS256 token should verify", token: sign(map[string]string{"alg": "HS256", "kid": "payroll"}, claims, hs256(_secret))},
+		{name: "given RS256 token should verify", token: sign(map[string]string{"alg": "RS256", "kid": "mobile"}, claims, rs256(rsaKey))},
+		{name: "given wrong secret should fail", token: sign(map[string]string{"alg": "HS256", "kid": "payroll"}, claims, hs256([]byte("another secret of thirty two bytes"))), expected: jwt.ErrSignature},
+		{name: "given unknown kid should fail", token: sign(map[string]string{"alg": "HS256", "kid": "revoked"}, claims, hs256(_secret)), expected: jwt.ErrUnknownKey},
+		{name: "given HS256 on an RSA key should fail", token: sign(map[string]string{"alg": "HS256", "kid": "mobile"}, claims, hs256(rsaKey.N.Bytes())), expected: jwt.ErrAlgorithm},
+		{name: "given alg none should fail", token: sign(map[string]string{"alg": "none", "kid": "payroll"}, claims, func([]byte) []byte { return nil }), expected: jwt.ErrAlgorithm},
+		{name: "given expired token should fail", token: sign(map[string]string{"alg": "HS256", "kid": "payroll"}, map[string]interface{}{"sub": "payroll", "exp": _now.Unix()}, hs256(_secret)), expected: jwt.ErrExpired},
+		{name: "given token without exp should fail", token: sign(map[string]string{"alg": "HS256", "kid": "payroll"}, map[string]interface{}{"sub": "payroll"}, hs256(_secret)), expected: jwt.ErrExpired},
+		{name: "given token not valid yet should fail", token: sign(map[string]string{"alg": "HS256", "kid": "payroll"}, map[string]interface{}{"sub": "payroll", "nbf": _now.Add(time.Minute).Unix(), "exp": _now.Add(time.Hour).Unix()}, hs256(_secret)), expected: jwt.ErrExpired},
+		{name: "given malformed token should fail", token: "not.a-token", expected: jwt.ErrMalformed},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := ks.Verify(tc.token, _now)
+
+			if tc.expected != nil {
+				assert.ErrorIs(t, err, tc.expected)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "payroll", c.Subject)
+			assert.Equal(t, jwt.Audience{"assessment-tax"}, c.Audience)
+			assert.Equal(t, []string{"calculate", "bulk-upload"}, c.Scopes())
+		})
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	cases := []struct {
+		name string
+		jwks string
+	}{
+		{name: "given key without kid should fail", jwks: `{"keys": [{"kty": "oct", "k": "` + b64(_secret) + `"}]}`},
+		{name: "given short secret should fail", jwks: `{"keys": [{"kty": "oct", "kid": "a", "k": "c2hvcnQ"}]}`},
+		{name: "given duplicate kid should fail", jwks: `{"keys": [{"kty": "oct", "kid": "a", "k": "` + b64(_secret) + `"}, {"kty": "oct", "kid": "a", "k": "` + b64(_secret) + `"}]}`},
+		{name: "given unsupported key type should fail", jwks: `{"keys": [{"kty": "EC", "kid": "a"}]}`},
+		{name: "given invalid JSON should fail", jwks: `{"keys":`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := jwt.ParseJWKS([]byte(tc.jwks))
+
+			assert.NotNil(t, err)
+		})
+	}
+}
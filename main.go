@@ -3,15 +3,18 @@ package main
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
-	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/kanawat2566/assessment-tax/config"
 	"github.com/kanawat2566/assessment-tax/constants"
 	"github.com/kanawat2566/assessment-tax/handlers"
+	"github.com/kanawat2566/assessment-tax/jwt"
+	"github.com/kanawat2566/assessment-tax/migrations"
 	"github.com/kanawat2566/assessment-tax/repository"
 	"github.com/kanawat2566/assessment-tax/services"
 	"github.com/labstack/echo/v4"
@@ -19,35 +22,160 @@ import (
 )
 
 func main() {
-	db, err := repository.InitDB()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := repository.InitDB(cfg.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(os.Args) > 1 {
+		if os.Args[1] != "migrate" {
+			log.Fatalf("unknown command %q, %s", os.Args[1], migrateUsage)
+		}
+		if err := migrate(db, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if cfg.Database.MigrateOnStart {
+		m, err := migrations.New(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := migrateUp(context.Background(), m); err != nil {
+			log.Fatal(err)
+		}
+	}
+	pg := repository.New(db)
+	p := repository.NewConfigCache(pg)
+
+	listener, err := repository.ListenConfigChanges(cfg.Database.URL, p.Invalidate)
 	if err != nil {
 		panic(err)
 	}
-	p := repository.New(db)
+	defer listener.Close()
 
 	e := echo.New()
+	e.HTTPErrorHandler = handlers.ErrorHandler
+	e.Use(middleware.RequestID())
+	// rate limits go by client IP, so only trust X-Forwarded-For from private networks
+	e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	e.Server.ReadTimeout = cfg.Server.ReadTimeout
+	e.Server.WriteTimeout = cfg.Server.WriteTimeout
 	// e.Validator = &handlers.CustomValidator{Validator: validator.New()}
 
-	serv := services.NewServices(p)
-	taxHandler := handlers.NewHandler(serv)
+	serv := services.NewServices(p).WithHistory(pg)
+	taxHandler := handlers.NewHandler(serv).WithCsvLimits(cfg.Upload.MaxBytes, cfg.Upload.MaxRows)
+
+	jobs := services.NewJobService(pg, serv, cfg.Jobs.Workers, cfg.Upload.MaxRows)
+	jobHandler := handlers.NewJobHandler(jobs).WithMaxUpload(cfg.Upload.MaxBytes)
+	jobs.Start()
+
+	calculationHandler := handlers.NewCalculationHandler(services.NewCalculationService(pg))
+	auditHandler := handlers.NewAuditHandler(services.NewAuditService(pg))
+
+	users := services.NewUserService(pg)
+	bootstrapAdmin(users, cfg.Auth)
+	userHandler := handlers.NewUserHandler(users)
+
+	clients := services.NewClientService(pg)
+	if cfg.Auth.JWKSFile != "" {
+		keys, err := jwt.LoadJWKS(cfg.Auth.JWKSFile)
+		if err != nil {
+			panic(err)
+		}
+		clients.WithJWT(keys, cfg.Auth.JWTIssuer, cfg.Auth.JWTAudience)
+	}
+	clientHandler := handlers.NewClientHandler(clients)
+	// until auth.clientAuthRequired is set, callers without credentials still get in
+	clientAuth := handlers.ClientAuth(clients, !cfg.Auth.ClientAuthRequired)
+
+	adminAuth := handlers.AdminAuth(users, clients)
 
-	e.GET("/", func(c echo.Context) error {
-		return c.String(http.StatusOK, "Hello, Go Bootcamp!")
-	})
+	limits := map[string]repository.RateLimit{}
+	for class, l := range map[string]config.Limit{
+		constants.RateLimitCalculate:    cfg.RateLimit.Calculate,
+		constants.RateLimitBulk:         cfg.RateLimit.Bulk,
+		constants.RateLimitAdmin:        cfg.RateLimit.Admin,
+		constants.RateLimitAuthFailures: cfg.RateLimit.AuthFailures,
+	} {
+		if l.Requests > 0 {
+			limits[class] = repository.RateLimit(l)
+		}
+	}
+	quotas := map[string]repository.RateLimit{}
+	for class, q := range map[string]config.Limit{
+		constants.RateLimitCalculate: cfg.RateLimit.CalculateQuota,
+		constants.RateLimitBulk:      cfg.RateLimit.BulkQuota,
+	} {
+		if q.Requests > 0 {
+			quotas[class] = repository.RateLimit(q)
+		}
+	}
+	var store repository.RateLimitStore = repository.NewMemoryRateLimits()
+	if cfg.RateLimit.Store == config.StorePostgres {
+		store = pg
+	}
+	rateLimits := services.NewRateLimitService(store, limits, quotas)
+	// ahead of the authentication of every route, so that failed sign-ins count
+	e.Use(handlers.LimitAuthFailures(rateLimits))
+	rateLimit := handlers.RateLimit(rateLimits)
+	limitCalculate := rateLimit(constants.RateLimitCalculate)
+	limitBulk := rateLimit(constants.RateLimitBulk)
+	limitAdmin := rateLimit(constants.RateLimitAdmin)
+	canRead := handlers.RequireRole(constants.RoleViewer, constants.RoleConfigEditor, constants.RoleBracketAdmin)
+	canEditConfig := handlers.RequireRole(constants.RoleConfigEditor)
+	canEditBrackets := handlers.RequireRole(constants.RoleBracketAdmin)
+	canAudit := handlers.RequireRole(constants.RoleAuditor)
+	// auditors read the snapshots the calculations they review were pinned to
+	canReadSnapshots := handlers.RequireRole(constants.RoleViewer, constants.RoleConfigEditor, constants.RoleBracketAdmin, constants.RoleAuditor)
+	canManageUsers := handlers.RequireRole(constants.RoleUserAdmin)
 
-	e.POST("/tax/calculations", taxHandler.CalculationsHandler)
-	e.POST("/tax/calculations/:uploadType", taxHandler.CalFromUploadCsvHandler)
-	e.POST("/admin/deductions/:type", taxHandler.Deductions, BasicAuthMiddleware)
+	// probes are not authenticated or rate limited
+	healthHandler := handlers.NewHealthHandler(services.NewHealthService(pg, p))
+	e.GET("/healthz", healthHandler.Healthz)
+	e.GET("/readyz", healthHandler.Readyz)
 
-	serverInit(e)
+	e.POST("/tax/calculations", taxHandler.CalculationsHandler, clientAuth(constants.ScopeCalculate), limitCalculate)
+	e.POST("/tax/calculations/:uploadType", taxHandler.CalFromUploadCsvHandler, clientAuth(constants.ScopeBulkUpload), limitBulk)
+	e.POST("/tax/jobs", jobHandler.SubmitTaxJob, clientAuth(constants.ScopeBulkUpload), limitBulk)
+	// polling a job is cheap, so it does not use up the bulk limit
+	e.GET("/tax/jobs/:id", jobHandler.GetTaxJob, clientAuth(constants.ScopeBulkUpload), limitCalculate)
+	e.GET("/tax/jobs/:id/results", jobHandler.TaxJobResults, clientAuth(constants.ScopeBulkUpload), limitCalculate)
+	e.POST("/admin/deductions/:type", taxHandler.Deductions, adminAuth, limitAdmin, canEditConfig)
+	e.GET("/admin/allowances", taxHandler.ListAllowances, adminAuth, limitAdmin, canRead)
+	e.POST("/admin/allowances", taxHandler.CreateAllowance, adminAuth, limitAdmin, canEditConfig)
+	e.GET("/admin/tax-rates", taxHandler.ListTaxRates, adminAuth, limitAdmin, canRead)
+	e.POST("/admin/tax-rates", taxHandler.CreateTaxRate, adminAuth, limitAdmin, canEditBrackets)
+	e.PUT("/admin/tax-rates/:id", taxHandler.UpdateTaxRate, adminAuth, limitAdmin, canEditBrackets)
+	e.DELETE("/admin/tax-rates/:id", taxHandler.DeleteTaxRate, adminAuth, limitAdmin, canEditBrackets)
+	e.GET("/admin/calculations", calculationHandler.ListCalculations, adminAuth, limitAdmin, canAudit)
+	e.GET("/admin/calculations/:id", calculationHandler.GetCalculation, adminAuth, limitAdmin, canAudit)
+	e.GET("/admin/config-snapshots/:id", taxHandler.GetConfigSnapshot, adminAuth, limitAdmin, canReadSnapshots)
+	e.GET("/admin/audit", auditHandler.ListAuditEntries, adminAuth, limitAdmin, canAudit)
+	e.GET("/admin/users", userHandler.ListAdminUsers, adminAuth, limitAdmin, canManageUsers)
+	e.POST("/admin/users", userHandler.CreateAdminUser, adminAuth, limitAdmin, canManageUsers)
+	e.PUT("/admin/users/:username", userHandler.UpdateAdminUser, adminAuth, limitAdmin, canManageUsers)
+	e.DELETE("/admin/users/:username", userHandler.DeleteAdminUser, adminAuth, limitAdmin, canManageUsers)
+	e.GET("/admin/api-keys", clientHandler.ListAPIKeys, adminAuth, limitAdmin, canManageUsers)
+	e.POST("/admin/api-keys", clientHandler.CreateAPIKey, adminAuth, limitAdmin, canManageUsers)
+	e.DELETE("/admin/api-keys/:id", clientHandler.RevokeAPIKey, adminAuth, limitAdmin, canManageUsers)
+
+	serverInit(e, jobs, cfg)
 }
 
-func serverInit(e *echo.Echo) {
-	godotenv.Load(".env")
-	port := os.Getenv("PORT")
+// drainer is something with work in flight to finish on shutdown.
+type drainer interface {
+	Shutdown(ctx context.Context) error
+}
 
+func serverInit(e *echo.Echo, jobs drainer, cfg config.Config) {
 	go func() {
-		if err := e.Start(":" + port); err != nil && err != http.ErrServerClosed {
+		if err := e.Start(":" + strconv.Itoa(cfg.Server.Port)); err != nil && err != http.ErrServerClosed {
 			e.Logger.Fatal(err)
 		}
 	}()
@@ -56,20 +184,45 @@ func serverInit(e *echo.Echo) {
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
 	<-shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := e.Shutdown(ctx); err != nil {
 		e.Logger.Errorf("error when closing server %v", err)
 	}
 
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Jobs.DrainTimeout)
+	defer cancelDrain()
+	if err := jobs.Shutdown(drainCtx); err != nil {
+		e.Logger.Errorf("tax jobs still running were queued again: %v", err)
+	}
+
 	e.Logger.Info("shutting down the server")
 	fmt.Println("shutting down the server")
 }
 
-var BasicAuthMiddleware = middleware.BasicAuth(func(username, password string, c echo.Context) (bool, error) {
-	if username == constants.UserAuth && password == constants.PassAuth {
-		return true, nil
+// bootstrapAdmin creates the first admin user from auth.adminUsername and
+// auth.adminPassword when there is no admin user yet. Once there is one,
+// further users are managed through /admin/users and the settings are
+// ignored, so a stale password does not keep the service from starting.
+// Without any admin user and without the settings to create one the service
+// refuses to start, as there is no default password to fall back on.
+func bootstrapAdmin(users services.UserService, cfg config.Auth) {
+	res, err := users.ListAdminUsers()
+	if err != nil {
+		log.Fatalf("cannot list admin users: %v", err)
+	}
+	if len(res.Users) > 0 {
+		return
+	}
+	if cfg.AdminUsername == "" || cfg.AdminPassword == "" {
+		log.Fatal("there is no admin user yet: set ADMIN_USERNAME and ADMIN_PASSWORD to create the first one")
 	}
-	return false, nil
-})
+	created, err := users.BootstrapAdmin(cfg.AdminUsername, cfg.AdminPassword)
+	if err != nil {
+		log.Fatalf("cannot create the first admin user: %v", err)
+	}
+	if created {
+		log.Printf("created the first admin user %q", cfg.AdminUsername)
+	}
+}
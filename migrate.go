@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kanawat2566/assessment-tax/migrations"
+)
+
+const migrateUsage = "usage: app migrate up | down [steps] | status"
+
+// migrate runs the migrate command: up applies every pending migration, down
+// reverts the latest steps, one unless given, and status lists them all.
+func migrate(db *sql.DB, args []string) error {
+	m, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	switch args[0] {
+	case "up":
+		return migrateUp(ctx, m)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return errors.New(migrateUsage)
+			}
+		}
+		done, err := m.Down(ctx, steps)
+		for _, mg := range done {
+			log.Printf("reverted migration %d_%s", mg.Version, mg.Name)
+		}
+		return err
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	}
+	return errors.New(migrateUsage)
+}
+
+// migrateUp applies every pending migration and logs each one.
+func migrateUp(ctx context.Context, m *migrations.Migrator) error {
+	done, err := m.Up(ctx)
+	for _, mg := range done {
+		log.Printf("applied migration %d_%s", mg.Version, mg.Name)
+	}
+	return err
+}
@@ -0,0 +1,15 @@
+-- Drops the whole schema, data included.
+
+DROP TABLE IF EXISTS rate_limit_buckets;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS admin_users;
+DROP TABLE IF EXISTS audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only();
+DROP TABLE IF EXISTS tax_calculations;
+DROP TABLE IF EXISTS tax_job_rows;
+DROP TABLE IF EXISTS tax_job_files;
+DROP TABLE IF EXISTS tax_jobs;
+DROP TABLE IF EXISTS config_snapshots;
+DROP TABLE IF EXISTS allowance_groups;
+DROP TABLE IF EXISTS allowances;
+DROP TABLE IF EXISTS income_tax_rates;
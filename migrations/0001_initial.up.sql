@@ -0,0 +1,298 @@
+-- The schema as it was kept in init.sql before migrations. It only creates
+-- what is missing and seeds what is missing, so it also adopts a database
+-- that init.sql created:
+--   - the original init.sql made income_tax_rates and allowances without tax
+--     years, allowance settings or an open-ended top bracket; those tables are
+--     upgraded in place below and their rows take effect from 2017;
+--   - any other existing table must already have every column below, or the
+--     migration fails and nothing is recorded as applied.
+
+DO $$
+BEGIN
+	IF to_regclass('income_tax_rates') IS NOT NULL AND NOT EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'income_tax_rates' AND column_name = 'tax_year'
+	) THEN
+		ALTER TABLE income_tax_rates ADD COLUMN tax_year INT NOT NULL DEFAULT 2017;
+		ALTER TABLE income_tax_rates ALTER COLUMN tax_year DROP DEFAULT;
+		ALTER TABLE income_tax_rates ALTER COLUMN max_income DROP NOT NULL;
+		-- the top bracket was closed with a huge maximum and started 1 satang
+		-- rather than 1 baht after the bracket before it
+		UPDATE income_tax_rates SET max_income = NULL WHERE max_income >= 99999999999999;
+		UPDATE income_tax_rates SET min_income = 2000001.00 WHERE min_income = 2000000.01;
+	END IF;
+
+	IF to_regclass('allowances') IS NOT NULL AND NOT EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'allowances' AND column_name = 'tax_year'
+	) THEN
+		ALTER TABLE allowances
+			ADD COLUMN tax_year INT NOT NULL DEFAULT 2017,
+			ADD COLUMN response_name varchar(50),
+			ADD COLUMN admin_configurable BOOLEAN NOT NULL DEFAULT FALSE,
+			ADD COLUMN auto_claim BOOLEAN NOT NULL DEFAULT FALSE,
+			ADD COLUMN cap_rule varchar(20) NOT NULL DEFAULT 'flat'
+				CHECK (cap_rule IN ('flat', 'percent_of_gross', 'percent_of_net')),
+			ADD COLUMN cap_percent numeric(5, 2) NOT NULL DEFAULT 0,
+			ADD COLUMN group_name varchar(50);
+		ALTER TABLE allowances ALTER COLUMN tax_year DROP DEFAULT;
+		-- the three types the original init.sql knew, as seeded below
+		UPDATE allowances SET response_name = 'kReceipt', admin_configurable = TRUE WHERE allowance_name = 'k-receipt';
+		UPDATE allowances SET response_name = 'donation', cap_rule = 'percent_of_net', cap_percent = 10.00 WHERE allowance_name = 'donation';
+		UPDATE allowances SET response_name = 'personalDeduction', admin_configurable = TRUE, auto_claim = TRUE WHERE allowance_name = 'personal';
+		UPDATE allowances SET response_name = allowance_name WHERE response_name IS NULL;
+		ALTER TABLE allowances ALTER COLUMN response_name SET NOT NULL;
+		ALTER TABLE allowances DROP CONSTRAINT allowances_pkey;
+		ALTER TABLE allowances ADD PRIMARY KEY (allowance_name, tax_year);
+	END IF;
+END $$;
+
+DO $$
+DECLARE
+	missing text;
+BEGIN
+	SELECT string_agg(expected.name || '.' || col, ', ') INTO missing
+	FROM (VALUES
+		('income_tax_rates', ARRAY['id', 'tax_year', 'income_level', 'min_income', 'max_income', 'tax_rate']),
+		('allowances', ARRAY['allowance_name', 'tax_year', 'response_name', 'admin_configurable', 'auto_claim', 'cap_rule', 'cap_percent', 'group_name', 'max_allowance', 'min_allowance', 'limit_allowance']),
+		('allowance_groups', ARRAY['group_name', 'tax_year', 'limit_allowance']),
+		('config_snapshots', ARRAY['id', 'created_at', 'tax_rates', 'allowances', 'allowance_groups']),
+		('tax_jobs', ARRAY['id', 'status', 'strict', 'lang', 'file_size', 'read_bytes', 'processed_rows', 'error_rows', 'error', 'locked_until', 'created_at', 'started_at', 'finished_at']),
+		('tax_job_files', ARRAY['job_id', 'seq', 'data']),
+		('tax_job_rows', ARRAY['job_id', 'seq', 'row_id', 'total_income', 'tax', 'tax_refund', 'error']),
+		('tax_calculations', ARRAY['id', 'created_at', 'tax_year', 'total_income', 'snapshot_id', 'request', 'response']),
+		('audit_log', ARRAY['id', 'created_at', 'username', 'request_id', 'action', 'target', 'old_value', 'new_value']),
+		('admin_users', ARRAY['id', 'username', 'password_hash', 'disabled', 'roles', 'created_at', 'updated_at', 'password_changed_at']),
+		('api_keys', ARRAY['id', 'client', 'key_prefix', 'key_hash', 'scopes', 'created_at', 'revoked_at']),
+		('rate_limit_buckets', ARRAY['key', 'tokens', 'allowed', 'updated_at'])
+	) AS expected (name, cols)
+	CROSS JOIN LATERAL unnest(expected.cols) AS col
+	WHERE to_regclass(expected.name) IS NOT NULL AND NOT EXISTS (
+		SELECT 1 FROM information_schema.columns c
+		WHERE c.table_schema = current_schema() AND c.table_name = expected.name AND c.column_name = col
+	);
+	IF missing IS NOT NULL THEN
+		RAISE EXCEPTION 'cannot adopt the existing schema, columns missing: %', missing;
+	END IF;
+END $$;
+
+-- tax_year is the first tax year a row takes effect; it stays in force until a
+-- later tax_year is added for the same bracket set or allowance.
+-- A NULL max_income marks the open-ended top bracket.
+CREATE TABLE IF NOT EXISTS income_tax_rates (
+    id SERIAL PRIMARY KEY,
+    tax_year INT NOT NULL,
+    income_level VARCHAR(255) NOT NULL,
+    min_income numeric(18, 2) NOT NULL,
+    max_income numeric(18, 2),
+    tax_rate numeric(5, 2) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_income_tax_rates_tax_year ON income_tax_rates (tax_year);
+
+
+INSERT INTO income_tax_rates (tax_year, income_level, min_income, max_income, tax_rate)
+SELECT * FROM (VALUES
+    (2017, '0-150,000', 0.00, 150000.00, 0.00),
+    (2017, '150,001-500,000', 150001.00, 500000.00, 10.00),
+    (2017, '500,001-1,000,000', 500001.00, 1000000.00, 15.00),
+    (2017, '1,000,001-2,000,000', 1000001.00, 2000000.00, 20.00),
+    (2017, '2,000,001 ขึ้นไป', 2000001.00, NULL, 35.00)) AS seed
+WHERE NOT EXISTS (SELECT 1 FROM income_tax_rates);
+
+
+-- allowances is the registry of allowance types: a type exists for a tax year
+-- when it has a row with that tax_year or an earlier one. response_name is
+-- the key used for the type in API responses, admin_configurable allows
+-- POST /admin/deductions/:type to change limit_allowance, and auto_claim
+-- deducts limit_allowance for taxpayers who do not claim the type.
+-- cap_rule bounds the allowed amount on top of limit_allowance:
+--   flat             limit_allowance only
+--   percent_of_gross cap_percent of total income
+--   percent_of_net   cap_percent of income left after every other allowance
+--                    (applied last, e.g. donations)
+-- group_name puts the type in an allowance_groups ceiling shared with the
+-- other types of the group, applied after each type's own limits.
+CREATE TABLE IF NOT EXISTS allowances (
+	allowance_name varchar(50) NOT NULL,
+	tax_year INT NOT NULL,
+	response_name varchar(50) NOT NULL,
+	admin_configurable BOOLEAN NOT NULL DEFAULT FALSE,
+	auto_claim BOOLEAN NOT NULL DEFAULT FALSE,
+	cap_rule varchar(20) NOT NULL DEFAULT 'flat'
+		CHECK (cap_rule IN ('flat', 'percent_of_gross', 'percent_of_net')),
+	cap_percent numeric(5, 2) NOT NULL DEFAULT 0,
+	group_name varchar(50),
+	max_allowance numeric(18, 2) NOT NULL,
+	min_allowance numeric(18, 2) NOT NULL,
+	limit_allowance numeric(18, 2) NOT NULL,
+	PRIMARY KEY (allowance_name, tax_year)
+);
+
+
+
+INSERT INTO allowances (allowance_name, tax_year, response_name, admin_configurable, auto_claim, cap_rule, cap_percent, group_name, max_allowance, min_allowance, limit_allowance)
+SELECT * FROM (VALUES('k-receipt', 2017, 'kReceipt', TRUE, FALSE, 'flat', 0, NULL, 100000.00, 1.00, 50000.00),
+      ('donation', 2017, 'donation', FALSE, FALSE, 'percent_of_net', 10.00, NULL, 100000.00, 0, 100000.00),
+      ('personal', 2017, 'personalDeduction', TRUE, TRUE, 'flat', 0, NULL, 100000.00, 10001.00, 60000.00),
+      ('ssf', 2020, 'ssf', TRUE, FALSE, 'percent_of_gross', 30.00, 'retirement', 200000.00, 0, 200000.00),
+      ('rmf', 2017, 'rmf', TRUE, FALSE, 'percent_of_gross', 30.00, 'retirement', 500000.00, 0, 500000.00),
+      ('provident-fund', 2017, 'providentFund', TRUE, FALSE, 'percent_of_gross', 15.00, 'retirement', 500000.00, 0, 500000.00),
+      ('pension-insurance', 2017, 'pensionInsurance', TRUE, FALSE, 'percent_of_gross', 15.00, 'retirement', 200000.00, 0, 200000.00)) AS seed
+ON CONFLICT (allowance_name, tax_year) DO NOTHING;
+
+
+CREATE TABLE IF NOT EXISTS allowance_groups (
+	group_name varchar(50) NOT NULL,
+	tax_year INT NOT NULL,
+	limit_allowance numeric(18, 2) NOT NULL,
+	PRIMARY KEY (group_name, tax_year)
+);
+
+INSERT INTO allowance_groups (group_name, tax_year, limit_allowance)
+SELECT 'retirement', 2017, 500000.00
+WHERE NOT EXISTS (SELECT 1 FROM allowance_groups);
+
+
+-- Every change to the tables above records a snapshot of all three, every tax
+-- year included, as rows in the shape of the tables. Snapshots are never
+-- updated, so a calculation can be repeated under the settings it used.
+CREATE TABLE IF NOT EXISTS config_snapshots (
+	id BIGSERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	tax_rates jsonb NOT NULL,
+	allowances jsonb NOT NULL,
+	allowance_groups jsonb NOT NULL
+);
+
+INSERT INTO config_snapshots (tax_rates, allowances, allowance_groups)
+SELECT
+	COALESCE((SELECT jsonb_agg(to_jsonb(r) ORDER BY r.tax_year, r.min_income) FROM income_tax_rates r), '[]'),
+	COALESCE((SELECT jsonb_agg(to_jsonb(a) ORDER BY a.allowance_name, a.tax_year) FROM allowances a), '[]'),
+	COALESCE((SELECT jsonb_agg(to_jsonb(g) ORDER BY g.group_name, g.tax_year) FROM allowance_groups g), '[]')
+WHERE NOT EXISTS (SELECT 1 FROM config_snapshots);
+
+
+CREATE TABLE IF NOT EXISTS tax_jobs (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	status varchar(20) NOT NULL DEFAULT 'queued'
+		CHECK (status IN ('queued', 'running', 'done', 'failed')),
+	strict BOOLEAN NOT NULL DEFAULT FALSE,
+	lang varchar(35) NOT NULL DEFAULT '',
+	file_size BIGINT NOT NULL DEFAULT 0,
+	read_bytes BIGINT NOT NULL DEFAULT 0,
+	processed_rows INT NOT NULL DEFAULT 0,
+	error_rows INT NOT NULL DEFAULT 0,
+	error jsonb,
+	locked_until TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	started_at TIMESTAMPTZ,
+	finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_tax_jobs_claim ON tax_jobs (created_at) WHERE status IN ('queued', 'running');
+
+-- The uploaded file, in chunks so that it never has to be held in memory.
+CREATE TABLE IF NOT EXISTS tax_job_files (
+	job_id uuid NOT NULL REFERENCES tax_jobs (id) ON DELETE CASCADE,
+	seq INT NOT NULL,
+	data bytea NOT NULL,
+	PRIMARY KEY (job_id, seq)
+);
+
+CREATE TABLE IF NOT EXISTS tax_job_rows (
+	job_id uuid NOT NULL REFERENCES tax_jobs (id) ON DELETE CASCADE,
+	seq INT NOT NULL,
+	row_id TEXT NOT NULL DEFAULT '',
+	total_income numeric(18, 2) NOT NULL DEFAULT 0,
+	tax numeric(18, 2) NOT NULL DEFAULT 0,
+	tax_refund numeric(18, 2) NOT NULL DEFAULT 0,
+	error jsonb,
+	PRIMARY KEY (job_id, seq)
+);
+
+
+-- Every calculation made through POST /tax/calculations, kept so a figure can
+-- be reproduced later with the configuration snapshot it used.
+CREATE TABLE IF NOT EXISTS tax_calculations (
+	id BIGSERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	tax_year INT NOT NULL,
+	total_income numeric(18, 2) NOT NULL,
+	snapshot_id BIGINT NOT NULL REFERENCES config_snapshots (id),
+	request jsonb NOT NULL,
+	response jsonb NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_tax_calculations_created_at ON tax_calculations (created_at);
+CREATE INDEX IF NOT EXISTS idx_tax_calculations_total_income ON tax_calculations (total_income);
+
+
+-- Every admin write, with who made it and the changed rows before and after.
+-- The log is append-only: rows can be added but never changed or removed.
+CREATE TABLE IF NOT EXISTS audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	username varchar(100) NOT NULL,
+	request_id varchar(100) NOT NULL DEFAULT '',
+	action varchar(50) NOT NULL,
+	target varchar(100) NOT NULL DEFAULT '',
+	old_value jsonb,
+	new_value jsonb
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_username ON audit_log (username);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+	BEFORE UPDATE OR DELETE ON audit_log
+	FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+CREATE TRIGGER audit_log_no_truncate
+	BEFORE TRUNCATE ON audit_log
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+
+-- Accounts of the admin endpoints. Passwords are stored as bcrypt hashes only;
+-- the first account is created from ADMIN_USERNAME and ADMIN_PASSWORD.
+CREATE TABLE IF NOT EXISTS admin_users (
+	id BIGSERIAL PRIMARY KEY,
+	username varchar(50) NOT NULL UNIQUE,
+	password_hash TEXT NOT NULL,
+	disabled BOOLEAN NOT NULL DEFAULT FALSE,
+	roles TEXT[] NOT NULL DEFAULT '{}',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	password_changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+
+-- API keys of service callers. Only a SHA-256 hash of a key is stored; the
+-- prefix is kept to tell keys apart. A revoked key stays for the record.
+CREATE TABLE IF NOT EXISTS api_keys (
+	id BIGSERIAL PRIMARY KEY,
+	client varchar(50) NOT NULL,
+	key_prefix varchar(16) NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT[] NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	revoked_at TIMESTAMPTZ
+);
+
+
+-- Token buckets of rate limits shared by every replica. Losing them in a crash
+-- only resets the limits, so they skip the write-ahead log.
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limit_buckets (
+	key TEXT PRIMARY KEY,
+	tokens DOUBLE PRECISION NOT NULL,
+	allowed BOOLEAN NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE tax_jobs DROP COLUMN claim;
@@ -0,0 +1,3 @@
+-- The claim of the run a tax job belongs to. A worker only writes to a job
+-- while its claim is still the current one.
+ALTER TABLE tax_jobs ADD COLUMN claim uuid;
@@ -0,0 +1,8 @@
+-- The request counters of the daily (or other fixed window) quotas of rate
+-- limited callers. Unlike the token buckets, the table is logged: losing it
+-- in a crash would hand every caller a fresh quota.
+CREATE TABLE rate_limit_quotas (
+	key TEXT PRIMARY KEY,
+	window_start TIMESTAMPTZ NOT NULL,
+	count INTEGER NOT NULL
+);
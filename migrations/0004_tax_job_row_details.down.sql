@@ -0,0 +1,2 @@
+ALTER TABLE tax_job_rows DROP COLUMN input, DROP COLUMN tax_levels, DROP COLUMN taxable_income;
+ALTER TABLE tax_jobs DROP COLUMN input_header;
@@ -0,0 +1,9 @@
+-- What the CSV and XLSX exports of a job need besides the tax: the header of
+-- the uploaded file, once per job, and the cells, taxable income and tax of
+-- each level of every row. Rows stored before this have none of them and are
+-- exported with id and totalIncome only.
+ALTER TABLE tax_jobs ADD COLUMN input_header TEXT[];
+ALTER TABLE tax_job_rows
+	ADD COLUMN taxable_income numeric(18, 2) NOT NULL DEFAULT 0,
+	ADD COLUMN tax_levels jsonb,
+	ADD COLUMN input TEXT[];
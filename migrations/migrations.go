@@ -0,0 +1,254 @@
+// Package migrations versions the database schema. Each migration is a pair
+// of SQL files embedded in the binary, NNNN_name.up.sql to apply it and
+// NNNN_name.down.sql to revert it, and is applied at most once: the versions
+// applied are recorded in the schema_migrations table. Migrations run under a
+// Postgres advisory lock, so replicas starting together apply them once.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// lockKey is the advisory lock held while migrating. It only has to differ
+// from other advisory locks taken on the database.
+const lockKey int64 = 0x74617873636865 // "taxsche"
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var ErrUnknownVersion = errors.New("migrations: applied version has no migration")
+
+// Migration is a version of the schema: the SQL to migrate to it from the
+// version before and back.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied, nil when it is pending.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New migrates db with the migrations embedded in the binary.
+func New(db *sql.DB) (*Migrator, error) {
+	return NewFromFS(db, files)
+}
+
+// NewFromFS migrates db with the migrations in the top directory of fsys.
+func NewFromFS(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	ms, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: ms}, nil
+}
+
+// Load reads the migrations in the top directory of fsys in version order.
+// Every version needs both an up and a down file, and no two names.
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, name := range names {
+		parts := fileName.FindStringSubmatch(path.Base(name))
+		if parts == nil {
+			return nil, fmt.Errorf("migrations: %s should be named NNNN_name.up.sql or NNNN_name.down.sql", name)
+		}
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migrations: %s: version should be a positive number", name)
+		}
+		body, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		}
+		if m.Name != parts[2] {
+			return nil, fmt.Errorf("migrations: version %d is both %s and %s", version, m.Name, parts[2])
+		}
+		if parts[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	res := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrations: version %d (%s) needs both an up and a down file", m.Version, m.Name)
+		}
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, nil
+}
+
+// Up applies every migration not applied yet, lowest version first, each in
+// its own transaction. It returns the migrations it applied; on an error,
+// those before the one that failed stay applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int64]time.Time) error {
+		for _, mg := range m.migrations {
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+			if err := apply(ctx, conn, mg.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`, mg.Version, mg.Name); err != nil {
+				return fmt.Errorf("migrations: up %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the latest steps applied migrations, latest first. It returns
+// the migrations it reverted. It refuses to revert a version applied by a
+// newer binary, as it does not know how.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int64]time.Time) error {
+		versions := make([]int64, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		for _, v := range versions[:min(steps, len(versions))] {
+			mg, ok := m.find(v)
+			if !ok {
+				return fmt.Errorf("%w: %d", ErrUnknownVersion, v)
+			}
+			if err := apply(ctx, conn, mg.Down, `DELETE FROM schema_migrations WHERE version = $1;`, mg.Version); err != nil {
+				return fmt.Errorf("migrations: down %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status returns every migration with when it was applied, lowest version
+// first.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var res []Status
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int64]time.Time) error {
+		for _, mg := range m.migrations {
+			s := Status{Migration: mg}
+			if at, ok := applied[mg.Version]; ok {
+				s.AppliedAt = &at
+			}
+			res = append(res, s)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, mg := range m.migrations {
+		if mg.Version == version {
+			return mg, true
+		}
+	}
+	return Migration{}, false
+}
+
+// locked runs f on a connection holding the migration lock, with the versions
+// applied and when. The lock belongs to the session, so everything is done on
+// that one connection.
+func (m *Migrator) locked(ctx context.Context, f func(conn *sql.Conn, applied map[int64]time.Time) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("migrations: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, lockKey); err != nil {
+		return fmt.Errorf("migrations: lock: %w", err)
+	}
+	defer func() {
+		// unlock even when ctx is done, or the lock stays with the pooled
+		// connection
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, lockKey)
+	}()
+
+	if _, err := conn.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`); err != nil {
+		return fmt.Errorf("migrations: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations;`)
+	if err != nil {
+		return fmt.Errorf("migrations: %w", err)
+	}
+	defer rows.Close()
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var v int64
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return fmt.Errorf("migrations: %w", err)
+		}
+		applied[v] = at
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("migrations: %w", err)
+	}
+	rows.Close()
+
+	return f(conn, applied)
+}
+
+// apply runs the SQL of a migration and records it with record in one
+// transaction, so a migration is either applied and recorded or neither.
+func apply(ctx context.Context, conn *sql.Conn, migration, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
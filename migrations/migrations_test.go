@@ -0,0 +1,190 @@
+package migrations_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kanawat2566/assessment-tax/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+var _applied = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+var testFiles = fstest.MapFS{
+	"0002_add_notes.up.sql":   {Data: []byte("ALTER TABLE tax_calculations ADD COLUMN notes TEXT;")},
+	"0002_add_notes.down.sql": {Data: []byte("ALTER TABLE tax_calculations DROP COLUMN notes;")},
+	"0001_initial.up.sql":     {Data: []byte("CREATE TABLE tax_calculations (id BIGSERIAL PRIMARY KEY);")},
+	"0001_initial.down.sql":   {Data: []byte("DROP TABLE tax_calculations;")},
+}
+
+// expectLocked expects the migration lock to be taken and the applied
+// versions to be read.
+func expectLocked(mock sqlmock.Sqlmock, versions ...int64) {
+	mock.ExpectExec(`SELECT pg_advisory_lock\(\$1\);`).WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "applied_at"})
+	for _, v := range versions {
+		rows.AddRow(v, _applied)
+	}
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations;`).WillReturnRows(rows)
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\);`).WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestLoad(t *testing.T) {
+	ms, err := migrations.Load(testFiles)
+
+	assert.Nil(t, err)
+	if assert.Len(t, ms, 2) {
+		assert.Equal(t, migrations.Migration{
+			Version: 1, Name: "initial",
+			Up:   "CREATE TABLE tax_calculations (id BIGSERIAL PRIMARY KEY);",
+			Down: "DROP TABLE tax_calculations;",
+		}, ms[0])
+		assert.Equal(t, int64(2), ms[1].Version)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	cases := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{name: "given up without down should fail", files: fstest.MapFS{"0001_initial.up.sql": {Data: []byte("SELECT 1;")}}},
+		{name: "given badly named file should fail", files: fstest.MapFS{"initial.sql": {Data: []byte("SELECT 1;")}}},
+		{
+			name: "given version with two names should fail",
+			files: fstest.MapFS{
+				"0001_initial.up.sql": {Data: []byte("SELECT 1;")},
+				"0001_other.down.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := migrations.Load(tc.files)
+
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestNew_Embedded(t *testing.T) {
+	db, _, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	_, err = migrations.New(db)
+
+	assert.Nil(t, err, "The migrations embedded in the binary should load")
+}
+
+func TestUp(t *testing.T) {
+	t.Run("given one migration applied should apply the next", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+		expectLocked(mock, 1)
+		mock.ExpectBegin()
+		mock.ExpectExec(`ALTER TABLE tax_calculations ADD COLUMN notes TEXT;`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`INSERT INTO schema_migrations \(version, name\) VALUES \(\$1, \$2\);`).WithArgs(2, "add_notes").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		expectUnlock(mock)
+		m, err := migrations.NewFromFS(db, testFiles)
+		assert.Nil(t, err)
+
+		done, err := m.Up(context.Background())
+
+		assert.Nil(t, err)
+		if assert.Len(t, done, 1) {
+			assert.Equal(t, int64(2), done[0].Version)
+		}
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given failing migration should roll it back and release the lock", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+		expectLocked(mock)
+		mock.ExpectBegin()
+		mock.ExpectExec(`CREATE TABLE tax_calculations`).WillReturnError(errors.New("syntax error"))
+		mock.ExpectRollback()
+		expectUnlock(mock)
+		m, err := migrations.NewFromFS(db, testFiles)
+		assert.Nil(t, err)
+
+		done, err := m.Up(context.Background())
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "1_initial")
+		assert.Empty(t, done)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestDown(t *testing.T) {
+	t.Run("given two migrations applied should revert the latest", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+		expectLocked(mock, 1, 2)
+		mock.ExpectBegin()
+		mock.ExpectExec(`ALTER TABLE tax_calculations DROP COLUMN notes;`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM schema_migrations WHERE version = \$1;`).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		expectUnlock(mock)
+		m, err := migrations.NewFromFS(db, testFiles)
+		assert.Nil(t, err)
+
+		done, err := m.Down(context.Background(), 1)
+
+		assert.Nil(t, err)
+		if assert.Len(t, done, 1) {
+			assert.Equal(t, int64(2), done[0].Version)
+		}
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given version applied by a newer binary should refuse", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+		expectLocked(mock, 1, 2, 3)
+		expectUnlock(mock)
+		m, err := migrations.NewFromFS(db, testFiles)
+		assert.Nil(t, err)
+
+		done, err := m.Down(context.Background(), 1)
+
+		assert.ErrorIs(t, err, migrations.ErrUnknownVersion)
+		assert.Empty(t, done)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+	expectLocked(mock, 1)
+	expectUnlock(mock)
+	m, err := migrations.NewFromFS(db, testFiles)
+	assert.Nil(t, err)
+
+	status, err := m.Status(context.Background())
+
+	assert.Nil(t, err)
+	if assert.Len(t, status, 2) {
+		assert.Equal(t, &_applied, status[0].AppliedAt)
+		assert.Nil(t, status[1].AppliedAt, "Version 2 should be pending")
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
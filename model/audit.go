@@ -0,0 +1,39 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry is a change made by an admin. OldValue and NewValue are the
+// changed rows before and after, null for something created or removed.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	CreatedAt time.Time       `json:"createdAt"`
+	User      string          `json:"user"`
+	RequestID string          `json:"requestId"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	OldValue  json.RawMessage `json:"oldValue"`
+	NewValue  json.RawMessage `json:"newValue"`
+}
+
+// AuditQuery selects a page of the audit log. User, Action and Target match
+// exactly; From and To bound when the change was made, From included and To
+// left out. Zero values do not filter.
+type AuditQuery struct {
+	User   string
+	Action string
+	Target string
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+type AuditResponse struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"`
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+}
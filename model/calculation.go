@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/kanawat2566/assessment-tax/money"
+)
+
+// Calculation is a past calculation as it was asked for and answered.
+// TaxYear is the tax year it was calculated for and SnapshotID the config
+// snapshot it used.
+type Calculation struct {
+	ID         int64       `json:"id"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	TaxYear    int         `json:"taxYear"`
+	SnapshotID int64       `json:"snapshotId"`
+	Request    TaxRequest  `json:"request"`
+	Response   TaxResponse `json:"response"`
+}
+
+// CalculationQuery selects a page of the calculation history. From and To
+// bound when a calculation was made, From included and To left out;
+// MinIncome and MaxIncome bound its total income inclusively. Zero values do
+// not filter.
+type CalculationQuery struct {
+	From      time.Time
+	To        time.Time
+	MinIncome *money.Amount
+	MaxIncome *money.Amount
+	Limit     int
+	Offset    int
+}
+
+type CalculationsResponse struct {
+	Calculations []Calculation `json:"calculations"`
+	Total        int           `json:"total"`
+	Limit        int           `json:"limit"`
+	Offset       int           `json:"offset"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Client is a service caller signed in with an API key or a JWT, and the
+// scopes its credentials grant.
+type Client struct {
+	Name   string
+	Scopes []string
+}
+
+// APIKey is an API key as shown to admins, without the key itself.
+type APIKey struct {
+	ID        int64      `json:"id"`
+	Client    string     `json:"client"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+type APIKeyRequest struct {
+	Client string   `json:"client"`
+	Scopes []string `json:"scopes"`
+}
+
+// APIKeyCreated is a new API key. This is the only time Key is shown; only
+// its hash is kept.
+type APIKeyCreated struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type APIKeysResponse struct {
+	Keys []APIKey `json:"keys"`
+}
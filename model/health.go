@@ -0,0 +1,8 @@
+package models
+
+// Health is whether the service is up, or ready to serve requests, with the
+// outcome of each check it made keyed by check name.
+type Health struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TaxJob is a bulk calculation of an uploaded CSV file running in the
+// background. Status is one of the ct.Job* values and Progress the percentage
+// of the file read so far. Error is set when the job failed.
+type TaxJob struct {
+	ID            string          `json:"id"`
+	Status        string          `json:"status"`
+	Mode          string          `json:"mode"`
+	Progress      int             `json:"progress"`
+	ProcessedRows int             `json:"processedRows"`
+	ErrorRows     int             `json:"errorRows"`
+	Error         json.RawMessage `json:"error,omitempty"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	StartedAt     *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt    *time.Time      `json:"finishedAt,omitempty"`
+}
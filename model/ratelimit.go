@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// RateLimit is what a request left of its caller's rate limit: Limit requests
+// per Window, of which Remaining are left until the limit is whole again
+// after Reset. A request refused can be retried after RetryAfter.
+//
+// Quota is the caller's quota of the same class, nil when it has none. Limit
+// is zero when the class has a quota only.
+type RateLimit struct {
+	Allowed    bool
+	Limit      int
+	Window     time.Duration
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+	Quota      *RateLimit
+}
@@ -1,43 +1,156 @@
 package models
 
+import (
+	"time"
+
+	"github.com/kanawat2566/assessment-tax/money"
+	"golang.org/x/text/language"
+)
+
 type Allowance struct {
-	AllowanceType string  `json:"allowanceType"`
-	Amount        float64 `json:"amount"`
+	AllowanceType string       `json:"allowanceType"`
+	Amount        money.Amount `json:"amount"`
 }
 
+// TaxRequest is a calculation to make. SnapshotID pins the calculation to a
+// config snapshot, so it is made under the settings of that snapshot; zero
+// uses the current settings.
 type TaxRequest struct {
-	TotalIncome float64     `json:"totalIncome" validate:"required,numeric"`
-	WHT         float64     `json:"wht"`
-	Allowances  []Allowance `json:"allowances"`
+	TotalIncome money.Amount `json:"totalIncome" validate:"required,numeric"`
+	WHT         money.Amount `json:"wht"`
+	Allowances  []Allowance  `json:"allowances"`
+	TaxYear     int          `json:"taxYear"`
+	SnapshotID  int64        `json:"snapshotId,omitempty"`
+	// ID and Line identify a CSV row. ID is echoed back in its Taxes.
+	ID   string `json:"-"`
+	Line int    `json:"-"`
+	// Lang is the language of the tax level labels. language.Und keeps the
+	// labels stored with the tax rates.
+	Lang language.Tag `json:"-"`
+	// Input is the CSV row the request was read from.
+	Input *CsvRow `json:"-"`
 }
 
+// CsvRow is a row of an uploaded CSV file together with the file's header.
+type CsvRow struct {
+	Header []string
+	Cells  []string
+}
+
+// TaxResponse is the result of a calculation. SnapshotID is the config
+// snapshot it was made under. CalculationID is set when the calculation was
+// recorded, see GET /admin/calculations/:id.
 type TaxResponse struct {
-	Tax       float64    `json:"tax"`
-	TaxRefund float64    `json:"taxRefund"`
-	TaxLevels []TaxLevel `json:"taxLevel"`
+	Tax           money.Amount      `json:"tax"`
+	TaxRefund     money.Amount      `json:"taxRefund"`
+	TaxableIncome money.Amount      `json:"taxableIncome"`
+	TaxLevels     []TaxLevel        `json:"taxLevel"`
+	Allowances    []AllowanceDetail `json:"allowances,omitempty"`
+	SnapshotID    int64             `json:"snapshotId"`
+	CalculationID int64             `json:"calculationId,omitempty"`
+}
+
+// AllowanceDetail is how much of an allowance claim was deducted. Limit is the
+// ceiling that applied to the claim and Reason says where it came from, one of
+// the ct.Reason* values. GroupTrimmed is the part of the claim cut by the
+// ceiling shared with its allowance group.
+type AllowanceDetail struct {
+	AllowanceType string       `json:"allowanceType"`
+	Claimed       money.Amount `json:"claimed"`
+	Allowed       money.Amount `json:"allowed"`
+	Limit         money.Amount `json:"limit"`
+	Reason        string       `json:"reason"`
+	GroupTrimmed  money.Amount `json:"groupTrimmed,omitempty"`
 }
 
 type TaxLevel struct {
-	Level string  `json:"level"`
-	Tax   float64 `json:"tax"`
+	Level string       `json:"level"`
+	Tax   money.Amount `json:"tax"`
 }
 
 type TaxLevelReponse struct {
-	Tax       float64    `json:"tax"`
-	TaxLevels []TaxLevel `json:"taxLevel"`
+	Tax           money.Amount      `json:"tax"`
+	TaxableIncome money.Amount      `json:"taxableIncome"`
+	TaxLevels     []TaxLevel        `json:"taxLevel"`
+	Allowances    []AllowanceDetail `json:"allowances,omitempty"`
+	SnapshotID    int64             `json:"snapshotId"`
+	CalculationID int64             `json:"calculationId,omitempty"`
 }
 
 type DeductRequest struct {
-	Amount float64 `json:"amount" validate:"required,numeric"`
+	Amount  money.Amount `json:"amount" validate:"required,numeric"`
+	TaxYear int          `json:"taxYear"`
 }
 
 type DeductResponse struct {
-	PersonalDeduction float64 `json:"personalDeduction"`
-	KReceipt          float64 `json:"kReceipt"`
+	PersonalDeduction money.Amount `json:"personalDeduction"`
+	KReceipt          money.Amount `json:"kReceipt"`
 }
 
 type Taxes struct {
-	TotalIncome float64 `json:"totalIncome"`
-	Tax         float64 `json:"tax"`
-	TaxRefund   float64 `json:"taxRefund"`
+	ID          string       `json:"id,omitempty"`
+	TotalIncome money.Amount `json:"totalIncome"`
+	Tax         money.Amount `json:"tax"`
+	TaxRefund   money.Amount `json:"taxRefund"`
+	// TaxableIncome, TaxLevels and Input are only used by the CSV and XLSX
+	// exports, which repeat the uploaded row next to the tax breakdown.
+	TaxableIncome money.Amount `json:"-"`
+	TaxLevels     []TaxLevel   `json:"-"`
+	Input         *CsvRow      `json:"-"`
+}
+
+// TaxRate is a progressive tax bracket. A nil MaxIncome marks the
+// open-ended top bracket.
+type TaxRate struct {
+	ID        int           `json:"id"`
+	TaxYear   int           `json:"taxYear"`
+	Level     string        `json:"level"`
+	MinIncome money.Amount  `json:"minIncome"`
+	MaxIncome *money.Amount `json:"maxIncome"`
+	TaxRate   money.Percent `json:"taxRate"`
+}
+
+type TaxRatesResponse struct {
+	TaxYear  int       `json:"taxYear"`
+	TaxRates []TaxRate `json:"taxRates"`
+}
+
+// AllowanceConfig is an allowance type in the registry together with its
+// limits for TaxYear.
+type AllowanceConfig struct {
+	AllowanceType     string        `json:"allowanceType"`
+	ResponseName      string        `json:"responseName"`
+	TaxYear           int           `json:"taxYear"`
+	AdminConfigurable bool          `json:"adminConfigurable"`
+	AutoClaim         bool          `json:"autoClaim"`
+	CapRule           string        `json:"capRule"`
+	CapPercent        money.Percent `json:"capPercent"`
+	GroupName         string        `json:"groupName,omitempty"`
+	MinAmount         money.Amount  `json:"minAmount"`
+	MaxAmount         money.Amount  `json:"maxAmount"`
+	LimitAmount       money.Amount  `json:"limitAmount"`
+}
+
+type AllowancesResponse struct {
+	TaxYear    int               `json:"taxYear"`
+	Allowances []AllowanceConfig `json:"allowances"`
+}
+
+// AllowanceGroup is the ceiling shared by the allowance types of a group from
+// TaxYear on.
+type AllowanceGroup struct {
+	GroupName   string       `json:"groupName"`
+	TaxYear     int          `json:"taxYear"`
+	LimitAmount money.Amount `json:"limitAmount"`
+}
+
+// ConfigSnapshot is the whole tax configuration, every tax year of it, as it
+// was after a change. Each row applies from its tax year until a later row
+// of the same bracket set, allowance type or group takes over.
+type ConfigSnapshot struct {
+	ID              int64             `json:"id"`
+	CreatedAt       time.Time         `json:"createdAt"`
+	TaxRates        []TaxRate         `json:"taxRates"`
+	Allowances      []AllowanceConfig `json:"allowances"`
+	AllowanceGroups []AllowanceGroup  `json:"allowanceGroups"`
 }
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// AdminUser is an admin account as shown to admins, without its password.
+type AdminUser struct {
+	Username          string    `json:"username"`
+	Disabled          bool      `json:"disabled"`
+	Roles             []string  `json:"roles"`
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+	PasswordChangedAt time.Time `json:"passwordChangedAt"`
+}
+
+type AdminUserRequest struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Roles    []string `json:"roles"`
+}
+
+// AdminUserUpdate changes an admin account. Fields left out are kept.
+type AdminUserUpdate struct {
+	Password *string   `json:"password"`
+	Disabled *bool     `json:"disabled"`
+	Roles    *[]string `json:"roles"`
+}
+
+type AdminUsersResponse struct {
+	Users []AdminUser `json:"users"`
+}
@@ -0,0 +1,285 @@
+// Package money provides fixed-point types for baht amounts and tax rates so
+// that calculations never pass through float64.
+//
+// Both types keep two decimal places. Whenever a value has to be reduced to
+// two decimal places (parsing input with more digits, or applying a percentage)
+// it is rounded to the nearest unit with halves rounded away from zero
+// (ROUND_HALF_UP), e.g. 0.005 baht becomes 0.01 baht and -0.005 becomes -0.01.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// scale is the number of minor units in one major unit (satang per baht,
+// hundredths per percent).
+const scale = 100
+
+var ErrInvalidNumber = errors.New("invalid decimal number")
+
+// Amount is a baht amount held in satang.
+type Amount int64
+
+// Baht returns an Amount of n whole baht.
+func Baht(n int64) Amount {
+	return Amount(n * scale)
+}
+
+// Satang returns an Amount of n satang.
+func Satang(n int64) Amount {
+	return Amount(n)
+}
+
+// Parse reads a decimal string such as "1234.5" into an Amount.
+func Parse(s string) (Amount, error) {
+	v, err := parseFixed(s)
+	return Amount(v), err
+}
+
+// MustParse is like Parse but panics on invalid input. It is meant for
+// constants and tests.
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Min returns the smaller of a and b.
+func Min(a, b Amount) Amount {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Max returns the larger of a and b.
+func Max(a, b Amount) Amount {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Abs returns the absolute value of a.
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// Percent returns p percent of a, rounded to the satang.
+func (a Amount) Percent(p Percent) Amount {
+	// Split a so the multiplication cannot overflow for any numeric(18,2).
+	const div = scale * scale
+	q, r := int64(a)/div, int64(a)%div
+	return Amount(q*int64(p) + roundDiv(r*int64(p), div))
+}
+
+// Float64 returns a as a float64. It is only meant for display.
+func (a Amount) Float64() float64 {
+	return float64(a) / scale
+}
+
+// String formats a with exactly two decimal places, e.g. "29000.00".
+func (a Amount) String() string {
+	return formatFixed(int64(a), true)
+}
+
+// MarshalJSON writes a as a JSON number without trailing zeros, e.g. 29000 or
+// 1234.5.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(formatFixed(int64(a), false)), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a quoted decimal string.
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	v, err := unmarshalFixed(b)
+	if err != nil {
+		return err
+	}
+	*a = Amount(v)
+	return nil
+}
+
+// Scan implements sql.Scanner for numeric columns.
+func (a *Amount) Scan(src interface{}) error {
+	v, err := scanFixed(src)
+	if err != nil {
+		return err
+	}
+	*a = Amount(v)
+	return nil
+}
+
+// Value implements driver.Valuer, sending a as an exact decimal string.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Percent is a percentage held in hundredths of a percent, matching the
+// numeric(5,2) tax_rate column.
+type Percent int64
+
+// Percentage returns a Percent of n whole percent.
+func Percentage(n int64) Percent {
+	return Percent(n * scale)
+}
+
+// ParsePercent reads a decimal string such as "12.5" into a Percent.
+func ParsePercent(s string) (Percent, error) {
+	v, err := parseFixed(s)
+	return Percent(v), err
+}
+
+// Float64 returns p as a float64. It is only meant for display.
+func (p Percent) Float64() float64 {
+	return float64(p) / scale
+}
+
+// String formats p with exactly two decimal places, e.g. "10.00".
+func (p Percent) String() string {
+	return formatFixed(int64(p), true)
+}
+
+func (p Percent) MarshalJSON() ([]byte, error) {
+	return []byte(formatFixed(int64(p), false)), nil
+}
+
+func (p *Percent) UnmarshalJSON(b []byte) error {
+	v, err := unmarshalFixed(b)
+	if err != nil {
+		return err
+	}
+	*p = Percent(v)
+	return nil
+}
+
+func (p *Percent) Scan(src interface{}) error {
+	v, err := scanFixed(src)
+	if err != nil {
+		return err
+	}
+	*p = Percent(v)
+	return nil
+}
+
+func (p Percent) Value() (driver.Value, error) {
+	return p.String(), nil
+}
+
+// roundDiv divides n by d (d > 0), rounding half away from zero.
+func roundDiv(n, d int64) int64 {
+	q, r := n/d, n%d
+	if r < 0 {
+		r = -r
+	}
+	if 2*r >= d {
+		if n < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+func parseFixed(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidNumber
+	}
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return 0, ErrInvalidNumber
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, ErrInvalidNumber
+	}
+
+	// Keep one digit beyond the scale; it alone decides half-up rounding.
+	frac := fracPart + "000"
+	v, err := strconv.ParseInt(intPart+frac[:3], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidNumber
+	}
+	v = roundDiv(v, 10)
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func formatFixed(v int64, fixed bool) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	s := fmt.Sprintf("%s%d.%02d", sign, v/scale, v%scale)
+	if !fixed {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+func unmarshalFixed(b []byte) (int64, error) {
+	s := string(b)
+	if s == "null" {
+		return 0, nil
+	}
+	if uq, err := strconv.Unquote(s); err == nil {
+		s = uq
+	}
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, ErrInvalidNumber
+		}
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return parseFixed(s)
+}
+
+func scanFixed(src interface{}) (int64, error) {
+	switch v := src.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return v * scale, nil
+	case float64:
+		return parseFixed(strconv.FormatFloat(v, 'f', -1, 64))
+	case []byte:
+		return parseFixed(string(v))
+	case string:
+		return parseFixed(v)
+	}
+	return 0, fmt.Errorf("money: cannot scan %T", src)
+}
@@ -0,0 +1,101 @@
+package money_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		expected money.Amount
+	}{
+		{name: "whole baht", input: "500000", expected: money.Baht(500000)},
+		{name: "satang", input: "1234.56", expected: money.Satang(123456)},
+		{name: "one decimal place", input: "0.5", expected: money.Satang(50)},
+		{name: "leading dot", input: ".25", expected: money.Satang(25)},
+		{name: "surrounding spaces", input: " 10 ", expected: money.Baht(10)},
+		{name: "half satang rounds up", input: "0.005", expected: money.Satang(1)},
+		{name: "below half satang rounds down", input: "0.00499", expected: money.Satang(0)},
+		{name: "negative half satang rounds away from zero", input: "-0.005", expected: money.Satang(-1)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := money.Parse(tc.input)
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+}
+
+func TestParse_Invalids(t *testing.T) {
+	for _, input := range []string{"", "abc", "1.2.3", "1,000", "-", "."} {
+		t.Run(input, func(t *testing.T) {
+			_, err := money.Parse(input)
+
+			assert.ErrorIs(t, err, money.ErrInvalidNumber)
+		})
+	}
+}
+
+func TestAmount_Percent(t *testing.T) {
+	cases := []struct {
+		name     string
+		amount   money.Amount
+		percent  money.Percent
+		expected money.Amount
+	}{
+		{name: "whole result", amount: money.Baht(290000), percent: money.Percentage(10), expected: money.Baht(29000)},
+		{name: "fractional rate", amount: money.Baht(1000), percent: money.Percent(1250), expected: money.Baht(125)},
+		{name: "rounds half up", amount: money.Satang(5), percent: money.Percentage(10), expected: money.Satang(1)},
+		{name: "rounds down below half", amount: money.Satang(4), percent: money.Percentage(10), expected: money.Satang(0)},
+		{name: "large amount does not overflow", amount: money.Baht(99999999999999), percent: money.Percentage(35), expected: money.MustParse("34999999999999.65")},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.amount.Percent(tc.percent))
+		})
+	}
+}
+
+func TestAmount_JSON(t *testing.T) {
+	type payload struct {
+		Tax money.Amount `json:"tax"`
+	}
+
+	b, err := json.Marshal(payload{Tax: money.MustParse("29000.10")})
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"tax": 29000.1}`, string(b))
+
+	var p payload
+	assert.Nil(t, json.Unmarshal([]byte(`{"tax": 29000.000000004}`), &p))
+	assert.Equal(t, money.Baht(29000), p.Tax)
+
+	assert.Nil(t, json.Unmarshal([]byte(`{"tax": "1.5"}`), &p))
+	assert.Equal(t, money.Satang(150), p.Tax)
+
+	assert.NotNil(t, json.Unmarshal([]byte(`{"tax": true}`), &p))
+}
+
+func TestAmount_Scan(t *testing.T) {
+	var a money.Amount
+
+	assert.Nil(t, a.Scan([]byte("150001.00")))
+	assert.Equal(t, money.Baht(150001), a)
+
+	assert.Nil(t, a.Scan(int64(7)))
+	assert.Equal(t, money.Baht(7), a)
+
+	assert.NotNil(t, a.Scan(true))
+
+	v, err := money.Baht(60000).Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "60000.00", v)
+}
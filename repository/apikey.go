@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/lib/pq"
+)
+
+// APIKey is a credential issued to a service caller. Only a hash of the key
+// is stored; RevokedAt is nil while the key is in use.
+type APIKey struct {
+	ID        int64      `postgres:"id"`
+	Client    string     `postgres:"client"`
+	Prefix    string     `postgres:"key_prefix"`
+	Hash      string     `postgres:"key_hash"`
+	Scopes    []string   `postgres:"scopes"`
+	CreatedAt time.Time  `postgres:"created_at"`
+	RevokedAt *time.Time `postgres:"revoked_at"`
+}
+
+type APIKeyRepository interface {
+	GetAPIKeyByHash(hash string) (*APIKey, error)
+	ListAPIKeys() ([]APIKey, error)
+	CreateAPIKey(k APIKey, change AuditEntry) (*APIKey, error)
+	RevokeAPIKey(id int64, change AuditEntry) (bool, error)
+}
+
+const apiKeyColumns = `
+	id, client, key_prefix, key_hash, scopes, created_at, revoked_at`
+
+// apiKeyJSON is a key as JSON for its audit entry, without the hash.
+const apiKeyJSON = `
+	SELECT to_jsonb(k) - 'key_hash' FROM api_keys k WHERE id = $1;`
+
+func scanAPIKey(row scanner) (*APIKey, error) {
+	var k APIKey
+	err := row.Scan(&k.ID, &k.Client, &k.Prefix, &k.Hash, pq.Array(&k.Scopes), &k.CreatedAt, &k.RevokedAt)
+	return &k, err
+}
+
+// GetAPIKeyByHash returns the key with the given hash, revoked or not, or nil
+// when there is none.
+func (p *Postgres) GetAPIKeyByHash(hash string) (*APIKey, error) {
+	k, err := scanAPIKey(p.Db.QueryRow(`SELECT`+apiKeyColumns+` FROM api_keys WHERE key_hash = $1;`, hash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return k, nil
+}
+
+func (p *Postgres) ListAPIKeys() ([]APIKey, error) {
+	rows, err := p.Db.Query(`SELECT` + apiKeyColumns + ` FROM api_keys ORDER BY id;`)
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer rows.Close()
+
+	var res []APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, errors.New(ct.ErrMsgDatabaseError)
+		}
+		res = append(res, *k)
+	}
+	if rows.Err() != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return res, nil
+}
+
+// CreateAPIKey stores k and returns it with its id and creation time.
+func (p *Postgres) CreateAPIKey(k APIKey, change AuditEntry) (*APIKey, error) {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer tx.Rollback()
+
+	created, err := scanAPIKey(tx.QueryRow(`
+	INSERT INTO api_keys (client, key_prefix, key_hash, scopes)
+	VALUES ($1, $2, $3, $4)
+	RETURNING`+apiKeyColumns+`;`, k.Client, k.Prefix, k.Hash, pq.Array(k.Scopes)))
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+
+	if change.NewValue, err = auditValue(tx, apiKeyJSON, created.ID); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := audit(tx, change); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return created, nil
+}
+
+// RevokeAPIKey marks the key with the given id as revoked. It returns false
+// without an error when there is no such key or it is revoked already.
+func (p *Postgres) RevokeAPIKey(id int64, change AuditEntry) (bool, error) {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer tx.Rollback()
+
+	if change.OldValue, err = auditValue(tx, apiKeyJSON, id); err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	res, err := tx.Exec(`UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL;`, id)
+	if err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if affect, _ := res.RowsAffected(); affect < 1 {
+		return false, nil
+	}
+
+	if change.NewValue, err = auditValue(tx, apiKeyJSON, id); err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := audit(tx, change); err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return true, nil
+}
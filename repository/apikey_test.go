@@ -0,0 +1,100 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var apiKeyColumns = []string{"id", "client", "key_prefix", "key_hash", "scopes", "created_at", "revoked_at"}
+
+func TestGetAPIKeyByHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	created := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT (.+) FROM api_keys WHERE key_hash = \$1;`).WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).AddRow(3, "payroll", "atx_Zk3q9Hc1", "hash", []byte("{calculate,bulk-upload}"), created, nil))
+	mock.ExpectQuery(`SELECT (.+) FROM api_keys WHERE key_hash = \$1;`).WithArgs("other").WillReturnError(sql.ErrNoRows)
+
+	repo := repository.New(db)
+
+	k, err := repo.GetAPIKeyByHash("hash")
+	assert.Nil(t, err)
+	assert.Equal(t, &repository.APIKey{
+		ID: 3, Client: "payroll", Prefix: "atx_Zk3q9Hc1", Hash: "hash", Scopes: []string{ct.ScopeCalculate, ct.ScopeBulkUpload}, CreatedAt: created,
+	}, k)
+
+	k, err = repo.GetAPIKeyByHash("other")
+	assert.Nil(t, err)
+	assert.Nil(t, k)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	change := repository.AuditEntry{User: "adminTax", RequestID: "req-1", Action: ct.AuditAPIKeyCreate, Target: "payroll"}
+	created := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO api_keys`).
+		WithArgs("payroll", "atx_Zk3q9Hc1", "hash", `{"calculate"}`).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).AddRow(3, "payroll", "atx_Zk3q9Hc1", "hash", []byte("{calculate}"), created, nil))
+	expectAuditValue(mock, "api_keys", `{"id": 3}`)
+	expectAudit(mock, change, nil, `{"id": 3}`)
+	mock.ExpectCommit()
+
+	k, err := repository.New(db).CreateAPIKey(repository.APIKey{Client: "payroll", Prefix: "atx_Zk3q9Hc1", Hash: "hash", Scopes: []string{ct.ScopeCalculate}}, change)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), k.ID)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	change := repository.AuditEntry{User: "adminTax", RequestID: "req-1", Action: ct.AuditAPIKeyRevoke, Target: "3"}
+
+	t.Run("given key in use should revoke and audit it", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+
+		mock.ExpectBegin()
+		expectAuditValue(mock, "api_keys", `{"revoked_at": null}`)
+		mock.ExpectExec(`UPDATE api_keys SET revoked_at = now\(\) WHERE id = \$1 AND revoked_at IS NULL;`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAuditValue(mock, "api_keys", `{"revoked_at": "2024-03-01T00:00:00Z"}`)
+		expectAudit(mock, change, `{"revoked_at": null}`, `{"revoked_at": "2024-03-01T00:00:00Z"}`)
+		mock.ExpectCommit()
+
+		revoked, err := repository.New(db).RevokeAPIKey(3, change)
+
+		assert.Nil(t, err)
+		assert.True(t, revoked)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given revoked key should return false", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+
+		mock.ExpectBegin()
+		expectAuditValue(mock, "api_keys", `{"revoked_at": "2024-03-01T00:00:00Z"}`)
+		mock.ExpectExec(`UPDATE api_keys`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		revoked, err := repository.New(db).RevokeAPIKey(3, change)
+
+		assert.Nil(t, err)
+		assert.False(t, revoked)
+		assert.Nil(t, mock.ExpectationsWereMet(), "Nothing changed, so nothing should be audited")
+	})
+}
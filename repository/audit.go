@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+)
+
+// AuditEntry is a change made by an admin: who made it, in which request,
+// and the changed rows as JSON before and after. OldValue is nil for
+// something created and NewValue for something removed.
+type AuditEntry struct {
+	ID        int64     `postgres:"id"`
+	CreatedAt time.Time `postgres:"created_at"`
+	User      string    `postgres:"username"`
+	RequestID string    `postgres:"request_id"`
+	Action    string    `postgres:"action"`
+	Target    string    `postgres:"target"`
+	OldValue  []byte    `postgres:"old_value"`
+	NewValue  []byte    `postgres:"new_value"`
+}
+
+// AuditFilter selects audit entries. Zero fields select everything: From is
+// the earliest time included and To the first time left out.
+type AuditFilter struct {
+	User   string
+	Action string
+	Target string
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+type AuditRepository interface {
+	ListAuditEntries(f AuditFilter) ([]AuditEntry, int, error)
+}
+
+// The rows a config write changes, as JSON for its audit entry.
+const (
+	taxRatesOfYearJSON = `
+	SELECT jsonb_agg(to_jsonb(r) ORDER BY r.min_income) FROM income_tax_rates r WHERE tax_year = $1;`
+	allowanceInForceJSON = `
+	SELECT to_jsonb(a) FROM allowances a WHERE allowance_name = $1 AND tax_year <= $2 ORDER BY tax_year DESC LIMIT 1;`
+)
+
+const auditEntryColumns = `
+	id, created_at, username, request_id, action, target, old_value, new_value`
+
+// audit records e in tx, so the entry is only kept if the change it describes
+// is.
+func audit(tx *sql.Tx, e AuditEntry) error {
+	_, err := tx.Exec(`
+	INSERT INTO audit_log (username, request_id, action, target, old_value, new_value)
+	VALUES ($1, $2, $3, $4, $5, $6);`, e.User, e.RequestID, e.Action, e.Target, nullJSON(e.OldValue), nullJSON(e.NewValue))
+	return err
+}
+
+// auditValue returns the JSON the query selects in tx, or nil when it selects
+// NULL or nothing.
+func auditValue(tx *sql.Tx, query string, args ...interface{}) ([]byte, error) {
+	var v []byte
+	err := tx.QueryRow(query, args...).Scan(&v)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return v, err
+}
+
+// nullJSON sends an empty value as NULL rather than as invalid JSON.
+func nullJSON(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
+
+// ListAuditEntries returns a page of the entries selected by f, the latest
+// first, and how many there are in all.
+func (p *Postgres) ListAuditEntries(f AuditFilter) ([]AuditEntry, int, error) {
+	var conds []string
+	var args []interface{}
+	where := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.User != "" {
+		where("username = $%d", f.User)
+	}
+	if f.Action != "" {
+		where("action = $%d", f.Action)
+	}
+	if f.Target != "" {
+		where("target = $%d", f.Target)
+	}
+	if !f.From.IsZero() {
+		where("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		where("created_at < $%d", f.To)
+	}
+	filter := ""
+	if len(conds) > 0 {
+		filter = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := p.Db.QueryRow(`SELECT count(*) FROM audit_log`+filter+`;`, args...).Scan(&total); err != nil {
+		return nil, 0, errors.New(ct.ErrMsgDatabaseError)
+	}
+
+	args = append(args, f.Limit, f.Offset)
+	rows, err := p.Db.Query(`SELECT`+auditEntryColumns+` FROM audit_log`+filter+
+		fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d;`, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer rows.Close()
+
+	var res []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.User, &e.RequestID, &e.Action, &e.Target, &e.OldValue, &e.NewValue); err != nil {
+			return nil, 0, errors.New(ct.ErrMsgDatabaseError)
+		}
+		res = append(res, e)
+	}
+	if rows.Err() != nil {
+		return nil, 0, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return res, total, nil
+}
@@ -0,0 +1,38 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var auditColumns = []string{"id", "created_at", "username", "request_id", "action", "target", "old_value", "new_value"}
+
+func TestListAuditEntries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	to := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT count\(\*\) FROM audit_log WHERE username = \$1 AND action = \$2 AND created_at < \$3;`).
+		WithArgs("adminTax", ct.AuditDeductionUpdate, to).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT (.+) FROM audit_log WHERE username = \$1 AND action = \$2 AND created_at < \$3 ORDER BY created_at DESC, id DESC LIMIT \$4 OFFSET \$5;`).
+		WithArgs("adminTax", ct.AuditDeductionUpdate, to, 50, 0).
+		WillReturnRows(sqlmock.NewRows(auditColumns).
+			AddRow(4, to, "adminTax", "req-1", ct.AuditDeductionUpdate, ct.Personal, []byte(`{"limit_allowance": 60000.00}`), []byte(`{"limit_allowance": 70000.00}`)))
+
+	rows, total, err := repository.New(db).ListAuditEntries(repository.AuditFilter{User: "adminTax", Action: ct.AuditDeductionUpdate, To: to, Limit: 50})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, []repository.AuditEntry{{
+		ID: 4, CreatedAt: to, User: "adminTax", RequestID: "req-1", Action: ct.AuditDeductionUpdate, Target: ct.Personal,
+		OldValue: []byte(`{"limit_allowance": 60000.00}`), NewValue: []byte(`{"limit_allowance": 70000.00}`),
+	}}, rows)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
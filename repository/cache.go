@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"container/list"
+	"log"
+	"sync"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/lib/pq"
+)
+
+// ConfigChannel is the Postgres channel a change to the tax configuration is
+// announced on, so that every replica drops its cached copy.
+const ConfigChannel = "tax_config_changed"
+
+// ConfigCache is a TaxRepository that keeps config snapshots in memory. Every
+// calculation reads its configuration from a snapshot, so this is the only
+// configuration cache: the per-year reads left, e.g. listing allowances,
+// serve the admin API and go to the wrapped repository, where the admin sees
+// their own writes at once.
+//
+// A snapshot never changes, so only which one is the latest is dropped, by
+// Invalidate. Writes through the cache invalidate it; writes by other
+// replicas reach it through ListenConfigChanges. Besides the latest, only
+// the maxCachedSnapshots snapshots read most recently are kept, as callers
+// can pin any snapshot ever taken.
+type ConfigCache struct {
+	TaxRepository
+
+	mu        sync.Mutex
+	snapshots map[int64]*list.Element
+	recent    *list.List // of *ConfigSnapshot, the most recently read first
+	latest    *ConfigSnapshot
+}
+
+// maxCachedSnapshots is the number of snapshots kept besides the latest.
+const maxCachedSnapshots = 32
+
+func NewConfigCache(r TaxRepository) *ConfigCache {
+	return &ConfigCache{TaxRepository: r, snapshots: map[int64]*list.Element{}, recent: list.New()}
+}
+
+// Invalidate drops the latest snapshot.
+func (c *ConfigCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.latest = nil
+}
+
+// GetConfigSnapshot returns the snapshot with the given id, or the latest one
+// when id is zero, loading it on a miss. The snapshot is shared, so callers
+// must not change it. The lock is held while loading so that an Invalidate
+// for a write that commits meanwhile cannot be overtaken by the now stale
+// latest snapshot.
+func (c *ConfigCache) GetConfigSnapshot(id int64) (*ConfigSnapshot, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.latest != nil && (id == 0 || id == c.latest.ID) {
+		return c.latest, nil
+	}
+	if e, ok := c.snapshots[id]; ok {
+		c.recent.MoveToFront(e)
+		return e.Value.(*ConfigSnapshot), nil
+	}
+
+	s, err := c.TaxRepository.GetConfigSnapshot(id)
+	if err != nil || s == nil {
+		return s, err
+	}
+	if id == 0 {
+		c.latest = s
+	}
+	// the latest is kept as well, to stay cached once it is not the latest
+	if _, ok := c.snapshots[s.ID]; !ok {
+		c.snapshots[s.ID] = c.recent.PushFront(s)
+	}
+	if c.recent.Len() > maxCachedSnapshots {
+		oldest := c.recent.Remove(c.recent.Back()).(*ConfigSnapshot)
+		delete(c.snapshots, oldest.ID)
+	}
+	return s, nil
+}
+
+func (c *ConfigCache) SaveTaxRates(taxYear int, base, rates []*IncomeTaxRates, change AuditEntry) ([]*IncomeTaxRates, error) {
+	defer c.Invalidate()
+	return c.TaxRepository.SaveTaxRates(taxYear, base, rates, change)
+}
+
+func (c *ConfigCache) CreateAllowance(allowance Allowances, change AuditEntry) (bool, error) {
+	defer c.Invalidate()
+	return c.TaxRepository.CreateAllowance(allowance, change)
+}
+
+func (c *ConfigCache) UpdateConfigDeduct(config ct.Deduction, change AuditEntry) error {
+	defer c.Invalidate()
+	return c.TaxRepository.UpdateConfigDeduct(config, change)
+}
+
+// ListenConfigChanges calls onChange for every notification on
+// ConfigChannel, and whenever the connection is re-established, since
+// notifications may have been missed while it was down. Close the returned
+// listener to stop.
+func ListenConfigChanges(databaseSource string, onChange func()) (*pq.Listener, error) {
+	l := pq.NewListener(databaseSource, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("config listener: %v", err)
+		}
+	})
+	if err := l.Listen(ConfigChannel); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			select {
+			case _, ok := <-l.Notify:
+				if !ok {
+					return
+				}
+				onChange()
+			case <-time.After(90 * time.Second):
+				// a quiet connection may be dead without anyone noticing
+				go l.Ping()
+			}
+		}
+	}()
+	return l, nil
+}
@@ -0,0 +1,136 @@
+package repository_test
+
+import (
+	"errors"
+	"testing"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingRepo counts the configuration reads that reach the database.
+type countingRepo struct {
+	repository.TaxRepository
+	loads     int
+	snapshots int
+	err       error
+}
+
+func (r *countingRepo) GetTaxRates(taxYear int) ([]*repository.IncomeTaxRates, error) {
+	r.loads++
+	return []*repository.IncomeTaxRates{{TaxYear: taxYear, IncomeLevel: "0-150,000", MaxIncome: upTo(150000)}}, r.err
+}
+
+func (r *countingRepo) GetConfigSnapshot(id int64) (*repository.ConfigSnapshot, error) {
+	r.snapshots++
+	if r.err != nil {
+		return nil, r.err
+	}
+	if id == 0 {
+		id = int64(r.snapshots)
+	}
+	return &repository.ConfigSnapshot{ID: id}, nil
+}
+
+func (r *countingRepo) UpdateConfigDeduct(config ct.Deduction, change repository.AuditEntry) error {
+	return nil
+}
+
+func (r *countingRepo) CreateAllowance(a repository.Allowances, change repository.AuditEntry) (bool, error) {
+	return true, nil
+}
+
+func (r *countingRepo) SaveTaxRates(taxYear int, base, rates []*repository.IncomeTaxRates, change repository.AuditEntry) ([]*repository.IncomeTaxRates, error) {
+	return rates, nil
+}
+
+func TestConfigCache_ReadsYearsThrough(t *testing.T) {
+	repo := &countingRepo{}
+	cache := repository.NewConfigCache(repo)
+
+	for i := 0; i < 3; i++ {
+		_, err := cache.GetTaxRates(2024)
+		assert.Nil(t, err)
+	}
+
+	assert.Equal(t, 3, repo.loads, "Only snapshots should be cached, the admin reads the tax year as it is")
+}
+
+func TestConfigCache_DoesNotCacheErrors(t *testing.T) {
+	repo := &countingRepo{err: errors.New(ct.ErrMsgDatabaseError)}
+	cache := repository.NewConfigCache(repo)
+
+	_, err := cache.GetConfigSnapshot(0)
+	assert.EqualError(t, err, ct.ErrMsgDatabaseError)
+
+	repo.err = nil
+	_, err = cache.GetConfigSnapshot(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, repo.snapshots)
+}
+
+func TestConfigCache_Invalidate(t *testing.T) {
+	cases := []struct {
+		name  string
+		write func(c *repository.ConfigCache)
+	}{
+		{name: "given notification", write: func(c *repository.ConfigCache) { c.Invalidate() }},
+		{name: "given deduction update", write: func(c *repository.ConfigCache) { c.UpdateConfigDeduct(ct.Deduction{}, repository.AuditEntry{}) }},
+		{name: "given new allowance", write: func(c *repository.ConfigCache) { c.CreateAllowance(repository.Allowances{}, repository.AuditEntry{}) }},
+		{name: "given saved tax rates", write: func(c *repository.ConfigCache) { c.SaveTaxRates(2024, nil, nil, repository.AuditEntry{}) }},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &countingRepo{}
+			cache := repository.NewConfigCache(repo)
+			cache.GetConfigSnapshot(0)
+
+			tc.write(cache)
+			cache.GetConfigSnapshot(0)
+
+			assert.Equal(t, 2, repo.snapshots, "The latest snapshot should be loaded again after a change")
+		})
+	}
+}
+
+func TestConfigCache_Snapshots(t *testing.T) {
+	repo := &countingRepo{}
+	cache := repository.NewConfigCache(repo)
+
+	latest, err := cache.GetConfigSnapshot(0)
+	assert.Nil(t, err)
+	again, _ := cache.GetConfigSnapshot(0)
+	byID, _ := cache.GetConfigSnapshot(latest.ID)
+	assert.Same(t, latest, again)
+	assert.Same(t, latest, byID, "The latest snapshot should also be cached by its id")
+	assert.Equal(t, 1, repo.snapshots)
+
+	assert.Nil(t, cache.UpdateConfigDeduct(ct.Deduction{Type: ct.Personal, TaxYear: 2024, Amount: money.Baht(70000)}, repository.AuditEntry{}))
+	newer, _ := cache.GetConfigSnapshot(0)
+	old, _ := cache.GetConfigSnapshot(latest.ID)
+
+	assert.Equal(t, int64(2), newer.ID, "A write should make the next snapshot the latest")
+	assert.Same(t, latest, old, "Snapshots never change, so they should stay cached")
+	assert.Equal(t, 2, repo.snapshots)
+}
+
+func TestConfigCache_EvictsPinnedSnapshots(t *testing.T) {
+	repo := &countingRepo{}
+	cache := repository.NewConfigCache(repo)
+	latest, _ := cache.GetConfigSnapshot(0)
+
+	for id := int64(100); id < 200; id++ {
+		cache.GetConfigSnapshot(id)
+	}
+	loads := repo.snapshots
+	again, _ := cache.GetConfigSnapshot(latest.ID)
+	cache.GetConfigSnapshot(199)
+	assert.Same(t, latest, again, "The latest snapshot should always stay cached")
+	assert.Equal(t, loads, repo.snapshots, "The snapshots read most recently should stay cached")
+
+	cache.GetConfigSnapshot(100)
+	assert.Equal(t, loads+1, repo.snapshots, "The snapshots read least recently should be dropped")
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/money"
+)
+
+// TaxCalculation is a calculation kept for the record: the request and the
+// response it got as JSON, with the config snapshot it used.
+type TaxCalculation struct {
+	ID          int64        `postgres:"id"`
+	CreatedAt   time.Time    `postgres:"created_at"`
+	TaxYear     int          `postgres:"tax_year"`
+	TotalIncome money.Amount `postgres:"total_income"`
+	SnapshotID  int64        `postgres:"snapshot_id"`
+	Request     []byte       `postgres:"request"`
+	Response    []byte       `postgres:"response"`
+}
+
+// CalculationFilter selects stored calculations. Zero fields select
+// everything: From is the earliest time included and To the first time left
+// out, MinIncome and MaxIncome bound the total income inclusively.
+type CalculationFilter struct {
+	From      time.Time
+	To        time.Time
+	MinIncome *money.Amount
+	MaxIncome *money.Amount
+	Limit     int
+	Offset    int
+}
+
+type CalculationRepository interface {
+	SaveTaxCalculation(c TaxCalculation) (*TaxCalculation, error)
+	GetTaxCalculation(id int64) (*TaxCalculation, error)
+	ListTaxCalculations(f CalculationFilter) ([]TaxCalculation, int, error)
+}
+
+const taxCalculationColumns = `
+	id, created_at, tax_year, total_income, snapshot_id, request, response`
+
+func scanTaxCalculation(row scanner) (*TaxCalculation, error) {
+	var c TaxCalculation
+	err := row.Scan(&c.ID, &c.CreatedAt, &c.TaxYear, &c.TotalIncome, &c.SnapshotID, &c.Request, &c.Response)
+	return &c, err
+}
+
+// SaveTaxCalculation stores c and returns it with its id and creation time.
+func (p *Postgres) SaveTaxCalculation(c TaxCalculation) (*TaxCalculation, error) {
+	saved, err := scanTaxCalculation(p.Db.QueryRow(`
+	INSERT INTO tax_calculations (tax_year, total_income, snapshot_id, request, response)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING`+taxCalculationColumns+`;`, c.TaxYear, c.TotalIncome, c.SnapshotID, c.Request, c.Response))
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return saved, nil
+}
+
+// GetTaxCalculation returns the calculation with the given id, or nil when
+// there is none.
+func (p *Postgres) GetTaxCalculation(id int64) (*TaxCalculation, error) {
+	c, err := scanTaxCalculation(p.Db.QueryRow(`SELECT`+taxCalculationColumns+` FROM tax_calculations WHERE id = $1;`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return c, nil
+}
+
+// ListTaxCalculations returns a page of the calculations selected by f, the
+// latest first, and how many there are in all.
+func (p *Postgres) ListTaxCalculations(f CalculationFilter) ([]TaxCalculation, int, error) {
+	var conds []string
+	var args []interface{}
+	where := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if !f.From.IsZero() {
+		where("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		where("created_at < $%d", f.To)
+	}
+	if f.MinIncome != nil {
+		where("total_income >= $%d", *f.MinIncome)
+	}
+	if f.MaxIncome != nil {
+		where("total_income <= $%d", *f.MaxIncome)
+	}
+	filter := ""
+	if len(conds) > 0 {
+		filter = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := p.Db.QueryRow(`SELECT count(*) FROM tax_calculations`+filter+`;`, args...).Scan(&total); err != nil {
+		return nil, 0, errors.New(ct.ErrMsgDatabaseError)
+	}
+
+	args = append(args, f.Limit, f.Offset)
+	rows, err := p.Db.Query(`SELECT`+taxCalculationColumns+` FROM tax_calculations`+filter+
+		fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d;`, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer rows.Close()
+
+	var res []TaxCalculation
+	for rows.Next() {
+		c, err := scanTaxCalculation(rows)
+		if err != nil {
+			return nil, 0, errors.New(ct.ErrMsgDatabaseError)
+		}
+		res = append(res, *c)
+	}
+	if rows.Err() != nil {
+		return nil, 0, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return res, total, nil
+}
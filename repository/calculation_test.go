@@ -0,0 +1,94 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var calculationColumns = []string{"id", "created_at", "tax_year", "total_income", "snapshot_id", "request", "response"}
+
+func TestSaveTaxCalculation_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	created := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`INSERT INTO tax_calculations \(tax_year, total_income, snapshot_id, request, response\)`).
+		WithArgs(2024, money.Baht(500000), int64(3), []byte(`{}`), []byte(`{}`)).
+		WillReturnRows(sqlmock.NewRows(calculationColumns).AddRow(1, created, 2024, "500000.00", int64(3), []byte(`{}`), []byte(`{}`)))
+
+	saved, err := repository.New(db).SaveTaxCalculation(repository.TaxCalculation{
+		TaxYear: 2024, TotalIncome: money.Baht(500000), SnapshotID: 3, Request: []byte(`{}`), Response: []byte(`{}`),
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), saved.ID)
+	assert.Equal(t, created, saved.CreatedAt)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTaxCalculation_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT (.+) FROM tax_calculations WHERE id = \$1`).
+		WithArgs(int64(42)).
+		WillReturnRows(sqlmock.NewRows(calculationColumns))
+
+	c, err := repository.New(db).GetTaxCalculation(42)
+
+	assert.Nil(t, err)
+	assert.Nil(t, c)
+}
+
+func TestListTaxCalculations(t *testing.T) {
+	t.Run("given filters should select and count the same rows", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+
+		from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		min := money.Baht(100000)
+		mock.ExpectQuery(`SELECT count\(\*\) FROM tax_calculations WHERE created_at >= \$1 AND total_income >= \$2;`).
+			WithArgs(from, min).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectQuery(`SELECT (.+) FROM tax_calculations WHERE created_at >= \$1 AND total_income >= \$2 ORDER BY created_at DESC, id DESC LIMIT \$3 OFFSET \$4;`).
+			WithArgs(from, min, 2, 0).
+			WillReturnRows(sqlmock.NewRows(calculationColumns).
+				AddRow(3, from, 2024, "500000.00", 3, []byte(`{}`), []byte(`{}`)).
+				AddRow(2, from, 2024, "400000.00", 3, []byte(`{}`), []byte(`{}`)))
+
+		rows, total, err := repository.New(db).ListTaxCalculations(repository.CalculationFilter{From: from, MinIncome: &min, Limit: 2})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 3, total)
+		assert.Len(t, rows, 2)
+		assert.Equal(t, money.Baht(400000), rows[1].TotalIncome)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given no filter should list everything", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT count\(\*\) FROM tax_calculations;`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery(`FROM tax_calculations ORDER BY created_at DESC, id DESC LIMIT \$1 OFFSET \$2;`).
+			WithArgs(50, 0).
+			WillReturnRows(sqlmock.NewRows(calculationColumns))
+
+		rows, total, err := repository.New(db).ListTaxCalculations(repository.CalculationFilter{Limit: 50})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, total)
+		assert.Empty(t, rows)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
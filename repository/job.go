@@ -0,0 +1,349 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/lib/pq"
+)
+
+// jobFileChunk is the size of the pieces an uploaded file is stored in.
+const jobFileChunk = 1 << 20
+
+// TaxJob is a CSV upload calculated in the background. Claim identifies the
+// run that claimed the job: a worker may only record progress or the outcome
+// while its claim is the job's current one, so a worker that stalled past
+// its lease cannot interfere with the run that took the job over.
+// InputHeader is the header of the uploaded file, which the Input of every
+// row goes with.
+type TaxJob struct {
+	ID            string     `postgres:"id"`
+	Status        string     `postgres:"status"`
+	Strict        bool       `postgres:"strict"`
+	Lang          string     `postgres:"lang"`
+	FileSize      int64      `postgres:"file_size"`
+	ReadBytes     int64      `postgres:"read_bytes"`
+	ProcessedRows int        `postgres:"processed_rows"`
+	ErrorRows     int        `postgres:"error_rows"`
+	Error         []byte     `postgres:"error"`
+	CreatedAt     time.Time  `postgres:"created_at"`
+	StartedAt     *time.Time `postgres:"started_at"`
+	FinishedAt    *time.Time `postgres:"finished_at"`
+	Claim         string     `postgres:"claim"`
+	InputHeader   []string   `postgres:"input_header"`
+}
+
+// ErrTaxJobClaimLost is returned by the writes of a worker whose claim on a
+// job has been taken over, or whose job is no longer running.
+var ErrTaxJobClaimLost = errors.New(ct.ErrMsgTaxJobClaimLost)
+
+// TaxJobRow is the result of one CSV row of a job: its tax, with the tax of
+// each level as JSON, or its error as JSON. Input is the cells of the row.
+type TaxJobRow struct {
+	Seq           int          `postgres:"seq"`
+	RowID         string       `postgres:"row_id"`
+	TotalIncome   money.Amount `postgres:"total_income"`
+	Tax           money.Amount `postgres:"tax"`
+	TaxRefund     money.Amount `postgres:"tax_refund"`
+	TaxableIncome money.Amount `postgres:"taxable_income"`
+	TaxLevels     []byte       `postgres:"tax_levels"`
+	Input         []string     `postgres:"input"`
+	Error         []byte       `postgres:"error"`
+}
+
+type JobRepository interface {
+	CreateTaxJob(job TaxJob, file io.Reader) (*TaxJob, error)
+	GetTaxJob(id string) (*TaxJob, error)
+	ClaimTaxJob(lease time.Duration) (*TaxJob, error)
+	TaxJobFile(id string) io.Reader
+	SaveTaxJobRows(job TaxJob, rows []TaxJobRow, lease time.Duration) error
+	FinishTaxJob(job TaxJob) error
+	ReleaseTaxJob(job TaxJob) error
+	TaxJobRows(id string, yield func(TaxJobRow) error) error
+}
+
+const taxJobColumns = `
+	id, status, strict, lang,
+	file_size, read_bytes, processed_rows, error_rows, error,
+	created_at, started_at, finished_at, claim, input_header`
+
+func scanTaxJob(row scanner) (*TaxJob, error) {
+	var j TaxJob
+	var claim sql.NullString
+	err := row.Scan(&j.ID, &j.Status, &j.Strict, &j.Lang,
+		&j.FileSize, &j.ReadBytes, &j.ProcessedRows, &j.ErrorRows, &j.Error,
+		&j.CreatedAt, &j.StartedAt, &j.FinishedAt, &claim, pq.Array(&j.InputHeader))
+	j.Claim = claim.String
+	return &j, err
+}
+
+// leaseHeld reports whether res changed the job, i.e. the claim it was made
+// under was still current.
+func leaseHeld(res sql.Result) error {
+	if affect, _ := res.RowsAffected(); affect < 1 {
+		return ErrTaxJobClaimLost
+	}
+	return nil
+}
+
+// CreateTaxJob queues a job for file. The file is stored along with the job,
+// in chunks, so any replica can run it.
+func (p *Postgres) CreateTaxJob(job TaxJob, file io.Reader) (*TaxJob, error) {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRow(`INSERT INTO tax_jobs (strict, lang) VALUES ($1, $2) RETURNING id;`, job.Strict, job.Lang).Scan(&id)
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+
+	var size int64
+	buf := make([]byte, jobFileChunk)
+	for seq := 0; ; seq++ {
+		n, err := io.ReadFull(file, buf)
+		if n > 0 {
+			if _, err := tx.Exec(`INSERT INTO tax_job_files (job_id, seq, data) VALUES ($1, $2, $3);`, id, seq, buf[:n]); err != nil {
+				return nil, errors.New(ct.ErrMsgDatabaseError)
+			}
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New(ct.ErrMsgReadCsvFailed)
+		}
+	}
+
+	created, err := scanTaxJob(tx.QueryRow(`
+	UPDATE tax_jobs SET file_size = $2 WHERE id = $1
+	RETURNING`+taxJobColumns+`;`, id, size))
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return created, nil
+}
+
+// GetTaxJob returns the job with the given id, or nil when there is none.
+func (p *Postgres) GetTaxJob(id string) (*TaxJob, error) {
+	job, err := scanTaxJob(p.Db.QueryRow(`SELECT`+taxJobColumns+` FROM tax_jobs WHERE id = $1;`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return job, nil
+}
+
+// ClaimTaxJob marks the oldest queued job as running for lease under a new
+// claim and returns it, or nil when there is nothing to run. A running job
+// whose lease ran out, e.g. its replica died, is claimed again and starts
+// over.
+func (p *Postgres) ClaimTaxJob(lease time.Duration) (*TaxJob, error) {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer tx.Rollback()
+
+	job, err := scanTaxJob(tx.QueryRow(`
+	UPDATE tax_jobs
+	SET status = 'running', started_at = now(), locked_until = now() + $1 * interval '1 millisecond',
+		claim = gen_random_uuid(), read_bytes = 0, processed_rows = 0, error_rows = 0
+	WHERE id = (
+		SELECT id FROM tax_jobs
+		WHERE status = 'queued' OR (status = 'running' AND locked_until < now())
+		ORDER BY created_at
+		FOR UPDATE SKIP LOCKED
+		LIMIT 1
+	)
+	RETURNING`+taxJobColumns+`;`, lease.Milliseconds()))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM tax_job_rows WHERE job_id = $1;`, job.ID); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return job, nil
+}
+
+// TaxJobFile reads back the file of a job one chunk at a time.
+func (p *Postgres) TaxJobFile(id string) io.Reader {
+	return &jobFileReader{db: p.Db, id: id}
+}
+
+type jobFileReader struct {
+	db  *sql.DB
+	id  string
+	seq int
+	buf []byte
+	eof bool
+}
+
+func (r *jobFileReader) Read(b []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		err := r.db.QueryRow(`SELECT data FROM tax_job_files WHERE job_id = $1 AND seq = $2;`, r.id, r.seq).Scan(&r.buf)
+		if err == sql.ErrNoRows {
+			r.eof = true
+			continue
+		}
+		if err != nil {
+			return 0, errors.New(ct.ErrMsgDatabaseError)
+		}
+		r.seq++
+	}
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// jsonText returns JSON as text, or nil for none: both Exec and COPY send
+// []byte as bytea, which a jsonb column does not take.
+func jsonText(b []byte) interface{} {
+	if b == nil {
+		return nil
+	}
+	return string(b)
+}
+
+// SaveTaxJobRows stores a batch of results, records the progress of job and
+// renews its lease. It returns ErrTaxJobClaimLost, storing nothing, when job
+// has been claimed again since.
+func (p *Postgres) SaveTaxJobRows(job TaxJob, rows []TaxJobRow, lease time.Duration) error {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer tx.Rollback()
+
+	// the job row stays locked until commit, so it cannot be claimed again
+	// while the batch is copied
+	res, err := tx.Exec(`
+	UPDATE tax_jobs
+	SET read_bytes = $3, processed_rows = $4, error_rows = $5, locked_until = now() + $6 * interval '1 millisecond',
+		input_header = $7
+	WHERE id = $1 AND status = 'running' AND claim = $2;`, job.ID, job.Claim, job.ReadBytes, job.ProcessedRows, job.ErrorRows, lease.Milliseconds(), pq.Array(job.InputHeader))
+	if err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := leaseHeld(res); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("tax_job_rows", "job_id", "seq", "row_id", "total_income", "tax", "tax_refund", "taxable_income", "tax_levels", "input", "error"))
+	if err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	for _, r := range rows {
+		var input interface{}
+		if r.Input != nil {
+			input, _ = pq.Array(r.Input).Value()
+		}
+		if _, err := stmt.Exec(job.ID, r.Seq, r.RowID, r.TotalIncome, r.Tax, r.TaxRefund, r.TaxableIncome, jsonText(r.TaxLevels), input, jsonText(r.Error)); err != nil {
+			return errors.New(ct.ErrMsgDatabaseError)
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := stmt.Close(); err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	return nil
+}
+
+// FinishTaxJob records the final status of job and drops its file. It
+// returns ErrTaxJobClaimLost, changing nothing, when job has been claimed
+// again since.
+func (p *Postgres) FinishTaxJob(job TaxJob) error {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+	UPDATE tax_jobs
+	SET status = $3, error = $4, read_bytes = $5, processed_rows = $6, error_rows = $7,
+		finished_at = now(), locked_until = NULL
+	WHERE id = $1 AND status = 'running' AND claim = $2;`, job.ID, job.Claim, job.Status, jsonText(job.Error), job.ReadBytes, job.ProcessedRows, job.ErrorRows)
+	if err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := leaseHeld(res); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM tax_job_files WHERE job_id = $1;`, job.ID); err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	return nil
+}
+
+// ReleaseTaxJob queues a running job again, e.g. when its replica shuts down
+// before it is done. It returns ErrTaxJobClaimLost when job has been claimed
+// again since, leaving the job to its new run.
+func (p *Postgres) ReleaseTaxJob(job TaxJob) error {
+	res, err := p.Db.Exec(`
+	UPDATE tax_jobs SET status = 'queued', locked_until = NULL, claim = NULL
+	WHERE id = $1 AND status = 'running' AND claim = $2;`, job.ID, job.Claim)
+	if err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	return leaseHeld(res)
+}
+
+// TaxJobRows calls yield with the results of a job in file order.
+func (p *Postgres) TaxJobRows(id string, yield func(TaxJobRow) error) error {
+	rows, err := p.Db.Query(`
+	SELECT seq, row_id, total_income, tax, tax_refund, taxable_income, tax_levels, input, error
+	FROM tax_job_rows
+	WHERE job_id = $1
+	ORDER BY seq;`, id)
+	if err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r TaxJobRow
+		if err := rows.Scan(&r.Seq, &r.RowID, &r.TotalIncome, &r.Tax, &r.TaxRefund, &r.TaxableIncome, &r.TaxLevels, pq.Array(&r.Input), &r.Error); err != nil {
+			return errors.New(ct.ErrMsgDatabaseError)
+		}
+		if err := yield(r); err != nil {
+			return err
+		}
+	}
+	if rows.Err() != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	return nil
+}
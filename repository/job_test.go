@@ -0,0 +1,252 @@
+package repository_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	jobID   = "6f1c2a8e-3b4d-4e5f-8a9b-0c1d2e3f4a5b"
+	claimID = "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+)
+
+var jobColumns = []string{"id", "status", "strict", "lang", "file_size", "read_bytes", "processed_rows", "error_rows", "error", "created_at", "started_at", "finished_at", "claim", "input_header"}
+
+func jobRow(status string) *sqlmock.Rows {
+	return sqlmock.NewRows(jobColumns).AddRow(jobID, status, false, "th", 18, 0, 0, 0, nil, time.Now(), nil, nil, claimID, "{id,totalIncome}")
+}
+
+func TestCreateTaxJob_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	file := "totalIncome\n500000\n"
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO tax_jobs \(strict, lang\)`).
+		WithArgs(false, "th").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(jobID))
+	mock.ExpectExec(`INSERT INTO tax_job_files`).
+		WithArgs(jobID, 0, []byte(file)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`UPDATE tax_jobs SET file_size = \$2 WHERE id = \$1 RETURNING`).
+		WithArgs(jobID, int64(len(file))).
+		WillReturnRows(jobRow("queued"))
+	mock.ExpectCommit()
+
+	repo := repository.New(db)
+
+	job, err := repo.CreateTaxJob(repository.TaxJob{Lang: "th"}, strings.NewReader(file))
+
+	assert.Nil(t, err)
+	assert.Equal(t, jobID, job.ID)
+	assert.Equal(t, "queued", job.Status)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTaxJob_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT (.+) FROM tax_jobs WHERE id = \$1`).
+		WithArgs(jobID).
+		WillReturnRows(sqlmock.NewRows(jobColumns))
+
+	repo := repository.New(db)
+
+	job, err := repo.GetTaxJob(jobID)
+
+	assert.Nil(t, err)
+	assert.Nil(t, job)
+}
+
+func TestClaimTaxJob(t *testing.T) {
+	t.Run("given queued job should claim it and clear old results", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`UPDATE tax_jobs SET status = 'running'(.+)FOR UPDATE SKIP LOCKED`).
+			WithArgs(int64(60000)).
+			WillReturnRows(jobRow("running"))
+		mock.ExpectExec(`DELETE FROM tax_job_rows WHERE job_id = \$1`).
+			WithArgs(jobID).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		job, err := repository.New(db).ClaimTaxJob(time.Minute)
+
+		assert.Nil(t, err)
+		assert.Equal(t, jobID, job.ID)
+		assert.Equal(t, claimID, job.Claim)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given no queued job should return nil", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`UPDATE tax_jobs`).WillReturnRows(sqlmock.NewRows(jobColumns))
+		mock.ExpectRollback()
+
+		job, err := repository.New(db).ClaimTaxJob(time.Minute)
+
+		assert.Nil(t, err)
+		assert.Nil(t, job)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestTaxJobFile_ReadsChunks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT data FROM tax_job_files`).WithArgs(jobID, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow([]byte("totalIncome\n")))
+	mock.ExpectQuery(`SELECT data FROM tax_job_files`).WithArgs(jobID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow([]byte("500000\n")))
+	mock.ExpectQuery(`SELECT data FROM tax_job_files`).WithArgs(jobID, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}))
+
+	b, err := io.ReadAll(repository.New(db).TaxJobFile(jobID))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "totalIncome\n500000\n", string(b))
+}
+
+func TestSaveTaxJobRows_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE tax_jobs SET read_bytes = \$3, processed_rows = \$4, error_rows = \$5(.+)WHERE id = \$1 AND status = 'running' AND claim = \$2`).
+		WithArgs(jobID, claimID, int64(40), 2, 1, int64(60000), "{\"id\",\"totalIncome\"}").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	copyIn := mock.ExpectPrepare(`COPY "tax_job_rows"`)
+	copyIn.ExpectExec().
+		WithArgs(jobID, 1, "E-01", "500000.00", "29000.00", "0.00", "440000.00", `[{"level":"0-150,000","tax":0}]`, "{\"E-01\",\"500000\"}", nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	copyIn.ExpectExec().
+		WithArgs(jobID, 2, "E-02", "0.00", "0.00", "0.00", "0.00", nil, "{\"E-02\",\"x\"}", `{"code":"wht_invalid"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	copyIn.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	copyIn.WillBeClosed()
+	mock.ExpectCommit()
+
+	err = repository.New(db).SaveTaxJobRows(repository.TaxJob{ID: jobID, Claim: claimID, ReadBytes: 40, ProcessedRows: 2, ErrorRows: 1, InputHeader: []string{"id", "totalIncome"}}, []repository.TaxJobRow{
+		{Seq: 1, RowID: "E-01", TotalIncome: money.Baht(500000), Tax: money.Baht(29000), TaxableIncome: money.Baht(440000), TaxLevels: []byte(`[{"level":"0-150,000","tax":0}]`), Input: []string{"E-01", "500000"}},
+		{Seq: 2, RowID: "E-02", Input: []string{"E-02", "x"}, Error: []byte(`{"code":"wht_invalid"}`)},
+	}, time.Minute)
+
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveTaxJobRows_ClaimLost(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE tax_jobs SET read_bytes = (.+) AND claim = \$2`).
+		WithArgs(jobID, "stale-claim", int64(40), 1, 0, int64(60000), nil).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err = repository.New(db).SaveTaxJobRows(repository.TaxJob{ID: jobID, Claim: "stale-claim", ReadBytes: 40, ProcessedRows: 1},
+		[]repository.TaxJobRow{{Seq: 1, RowID: "E-01", TotalIncome: money.Baht(500000), Tax: money.Baht(29000)}}, time.Minute)
+
+	assert.ErrorIs(t, err, repository.ErrTaxJobClaimLost)
+	assert.Nil(t, mock.ExpectationsWereMet(), "The stale worker should copy no rows")
+}
+
+func TestFinishTaxJob(t *testing.T) {
+	t.Run("given current claim should finish and drop the file", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE tax_jobs SET status = \$3, error = \$4(.+)WHERE id = \$1 AND status = 'running' AND claim = \$2`).
+			WithArgs(jobID, claimID, "done", nil, int64(40), 2, 0).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM tax_job_files WHERE job_id = \$1`).
+			WithArgs(jobID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err = repository.New(db).FinishTaxJob(repository.TaxJob{ID: jobID, Claim: claimID, Status: "done", ReadBytes: 40, ProcessedRows: 2})
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given stale claim should keep the job and its file", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE tax_jobs SET status = \$3`).
+			WithArgs(jobID, "stale-claim", "done", nil, int64(40), 2, 0).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err = repository.New(db).FinishTaxJob(repository.TaxJob{ID: jobID, Claim: "stale-claim", Status: "done", ReadBytes: 40, ProcessedRows: 2})
+
+		assert.ErrorIs(t, err, repository.ErrTaxJobClaimLost)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestReleaseTaxJob_ClaimLost(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectExec(`UPDATE tax_jobs SET status = 'queued'(.+)WHERE id = \$1 AND status = 'running' AND claim = \$2`).
+		WithArgs(jobID, "stale-claim").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = repository.New(db).ReleaseTaxJob(repository.TaxJob{ID: jobID, Claim: "stale-claim"})
+
+	assert.ErrorIs(t, err, repository.ErrTaxJobClaimLost)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestTaxJobRows_InOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT seq, row_id, total_income, tax, tax_refund, taxable_income, tax_levels, input, error FROM tax_job_rows WHERE job_id = \$1 ORDER BY seq`).
+		WithArgs(jobID).
+		WillReturnRows(sqlmock.NewRows([]string{"seq", "row_id", "total_income", "tax", "tax_refund", "taxable_income", "tax_levels", "input", "error"}).
+			AddRow(1, "E-01", "500000.00", "29000.00", "0.00", "440000.00", []byte(`[{"level":"0-150,000","tax":0}]`), "{E-01,500000}", nil).
+			AddRow(2, "E-02", "0.00", "0.00", "0.00", "0.00", nil, nil, []byte(`{"code":"wht_invalid"}`)))
+
+	var rows []repository.TaxJobRow
+	err = repository.New(db).TaxJobRows(jobID, func(r repository.TaxJobRow) error {
+		rows = append(rows, r)
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []repository.TaxJobRow{
+		{Seq: 1, RowID: "E-01", TotalIncome: money.Baht(500000), Tax: money.Baht(29000), TaxableIncome: money.Baht(440000), TaxLevels: []byte(`[{"level":"0-150,000","tax":0}]`), Input: []string{"E-01", "500000"}},
+		{Seq: 2, RowID: "E-02", Error: []byte(`{"code":"wht_invalid"}`)},
+	}, rows)
+}
@@ -1,11 +1,13 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
-	"os"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/kanawat2566/assessment-tax/config"
 	_ "github.com/lib/pq"
 )
 
@@ -13,23 +15,64 @@ type Postgres struct {
 	Db *sql.DB
 }
 
-func InitDB() (*sql.DB, error) {
-	godotenv.Load(".env")
-	databaseSource := os.Getenv("DATABASE_URL")
+type HealthRepository interface {
+	Ping(ctx context.Context) error
+}
+
+// pingTimeout bounds a single ping, so a database that does not answer counts
+// as down rather than hanging startup or a readiness probe.
+const pingTimeout = 5 * time.Second
 
-	db, err := sql.Open("postgres", databaseSource)
+// InitDB opens the database with the pool sized by cfg and waits for it to be
+// reachable, see Connect.
+func InitDB(cfg config.Database) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.URL)
 	if err != nil {
-		log.Fatal(err)
 		return nil, err
 	}
-	err = db.Ping()
-	if err != nil {
-		log.Fatal(err)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	if err := Connect(db, cfg); err != nil {
+		db.Close()
+		return nil, err
 	}
 	return db, nil
 }
 
+// Connect pings db until it answers, at most cfg.ConnectAttempts times,
+// backing off exponentially from cfg.ConnectBackoff up to
+// cfg.ConnectMaxBackoff between attempts. A database that is a few seconds
+// slower to start than the service is then no reason to crash.
+func Connect(db *sql.DB, cfg config.Database) error {
+	wait := cfg.ConnectBackoff
+	for attempt := 1; ; attempt++ {
+		err := ping(db)
+		if err == nil {
+			return nil
+		}
+		if attempt >= cfg.ConnectAttempts {
+			return fmt.Errorf("database not reachable after %d attempts: %w", attempt, err)
+		}
+		log.Printf("database not reachable, retrying in %v: %v", wait, err)
+		time.Sleep(wait)
+		wait = min(2*wait, cfg.ConnectMaxBackoff)
+	}
+}
+
+func ping(db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
 func New(db *sql.DB) *Postgres {
 
 	return &Postgres{Db: db}
 }
+
+// Ping checks that the database can be reached.
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.Db.PingContext(ctx)
+}
@@ -0,0 +1,45 @@
+package repository_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kanawat2566/assessment-tax/config"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnect(t *testing.T) {
+	cfg := config.Database{ConnectAttempts: 3, ConnectBackoff: time.Millisecond, ConnectMaxBackoff: 2 * time.Millisecond}
+	down := errors.New("connection refused")
+
+	t.Run("given database up after a retry should connect", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+		mock.ExpectPing().WillReturnError(down)
+		mock.ExpectPing()
+
+		err = repository.Connect(db, cfg)
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given database down should give up after the last attempt", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+		for i := 0; i < cfg.ConnectAttempts; i++ {
+			mock.ExpectPing().WillReturnError(down)
+		}
+
+		err = repository.Connect(db, cfg)
+
+		assert.ErrorIs(t, err, down)
+		assert.Contains(t, err.Error(), "3 attempts")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
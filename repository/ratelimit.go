@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+)
+
+// RateLimit is a token bucket: it holds up to Requests tokens and refills
+// them all over Window. A request takes a token, so a caller can burst up to
+// Requests and then keeps Requests per Window.
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// perSecond is how many tokens the bucket gains a second.
+func (l RateLimit) perSecond() float64 {
+	return float64(l.Requests) / l.Window.Seconds()
+}
+
+// refill returns the tokens of a bucket that had tokens elapsed ago.
+func (l RateLimit) refill(tokens float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(l.Requests), tokens+elapsed.Seconds()*l.perSecond())
+}
+
+// RateLimitState is a bucket after a request tried to take a token from it.
+// Reset is how long until the bucket is full again and RetryAfter, for a
+// request refused, how long until there is a token.
+type RateLimitState struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+func (l RateLimit) state(tokens float64, allowed bool) RateLimitState {
+	s := RateLimitState{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(l.Requests) - tokens) / l.perSecond() * float64(time.Second)),
+	}
+	if !allowed {
+		s.RetryAfter = time.Duration((1 - tokens) / l.perSecond() * float64(time.Second))
+	}
+	return s
+}
+
+// RateLimitStore keeps token buckets and quota counters by key.
+type RateLimitStore interface {
+	// TakeToken takes a token from the bucket of key at now, if there is one.
+	TakeToken(key string, l RateLimit, now time.Time) (RateLimitState, error)
+	// PeekToken returns the bucket of key at now without taking a token.
+	PeekToken(key string, l RateLimit, now time.Time) (RateLimitState, error)
+	// CountRequest counts a request against the quota of key for the window
+	// starting at start, and returns how many were counted in it so far. A
+	// counter from an earlier window starts over.
+	CountRequest(key string, start time.Time) (int, error)
+	// PruneRateLimits drops buckets last used before before, and quota
+	// counters of windows started before it. A bucket left alone for its
+	// window is full, which is the same as having none.
+	PruneRateLimits(before time.Time) error
+}
+
+// MemoryRateLimits keeps token buckets in memory. Each replica then limits on
+// its own, so use Postgres when there is more than one.
+type MemoryRateLimits struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	quotas  map[string]*quota
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type quota struct {
+	start time.Time
+	count int
+}
+
+func NewMemoryRateLimits() *MemoryRateLimits {
+	return &MemoryRateLimits{buckets: map[string]*bucket{}, quotas: map[string]*quota{}}
+}
+
+func (m *MemoryRateLimits) TakeToken(key string, l RateLimit, now time.Time) (RateLimitState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Requests), updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = l.refill(b.tokens, now.Sub(b.updated))
+	if now.After(b.updated) {
+		b.updated = now
+	}
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return l.state(b.tokens, allowed), nil
+}
+
+func (m *MemoryRateLimits) PeekToken(key string, l RateLimit, now time.Time) (RateLimitState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokens := float64(l.Requests)
+	if b, ok := m.buckets[key]; ok {
+		tokens = l.refill(b.tokens, now.Sub(b.updated))
+	}
+	return l.state(tokens, tokens >= 1), nil
+}
+
+func (m *MemoryRateLimits) CountRequest(key string, start time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q, ok := m.quotas[key]
+	if !ok || !q.start.Equal(start) {
+		q = &quota{start: start}
+		m.quotas[key] = q
+	}
+	q.count++
+	return q.count, nil
+}
+
+func (m *MemoryRateLimits) PruneRateLimits(before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, b := range m.buckets {
+		if b.updated.Before(before) {
+			delete(m.buckets, key)
+		}
+	}
+	for key, q := range m.quotas {
+		if q.start.Before(before) {
+			delete(m.quotas, key)
+		}
+	}
+	return nil
+}
+
+// TakeToken takes a token in one statement, so replicas sharing a bucket
+// never hand out the same token twice.
+func (p *Postgres) TakeToken(key string, l RateLimit, now time.Time) (RateLimitState, error) {
+	var tokens float64
+	var allowed bool
+	err := p.Db.QueryRow(`
+	INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+	VALUES ($1, $2 - 1, TRUE, $3)
+	ON CONFLICT (key) DO UPDATE SET
+		allowed = LEAST($2, b.tokens + GREATEST(0, EXTRACT(EPOCH FROM $3 - b.updated_at)) * $4) >= 1,
+		tokens = LEAST($2, b.tokens + GREATEST(0, EXTRACT(EPOCH FROM $3 - b.updated_at)) * $4)
+			- CASE WHEN LEAST($2, b.tokens + GREATEST(0, EXTRACT(EPOCH FROM $3 - b.updated_at)) * $4) >= 1 THEN 1 ELSE 0 END,
+		updated_at = GREATEST(b.updated_at, $3)
+	RETURNING tokens, allowed;`, key, float64(l.Requests), now, l.perSecond()).Scan(&tokens, &allowed)
+	if err != nil {
+		return RateLimitState{}, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return l.state(tokens, allowed), nil
+}
+
+func (p *Postgres) PeekToken(key string, l RateLimit, now time.Time) (RateLimitState, error) {
+	var tokens float64
+	var updated time.Time
+	err := p.Db.QueryRow(`SELECT tokens, updated_at FROM rate_limit_buckets WHERE key = $1;`, key).Scan(&tokens, &updated)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		tokens = float64(l.Requests)
+	case err != nil:
+		return RateLimitState{}, errors.New(ct.ErrMsgDatabaseError)
+	default:
+		tokens = l.refill(tokens, now.Sub(updated))
+	}
+	return l.state(tokens, tokens >= 1), nil
+}
+
+// CountRequest counts in one statement, so replicas sharing a quota never
+// lose a request.
+func (p *Postgres) CountRequest(key string, start time.Time) (int, error) {
+	var count int
+	err := p.Db.QueryRow(`
+	INSERT INTO rate_limit_quotas AS q (key, window_start, count)
+	VALUES ($1, $2, 1)
+	ON CONFLICT (key) DO UPDATE SET
+		count = CASE WHEN q.window_start = $2 THEN q.count + 1 ELSE 1 END,
+		window_start = $2
+	RETURNING count;`, key, start).Scan(&count)
+	if err != nil {
+		return 0, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return count, nil
+}
+
+func (p *Postgres) PruneRateLimits(before time.Time) error {
+	if _, err := p.Db.Exec(`DELETE FROM rate_limit_buckets WHERE updated_at < $1;`, before); err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	if _, err := p.Db.Exec(`DELETE FROM rate_limit_quotas WHERE window_start < $1;`, before); err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package repository_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRateLimits(t *testing.T) {
+	m := repository.NewMemoryRateLimits()
+	l := repository.RateLimit{Requests: 2, Window: time.Minute}
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	st, _ := m.TakeToken("calculate:ip:10.0.0.1", l, start)
+	assert.Equal(t, repository.RateLimitState{Allowed: true, Remaining: 1, Reset: 30 * time.Second}, st)
+
+	st, _ = m.TakeToken("calculate:ip:10.0.0.1", l, start)
+	assert.Equal(t, repository.RateLimitState{Allowed: true, Remaining: 0, Reset: time.Minute}, st)
+
+	st, _ = m.TakeToken("calculate:ip:10.0.0.1", l, start.Add(10*time.Second))
+	assert.False(t, st.Allowed, "The burst is used up")
+	assert.Equal(t, 20*time.Second, st.RetryAfter.Round(time.Second))
+
+	st, _ = m.TakeToken("calculate:ip:10.0.0.2", l, start.Add(10*time.Second))
+	assert.True(t, st.Allowed, "Every key should have its own bucket")
+
+	st, _ = m.TakeToken("calculate:ip:10.0.0.1", l, start.Add(30*time.Second))
+	assert.True(t, st.Allowed, "A token should be back after half the window")
+
+	st, _ = m.PeekToken("calculate:ip:10.0.0.1", l, start.Add(30*time.Second))
+	assert.Equal(t, 0, st.Remaining, "Peeking should not take a token")
+	st, _ = m.PeekToken("calculate:ip:10.0.0.3", l, start)
+	assert.Equal(t, repository.RateLimitState{Allowed: true, Remaining: 2}, st, "An unknown bucket is full")
+
+	assert.Nil(t, m.PruneRateLimits(start.Add(20*time.Second)))
+	st, _ = m.TakeToken("calculate:ip:10.0.0.2", l, start.Add(30*time.Second))
+	assert.Equal(t, 1, st.Remaining, "A pruned bucket should start full")
+}
+
+func TestMemoryRateLimits_CountRequest(t *testing.T) {
+	m := repository.NewMemoryRateLimits()
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	n, _ := m.CountRequest("bulk:client:payroll", day)
+	assert.Equal(t, 1, n)
+	n, _ = m.CountRequest("bulk:client:payroll", day)
+	assert.Equal(t, 2, n)
+	n, _ = m.CountRequest("bulk:client:other", day)
+	assert.Equal(t, 1, n, "Every key should have its own count")
+	n, _ = m.CountRequest("bulk:client:payroll", day.Add(24*time.Hour))
+	assert.Equal(t, 1, n, "A new window should start over")
+
+	assert.Nil(t, m.PruneRateLimits(day.Add(time.Hour)))
+	n, _ = m.CountRequest("bulk:client:other", day)
+	assert.Equal(t, 1, n, "A counter of a window over should be pruned")
+}
+
+func TestPeekToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	l := repository.RateLimit{Requests: 20, Window: 20 * time.Second}
+	mock.ExpectQuery(`SELECT tokens, updated_at FROM rate_limit_buckets WHERE key = \$1;`).
+		WithArgs("auth_failures:ip:10.0.0.1").
+		WillReturnRows(sqlmock.NewRows([]string{"tokens", "updated_at"}).AddRow(0.0, now.Add(-500*time.Millisecond)))
+	mock.ExpectQuery(`SELECT tokens, updated_at FROM rate_limit_buckets`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT tokens, updated_at FROM rate_limit_buckets`).WillReturnError(errors.New("db down"))
+
+	repo := repository.New(db)
+
+	st, err := repo.PeekToken("auth_failures:ip:10.0.0.1", l, now)
+	assert.Nil(t, err)
+	assert.False(t, st.Allowed)
+	assert.Equal(t, 500*time.Millisecond, st.RetryAfter.Round(time.Millisecond))
+
+	st, err = repo.PeekToken("auth_failures:ip:10.0.0.2", l, now)
+	assert.Nil(t, err)
+	assert.Equal(t, repository.RateLimitState{Allowed: true, Remaining: 20}, st, "An unknown bucket is full")
+
+	_, err = repo.PeekToken("auth_failures:ip:10.0.0.1", l, now)
+	assert.NotNil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCountRequest(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`INSERT INTO rate_limit_quotas (.+) ON CONFLICT \(key\) DO UPDATE SET (.+) RETURNING count;`).
+		WithArgs("bulk:client:payroll", day).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+	mock.ExpectQuery(`INSERT INTO rate_limit_quotas`).WillReturnError(errors.New("db down"))
+
+	repo := repository.New(db)
+
+	n, err := repo.CountRequest("bulk:client:payroll", day)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, n)
+
+	_, err = repo.CountRequest("bulk:client:payroll", day)
+	assert.NotNil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestTakeToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	l := repository.RateLimit{Requests: 60, Window: time.Minute}
+	mock.ExpectQuery(`INSERT INTO rate_limit_buckets (.+) ON CONFLICT \(key\) DO UPDATE SET (.+) RETURNING tokens, allowed;`).
+		WithArgs("bulk:client:payroll", float64(60), now, float64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens", "allowed"}).AddRow(0.5, false))
+	mock.ExpectQuery(`INSERT INTO rate_limit_buckets`).WillReturnError(errors.New("db down"))
+
+	repo := repository.New(db)
+
+	st, err := repo.TakeToken("bulk:client:payroll", l, now)
+	assert.Nil(t, err)
+	assert.Equal(t, repository.RateLimitState{Allowed: false, Remaining: 0, Reset: 59500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}, st)
+
+	_, err = repo.TakeToken("bulk:client:payroll", l, now)
+	assert.NotNil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPruneRateLimits(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	before := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	mock.ExpectExec(`DELETE FROM rate_limit_buckets WHERE updated_at < \$1;`).WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`DELETE FROM rate_limit_quotas WHERE window_start < \$1;`).WithArgs(before).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.Nil(t, repository.New(db).PruneRateLimits(before))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
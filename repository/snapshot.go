@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+)
+
+// configLockKey is the advisory lock every write to the tax configuration
+// holds, so that writes, and the snapshots they record, follow one another.
+const configLockKey = 7306115
+
+// ConfigSnapshot is the whole tax configuration, every tax year of it, as it
+// was after a change. Snapshots are never changed, so a calculation can be
+// made again under the settings it was first made with.
+type ConfigSnapshot struct {
+	ID         int64
+	CreatedAt  time.Time
+	TaxRates   []*IncomeTaxRates
+	Allowances []Allowances
+	Groups     []AllowanceGroups
+}
+
+// snapshotConfig records the configuration as it is in the transaction.
+const snapshotConfig = `
+	INSERT INTO config_snapshots (tax_rates, allowances, allowance_groups)
+	SELECT
+		COALESCE((SELECT jsonb_agg(to_jsonb(r) ORDER BY r.tax_year, r.min_income) FROM income_tax_rates r), '[]'),
+		COALESCE((SELECT jsonb_agg(to_jsonb(a) ORDER BY a.allowance_name, a.tax_year) FROM allowances a), '[]'),
+		COALESCE((SELECT jsonb_agg(to_jsonb(g) ORDER BY g.group_name, g.tax_year) FROM allowance_groups g), '[]');`
+
+// lockConfig waits for other writes to the configuration to finish. The lock
+// is held until tx ends.
+func lockConfig(tx *sql.Tx) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock($1);`, configLockKey)
+	return err
+}
+
+// configChanged records a snapshot of the configuration written by tx and
+// announces the change on ConfigChannel. The notification is only sent when
+// tx commits.
+func configChanged(tx *sql.Tx) error {
+	if _, err := tx.Exec(snapshotConfig); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`SELECT pg_notify($1, '');`, ConfigChannel)
+	return err
+}
+
+// GetConfigSnapshot returns the snapshot with the given id, or the latest one
+// when id is zero. It returns nil when there is no such snapshot.
+func (p *Postgres) GetConfigSnapshot(id int64) (*ConfigSnapshot, error) {
+	query := `
+	SELECT id, created_at, tax_rates, allowances, allowance_groups
+	FROM config_snapshots
+	WHERE id = $1;`
+	args := []interface{}{id}
+	if id == 0 {
+		query = `
+	SELECT id, created_at, tax_rates, allowances, allowance_groups
+	FROM config_snapshots
+	ORDER BY id DESC
+	LIMIT 1;`
+		args = nil
+	}
+
+	var s ConfigSnapshot
+	var rates, allowances, groups []byte
+	err := p.Db.QueryRow(query, args...).Scan(&s.ID, &s.CreatedAt, &rates, &allowances, &groups)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if json.Unmarshal(rates, &s.TaxRates) != nil || json.Unmarshal(allowances, &s.Allowances) != nil || json.Unmarshal(groups, &s.Groups) != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return &s, nil
+}
@@ -0,0 +1,62 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var snapshotColumns = []string{"id", "created_at", "tax_rates", "allowances", "allowance_groups"}
+
+func TestGetConfigSnapshot(t *testing.T) {
+	created := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	rates := `[{"id": 1, "tax_year": 2017, "income_level": "0-150,000", "min_income": 0.00, "max_income": 150000.00, "tax_rate": 0.00},
+		{"id": 2, "tax_year": 2017, "income_level": "150,001 ขึ้นไป", "min_income": 150001.00, "max_income": null, "tax_rate": 10.00}]`
+	allowances := `[{"allowance_name": "donation", "tax_year": 2017, "response_name": "donation", "admin_configurable": false, "auto_claim": false,
+		"cap_rule": "flat", "cap_percent": 0, "group_name": null, "max_allowance": 100000.00, "min_allowance": 0.00, "limit_allowance": 100000.00}]`
+	groups := `[{"group_name": "retirement", "tax_year": 2017, "limit_allowance": 500000.00}]`
+
+	t.Run("given no id should return the latest", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT (.+) FROM config_snapshots ORDER BY id DESC LIMIT 1`).
+			WillReturnRows(sqlmock.NewRows(snapshotColumns).AddRow(3, created, []byte(rates), []byte(allowances), []byte(groups)))
+
+		s, err := repository.New(db).GetConfigSnapshot(0)
+
+		assert.Nil(t, err)
+		assert.Equal(t, &repository.ConfigSnapshot{
+			ID:        3,
+			CreatedAt: created,
+			TaxRates: []*repository.IncomeTaxRates{
+				{ID: 1, TaxYear: 2017, IncomeLevel: "0-150,000", MinIncome: money.Baht(0), MaxIncome: upTo(150000), TaxRate: money.Percentage(0)},
+				{ID: 2, TaxYear: 2017, IncomeLevel: "150,001 ขึ้นไป", MinIncome: money.Baht(150001), TaxRate: money.Percentage(10)},
+			},
+			Allowances: []repository.Allowances{{Allowance_name: "donation", TaxYear: 2017, ResponseName: "donation", CapRule: "flat",
+				MaxAmt: money.Baht(100000), LimitAmt: money.Baht(100000)}},
+			Groups: []repository.AllowanceGroups{{GroupName: "retirement", TaxYear: 2017, LimitAmt: money.Baht(500000)}},
+		}, s)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given unknown id should return nil", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT (.+) FROM config_snapshots WHERE id = \$1`).
+			WithArgs(int64(9)).
+			WillReturnRows(sqlmock.NewRows(snapshotColumns))
+
+		s, err := repository.New(db).GetConfigSnapshot(9)
+
+		assert.Nil(t, err)
+		assert.Nil(t, s)
+	})
+}
@@ -5,54 +5,232 @@ import (
 	"errors"
 
 	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/lib/pq"
 )
 
 type IncomeTaxRates struct {
-	ID          int     `postgres:"id"`
-	IncomeLevel string  `postgres:"income_level"`
-	MinIncome   float64 `postgres:"min_income"`
-	MaxIncome   float64 `postgres:"max_income"`
-	TaxRate     float64 `postgres:"tax_rate"`
+	ID          int           `postgres:"id" json:"id"`
+	TaxYear     int           `postgres:"tax_year" json:"tax_year"`
+	IncomeLevel string        `postgres:"income_level" json:"income_level"`
+	MinIncome   money.Amount  `postgres:"min_income" json:"min_income"`
+	MaxIncome   *money.Amount `postgres:"max_income" json:"max_income"`
+	TaxRate     money.Percent `postgres:"tax_rate" json:"tax_rate"`
 }
 
 type Allowances struct {
-	Allowance_name string  `postgres:"allowance_name"`
-	MinAmt         float64 `postgres:"min_allowance"`
-	MaxAmt         float64 `postgres:"max_allowance"`
-	LimitAmt       float64 `postgres:"limit_allowance"`
+	Allowance_name string        `postgres:"allowance_name" json:"allowance_name"`
+	TaxYear        int           `postgres:"tax_year" json:"tax_year"`
+	ResponseName   string        `postgres:"response_name" json:"response_name"`
+	Configurable   bool          `postgres:"admin_configurable" json:"admin_configurable"`
+	AutoClaim      bool          `postgres:"auto_claim" json:"auto_claim"`
+	CapRule        string        `postgres:"cap_rule" json:"cap_rule"`
+	CapPercent     money.Percent `postgres:"cap_percent" json:"cap_percent"`
+	GroupName      string        `postgres:"group_name" json:"group_name"`
+	MinAmt         money.Amount  `postgres:"min_allowance" json:"min_allowance"`
+	MaxAmt         money.Amount  `postgres:"max_allowance" json:"max_allowance"`
+	LimitAmt       money.Amount  `postgres:"limit_allowance" json:"limit_allowance"`
+}
+
+type AllowanceGroups struct {
+	GroupName string       `postgres:"group_name" json:"group_name"`
+	TaxYear   int          `postgres:"tax_year" json:"tax_year"`
+	LimitAmt  money.Amount `postgres:"limit_allowance" json:"limit_allowance"`
 }
 
 type TaxRepository interface {
-	GetTaxRates() ([]*IncomeTaxRates, error)
-	GetLimitAllowances(allowanceType string) (Allowances, error)
-	UpdateConfigDeduct(config ct.Deduction) error
+	GetTaxRates(taxYear int) ([]*IncomeTaxRates, error)
+	ListTaxRates(taxYear int) ([]*IncomeTaxRates, error)
+	GetTaxRate(id int) (*IncomeTaxRates, error)
+	SaveTaxRates(taxYear int, base, rates []*IncomeTaxRates, change AuditEntry) ([]*IncomeTaxRates, error)
+	GetLimitAllowances(allowanceType string, taxYear int) (Allowances, error)
+	GetAllowances(taxYear int) ([]Allowances, error)
+	CreateAllowance(allowance Allowances, change AuditEntry) (bool, error)
+	UpdateConfigDeduct(config ct.Deduction, change AuditEntry) error
+	GetConfigSnapshot(id int64) (*ConfigSnapshot, error)
 }
 
-func (p *Postgres) GetTaxRates() ([]*IncomeTaxRates, error) {
+// GetTaxRates returns the bracket set in force for taxYear, i.e. the set with
+// the latest tax_year that is not after taxYear.
+func (p *Postgres) GetTaxRates(taxYear int) ([]*IncomeTaxRates, error) {
 	rows, err := p.Db.Query(`
 	SELECT 
-	id, income_level, 
+	id, tax_year, income_level, 
 	min_income, max_income, 
 	tax_rate 
 	FROM income_tax_rates
-	ORDER BY id;`)
+	WHERE tax_year = (
+		SELECT MAX(tax_year) FROM income_tax_rates WHERE tax_year <= $1
+	)
+	ORDER BY min_income;`, taxYear)
 
 	if err != nil {
 		return nil, errors.New(ct.ErrMsgDatabaseError)
 	}
+	return scanTaxRates(rows)
+}
+
+// taxRatesOfYear selects the brackets stored for a tax year.
+const taxRatesOfYear = `
+	SELECT 
+	id, tax_year, income_level, 
+	min_income, max_income, 
+	tax_rate 
+	FROM income_tax_rates
+	WHERE tax_year = $1
+	ORDER BY min_income;`
+
+// ErrTaxRatesChanged is returned by SaveTaxRates when the brackets of the
+// year are no longer those the change was made to.
+var ErrTaxRatesChanged = errors.New(ct.ErrMsgTaxRatesChanged)
+
+// ListTaxRates returns only the brackets stored for taxYear itself.
+func (p *Postgres) ListTaxRates(taxYear int) ([]*IncomeTaxRates, error) {
+	rows, err := p.Db.Query(taxRatesOfYear, taxYear)
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return scanTaxRates(rows)
+}
+
+func scanTaxRates(rows *sql.Rows) ([]*IncomeTaxRates, error) {
 	defer rows.Close()
 	var incomeTaxRates []*IncomeTaxRates
 	for rows.Next() {
 		var t IncomeTaxRates
-		err = rows.Scan(&t.ID, &t.IncomeLevel, &t.MinIncome, &t.MaxIncome, &t.TaxRate)
+		err := rows.Scan(&t.ID, &t.TaxYear, &t.IncomeLevel, &t.MinIncome, &t.MaxIncome, &t.TaxRate)
 		if err != nil {
 			return nil, errors.New(ct.ErrMsgDatabaseError)
 		}
 		incomeTaxRates = append(incomeTaxRates, &t)
 	}
+	if rows.Err() != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
 	return incomeTaxRates, nil
 }
-func (p *Postgres) GetLimitAllowances(allowanceType string) (Allowances, error) {
+
+// GetTaxRate returns the bracket with the given id, or nil when there is none.
+func (p *Postgres) GetTaxRate(id int) (*IncomeTaxRates, error) {
+	row := p.Db.QueryRow(`
+	SELECT 
+	id, tax_year, income_level, 
+	min_income, max_income, 
+	tax_rate 
+	FROM income_tax_rates
+	WHERE id = $1;`, id)
+
+	var t IncomeTaxRates
+	err := row.Scan(&t.ID, &t.TaxYear, &t.IncomeLevel, &t.MinIncome, &t.MaxIncome, &t.TaxRate)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return &t, nil
+}
+
+// SaveTaxRates replaces the bracket set of taxYear with rates in a single
+// transaction. Rates with an ID are updated in place, rates without one are
+// inserted, and brackets of that year missing from rates are deleted.
+//
+// base is the set of taxYear, as ListTaxRates returned it, that rates was
+// made from. When another write changed the set since, nothing is saved and
+// ErrTaxRatesChanged is returned, so that write is not lost.
+func (p *Postgres) SaveTaxRates(taxYear int, base, rates []*IncomeTaxRates, change AuditEntry) ([]*IncomeTaxRates, error) {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer tx.Rollback()
+	if err := lockConfig(tx); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	rows, err := tx.Query(taxRatesOfYear, taxYear)
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	cur, err := scanTaxRates(rows)
+	if err != nil {
+		return nil, err
+	}
+	if !sameTaxRates(cur, base) {
+		return nil, ErrTaxRatesChanged
+	}
+	if change.OldValue, err = auditValue(tx, taxRatesOfYearJSON, taxYear); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+
+	var keep []int64
+	for _, r := range rates {
+		if r.ID != 0 {
+			keep = append(keep, int64(r.ID))
+		}
+	}
+	_, err = tx.Exec(`DELETE FROM income_tax_rates WHERE tax_year = $1 AND NOT (id = ANY($2));`, taxYear, pq.Array(keep))
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+
+	saved := make([]*IncomeTaxRates, 0, len(rates))
+	for _, r := range rates {
+		t := *r
+		t.TaxYear = taxYear
+		if t.ID == 0 {
+			err = tx.QueryRow(`
+			INSERT INTO income_tax_rates (tax_year, income_level, min_income, max_income, tax_rate)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id;`, t.TaxYear, t.IncomeLevel, t.MinIncome, t.MaxIncome, t.TaxRate).Scan(&t.ID)
+		} else {
+			_, err = tx.Exec(`
+			UPDATE income_tax_rates
+			SET income_level = $3, min_income = $4, max_income = $5, tax_rate = $6
+			WHERE id = $1 AND tax_year = $2;`, t.ID, t.TaxYear, t.IncomeLevel, t.MinIncome, t.MaxIncome, t.TaxRate)
+		}
+		if err != nil {
+			return nil, errors.New(ct.ErrMsgDatabaseError)
+		}
+		saved = append(saved, &t)
+	}
+
+	if change.NewValue, err = auditValue(tx, taxRatesOfYearJSON, taxYear); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := audit(tx, change); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := configChanged(tx); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return saved, nil
+}
+
+// sameTaxRates tells whether a and b hold the same brackets, in the same
+// order.
+func sameTaxRates(a, b []*IncomeTaxRates) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := *a[i], *b[i]
+		if (x.MaxIncome == nil) != (y.MaxIncome == nil) || x.MaxIncome != nil && *x.MaxIncome != *y.MaxIncome {
+			return false
+		}
+		x.MaxIncome, y.MaxIncome = nil, nil
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
+
+// GetLimitAllowances returns the allowance in force for taxYear. The result
+// is empty when the type does not exist for that year.
+func (p *Postgres) GetLimitAllowances(allowanceType string, taxYear int) (Allowances, error) {
 	res := Allowances{}
 
 	if allowanceType == "" {
@@ -61,25 +239,147 @@ func (p *Postgres) GetLimitAllowances(allowanceType string) (Allowances, error)
 
 	query := `
 	SELECT  
+	allowance_name,
+	tax_year,
+	response_name,
+	admin_configurable,
+	auto_claim,
+	cap_rule,
+	cap_percent,
+	COALESCE(group_name, ''),
 	max_allowance,
 	min_allowance,
 	limit_allowance 
 	FROM allowances 
-	WHERE allowance_name=$1`
+	WHERE allowance_name=$1 AND tax_year <= $2
+	ORDER BY tax_year DESC
+	LIMIT 1`
 
-	row := p.Db.QueryRow(query, allowanceType)
+	row := p.Db.QueryRow(query, allowanceType, taxYear)
 
-	err := row.Scan(&res.MaxAmt, &res.MinAmt, &res.LimitAmt)
+	err := scanAllowance(row, &res)
 	if err == sql.ErrNoRows {
-		return res, errors.New(ct.ErrMsgDatabaseError)
+		return Allowances{}, nil
+	}
+	if err != nil {
+		return Allowances{}, errors.New(ct.ErrMsgDatabaseError)
 	}
-	res.Allowance_name = allowanceType
 	return res, nil
 }
 
-func (p *Postgres) UpdateConfigDeduct(config ct.Deduction) error {
-	query := `UPDATE allowances SET limit_allowance = $1 WHERE allowance_name=$2;`
-	res, err := p.Db.Exec(query, config.Amount, config.Type)
+// GetAllowances returns every allowance type that exists for taxYear, each
+// with the limits in force for that year.
+func (p *Postgres) GetAllowances(taxYear int) ([]Allowances, error) {
+	rows, err := p.Db.Query(`
+	SELECT DISTINCT ON (allowance_name)
+	allowance_name,
+	tax_year,
+	response_name,
+	admin_configurable,
+	auto_claim,
+	cap_rule,
+	cap_percent,
+	COALESCE(group_name, ''),
+	max_allowance,
+	min_allowance,
+	limit_allowance 
+	FROM allowances 
+	WHERE tax_year <= $1
+	ORDER BY allowance_name, tax_year DESC`, taxYear)
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer rows.Close()
+
+	var res []Allowances
+	for rows.Next() {
+		var a Allowances
+		if err := scanAllowance(rows, &a); err != nil {
+			return nil, errors.New(ct.ErrMsgDatabaseError)
+		}
+		res = append(res, a)
+	}
+	if rows.Err() != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return res, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAllowance(row scanner, a *Allowances) error {
+	return row.Scan(&a.Allowance_name, &a.TaxYear, &a.ResponseName, &a.Configurable, &a.AutoClaim, &a.CapRule, &a.CapPercent, &a.GroupName, &a.MaxAmt, &a.MinAmt, &a.LimitAmt)
+}
+
+// CreateAllowance registers a new allowance type. It returns false without an
+// error when the type or its response name is already registered for any
+// tax year.
+func (p *Postgres) CreateAllowance(a Allowances, change AuditEntry) (bool, error) {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer tx.Rollback()
+	if err := lockConfig(tx); err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+
+	query := `
+	INSERT INTO allowances (allowance_name, tax_year, response_name, admin_configurable, auto_claim, cap_rule, cap_percent, group_name, max_allowance, min_allowance, limit_allowance)
+	SELECT $1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10, $11
+	WHERE NOT EXISTS (
+		SELECT 1 FROM allowances WHERE allowance_name = $1 OR response_name = $3
+	);`
+	res, err := tx.Exec(query, a.Allowance_name, a.TaxYear, a.ResponseName, a.Configurable, a.AutoClaim, a.CapRule, a.CapPercent, a.GroupName, a.MaxAmt, a.MinAmt, a.LimitAmt)
+	if err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if affect, _ := res.RowsAffected(); affect < 1 {
+		return false, nil
+	}
+
+	if change.NewValue, err = auditValue(tx, allowanceInForceJSON, a.Allowance_name, a.TaxYear); err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := audit(tx, change); err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := configChanged(tx); err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return true, nil
+}
+
+// UpdateConfigDeduct sets the limit for config.TaxYear. Earlier years keep
+// their own rows, so the row in force for that year is copied forward first
+// when the year has no row of its own yet.
+func (p *Postgres) UpdateConfigDeduct(config ct.Deduction, change AuditEntry) error {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer tx.Rollback()
+	if err := lockConfig(tx); err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	if change.OldValue, err = auditValue(tx, allowanceInForceJSON, config.Type, config.TaxYear); err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+
+	query := `
+	INSERT INTO allowances (allowance_name, tax_year, response_name, admin_configurable, auto_claim, cap_rule, cap_percent, group_name, max_allowance, min_allowance, limit_allowance)
+	SELECT allowance_name, $3, response_name, admin_configurable, auto_claim, cap_rule, cap_percent, group_name, max_allowance, min_allowance, $1
+	FROM allowances
+	WHERE allowance_name=$2 AND tax_year <= $3
+	ORDER BY tax_year DESC
+	LIMIT 1
+	ON CONFLICT (allowance_name, tax_year) DO UPDATE SET limit_allowance = EXCLUDED.limit_allowance;`
+	res, err := tx.Exec(query, config.Amount, config.Type, config.TaxYear)
 	if err != nil {
 		return errors.New(ct.ErrMsgDatabaseError)
 	}
@@ -87,5 +387,18 @@ func (p *Postgres) UpdateConfigDeduct(config ct.Deduction) error {
 	if affect < 1 {
 		return errors.New(ct.ErrMsgUpdateNotSuccess)
 	}
+
+	if change.NewValue, err = auditValue(tx, allowanceInForceJSON, config.Type, config.TaxYear); err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := audit(tx, change); err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := configChanged(tx); err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.New(ct.ErrMsgDatabaseError)
+	}
 	return nil
 }
@@ -6,10 +6,48 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/money"
 	"github.com/kanawat2566/assessment-tax/repository"
 	"github.com/stretchr/testify/assert"
 )
 
+func upTo(baht int64) *money.Amount {
+	m := money.Baht(baht)
+	return &m
+}
+
+// expectConfigLock expects a write to the configuration to take its lock.
+func expectConfigLock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1\)`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+// expectConfigChanged expects a write to the configuration to record a
+// snapshot and announce the change.
+func expectConfigChanged(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`INSERT INTO config_snapshots`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SELECT pg_notify\(\$1, ''\)`).
+		WithArgs(repository.ConfigChannel).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+var _change = repository.AuditEntry{User: "adminTax", RequestID: "req-1", Action: ct.AuditDeductionUpdate, Target: ct.Personal}
+
+// expectAuditValue expects a write to read the rows it changes as JSON.
+func expectAuditValue(mock sqlmock.Sqlmock, table string, value interface{}) {
+	mock.ExpectQuery(`SELECT (.+) FROM ` + table).
+		WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(value))
+}
+
+// expectAudit expects the audit entry of a write.
+func expectAudit(mock sqlmock.Sqlmock, e repository.AuditEntry, oldValue, newValue interface{}) {
+	mock.ExpectExec(`INSERT INTO audit_log`).
+		WithArgs(e.User, e.RequestID, e.Action, e.Target, oldValue, newValue).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
 func TestGetTaxRates_Error(t *testing.T) {
 	// Create a mock database connection
 	db, mock, err := sqlmock.New()
@@ -21,7 +59,7 @@ func TestGetTaxRates_Error(t *testing.T) {
 	repo := repository.New(db)
 
 	// Call GetTaxRates
-	_, err = repo.GetTaxRates()
+	_, err = repo.GetTaxRates(2024)
 
 	// Assertions
 	assert.NotNil(t, err, "Error should not be nil for failed query")
@@ -31,8 +69,8 @@ func TestGetTaxRates_Error(t *testing.T) {
 func TestGetTaxRates_Success(t *testing.T) {
 	// Define expected tax rates
 	expected := []*repository.IncomeTaxRates{
-		{ID: 1, TaxRate: 0, IncomeLevel: "0 - 150,000", MinIncome: 0, MaxIncome: 150000},
-		{ID: 2, TaxRate: 10, IncomeLevel: "150,001 - 500,000", MinIncome: 150001, MaxIncome: 500000},
+		{ID: 1, TaxYear: 2017, TaxRate: money.Percentage(0), IncomeLevel: "0 - 150,000", MinIncome: money.Baht(0), MaxIncome: upTo(150000)},
+		{ID: 2, TaxYear: 2017, TaxRate: money.Percentage(10), IncomeLevel: "150,001 - 500,000", MinIncome: money.Baht(150001), MaxIncome: upTo(500000)},
 	}
 
 	// Create a mock database connection
@@ -41,27 +79,265 @@ func TestGetTaxRates_Success(t *testing.T) {
 	defer db.Close()
 
 	// Configure mock query to return expected data
-	mock.ExpectQuery(`
-		SELECT 
-		id, income_level, 
-		min_income, max_income, 
-		tax_rate 
-		FROM income_tax_rates
-		ORDER BY id
-	`).WillReturnRows(
-		sqlmock.NewRows([]string{"id", "income_level", "min_income", "max_income", "tax_rate"}).
-			AddRow(expected[0].ID, expected[0].IncomeLevel, expected[0].MinIncome, expected[0].MaxIncome, expected[0].TaxRate).
-			AddRow(expected[1].ID, expected[1].IncomeLevel, expected[1].MinIncome, expected[1].MaxIncome, expected[1].TaxRate),
+	mock.ExpectQuery(`SELECT (.+) FROM income_tax_rates WHERE tax_year = \(
+		SELECT MAX\(tax_year\) FROM income_tax_rates WHERE tax_year <= \$1
+	\)`).WithArgs(2024).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "tax_year", "income_level", "min_income", "max_income", "tax_rate"}).
+			AddRow(expected[0].ID, expected[0].TaxYear, expected[0].IncomeLevel, expected[0].MinIncome, expected[0].MaxIncome, expected[0].TaxRate).
+			AddRow(expected[1].ID, expected[1].TaxYear, expected[1].IncomeLevel, expected[1].MinIncome, expected[1].MaxIncome, expected[1].TaxRate),
 	)
 
 	// Create a TaxRepository instance using the mock Postgres
 	repo := repository.New(db)
 
 	// Call GetTaxRates
-	taxRates, err := repo.GetTaxRates()
+	taxRates, err := repo.GetTaxRates(2024)
 
 	// Assertions
 	assert.Nil(t, err, "Error should be nil for successful query")
 	assert.Equal(t, expected, taxRates, "Tax rates should match")
 	assert.Len(t, taxRates, 2, "Should have two tax rates")
 }
+
+var allowanceColumns = []string{"allowance_name", "tax_year", "response_name", "admin_configurable", "auto_claim", "cap_rule", "cap_percent", "group_name", "max_allowance", "min_allowance", "limit_allowance"}
+
+func TestGetLimitAllowances_Success(t *testing.T) {
+	expected := repository.Allowances{Allowance_name: ct.Personal, TaxYear: 2017, ResponseName: "personalDeduction", Configurable: true, AutoClaim: true, CapRule: ct.CapFlat, MaxAmt: money.Baht(100000), MinAmt: money.Baht(10001), LimitAmt: money.Baht(60000)}
+
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT (.+) FROM allowances WHERE allowance_name=\$1 AND tax_year <= \$2`).
+		WithArgs(ct.Personal, 2024).
+		WillReturnRows(
+			sqlmock.NewRows(allowanceColumns).
+				AddRow(expected.Allowance_name, expected.TaxYear, expected.ResponseName, expected.Configurable, expected.AutoClaim, expected.CapRule, expected.CapPercent, expected.GroupName, expected.MaxAmt, expected.MinAmt, expected.LimitAmt),
+		)
+
+	repo := repository.New(db)
+
+	res, err := repo.GetLimitAllowances(ct.Personal, 2024)
+
+	assert.Nil(t, err, "Error should be nil for successful query")
+	assert.Equal(t, expected, res, "Allowances should match")
+}
+
+func TestGetLimitAllowances_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT (.+) FROM allowances`).
+		WithArgs("unknown", 2024).
+		WillReturnRows(sqlmock.NewRows(allowanceColumns))
+
+	repo := repository.New(db)
+
+	res, err := repo.GetLimitAllowances("unknown", 2024)
+
+	assert.Nil(t, err, "Missing allowance type should not be an error")
+	assert.Zero(t, res)
+}
+
+func TestGetAllowances_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT DISTINCT ON \(allowance_name\)(.+)FROM allowances WHERE tax_year <= \$1`).
+		WithArgs(2024).
+		WillReturnRows(sqlmock.NewRows(allowanceColumns).
+			AddRow(ct.Donation, 2017, "donation", false, false, ct.CapPercentOfNet, "10.00", "", "100000.00", "0.00", "100000.00").
+			AddRow(ct.Personal, 2024, "personalDeduction", true, true, ct.CapFlat, "0.00", "", "100000.00", "10001.00", "70000.00"))
+
+	repo := repository.New(db)
+
+	res, err := repo.GetAllowances(2024)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []repository.Allowances{
+		{Allowance_name: ct.Donation, TaxYear: 2017, ResponseName: "donation", CapRule: ct.CapPercentOfNet, CapPercent: money.Percentage(10), MaxAmt: money.Baht(100000), LimitAmt: money.Baht(100000)},
+		{Allowance_name: ct.Personal, TaxYear: 2024, ResponseName: "personalDeduction", Configurable: true, AutoClaim: true, CapRule: ct.CapFlat, MaxAmt: money.Baht(100000), MinAmt: money.Baht(10001), LimitAmt: money.Baht(70000)},
+	}, res)
+}
+
+func TestCreateAllowance_AlreadyExists(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectConfigLock(mock)
+	mock.ExpectExec(`INSERT INTO allowances (.+) WHERE NOT EXISTS`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	repo := repository.New(db)
+
+	created, err := repo.CreateAllowance(repository.Allowances{Allowance_name: ct.Donation, TaxYear: 2024, ResponseName: "donation"}, _change)
+
+	assert.Nil(t, err)
+	assert.False(t, created)
+	assert.Nil(t, mock.ExpectationsWereMet(), "Nothing changed, so nothing should be announced or audited")
+}
+
+func TestCreateAllowance_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectConfigLock(mock)
+	mock.ExpectExec(`INSERT INTO allowances (.+) WHERE NOT EXISTS`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAuditValue(mock, "allowances", []byte(`{"allowance_name": "pension"}`))
+	change := repository.AuditEntry{User: "adminTax", RequestID: "req-1", Action: ct.AuditAllowanceCreate, Target: "pension"}
+	expectAudit(mock, change, nil, `{"allowance_name": "pension"}`)
+	expectConfigChanged(mock)
+	mock.ExpectCommit()
+
+	repo := repository.New(db)
+
+	created, err := repo.CreateAllowance(repository.Allowances{Allowance_name: "pension", TaxYear: 2024, ResponseName: "pension"}, change)
+
+	assert.Nil(t, err)
+	assert.True(t, created)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateConfigDeduct_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectConfigLock(mock)
+	expectAuditValue(mock, "allowances", []byte(`{"limit_allowance": 60000.00}`))
+	mock.ExpectExec(`INSERT INTO allowances (.+) ON CONFLICT \(allowance_name, tax_year\) DO UPDATE`).
+		WithArgs("70000.00", ct.Personal, 2024).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAuditValue(mock, "allowances", []byte(`{"limit_allowance": 70000.00}`))
+	expectAudit(mock, _change, `{"limit_allowance": 60000.00}`, `{"limit_allowance": 70000.00}`)
+	expectConfigChanged(mock)
+	mock.ExpectCommit()
+
+	repo := repository.New(db)
+
+	err = repo.UpdateConfigDeduct(ct.Deduction{Type: ct.Personal, TaxYear: 2024, Amount: money.Baht(70000)}, _change)
+
+	assert.Nil(t, err, "Error should be nil for successful update")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+// expectTaxRatesOfYear expects the brackets of 2024 to be read as stored.
+func expectTaxRatesOfYear(mock sqlmock.Sqlmock, stored []*repository.IncomeTaxRates) {
+	rows := sqlmock.NewRows([]string{"id", "tax_year", "income_level", "min_income", "max_income", "tax_rate"})
+	for _, r := range stored {
+		rows.AddRow(r.ID, r.TaxYear, r.IncomeLevel, r.MinIncome, r.MaxIncome, r.TaxRate)
+	}
+	mock.ExpectQuery(`SELECT (.+) FROM income_tax_rates WHERE tax_year = \$1`).WithArgs(2024).WillReturnRows(rows)
+}
+
+var _storedTaxRates = []*repository.IncomeTaxRates{
+	{ID: 1, TaxYear: 2024, IncomeLevel: "0-150,000", MinIncome: money.Baht(0), MaxIncome: upTo(150000), TaxRate: money.Percentage(0)},
+	{ID: 2, TaxYear: 2024, IncomeLevel: "150,001-500,000", MinIncome: money.Baht(150001), MaxIncome: upTo(500000), TaxRate: money.Percentage(10)},
+	{ID: 3, TaxYear: 2024, IncomeLevel: "500,001 ขึ้นไป", MinIncome: money.Baht(500001), TaxRate: money.Percentage(15)},
+}
+
+func TestSaveTaxRates_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	rates := []*repository.IncomeTaxRates{
+		{ID: 1, IncomeLevel: "0-150,000", MinIncome: money.Baht(0), MaxIncome: upTo(150000), TaxRate: money.Percentage(0)},
+		{IncomeLevel: "150,001 ขึ้นไป", MinIncome: money.Baht(150001), TaxRate: money.Percentage(10)},
+	}
+
+	mock.ExpectBegin()
+	expectConfigLock(mock)
+	expectTaxRatesOfYear(mock, _storedTaxRates)
+	expectAuditValue(mock, "income_tax_rates", []byte(`[{"id": 1}, {"id": 2}, {"id": 3}]`))
+	mock.ExpectExec(`DELETE FROM income_tax_rates WHERE tax_year = \$1`).
+		WithArgs(2024, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`UPDATE income_tax_rates`).
+		WithArgs(1, 2024, "0-150,000", "0.00", "150000.00", "0.00").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO income_tax_rates`).
+		WithArgs(2024, "150,001 ขึ้นไป", "150001.00", nil, "10.00").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	expectAuditValue(mock, "income_tax_rates", []byte(`[{"id": 1}, {"id": 7}]`))
+	change := repository.AuditEntry{User: "adminTax", RequestID: "req-1", Action: ct.AuditTaxRateCreate, Target: "2024"}
+	expectAudit(mock, change, `[{"id": 1}, {"id": 2}, {"id": 3}]`, `[{"id": 1}, {"id": 7}]`)
+	expectConfigChanged(mock)
+	mock.ExpectCommit()
+
+	repo := repository.New(db)
+
+	saved, err := repo.SaveTaxRates(2024, _storedTaxRates, rates, change)
+
+	assert.Nil(t, err, "Error should be nil for successful save")
+	assert.Equal(t, 7, saved[1].ID, "Inserted bracket should get its new id")
+	assert.Equal(t, 2024, saved[0].TaxYear)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveTaxRates_RollbackOnError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectConfigLock(mock)
+	expectTaxRatesOfYear(mock, nil)
+	expectAuditValue(mock, "income_tax_rates", nil)
+	mock.ExpectExec(`DELETE FROM income_tax_rates`).WillReturnError(errors.New("error"))
+	mock.ExpectRollback()
+
+	repo := repository.New(db)
+
+	_, err = repo.SaveTaxRates(2024, nil, nil, _change)
+
+	assert.EqualError(t, err, ct.ErrMsgDatabaseError)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveTaxRates_ChangedMeanwhile(t *testing.T) {
+	base := []*repository.IncomeTaxRates{
+		{ID: 1, TaxYear: 2024, IncomeLevel: "0-150,000", MinIncome: money.Baht(0), MaxIncome: upTo(150000), TaxRate: money.Percentage(0)},
+		{ID: 2, TaxYear: 2024, IncomeLevel: "150,001 ขึ้นไป", MinIncome: money.Baht(150001), TaxRate: money.Percentage(10)},
+	}
+	cases := []struct {
+		name   string
+		stored []*repository.IncomeTaxRates
+	}{
+		{name: "given bracket added since should not save", stored: _storedTaxRates},
+		{name: "given year without brackets since should not save", stored: nil},
+		{name: "given bracket changed since should not save", stored: []*repository.IncomeTaxRates{
+			base[0],
+			{ID: 2, TaxYear: 2024, IncomeLevel: "150,001 ขึ้นไป", MinIncome: money.Baht(150001), TaxRate: money.Percentage(12)},
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.Nil(t, err, "Error creating mock DB")
+			defer db.Close()
+
+			mock.ExpectBegin()
+			expectConfigLock(mock)
+			expectTaxRatesOfYear(mock, tc.stored)
+			mock.ExpectRollback()
+
+			repo := repository.New(db)
+
+			_, err = repo.SaveTaxRates(2024, base, base, _change)
+
+			assert.ErrorIs(t, err, repository.ErrTaxRatesChanged)
+			assert.Nil(t, mock.ExpectationsWereMet(), "Nothing should be written")
+		})
+	}
+}
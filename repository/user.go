@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/lib/pq"
+)
+
+// AdminUser is an account allowed into the admin endpoints its roles grant.
+// Only a hash of its password is stored.
+type AdminUser struct {
+	ID                int64     `postgres:"id"`
+	Username          string    `postgres:"username"`
+	PasswordHash      string    `postgres:"password_hash"`
+	Disabled          bool      `postgres:"disabled"`
+	Roles             []string  `postgres:"roles"`
+	CreatedAt         time.Time `postgres:"created_at"`
+	UpdatedAt         time.Time `postgres:"updated_at"`
+	PasswordChangedAt time.Time `postgres:"password_changed_at"`
+}
+
+type UserRepository interface {
+	GetAdminUser(username string) (*AdminUser, error)
+	ListAdminUsers() ([]AdminUser, error)
+	CreateAdminUser(u AdminUser, change AuditEntry) (*AdminUser, error)
+	BootstrapAdminUser(u AdminUser, change AuditEntry) (*AdminUser, error)
+	UpdateAdminUser(u AdminUser, change AuditEntry) (*AdminUser, error)
+	DeleteAdminUser(username string, change AuditEntry) (bool, error)
+}
+
+const adminUserColumns = `
+	id, username, password_hash, disabled, roles, created_at, updated_at, password_changed_at`
+
+// adminUserJSON is a user as JSON for its audit entry, without the hash.
+const adminUserJSON = `
+	SELECT to_jsonb(u) - 'password_hash' FROM admin_users u WHERE username = $1;`
+
+func scanAdminUser(row scanner) (*AdminUser, error) {
+	var u AdminUser
+	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Disabled, pq.Array(&u.Roles), &u.CreatedAt, &u.UpdatedAt, &u.PasswordChangedAt)
+	return &u, err
+}
+
+// GetAdminUser returns the user with the given username, or nil when there
+// is none.
+func (p *Postgres) GetAdminUser(username string) (*AdminUser, error) {
+	u, err := scanAdminUser(p.Db.QueryRow(`SELECT`+adminUserColumns+` FROM admin_users WHERE username = $1;`, username))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return u, nil
+}
+
+func (p *Postgres) ListAdminUsers() ([]AdminUser, error) {
+	rows, err := p.Db.Query(`SELECT` + adminUserColumns + ` FROM admin_users ORDER BY username;`)
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer rows.Close()
+
+	var res []AdminUser
+	for rows.Next() {
+		u, err := scanAdminUser(rows)
+		if err != nil {
+			return nil, errors.New(ct.ErrMsgDatabaseError)
+		}
+		res = append(res, *u)
+	}
+	if rows.Err() != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return res, nil
+}
+
+// CreateAdminUser adds u. It returns nil without an error when the username
+// is taken.
+func (p *Postgres) CreateAdminUser(u AdminUser, change AuditEntry) (*AdminUser, error) {
+	return p.insertAdminUser(`
+	INSERT INTO admin_users (username, password_hash, disabled, roles)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (username) DO NOTHING
+	RETURNING`+adminUserColumns+`;`, u, change)
+}
+
+// BootstrapAdminUser adds u only when there is no user at all yet, and
+// returns nil without an error otherwise.
+func (p *Postgres) BootstrapAdminUser(u AdminUser, change AuditEntry) (*AdminUser, error) {
+	return p.insertAdminUser(`
+	INSERT INTO admin_users (username, password_hash, disabled, roles)
+	SELECT $1, $2, $3, $4
+	WHERE NOT EXISTS (SELECT 1 FROM admin_users)
+	ON CONFLICT (username) DO NOTHING
+	RETURNING`+adminUserColumns+`;`, u, change)
+}
+
+func (p *Postgres) insertAdminUser(query string, u AdminUser, change AuditEntry) (*AdminUser, error) {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer tx.Rollback()
+
+	created, err := scanAdminUser(tx.QueryRow(query, u.Username, u.PasswordHash, u.Disabled, pq.Array(u.Roles)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+
+	if change.NewValue, err = auditValue(tx, adminUserJSON, u.Username); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := audit(tx, change); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return created, nil
+}
+
+// UpdateAdminUser sets the password hash, the disabled flag and the roles of
+// the user with u's username. It returns nil without an error when there is
+// no such user.
+func (p *Postgres) UpdateAdminUser(u AdminUser, change AuditEntry) (*AdminUser, error) {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer tx.Rollback()
+
+	if change.OldValue, err = auditValue(tx, adminUserJSON, u.Username); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	updated, err := scanAdminUser(tx.QueryRow(`
+	UPDATE admin_users
+	SET password_hash = $2, disabled = $3, roles = $4, updated_at = now(),
+		password_changed_at = CASE WHEN password_hash = $2 THEN password_changed_at ELSE now() END
+	WHERE username = $1
+	RETURNING`+adminUserColumns+`;`, u.Username, u.PasswordHash, u.Disabled, pq.Array(u.Roles)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+
+	if change.NewValue, err = auditValue(tx, adminUserJSON, u.Username); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := audit(tx, change); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return updated, nil
+}
+
+// DeleteAdminUser removes the user with the given username. It returns false
+// without an error when there is no such user.
+func (p *Postgres) DeleteAdminUser(username string, change AuditEntry) (bool, error) {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	defer tx.Rollback()
+
+	if change.OldValue, err = auditValue(tx, adminUserJSON, username); err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	res, err := tx.Exec(`DELETE FROM admin_users WHERE username = $1;`, username)
+	if err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if affect, _ := res.RowsAffected(); affect < 1 {
+		return false, nil
+	}
+
+	if err := audit(tx, change); err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, errors.New(ct.ErrMsgDatabaseError)
+	}
+	return true, nil
+}
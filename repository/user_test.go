@@ -0,0 +1,160 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var adminUserColumns = []string{"id", "username", "password_hash", "disabled", "roles", "created_at", "updated_at", "password_changed_at"}
+
+var _created = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func adminUserRow(username string, disabled bool) *sqlmock.Rows {
+	return sqlmock.NewRows(adminUserColumns).AddRow(1, username, "$2a$hash", disabled, []byte("{viewer,auditor}"), _created, _created, _created)
+}
+
+func TestGetAdminUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT (.+) FROM admin_users WHERE username = \$1;`).WithArgs("adminTax").WillReturnRows(adminUserRow("adminTax", false))
+	mock.ExpectQuery(`SELECT (.+) FROM admin_users WHERE username = \$1;`).WithArgs("nobody").WillReturnError(sql.ErrNoRows)
+
+	repo := repository.New(db)
+
+	u, err := repo.GetAdminUser("adminTax")
+	assert.Nil(t, err)
+	assert.Equal(t, &repository.AdminUser{
+		ID: 1, Username: "adminTax", PasswordHash: "$2a$hash", Roles: []string{ct.RoleViewer, ct.RoleAuditor}, CreatedAt: _created, UpdatedAt: _created, PasswordChangedAt: _created}, u)
+
+	u, err = repo.GetAdminUser("nobody")
+	assert.Nil(t, err)
+	assert.Nil(t, u)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAdminUser(t *testing.T) {
+	change := repository.AuditEntry{User: "adminTax", RequestID: "req-1", Action: ct.AuditUserCreate, Target: "support"}
+
+	t.Run("given new username should insert and audit it", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO admin_users (.+) ON CONFLICT \(username\) DO NOTHING`).
+			WithArgs("support", "$2a$hash", false, `{"viewer","auditor"}`).
+			WillReturnRows(adminUserRow("support", false))
+		expectAuditValue(mock, "admin_users", `{"username": "support"}`)
+		expectAudit(mock, change, nil, `{"username": "support"}`)
+		mock.ExpectCommit()
+
+		u, err := repository.New(db).CreateAdminUser(repository.AdminUser{Username: "support", PasswordHash: "$2a$hash", Roles: []string{ct.RoleViewer, ct.RoleAuditor}}, change)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "support", u.Username)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given taken username should return nil", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO admin_users`).WillReturnRows(sqlmock.NewRows(adminUserColumns))
+		mock.ExpectRollback()
+
+		u, err := repository.New(db).CreateAdminUser(repository.AdminUser{Username: "support", PasswordHash: "$2a$hash"}, change)
+
+		assert.Nil(t, err)
+		assert.Nil(t, u)
+		assert.Nil(t, mock.ExpectationsWereMet(), "Nothing changed, so nothing should be audited")
+	})
+}
+
+func TestBootstrapAdminUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO admin_users (.+) WHERE NOT EXISTS \(SELECT 1 FROM admin_users\)`).
+		WithArgs("adminTax", "$2a$hash", false, `{"viewer","config-editor","bracket-admin","auditor","user-admin"}`).
+		WillReturnRows(sqlmock.NewRows(adminUserColumns))
+	mock.ExpectRollback()
+
+	u, err := repository.New(db).BootstrapAdminUser(repository.AdminUser{Username: "adminTax", PasswordHash: "$2a$hash", Roles: ct.Roles}, repository.AuditEntry{})
+
+	assert.Nil(t, err)
+	assert.Nil(t, u, "There are users already")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateAdminUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err, "Error creating mock DB")
+	defer db.Close()
+
+	change := repository.AuditEntry{User: "adminTax", RequestID: "req-1", Action: ct.AuditUserUpdate, Target: "support"}
+	mock.ExpectBegin()
+	expectAuditValue(mock, "admin_users", `{"disabled": false}`)
+	mock.ExpectQuery(`UPDATE admin_users SET (.+) WHERE username = \$1`).
+		WithArgs("support", "$2a$hash", true, `{"viewer","auditor"}`).
+		WillReturnRows(adminUserRow("support", true))
+	expectAuditValue(mock, "admin_users", `{"disabled": true}`)
+	expectAudit(mock, change, `{"disabled": false}`, `{"disabled": true}`)
+	mock.ExpectCommit()
+
+	u, err := repository.New(db).UpdateAdminUser(repository.AdminUser{Username: "support", PasswordHash: "$2a$hash", Disabled: true, Roles: []string{ct.RoleViewer, ct.RoleAuditor}}, change)
+
+	assert.Nil(t, err)
+	assert.True(t, u.Disabled)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteAdminUser(t *testing.T) {
+	change := repository.AuditEntry{User: "adminTax", RequestID: "req-1", Action: ct.AuditUserDelete, Target: "support"}
+
+	t.Run("given existing user should delete and audit it", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+
+		mock.ExpectBegin()
+		expectAuditValue(mock, "admin_users", `{"username": "support"}`)
+		mock.ExpectExec(`DELETE FROM admin_users WHERE username = \$1;`).WithArgs("support").WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAudit(mock, change, `{"username": "support"}`, nil)
+		mock.ExpectCommit()
+
+		deleted, err := repository.New(db).DeleteAdminUser("support", change)
+
+		assert.Nil(t, err)
+		assert.True(t, deleted)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given unknown user should return false", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err, "Error creating mock DB")
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT (.+) FROM admin_users`).WillReturnError(sql.ErrNoRows)
+		mock.ExpectExec(`DELETE FROM admin_users`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		deleted, err := repository.New(db).DeleteAdminUser("support", change)
+
+		assert.Nil(t, err)
+		assert.False(t, deleted)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/repository"
+)
+
+var (
+	allowanceNamePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	responseNamePattern  = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+)
+
+type allowanceClaim struct {
+	allowance repository.Allowances
+	amount    money.Amount
+	auto      bool
+	deducted  money.Amount
+	limit     money.Amount
+	reason    string
+	trimmed   money.Amount
+}
+
+// allowed returns how much of the claim can be deducted, the limit that
+// applied to it and the reason for the amount. base is the income the cap
+// percentage applies to: total income for percent_of_gross and income after
+// the other allowances for percent_of_net.
+func (c allowanceClaim) allowed(base money.Amount) (money.Amount, money.Amount, string) {
+	limit, reason := c.allowance.LimitAmt, ct.ReasonAllowanceLimit
+	switch c.allowance.CapRule {
+	case ct.CapPercentOfGross, ct.CapPercentOfNet:
+		if capped := base.Percent(c.allowance.CapPercent); capped < limit {
+			limit, reason = capped, c.allowance.CapRule
+		}
+	}
+
+	switch {
+	case c.amount > limit:
+		return limit, limit, reason
+	case c.auto:
+		return c.amount, limit, ct.ReasonAutoClaimed
+	}
+	return c.amount, limit, ct.ReasonClaimed
+}
+
+func sortedKeys(registry map[string]repository.Allowances) []string {
+	keys := make([]string, 0, len(registry))
+	for k := range registry {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (ts *taxService) ListAllowances(taxYear int) (models.AllowancesResponse, error) {
+	if err := validateTaxYear(taxYear); err != nil {
+		return models.AllowancesResponse{}, err
+	}
+	taxYear = taxYearOrCurrent(taxYear)
+
+	allowances, err := ts.repo.GetAllowances(taxYear)
+	if err != nil {
+		return models.AllowancesResponse{}, ErrInternal
+	}
+
+	res := models.AllowancesResponse{TaxYear: taxYear, Allowances: []models.AllowanceConfig{}}
+	for _, a := range allowances {
+		res.Allowances = append(res.Allowances, toAllowanceConfig(a))
+	}
+	sort.Slice(res.Allowances, func(i, j int) bool {
+		return res.Allowances[i].AllowanceType < res.Allowances[j].AllowanceType
+	})
+	return res, nil
+}
+
+// CreateAllowance registers a new allowance type starting from
+// allowance.TaxYear.
+func (ts *taxService) CreateAllowance(allowance models.AllowanceConfig, by ct.Actor) (models.AllowanceConfig, error) {
+	if err := validateTaxYear(allowance.TaxYear); err != nil {
+		return models.AllowanceConfig{}, err
+	}
+	allowance.TaxYear = taxYearOrCurrent(allowance.TaxYear)
+	allowance.AllowanceType = strings.ToLower(strings.TrimSpace(allowance.AllowanceType))
+	allowance.ResponseName = strings.TrimSpace(allowance.ResponseName)
+	allowance.GroupName = strings.TrimSpace(allowance.GroupName)
+	if allowance.CapRule == "" {
+		allowance.CapRule = ct.CapFlat
+	}
+	if err := validateAllowanceConfig(allowance); err != nil {
+		return models.AllowanceConfig{}, err
+	}
+
+	created, err := ts.repo.CreateAllowance(repository.Allowances{
+		Allowance_name: allowance.AllowanceType,
+		TaxYear:        allowance.TaxYear,
+		ResponseName:   allowance.ResponseName,
+		Configurable:   allowance.AdminConfigurable,
+		AutoClaim:      allowance.AutoClaim,
+		CapRule:        allowance.CapRule,
+		CapPercent:     allowance.CapPercent,
+		GroupName:      allowance.GroupName,
+		MinAmt:         allowance.MinAmount,
+		MaxAmt:         allowance.MaxAmount,
+		LimitAmt:       allowance.LimitAmount,
+	}, auditEntry(by, ct.AuditAllowanceCreate, allowance.AllowanceType))
+	if err != nil {
+		return models.AllowanceConfig{}, ErrInternal
+	}
+	if !created {
+		return models.AllowanceConfig{}, ErrAllowanceExists
+	}
+	return allowance, nil
+}
+
+func validateAllowanceConfig(a models.AllowanceConfig) error {
+	if !allowanceNamePattern.MatchString(a.AllowanceType) {
+		return ErrAllowanceName
+	}
+	if !responseNamePattern.MatchString(a.ResponseName) {
+		return ErrAllowanceRespName
+	}
+	if a.MinAmount < 0 || a.MinAmount > a.LimitAmount || a.LimitAmount > a.MaxAmount {
+		return ErrAllowanceLimits
+	}
+	switch a.CapRule {
+	case ct.CapFlat:
+		if a.CapPercent != 0 {
+			return ErrAllowanceCapPct
+		}
+	case ct.CapPercentOfGross, ct.CapPercentOfNet:
+		if a.CapPercent <= 0 || a.CapPercent > money.Percentage(100) {
+			return ErrAllowanceCapPct
+		}
+	default:
+		return ErrAllowanceCapRule
+	}
+	return nil
+}
+
+func toAllowanceConfig(a repository.Allowances) models.AllowanceConfig {
+	return models.AllowanceConfig{
+		AllowanceType:     a.Allowance_name,
+		ResponseName:      a.ResponseName,
+		TaxYear:           a.TaxYear,
+		AdminConfigurable: a.Configurable,
+		AutoClaim:         a.AutoClaim,
+		CapRule:           a.CapRule,
+		CapPercent:        a.CapPercent,
+		GroupName:         a.GroupName,
+		MinAmount:         a.MinAmt,
+		MaxAmount:         a.MaxAmt,
+		LimitAmount:       a.LimitAmt,
+	}
+}
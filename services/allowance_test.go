@@ -0,0 +1,359 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func registryRepo() *MockTaxRepository {
+	allowances := map[string]repository.Allowances{}
+	for k, v := range _allowances {
+		allowances[k] = v
+	}
+	allowances["life-insurance"] = repository.Allowances{Allowance_name: "life-insurance", ResponseName: "lifeInsurance", Configurable: true, LimitAmt: money.Baht(100000), MaxAmt: money.Baht(100000)}
+	allowances["social-security"] = repository.Allowances{Allowance_name: "social-security", ResponseName: "socialSecurity", AutoClaim: true, LimitAmt: money.Baht(9000), MaxAmt: money.Baht(9000)}
+	return &MockTaxRepository{taxRates: _taxRates, allowances: allowances}
+}
+
+func TestCalculateTax_AllowanceRegistry(t *testing.T) {
+	cases := []TaxCase{
+		{
+			name:     "given registered auto-claim allowance should deduct its limit",
+			request:  md.TaxRequest{TotalIncome: money.Baht(500000)},
+			expected: md.TaxResponse{Tax: money.Baht(28100)},
+		},
+		{
+			name: "given registered allowance type should deduct up to its limit",
+			request: md.TaxRequest{
+				TotalIncome: money.Baht(500000),
+				Allowances:  []md.Allowance{{AllowanceType: "life-insurance", Amount: money.Baht(150000)}},
+			},
+			expected: md.TaxResponse{Tax: money.Baht(18100)},
+		},
+		{
+			name: "given allowance type in upper case should match registry",
+			request: md.TaxRequest{
+				TotalIncome: money.Baht(500000),
+				Allowances:  []md.Allowance{{AllowanceType: "Life-Insurance", Amount: money.Baht(10000)}},
+			},
+			expected: md.TaxResponse{Tax: money.Baht(27100)},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			serv := services.NewServices(registryRepo())
+			rep, err := serv.TaxCalculations(tc.request)
+
+			assert.Nil(t, err, "Error should be nil for valid inputs")
+			assert.Equal(t, tc.expected.Tax, rep.Tax, "Calculated tax should match")
+		})
+	}
+}
+
+func TestConfigDeduction_RegisteredType(t *testing.T) {
+	repo := registryRepo()
+	serv := services.NewServices(repo)
+
+	rep, err := serv.SetAdminDeductions(ct.Deduction{Type: "life-insurance", Amount: money.Baht(80000)}, _admin)
+
+	assert.Nil(t, err)
+	assert.Equal(t, ct.Deduction{Type: "life-insurance", Name: "lifeInsurance", TaxYear: rep.TaxYear, Amount: money.Baht(80000)}, rep)
+	assert.Equal(t, repository.AuditEntry{User: "adminTax", RequestID: "req-1", Action: ct.AuditDeductionUpdate, Target: "life-insurance"}, repo.change)
+}
+
+func TestListAllowances(t *testing.T) {
+	serv := services.NewServices(registryRepo())
+
+	res, err := serv.ListAllowances(2024)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2024, res.TaxYear)
+	var names []string
+	for _, a := range res.Allowances {
+		names = append(names, a.AllowanceType)
+	}
+	assert.Equal(t, []string{"donation", "k-receipt", "life-insurance", "personal", "social-security"}, names)
+}
+
+func TestCreateAllowance_Valid(t *testing.T) {
+	repo := registryRepo()
+	serv := services.NewServices(repo)
+
+	rep, err := serv.CreateAllowance(md.AllowanceConfig{
+		AllowanceType:     " Home-Loan-Interest ",
+		ResponseName:      "homeLoanInterest",
+		TaxYear:           2024,
+		AdminConfigurable: true,
+		MaxAmount:         money.Baht(100000),
+		LimitAmount:       money.Baht(100000),
+	}, _admin)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "home-loan-interest", rep.AllowanceType)
+	assert.Equal(t, repository.AuditEntry{User: "adminTax", RequestID: "req-1", Action: ct.AuditAllowanceCreate, Target: "home-loan-interest"}, repo.change)
+	assert.Equal(t, &repository.Allowances{
+		Allowance_name: "home-loan-interest",
+		TaxYear:        2024,
+		ResponseName:   "homeLoanInterest",
+		Configurable:   true,
+		CapRule:        ct.CapFlat,
+		MaxAmt:         money.Baht(100000),
+		LimitAmt:       money.Baht(100000),
+	}, repo.createdAwc)
+}
+
+func TestCreateAllowance_Invalids(t *testing.T) {
+	valid := md.AllowanceConfig{AllowanceType: "ssf", ResponseName: "ssf", TaxYear: 2024, MaxAmount: money.Baht(200000), LimitAmount: money.Baht(200000)}
+
+	cases := []struct {
+		name     string
+		mockRepo *MockTaxRepository
+		request  func(a md.AllowanceConfig) md.AllowanceConfig
+		expected error
+	}{
+		{
+			name:     "case invalid allowance type name",
+			mockRepo: registryRepo(),
+			request:  func(a md.AllowanceConfig) md.AllowanceConfig { a.AllowanceType = "ssf fund"; return a },
+			expected: errors.New(ct.ErrMsgAllowanceName),
+		},
+		{
+			name:     "case invalid response name",
+			mockRepo: registryRepo(),
+			request:  func(a md.AllowanceConfig) md.AllowanceConfig { a.ResponseName = ""; return a },
+			expected: errors.New(ct.ErrMsgAllowanceRespName),
+		},
+		{
+			name:     "case invalid limit more than maximum",
+			mockRepo: registryRepo(),
+			request:  func(a md.AllowanceConfig) md.AllowanceConfig { a.LimitAmount = money.Baht(200001); return a },
+			expected: errors.New(ct.ErrMsgAllowanceLimits),
+		},
+		{
+			name:     "case invalid minimum more than limit",
+			mockRepo: registryRepo(),
+			request:  func(a md.AllowanceConfig) md.AllowanceConfig { a.MinAmount = money.Baht(200001); return a },
+			expected: errors.New(ct.ErrMsgAllowanceLimits),
+		},
+		{
+			name:     "case invalid allowance type already exists",
+			mockRepo: registryRepo(),
+			request:  func(a md.AllowanceConfig) md.AllowanceConfig { a.AllowanceType = ct.Donation; return a },
+			expected: errors.New(ct.ErrMsgAllowanceExists),
+		},
+		{
+			name:     "case invalid database error",
+			mockRepo: &MockTaxRepository{awcErr: errors.New("error")},
+			request:  func(a md.AllowanceConfig) md.AllowanceConfig { return a },
+			expected: errors.New(ct.ErrMessageInternal),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			serv := services.NewServices(tc.mockRepo)
+			rep, err := serv.CreateAllowance(tc.request(valid), _admin)
+
+			assert.EqualError(t, err, tc.expected.Error())
+			assert.Zero(t, rep)
+		})
+	}
+}
+
+func capRulesRepo() *MockTaxRepository {
+	return &MockTaxRepository{
+		taxRates: _taxRates,
+		allowances: map[string]repository.Allowances{
+			ct.Personal: _allowances[ct.Personal],
+			ct.Donation: {Allowance_name: ct.Donation, CapRule: ct.CapPercentOfNet, CapPercent: money.Percentage(10), LimitAmt: money.Baht(100000), MaxAmt: money.Baht(100000)},
+			"ssf":       {Allowance_name: "ssf", CapRule: ct.CapPercentOfGross, CapPercent: money.Percentage(30), LimitAmt: money.Baht(200000), MaxAmt: money.Baht(200000)},
+		},
+	}
+}
+
+func TestCalculateTax_AllowanceCapRules(t *testing.T) {
+	cases := []TaxCase{
+		{
+			name: "given donation above 10% of net income should cap donation at 10% of net income",
+			request: md.TaxRequest{
+				TotalIncome: money.Baht(500000),
+				Allowances:  []md.Allowance{{AllowanceType: ct.Donation, Amount: money.Baht(200000)}},
+			},
+			expected: md.TaxResponse{Tax: money.Baht(24600)},
+		},
+		{
+			name: "given ssf above 30% of total income should cap ssf at 30% of total income",
+			request: md.TaxRequest{
+				TotalIncome: money.Baht(500000),
+				Allowances:  []md.Allowance{{AllowanceType: "ssf", Amount: money.Baht(200000)}},
+			},
+			expected: md.TaxResponse{Tax: money.Baht(14000)},
+		},
+		{
+			name: "given ssf and donation should cap donation on income after ssf",
+			request: md.TaxRequest{
+				TotalIncome: money.Baht(500000),
+				Allowances: []md.Allowance{
+					{AllowanceType: ct.Donation, Amount: money.Baht(100000)},
+					{AllowanceType: "ssf", Amount: money.Baht(100000)},
+				},
+			},
+			expected: md.TaxResponse{Tax: money.Baht(15600)},
+		},
+		{
+			name: "given same allowance type twice should cap the combined claim",
+			request: md.TaxRequest{
+				TotalIncome: money.Baht(500000),
+				Allowances: []md.Allowance{
+					{AllowanceType: "ssf", Amount: money.Baht(100000)},
+					{AllowanceType: "ssf", Amount: money.Baht(100000)},
+				},
+			},
+			expected: md.TaxResponse{Tax: money.Baht(14000)},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			serv := services.NewServices(capRulesRepo())
+			rep, err := serv.TaxCalculations(tc.request)
+
+			assert.Nil(t, err, "Error should be nil for valid inputs")
+			assert.Equal(t, tc.expected.Tax, rep.Tax, "Calculated tax should match")
+		})
+	}
+}
+
+func TestCreateAllowance_CapRules(t *testing.T) {
+	cases := []struct {
+		name     string
+		request  md.AllowanceConfig
+		expected error
+	}{
+		{
+			name:     "case valid percent of net cap",
+			request:  md.AllowanceConfig{AllowanceType: "education-donation", ResponseName: "educationDonation", CapRule: ct.CapPercentOfNet, CapPercent: money.Percentage(10), MaxAmount: money.Baht(100000), LimitAmount: money.Baht(100000)},
+			expected: nil,
+		},
+		{
+			name:     "case invalid unknown cap rule",
+			request:  md.AllowanceConfig{AllowanceType: "rmf", ResponseName: "rmf", CapRule: "percent", CapPercent: money.Percentage(30), MaxAmount: money.Baht(500000), LimitAmount: money.Baht(500000)},
+			expected: errors.New(ct.ErrMsgAllowanceCapRule),
+		},
+		{
+			name:     "case invalid percentage cap without percent",
+			request:  md.AllowanceConfig{AllowanceType: "rmf", ResponseName: "rmf", CapRule: ct.CapPercentOfGross, MaxAmount: money.Baht(500000), LimitAmount: money.Baht(500000)},
+			expected: errors.New(ct.ErrMsgAllowanceCapPct),
+		},
+		{
+			name:     "case invalid flat cap with percent",
+			request:  md.AllowanceConfig{AllowanceType: "rmf", ResponseName: "rmf", CapPercent: money.Percentage(30), MaxAmount: money.Baht(500000), LimitAmount: money.Baht(500000)},
+			expected: errors.New(ct.ErrMsgAllowanceCapPct),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			serv := services.NewServices(registryRepo())
+			_, err := serv.CreateAllowance(tc.request, _admin)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expected.Error())
+			}
+		})
+	}
+}
+
+func groupRepo() *MockTaxRepository {
+	repo := capRulesRepo()
+	ssf := repo.allowances["ssf"]
+	ssf.GroupName = "retirement"
+	repo.allowances["ssf"] = ssf
+	repo.allowances["rmf"] = repository.Allowances{Allowance_name: "rmf", CapRule: ct.CapPercentOfGross, CapPercent: money.Percentage(30), GroupName: "retirement", LimitAmt: money.Baht(500000), MaxAmt: money.Baht(500000)}
+	repo.groups = []repository.AllowanceGroups{{GroupName: "retirement", TaxYear: 2017, LimitAmt: money.Baht(500000)}}
+	return repo
+}
+
+func TestCalculateTax_AllowanceGroupLimit(t *testing.T) {
+	cases := []struct {
+		name     string
+		request  md.TaxRequest
+		expected []md.AllowanceDetail
+	}{
+		{
+			name: "given ssf and rmf above group limit should trim the later claim",
+			request: md.TaxRequest{
+				TotalIncome: money.Baht(2000000),
+				Allowances: []md.Allowance{
+					{AllowanceType: "ssf", Amount: money.Baht(200000)},
+					{AllowanceType: "rmf", Amount: money.Baht(400000)},
+				},
+			},
+			expected: []md.AllowanceDetail{
+				{AllowanceType: "ssf", Claimed: money.Baht(200000), Allowed: money.Baht(200000), Limit: money.Baht(200000), Reason: ct.ReasonClaimed},
+				{AllowanceType: "rmf", Claimed: money.Baht(400000), Allowed: money.Baht(300000), Limit: money.Baht(300000), Reason: ct.ReasonGroupLimit, GroupTrimmed: money.Baht(100000)},
+				{AllowanceType: ct.Personal, Claimed: money.Baht(60000), Allowed: money.Baht(60000), Limit: money.Baht(60000), Reason: ct.ReasonAutoClaimed},
+			},
+		},
+		{
+			name: "given ssf and rmf within group limit should allow both",
+			request: md.TaxRequest{
+				TotalIncome: money.Baht(2000000),
+				Allowances: []md.Allowance{
+					{AllowanceType: "ssf", Amount: money.Baht(100000)},
+					{AllowanceType: "rmf", Amount: money.Baht(200000)},
+				},
+			},
+			expected: []md.AllowanceDetail{
+				{AllowanceType: "ssf", Claimed: money.Baht(100000), Allowed: money.Baht(100000), Limit: money.Baht(200000), Reason: ct.ReasonClaimed},
+				{AllowanceType: "rmf", Claimed: money.Baht(200000), Allowed: money.Baht(200000), Limit: money.Baht(500000), Reason: ct.ReasonClaimed},
+				{AllowanceType: ct.Personal, Claimed: money.Baht(60000), Allowed: money.Baht(60000), Limit: money.Baht(60000), Reason: ct.ReasonAutoClaimed},
+			},
+		},
+		{
+			name: "given rmf capped by income should trim only what is left of the group",
+			request: md.TaxRequest{
+				TotalIncome: money.Baht(1000000),
+				Allowances: []md.Allowance{
+					{AllowanceType: "rmf", Amount: money.Baht(500000)},
+					{AllowanceType: "ssf", Amount: money.Baht(200000)},
+				},
+			},
+			expected: []md.AllowanceDetail{
+				{AllowanceType: "rmf", Claimed: money.Baht(500000), Allowed: money.Baht(300000), Limit: money.Baht(300000), Reason: ct.CapPercentOfGross},
+				{AllowanceType: "ssf", Claimed: money.Baht(200000), Allowed: money.Baht(200000), Limit: money.Baht(200000), Reason: ct.ReasonClaimed},
+				{AllowanceType: ct.Personal, Claimed: money.Baht(60000), Allowed: money.Baht(60000), Limit: money.Baht(60000), Reason: ct.ReasonAutoClaimed},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			serv := services.NewServices(groupRepo())
+			rep, err := serv.TaxCalculations(tc.request)
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, rep.Allowances)
+		})
+	}
+}
+
+func TestCalculateTax_AllowanceGroupError(t *testing.T) {
+	repo := groupRepo()
+	repo.awcErr = errors.New("error")
+	serv := services.NewServices(repo)
+
+	_, err := serv.TaxCalculations(md.TaxRequest{TotalIncome: money.Baht(500000)})
+
+	assert.EqualError(t, err, ct.ErrMessageInternal)
+}
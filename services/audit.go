@@ -0,0 +1,82 @@
+package services
+
+import (
+	"encoding/json"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/repository"
+)
+
+type AuditService interface {
+	ListAuditEntries(q models.AuditQuery) (models.AuditResponse, error)
+}
+
+// auditService reads the audit log. Entries are written by the repository
+// together with the change they describe.
+type auditService struct {
+	repo repository.AuditRepository
+}
+
+func NewAuditService(r repository.AuditRepository) *auditService {
+	return &auditService{repo: r}
+}
+
+// auditEntry starts the audit entry of a write by an admin. The repository
+// adds the values before and after.
+func auditEntry(by ct.Actor, action, target string) repository.AuditEntry {
+	return repository.AuditEntry{User: by.User, RequestID: by.RequestID, Action: action, Target: target}
+}
+
+// ListAuditEntries returns a page of the entries selected by q, the latest
+// first. A zero limit means ct.AuditPageSize.
+func (as *auditService) ListAuditEntries(q models.AuditQuery) (models.AuditResponse, error) {
+	if q.Limit == 0 {
+		q.Limit = ct.AuditPageSize
+	}
+	if q.Limit < 1 || q.Limit > ct.AuditMaxPageSize {
+		return models.AuditResponse{}, ErrPageLimit.WithArgs(ct.AuditMaxPageSize)
+	}
+	if q.Offset < 0 {
+		return models.AuditResponse{}, ErrPageOffset
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.From.After(q.To) {
+		return models.AuditResponse{}, ErrDateRange
+	}
+
+	rows, total, err := as.repo.ListAuditEntries(repository.AuditFilter{
+		User:   q.User,
+		Action: q.Action,
+		Target: q.Target,
+		From:   q.From,
+		To:     q.To,
+		Limit:  q.Limit,
+		Offset: q.Offset,
+	})
+	if err != nil {
+		return models.AuditResponse{}, ErrInternal
+	}
+
+	res := models.AuditResponse{Entries: make([]models.AuditEntry, 0, len(rows)), Total: total, Limit: q.Limit, Offset: q.Offset}
+	for _, r := range rows {
+		res.Entries = append(res.Entries, models.AuditEntry{
+			ID:        r.ID,
+			CreatedAt: r.CreatedAt,
+			User:      r.User,
+			RequestID: r.RequestID,
+			Action:    r.Action,
+			Target:    r.Target,
+			OldValue:  rawJSON(r.OldValue),
+			NewValue:  rawJSON(r.NewValue),
+		})
+	}
+	return res, nil
+}
+
+// rawJSON returns b as JSON, or null when it is empty.
+func rawJSON(b []byte) json.RawMessage {
+	if len(b) == 0 {
+		return json.RawMessage("null")
+	}
+	return b
+}
@@ -0,0 +1,71 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/stretchr/testify/assert"
+)
+
+var _admin = ct.Actor{User: "adminTax", RequestID: "req-1"}
+
+type MockAuditRepository struct {
+	rows   []repository.AuditEntry
+	total  int
+	err    error
+	filter repository.AuditFilter
+}
+
+func (m *MockAuditRepository) ListAuditEntries(f repository.AuditFilter) ([]repository.AuditEntry, int, error) {
+	m.filter = f
+	return m.rows, m.total, m.err
+}
+
+func TestListAuditEntries(t *testing.T) {
+	t.Run("given no limit should use the default page size", func(t *testing.T) {
+		created := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+		repo := &MockAuditRepository{total: 1, rows: []repository.AuditEntry{{
+			ID: 3, CreatedAt: created, User: "adminTax", RequestID: "req-1", Action: ct.AuditAllowanceCreate, Target: "pension",
+			NewValue: []byte(`{"allowance_name": "pension"}`),
+		}}}
+
+		res, err := services.NewAuditService(repo).ListAuditEntries(md.AuditQuery{User: "adminTax"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, repository.AuditFilter{User: "adminTax", Limit: ct.AuditPageSize}, repo.filter)
+		assert.Equal(t, 1, res.Total)
+		if assert.Len(t, res.Entries, 1) {
+			assert.Equal(t, "null", string(res.Entries[0].OldValue), "Nothing was there before a create")
+			assert.JSONEq(t, `{"allowance_name": "pension"}`, string(res.Entries[0].NewValue))
+		}
+	})
+
+	cases := []struct {
+		name     string
+		query    md.AuditQuery
+		repoErr  error
+		expected error
+	}{
+		{name: "given limit over the maximum should fail", query: md.AuditQuery{Limit: ct.AuditMaxPageSize + 1}, expected: services.ErrPageLimit},
+		{name: "given negative offset should fail", query: md.AuditQuery{Offset: -1}, expected: services.ErrPageOffset},
+		{
+			name:     "given from after to should fail",
+			query:    md.AuditQuery{From: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+			expected: services.ErrDateRange,
+		},
+		{name: "given database error should fail", repoErr: errors.New("db down"), expected: services.ErrInternal},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := services.NewAuditService(&MockAuditRepository{err: tc.repoErr}).ListAuditEntries(tc.query)
+
+			assert.ErrorIs(t, err, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"encoding/json"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/repository"
+)
+
+type CalculationService interface {
+	ListCalculations(q models.CalculationQuery) (models.CalculationsResponse, error)
+	GetCalculation(id int64) (models.Calculation, error)
+}
+
+// calculationService reads the history of calculations recorded by a tax
+// service with a history, see WithHistory.
+type calculationService struct {
+	repo repository.CalculationRepository
+}
+
+func NewCalculationService(r repository.CalculationRepository) *calculationService {
+	return &calculationService{repo: r}
+}
+
+// WithHistory records every calculation made through TaxCalculations in r.
+// Rows of a CSV upload are not recorded one by one.
+func (ts *taxService) WithHistory(r repository.CalculationRepository) *taxService {
+	ts.history = r
+	return ts
+}
+
+// saveCalculation records a calculation and returns res with its id. A
+// calculation that cannot be recorded fails, so no figure is ever handed out
+// without a record of it.
+func (ts *taxService) saveCalculation(req models.TaxRequest, res models.TaxResponse, cfg taxConfig) (models.TaxResponse, error) {
+	request, err := json.Marshal(req)
+	if err != nil {
+		return models.TaxResponse{}, ErrInternal
+	}
+	response, err := json.Marshal(res)
+	if err != nil {
+		return models.TaxResponse{}, ErrInternal
+	}
+
+	saved, err := ts.history.SaveTaxCalculation(repository.TaxCalculation{
+		TaxYear:     cfg.taxYear,
+		TotalIncome: req.TotalIncome,
+		SnapshotID:  cfg.snapshotID,
+		Request:     request,
+		Response:    response,
+	})
+	if err != nil {
+		return models.TaxResponse{}, ErrInternal
+	}
+	res.CalculationID = saved.ID
+	return res, nil
+}
+
+// ListCalculations returns a page of the calculations selected by q, the
+// latest first. A zero limit means ct.CalculationsPageSize.
+func (cs *calculationService) ListCalculations(q models.CalculationQuery) (models.CalculationsResponse, error) {
+	if q.Limit == 0 {
+		q.Limit = ct.CalculationsPageSize
+	}
+	if err := validateCalculationQuery(q); err != nil {
+		return models.CalculationsResponse{}, err
+	}
+
+	rows, total, err := cs.repo.ListTaxCalculations(repository.CalculationFilter{
+		From:      q.From,
+		To:        q.To,
+		MinIncome: q.MinIncome,
+		MaxIncome: q.MaxIncome,
+		Limit:     q.Limit,
+		Offset:    q.Offset,
+	})
+	if err != nil {
+		return models.CalculationsResponse{}, ErrInternal
+	}
+
+	res := models.CalculationsResponse{Calculations: make([]models.Calculation, 0, len(rows)), Total: total, Limit: q.Limit, Offset: q.Offset}
+	for _, r := range rows {
+		c, err := toCalculation(r)
+		if err != nil {
+			return models.CalculationsResponse{}, err
+		}
+		res.Calculations = append(res.Calculations, c)
+	}
+	return res, nil
+}
+
+func (cs *calculationService) GetCalculation(id int64) (models.Calculation, error) {
+	if id <= 0 {
+		return models.Calculation{}, ErrCalculationNotFound
+	}
+	r, err := cs.repo.GetTaxCalculation(id)
+	if err != nil {
+		return models.Calculation{}, ErrInternal
+	}
+	if r == nil {
+		return models.Calculation{}, ErrCalculationNotFound
+	}
+	return toCalculation(*r)
+}
+
+func validateCalculationQuery(q models.CalculationQuery) error {
+	if q.Limit < 1 || q.Limit > ct.CalculationsMaxPageSize {
+		return ErrPageLimit.WithArgs(ct.CalculationsMaxPageSize)
+	}
+	if q.Offset < 0 {
+		return ErrPageOffset
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.From.After(q.To) {
+		return ErrDateRange
+	}
+	if q.MinIncome != nil && q.MaxIncome != nil && *q.MinIncome > *q.MaxIncome {
+		return ErrIncomeRange
+	}
+	return nil
+}
+
+func toCalculation(r repository.TaxCalculation) (models.Calculation, error) {
+	c := models.Calculation{ID: r.ID, CreatedAt: r.CreatedAt, TaxYear: r.TaxYear, SnapshotID: r.SnapshotID}
+	if err := json.Unmarshal(r.Request, &c.Request); err != nil {
+		return models.Calculation{}, ErrInternal
+	}
+	if err := json.Unmarshal(r.Response, &c.Response); err != nil {
+		return models.Calculation{}, ErrInternal
+	}
+	c.Response.CalculationID = r.ID
+	return c, nil
+}
@@ -0,0 +1,166 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockCalculationRepository struct {
+	saved   []repository.TaxCalculation
+	filter  repository.CalculationFilter
+	rows    []repository.TaxCalculation
+	total   int
+	err     error
+	askedID int64
+}
+
+func (m *MockCalculationRepository) SaveTaxCalculation(c repository.TaxCalculation) (*repository.TaxCalculation, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	c.ID = int64(len(m.saved) + 1)
+	m.saved = append(m.saved, c)
+	return &c, nil
+}
+
+func (m *MockCalculationRepository) GetTaxCalculation(id int64) (*repository.TaxCalculation, error) {
+	m.askedID = id
+	for _, c := range m.saved {
+		if c.ID == id {
+			return &c, m.err
+		}
+	}
+	return nil, m.err
+}
+
+func (m *MockCalculationRepository) ListTaxCalculations(f repository.CalculationFilter) ([]repository.TaxCalculation, int, error) {
+	m.filter = f
+	return m.rows, m.total, m.err
+}
+
+func TestTaxCalculations_RecordsHistory(t *testing.T) {
+	history := &MockCalculationRepository{}
+	ts := services.NewServices(_mockRepo).WithHistory(history)
+	req := md.TaxRequest{TotalIncome: money.Baht(500000), TaxYear: 2023}
+
+	res, err := ts.TaxCalculations(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res.CalculationID)
+	if assert.Len(t, history.saved, 1) {
+		saved := history.saved[0]
+		assert.Equal(t, 2023, saved.TaxYear)
+		assert.Equal(t, money.Baht(500000), saved.TotalIncome)
+		assert.Equal(t, int64(1), saved.SnapshotID)
+		assert.JSONEq(t, `{"totalIncome": 500000, "wht": 0, "allowances": null, "taxYear": 2023}`, string(saved.Request))
+		assert.Contains(t, string(saved.Response), `"tax":29000`)
+	}
+
+	calc, err := services.NewCalculationService(history).GetCalculation(1)
+	assert.Nil(t, err)
+	assert.Equal(t, req.TotalIncome, calc.Request.TotalIncome)
+	assert.Equal(t, res, calc.Response, "The stored response should be the one returned")
+}
+
+func TestTaxCalculations_Snapshot(t *testing.T) {
+	old := &repository.ConfigSnapshot{ID: 7, TaxRates: _taxRates}
+	for _, a := range _allowances {
+		if a.Allowance_name == ct.Personal {
+			a.LimitAmt = money.Baht(50000)
+		}
+		old.Allowances = append(old.Allowances, a)
+	}
+	repo := &MockTaxRepository{taxRates: _taxRates, allowances: _allowances, snapshots: map[int64]*repository.ConfigSnapshot{7: old}}
+
+	t.Run("given no snapshot should use the latest", func(t *testing.T) {
+		history := &MockCalculationRepository{}
+
+		res, err := services.NewServices(repo).WithHistory(history).TaxCalculations(md.TaxRequest{TotalIncome: money.Baht(500000)})
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), res.SnapshotID)
+		assert.Equal(t, money.Baht(29000), res.Tax)
+		assert.Equal(t, int64(1), history.saved[0].SnapshotID)
+	})
+
+	t.Run("given old snapshot should calculate under its settings", func(t *testing.T) {
+		history := &MockCalculationRepository{}
+
+		res, err := services.NewServices(repo).WithHistory(history).TaxCalculations(md.TaxRequest{TotalIncome: money.Baht(500000), SnapshotID: 7})
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(7), res.SnapshotID)
+		assert.Equal(t, money.Baht(30000), res.Tax, "The old personal allowance of 50,000 should apply")
+		assert.Equal(t, int64(7), history.saved[0].SnapshotID)
+	})
+
+	t.Run("given unknown snapshot should return not found", func(t *testing.T) {
+		_, err := services.NewServices(repo).TaxCalculations(md.TaxRequest{TotalIncome: money.Baht(500000), SnapshotID: 9})
+
+		assert.ErrorIs(t, err, services.ErrSnapshotUnknown)
+	})
+}
+
+func TestTaxCalculations_HistoryError(t *testing.T) {
+	ts := services.NewServices(_mockRepo).WithHistory(&MockCalculationRepository{err: errors.New("db down")})
+
+	_, err := ts.TaxCalculations(md.TaxRequest{TotalIncome: money.Baht(500000)})
+
+	assert.ErrorIs(t, err, services.ErrInternal, "A calculation that cannot be recorded should fail")
+}
+
+func TestListCalculations(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	min, max := money.Baht(100000), money.Baht(50000)
+
+	t.Run("given no limit should use the default page size", func(t *testing.T) {
+		repo := &MockCalculationRepository{
+			rows:  []repository.TaxCalculation{{ID: 7, TaxYear: 2024, SnapshotID: 3, Request: []byte(`{"totalIncome": 500000}`), Response: []byte(`{"tax": 29000}`)}},
+			total: 12,
+		}
+
+		res, err := services.NewCalculationService(repo).ListCalculations(md.CalculationQuery{From: from, To: to, Offset: 10})
+
+		assert.Nil(t, err)
+		assert.Equal(t, repository.CalculationFilter{From: from, To: to, Limit: ct.CalculationsPageSize, Offset: 10}, repo.filter)
+		assert.Equal(t, 12, res.Total)
+		if assert.Len(t, res.Calculations, 1) {
+			assert.Equal(t, int64(7), res.Calculations[0].ID)
+			assert.Equal(t, money.Baht(29000), res.Calculations[0].Response.Tax)
+			assert.Equal(t, int64(7), res.Calculations[0].Response.CalculationID)
+		}
+	})
+
+	cases := []struct {
+		name  string
+		query md.CalculationQuery
+		err   error
+	}{
+		{name: "given limit above maximum should fail", query: md.CalculationQuery{Limit: ct.CalculationsMaxPageSize + 1}, err: services.ErrPageLimit},
+		{name: "given negative offset should fail", query: md.CalculationQuery{Offset: -1}, err: services.ErrPageOffset},
+		{name: "given from after to should fail", query: md.CalculationQuery{From: to, To: from}, err: services.ErrDateRange},
+		{name: "given min income above max income should fail", query: md.CalculationQuery{MinIncome: &min, MaxIncome: &max}, err: services.ErrIncomeRange},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := services.NewCalculationService(&MockCalculationRepository{}).ListCalculations(tc.query)
+
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestGetCalculation_NotFound(t *testing.T) {
+	_, err := services.NewCalculationService(&MockCalculationRepository{}).GetCalculation(42)
+
+	assert.ErrorIs(t, err, services.ErrCalculationNotFound)
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/jwt"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/repository"
+)
+
+type ClientService interface {
+	AuthenticateAPIKey(key string) (*models.Client, error)
+	AuthenticateToken(token string) (*models.Client, error)
+	ListAPIKeys() (models.APIKeysResponse, error)
+	CreateAPIKey(req models.APIKeyRequest, by ct.Actor) (models.APIKeyCreated, error)
+	RevokeAPIKey(id int64, by ct.Actor) error
+}
+
+// clientService signs in service callers, with API keys issued by admins or
+// with JWTs signed by keys of a local key set.
+type clientService struct {
+	repo     repository.APIKeyRepository
+	keys     *jwt.KeySet
+	issuer   string
+	audience string
+}
+
+func NewClientService(r repository.APIKeyRepository) *clientService {
+	return &clientService{repo: r}
+}
+
+// WithJWT accepts JWTs signed by keys. A token must be issued by issuer and
+// meant for audience when either is set. Without a key set no JWT is
+// accepted.
+func (cs *clientService) WithJWT(keys *jwt.KeySet, issuer, audience string) *clientService {
+	cs.keys, cs.issuer, cs.audience = keys, issuer, audience
+	return cs
+}
+
+// apiKeySecretBytes is how much randomness an API key carries.
+const apiKeySecretBytes = 32
+
+// apiKeyPrefixLength is how much of a key is kept to tell keys apart, e.g.
+// "atx_Zk3q9Hc1".
+var apiKeyPrefixLength = len(ct.APIKeyPrefix) + 8
+
+// AuthenticateAPIKey returns the client of key, or nil when the key is
+// unknown or revoked. A key is random enough that an unsalted hash is as good
+// as a password hash, and can be looked up.
+func (cs *clientService) AuthenticateAPIKey(key string) (*models.Client, error) {
+	if !strings.HasPrefix(key, ct.APIKeyPrefix) {
+		return nil, nil
+	}
+	k, err := cs.repo.GetAPIKeyByHash(hashAPIKey(key))
+	if err != nil {
+		return nil, ErrInternal
+	}
+	if k == nil || k.RevokedAt != nil {
+		return nil, nil
+	}
+	return &models.Client{Name: k.Client, Scopes: k.Scopes}, nil
+}
+
+// AuthenticateToken returns the client of a JWT, named by its subject, or nil
+// when the token does not verify. Scopes this service does not know are
+// dropped.
+func (cs *clientService) AuthenticateToken(token string) (*models.Client, error) {
+	if cs.keys == nil {
+		return nil, nil
+	}
+	c, err := cs.keys.Verify(token, time.Now())
+	if err != nil || c.Subject == "" {
+		return nil, nil
+	}
+	if cs.issuer != "" && c.Issuer != cs.issuer {
+		return nil, nil
+	}
+	if cs.audience != "" && !slices.Contains(c.Audience, cs.audience) {
+		return nil, nil
+	}
+
+	scopes, _ := inOrderOf(ct.Scopes, c.Scopes())
+	return &models.Client{Name: c.Subject, Scopes: scopes}, nil
+}
+
+func (cs *clientService) ListAPIKeys() (models.APIKeysResponse, error) {
+	keys, err := cs.repo.ListAPIKeys()
+	if err != nil {
+		return models.APIKeysResponse{}, ErrInternal
+	}
+	res := models.APIKeysResponse{Keys: make([]models.APIKey, 0, len(keys))}
+	for _, k := range keys {
+		res.Keys = append(res.Keys, toAPIKey(k))
+	}
+	return res, nil
+}
+
+// CreateAPIKey issues a new key to a client. The key is returned only here.
+func (cs *clientService) CreateAPIKey(req models.APIKeyRequest, by ct.Actor) (models.APIKeyCreated, error) {
+	if !adminUsernamePattern.MatchString(req.Client) {
+		return models.APIKeyCreated{}, ErrAPIKeyClient
+	}
+	scopes, ok := inOrderOf(ct.Scopes, req.Scopes)
+	if !ok || len(scopes) == 0 {
+		return models.APIKeyCreated{}, ErrAPIKeyScopes.WithArgs(strings.Join(ct.Scopes, ", "))
+	}
+
+	secret := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return models.APIKeyCreated{}, ErrInternal
+	}
+	key := ct.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	k, err := cs.repo.CreateAPIKey(repository.APIKey{
+		Client: req.Client,
+		Prefix: key[:apiKeyPrefixLength],
+		Hash:   hashAPIKey(key),
+		Scopes: scopes,
+	}, auditEntry(by, ct.AuditAPIKeyCreate, req.Client))
+	if err != nil {
+		return models.APIKeyCreated{}, ErrInternal
+	}
+	return models.APIKeyCreated{APIKey: toAPIKey(*k), Key: key}, nil
+}
+
+// RevokeAPIKey stops a key from signing in. The key is kept for the record.
+func (cs *clientService) RevokeAPIKey(id int64, by ct.Actor) error {
+	revoked, err := cs.repo.RevokeAPIKey(id, auditEntry(by, ct.AuditAPIKeyRevoke, strconv.FormatInt(id, 10)))
+	if err != nil {
+		return ErrInternal
+	}
+	if !revoked {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func toAPIKey(k repository.APIKey) models.APIKey {
+	return models.APIKey{
+		ID:        k.ID,
+		Client:    k.Client,
+		Prefix:    k.Prefix,
+		Scopes:    k.Scopes,
+		CreatedAt: k.CreatedAt,
+		RevokedAt: k.RevokedAt,
+	}
+}
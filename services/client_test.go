@@ -0,0 +1,171 @@
+package services_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/jwt"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockAPIKeyRepository struct {
+	keys    []repository.APIKey
+	err     error
+	created repository.APIKey
+	change  repository.AuditEntry
+}
+
+func (m *MockAPIKeyRepository) GetAPIKeyByHash(hash string) (*repository.APIKey, error) {
+	for _, k := range m.keys {
+		if k.Hash == hash {
+			return &k, m.err
+		}
+	}
+	return nil, m.err
+}
+
+func (m *MockAPIKeyRepository) ListAPIKeys() ([]repository.APIKey, error) {
+	return m.keys, m.err
+}
+
+func (m *MockAPIKeyRepository) CreateAPIKey(k repository.APIKey, change repository.AuditEntry) (*repository.APIKey, error) {
+	m.created, m.change = k, change
+	k.ID = int64(len(m.keys) + 1)
+	m.keys = append(m.keys, k)
+	return &k, m.err
+}
+
+func (m *MockAPIKeyRepository) RevokeAPIKey(id int64, change repository.AuditEntry) (bool, error) {
+	m.change = change
+	for i, k := range m.keys {
+		if k.ID == id && k.RevokedAt == nil {
+			now := time.Now()
+			m.keys[i].RevokedAt = &now
+			return true, m.err
+		}
+	}
+	return false, m.err
+}
+
+var _jwtSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func hs256Token(claims map[string]interface{}) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	c, _ := json.Marshal(claims)
+	signed := enc([]byte(`{"alg":"HS256","kid":"payroll"}`)) + "." + enc(c)
+	mac := hmac.New(sha256.New, _jwtSecret)
+	mac.Write([]byte(signed))
+	return signed + "." + enc(mac.Sum(nil))
+}
+
+func keySet(t *testing.T) *jwt.KeySet {
+	ks, err := jwt.ParseJWKS([]byte(`{"keys": [{"kty": "oct", "kid": "payroll", "k": "` + base64.RawURLEncoding.EncodeToString(_jwtSecret) + `"}]}`))
+	assert.Nil(t, err)
+	return ks
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	t.Run("given client and scopes should issue a key only its hash is kept of", func(t *testing.T) {
+		repo := &MockAPIKeyRepository{}
+		cs := services.NewClientService(repo)
+
+		res, err := cs.CreateAPIKey(md.APIKeyRequest{Client: "payroll", Scopes: []string{ct.ScopeBulkUpload, ct.ScopeCalculate}}, _admin)
+
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(res.Key, ct.APIKeyPrefix))
+		assert.True(t, strings.HasPrefix(res.Key, res.Prefix))
+		assert.Equal(t, []string{ct.ScopeCalculate, ct.ScopeBulkUpload}, res.Scopes)
+		assert.NotEqual(t, res.Key, repo.created.Hash)
+		assert.Len(t, repo.created.Hash, 64, "Only a SHA-256 hash of the key should be stored")
+		assert.Equal(t, repository.AuditEntry{User: "adminTax", RequestID: "req-1", Action: ct.AuditAPIKeyCreate, Target: "payroll"}, repo.change)
+
+		cl, err := cs.AuthenticateAPIKey(res.Key)
+		assert.Nil(t, err)
+		assert.Equal(t, &md.Client{Name: "payroll", Scopes: []string{ct.ScopeCalculate, ct.ScopeBulkUpload}}, cl)
+	})
+
+	cases := []struct {
+		name     string
+		request  md.APIKeyRequest
+		expected error
+	}{
+		{name: "given invalid client should fail", request: md.APIKeyRequest{Client: "pay roll", Scopes: []string{ct.ScopeCalculate}}, expected: services.ErrAPIKeyClient},
+		{name: "given no scope should fail", request: md.APIKeyRequest{Client: "payroll"}, expected: services.ErrAPIKeyScopes},
+		{name: "given unknown scope should fail", request: md.APIKeyRequest{Client: "payroll", Scopes: []string{"root"}}, expected: services.ErrAPIKeyScopes},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := services.NewClientService(&MockAPIKeyRepository{}).CreateAPIKey(tc.request, _admin)
+
+			assert.ErrorIs(t, err, tc.expected)
+		})
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	repo := &MockAPIKeyRepository{}
+	cs := services.NewClientService(repo)
+	res, _ := cs.CreateAPIKey(md.APIKeyRequest{Client: "mobile", Scopes: []string{ct.ScopeCalculate}}, _admin)
+
+	assert.Nil(t, cs.RevokeAPIKey(res.ID, _admin))
+	assert.Equal(t, ct.AuditAPIKeyRevoke, repo.change.Action)
+
+	cl, err := cs.AuthenticateAPIKey(res.Key)
+	assert.Nil(t, err)
+	assert.Nil(t, cl, "A revoked key should not sign in")
+	assert.ErrorIs(t, cs.RevokeAPIKey(res.ID, _admin), services.ErrAPIKeyNotFound)
+}
+
+func TestAuthenticateAPIKey_Error(t *testing.T) {
+	_, err := services.NewClientService(&MockAPIKeyRepository{err: errors.New("db down")}).AuthenticateAPIKey(ct.APIKeyPrefix + "abc")
+
+	assert.ErrorIs(t, err, services.ErrInternal)
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	exp := time.Now().Add(time.Minute).Unix()
+	cases := []struct {
+		name     string
+		claims   map[string]interface{}
+		expected *md.Client
+	}{
+		{
+			name:     "given valid token should sign in with known scopes",
+			claims:   map[string]interface{}{"sub": "mobile", "iss": "idp", "aud": []string{"assessment-tax"}, "exp": exp, "scope": "calculate root"},
+			expected: &md.Client{Name: "mobile", Scopes: []string{ct.ScopeCalculate}},
+		},
+		{name: "given other issuer should not sign in", claims: map[string]interface{}{"sub": "mobile", "iss": "other", "aud": "assessment-tax", "exp": exp}},
+		{name: "given other audience should not sign in", claims: map[string]interface{}{"sub": "mobile", "iss": "idp", "aud": "other", "exp": exp}},
+		{name: "given no subject should not sign in", claims: map[string]interface{}{"iss": "idp", "aud": "assessment-tax", "exp": exp}},
+		{name: "given expired token should not sign in", claims: map[string]interface{}{"sub": "mobile", "iss": "idp", "aud": "assessment-tax", "exp": time.Now().Unix() - 1}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cs := services.NewClientService(&MockAPIKeyRepository{}).WithJWT(keySet(t), "idp", "assessment-tax")
+
+			cl, err := cs.AuthenticateToken(hs256Token(tc.claims))
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, cl)
+		})
+	}
+
+	t.Run("given no key set should not sign in", func(t *testing.T) {
+		cl, err := services.NewClientService(&MockAPIKeyRepository{}).AuthenticateToken(hs256Token(map[string]interface{}{"sub": "mobile", "exp": exp}))
+
+		assert.Nil(t, err)
+		assert.Nil(t, cl)
+	})
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"errors"
+	"sort"
+
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/repository"
+)
+
+// taxConfig is the configuration in force for a tax year in a config
+// snapshot: its brackets, its allowance types keyed by allowance name and its
+// allowance group ceilings keyed by group name.
+type taxConfig struct {
+	snapshotID int64
+	taxYear    int
+	rates      []*repository.IncomeTaxRates
+	allowances map[string]repository.Allowances
+	groups     map[string]money.Amount
+}
+
+// configSnapshot returns the snapshot with the given id, or the latest one
+// when id is zero.
+func (ts *taxService) configSnapshot(id int64) (*repository.ConfigSnapshot, error) {
+	s, err := ts.repo.GetConfigSnapshot(id)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	if s == nil {
+		if id != 0 {
+			return nil, ErrSnapshotUnknown.WithArgs(id)
+		}
+		return nil, ErrInternal
+	}
+	return s, nil
+}
+
+// taxConfig returns the configuration of taxYear in the snapshot with the
+// given id, or in the latest one when id is zero.
+func (ts *taxService) taxConfig(taxYear int, snapshotID int64) (taxConfig, error) {
+	s, err := ts.configSnapshot(snapshotID)
+	if err != nil {
+		return taxConfig{}, err
+	}
+	return configOfYear(s, taxYear), nil
+}
+
+// configOfYear picks the rows of s in force for taxYear, i.e. for each bracket
+// set, allowance type and group the row with the latest tax year that is not
+// after taxYear, the same way the repository does.
+func configOfYear(s *repository.ConfigSnapshot, taxYear int) taxConfig {
+	cfg := taxConfig{
+		snapshotID: s.ID,
+		taxYear:    taxYear,
+		allowances: map[string]repository.Allowances{},
+		groups:     map[string]money.Amount{},
+	}
+
+	ratesYear := -1
+	for _, r := range s.TaxRates {
+		if r.TaxYear <= taxYear && r.TaxYear > ratesYear {
+			ratesYear = r.TaxYear
+		}
+	}
+	for _, r := range s.TaxRates {
+		if r.TaxYear == ratesYear {
+			t := *r
+			cfg.rates = append(cfg.rates, &t)
+		}
+	}
+	sort.Slice(cfg.rates, func(i, j int) bool { return cfg.rates[i].MinIncome < cfg.rates[j].MinIncome })
+
+	for _, a := range s.Allowances {
+		if cur, ok := cfg.allowances[a.Allowance_name]; a.TaxYear <= taxYear && (!ok || a.TaxYear > cur.TaxYear) {
+			cfg.allowances[a.Allowance_name] = a
+		}
+	}
+
+	groupYears := map[string]int{}
+	for _, g := range s.Groups {
+		if y, ok := groupYears[g.GroupName]; g.TaxYear <= taxYear && (!ok || g.TaxYear > y) {
+			groupYears[g.GroupName] = g.TaxYear
+			cfg.groups[g.GroupName] = g.LimitAmt
+		}
+	}
+	return cfg
+}
+
+// GetConfigSnapshot returns the snapshot with the given id, or the latest one
+// when id is zero.
+func (ts *taxService) GetConfigSnapshot(id int64) (models.ConfigSnapshot, error) {
+	if id < 0 {
+		return models.ConfigSnapshot{}, ErrSnapshotNotFound.WithArgs(id)
+	}
+	s, err := ts.configSnapshot(id)
+	if errors.Is(err, ErrSnapshotUnknown) {
+		return models.ConfigSnapshot{}, ErrSnapshotNotFound.WithArgs(id)
+	}
+	if err != nil {
+		return models.ConfigSnapshot{}, err
+	}
+
+	res := models.ConfigSnapshot{
+		ID:              s.ID,
+		CreatedAt:       s.CreatedAt,
+		TaxRates:        make([]models.TaxRate, 0, len(s.TaxRates)),
+		Allowances:      make([]models.AllowanceConfig, 0, len(s.Allowances)),
+		AllowanceGroups: make([]models.AllowanceGroup, 0, len(s.Groups)),
+	}
+	for _, r := range s.TaxRates {
+		res.TaxRates = append(res.TaxRates, toTaxRate(r))
+	}
+	for _, a := range s.Allowances {
+		res.Allowances = append(res.Allowances, toAllowanceConfig(a))
+	}
+	for _, g := range s.Groups {
+		res.AllowanceGroups = append(res.AllowanceGroups, models.AllowanceGroup{GroupName: g.GroupName, TaxYear: g.TaxYear, LimitAmount: g.LimitAmt})
+	}
+	return res, nil
+}
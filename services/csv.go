@@ -0,0 +1,181 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/repository"
+)
+
+const (
+	csvIncome = "totalIncome"
+	csvWHT    = "wht"
+	csvID     = "id"
+)
+
+// csvColumnAliases maps normalized header names to the columns they stand
+// for. Allowance columns are matched against the allowances in force instead.
+var csvColumnAliases = map[string]string{
+	"totalincome":    csvIncome,
+	"income":         csvIncome,
+	"wht":            csvWHT,
+	"withholdingtax": csvWHT,
+	"id":             csvID,
+	"rowid":          csvID,
+	"employeeid":     csvID,
+	"reference":      csvID,
+}
+
+// normalizeHeader makes header matching ignore case, spaces, hyphens,
+// underscores and a byte order mark, e.g. "Total Income", "total_income" and
+// "totalIncome" match.
+func normalizeHeader(h string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '-', '_', '\ufeff':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(h)))
+}
+
+// parseTaxCsv reads tax requests from a CSV file with a header row and calls
+// yield with each one, in file order, without holding the file in memory. The
+// totalIncome column is required. The wht column, an id column that is echoed
+// back in the results, and a column per allowance type, named after the
+// allowance type or its response name, are optional. An empty or zero
+// allowance cell claims nothing.
+//
+// A row that cannot be read is passed to yield as a row error and the other
+// rows are still read. Each request, and each row error, has the row it was
+// read from as its Input. The returned error is set when the file as a whole
+// cannot be used, e.g. its header is wrong, when it has more than maxRows
+// rows, or when yield fails. A maxRows of zero means no limit.
+//
+// The allowance columns are those of cfg, so that they are the allowances the
+// rows are then calculated with.
+func parseTaxCsv(r io.Reader, maxRows int, cfg taxConfig, yield func(models.TaxRequest, *Error) error) error {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return ErrCsvFormat
+	}
+
+	columns, err := csvColumns(header, cfg.allowances)
+	if err != nil {
+		return err
+	}
+	// Rows are read into the same slice, so what is passed on is copied.
+	inputHeader := make([]string, len(header))
+	for i, h := range header {
+		inputHeader[i] = strings.TrimPrefix(h, "\ufeff")
+	}
+
+	for rows := 1; ; rows++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		// a row that failed to parse may have no fields to take the line from
+		var line int
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			line = perr.Line
+		} else if err != nil {
+			return ErrReadCsvFailed
+		} else {
+			line, _ = reader.FieldPos(0)
+		}
+		if maxRows > 0 && rows > maxRows {
+			return ErrCsvTooManyRows.WithArgs(maxRows).AtLine(line)
+		}
+
+		var taxReq models.TaxRequest
+		rowErr := ErrCsvFormat.AtLine(line)
+		if perr == nil {
+			taxReq, rowErr = parseCsvRow(columns, row, line)
+		}
+		taxReq.Input = &models.CsvRow{Header: inputHeader, Cells: append([]string(nil), row...)}
+		if err := yield(taxReq, rowErr); err != nil {
+			return err
+		}
+	}
+}
+
+// csvColumns returns the column each header stands for: totalIncome, wht, id
+// or one of allowances, keyed by allowance name.
+func csvColumns(header []string, allowances map[string]repository.Allowances) ([]string, error) {
+	allowanceColumns := map[string]string{}
+	for name, a := range allowances {
+		allowanceColumns[normalizeHeader(name)] = name
+		allowanceColumns[normalizeHeader(a.ResponseName)] = name
+	}
+
+	columns := make([]string, len(header))
+	seen := map[string]bool{}
+	for i, h := range header {
+		key := normalizeHeader(h)
+		col, ok := csvColumnAliases[key]
+		if !ok {
+			col, ok = allowanceColumns[key]
+		}
+		if !ok {
+			return nil, ErrCsvColumn.WithArgs(strings.TrimSpace(h)).WithField(h).AtLine(1)
+		}
+		if seen[col] {
+			return nil, ErrCsvDuplicateColumn.WithArgs(strings.TrimSpace(h)).WithField(h).AtLine(1)
+		}
+		seen[col] = true
+		columns[i] = col
+	}
+
+	if !seen[csvIncome] {
+		return nil, ErrCsvColumnMissing.WithArgs(csvIncome).WithField(csvIncome).AtLine(1)
+	}
+	return columns, nil
+}
+
+func parseCsvRow(columns []string, row []string, line int) (models.TaxRequest, *Error) {
+	taxReq := models.TaxRequest{Line: line}
+	for i, col := range columns {
+		cell := strings.TrimSpace(row[i])
+		switch col {
+		case csvID:
+			taxReq.ID = cell
+		case csvIncome:
+			amt, err := money.Parse(cell)
+			if err != nil {
+				return taxReq, ErrCsvIncome.WithArgs(line).AtLine(line)
+			}
+			taxReq.TotalIncome = amt
+		case csvWHT:
+			if cell == "" {
+				continue
+			}
+			amt, err := money.Parse(cell)
+			if err != nil {
+				return taxReq, ErrCsvWHT.WithArgs(line).AtLine(line)
+			}
+			taxReq.WHT = amt
+		default:
+			if cell == "" {
+				continue
+			}
+			amt, err := money.Parse(cell)
+			if err != nil {
+				return taxReq, ErrCsvAllowance.WithArgs(col, line).WithField(col).AtLine(line)
+			}
+			if amt != 0 {
+				taxReq.Allowances = append(taxReq.Allowances, models.Allowance{AllowanceType: col, Amount: amt})
+			}
+		}
+	}
+	return taxReq, nil
+}
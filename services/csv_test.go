@@ -0,0 +1,189 @@
+package services_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// parseCsv collects the requests and row errors ParseTaxCsv yields.
+// parseCsv returns the requests read from csv without their Input, which
+// TestParseTaxCsv_Input covers.
+func parseCsv(csv string, maxRows int) ([]md.TaxRequest, []*services.Error, error) {
+	var reqs []md.TaxRequest
+	var rowErrs []*services.Error
+	err := services.ParseTaxCsv(_mockRepo, strings.NewReader(csv), maxRows, func(req md.TaxRequest, rowErr *services.Error) error {
+		if rowErr != nil {
+			rowErrs = append(rowErrs, rowErr)
+			return nil
+		}
+		req.Input = nil
+		reqs = append(reqs, req)
+		return nil
+	})
+	return reqs, rowErrs, err
+}
+
+func TestParseTaxCsv_Valids(t *testing.T) {
+	cases := []struct {
+		name     string
+		csv      string
+		expected []md.TaxRequest
+	}{
+		{
+			name: "given original three column layout should claim donation",
+			csv:  "totalIncome,wht,donation\n500000,0,0\n600000,40000,20000\n",
+			expected: []md.TaxRequest{
+				{TotalIncome: money.Baht(500000), Line: 2},
+				{TotalIncome: money.Baht(600000), WHT: money.Baht(40000), Line: 3, Allowances: []md.Allowance{{AllowanceType: ct.Donation, Amount: money.Baht(20000)}}},
+			},
+		},
+		{
+			name: "given headers in any case, order and spacing should match columns",
+			csv:  "\ufeffEmployee ID, K Receipt ,TOTAL_INCOME\nE-01,50000,750000\n",
+			expected: []md.TaxRequest{
+				{ID: "E-01", TotalIncome: money.Baht(750000), Line: 2, Allowances: []md.Allowance{{AllowanceType: ct.K_Receipt, Amount: money.Baht(50000)}}},
+			},
+		},
+		{
+			name: "given response name header and empty cells should skip empty allowances",
+			csv:  "id,income,personalDeduction,kReceipt\n1,500000,70000,\n2,400000,,\n",
+			expected: []md.TaxRequest{
+				{ID: "1", TotalIncome: money.Baht(500000), Line: 2, Allowances: []md.Allowance{{AllowanceType: ct.Personal, Amount: money.Baht(70000)}}},
+				{ID: "2", TotalIncome: money.Baht(400000), Line: 3},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, rowErrs, err := parseCsv(tc.csv, 0)
+
+			assert.Nil(t, err)
+			assert.Nil(t, rowErrs)
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+}
+
+func TestParseTaxCsv_InvalidHeaders(t *testing.T) {
+	cases := []struct {
+		name     string
+		csv      string
+		expected *services.Error
+	}{
+		{name: "given unknown column", csv: "totalIncome,bonus\n500000,1\n", expected: services.ErrCsvColumn},
+		{name: "given duplicate column", csv: "totalIncome,income\n500000,1\n", expected: services.ErrCsvDuplicateColumn},
+		{name: "given missing income column", csv: "wht,donation\n0,0\n", expected: services.ErrCsvColumnMissing},
+		{name: "given empty file", csv: "", expected: services.ErrCsvFormat},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, _, err := parseCsv(tc.csv, 0)
+
+			assert.ErrorIs(t, err, tc.expected)
+			assert.Nil(t, res)
+		})
+	}
+}
+
+func TestParseTaxCsv_RowErrors(t *testing.T) {
+	csv := "id,totalIncome,wht,donation\n" +
+		"1,abc,0,0\n" +
+		"2,500000,0,0\n" +
+		"3,500000,x,0\n" +
+		"4,500000\n" +
+		"5,500000,0,1O0\n" +
+		"6,600000,0,0\n"
+	res, rowErrs, err := parseCsv(csv, 0)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []md.TaxRequest{
+		{ID: "2", TotalIncome: money.Baht(500000), Line: 3},
+		{ID: "6", TotalIncome: money.Baht(600000), Line: 7},
+	}, res, "Valid rows should still be read")
+	expected := []struct {
+		err  *services.Error
+		line int
+	}{
+		{services.ErrCsvIncome, 2},
+		{services.ErrCsvWHT, 4},
+		{services.ErrCsvFormat, 5},
+		{services.ErrCsvAllowance, 6},
+	}
+	if assert.Len(t, rowErrs, len(expected)) {
+		for i, e := range expected {
+			assert.ErrorIs(t, rowErrs[i], e.err)
+			assert.Equal(t, e.line, rowErrs[i].Line)
+		}
+	}
+}
+
+func TestParseTaxCsv_BadQuotes(t *testing.T) {
+	cases := []struct {
+		name string
+		csv  string
+		line int
+	}{
+		{name: "given unterminated quote in first field", csv: "totalIncome,wht\n500000,0\n\"600000,0\n", line: 3},
+		{name: "given bare quote in first field", csv: "totalIncome,wht\n500000,0\n6\"00000,0\n", line: 3},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, rowErrs, err := parseCsv(tc.csv, 0)
+
+			assert.Nil(t, err)
+			assert.Equal(t, []md.TaxRequest{{TotalIncome: money.Baht(500000), Line: 2}}, res)
+			if assert.Len(t, rowErrs, 1) {
+				assert.ErrorIs(t, rowErrs[0], services.ErrCsvFormat)
+				assert.Equal(t, tc.line, rowErrs[0].Line)
+			}
+		})
+	}
+}
+
+func TestParseTaxCsv_Input(t *testing.T) {
+	csv := "\ufeffid,Total Income\nE-01,500000\nE-02,abc,1\n"
+	var inputs []*md.CsvRow
+	err := services.ParseTaxCsv(_mockRepo, strings.NewReader(csv), 0, func(req md.TaxRequest, _ *services.Error) error {
+		inputs = append(inputs, req.Input)
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []*md.CsvRow{
+		{Header: []string{"id", "Total Income"}, Cells: []string{"E-01", "500000"}},
+		{Header: []string{"id", "Total Income"}, Cells: []string{"E-02", "abc", "1"}},
+	}, inputs, "Every row, including a row error, should keep its own cells")
+}
+
+func TestParseTaxCsv_MaxRows(t *testing.T) {
+	csv := "totalIncome\n500000\n600000\n700000\n"
+
+	res, _, err := parseCsv(csv, 2)
+
+	assert.ErrorIs(t, err, services.ErrCsvTooManyRows)
+	assert.Equal(t, 4, err.(*services.Error).Line)
+	assert.Len(t, res, 2, "Rows within the limit should already be yielded")
+}
+
+func TestParseTaxCsv_YieldError(t *testing.T) {
+	calls := 0
+	yieldErr := errors.New("client gone")
+
+	err := services.ParseTaxCsv(_mockRepo, strings.NewReader("totalIncome\n500000\n600000\n"), 0, func(md.TaxRequest, *services.Error) error {
+		calls++
+		return yieldErr
+	})
+
+	assert.Equal(t, yieldErr, err)
+	assert.Equal(t, 1, calls, "Reading should stop once yield fails")
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	cm "github.com/kanawat2566/assessment-tax/common"
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"golang.org/x/text/language"
+)
+
+// Kind says what went wrong with a request. Handlers map it to an HTTP status.
+type Kind int
+
+const (
+	// KindInternal is a failure on our side, e.g. the database is down.
+	KindInternal Kind = iota
+	// KindInvalid is a request that cannot be read, e.g. malformed JSON or CSV.
+	KindInvalid
+	// KindNotFound is a request for something that does not exist.
+	KindNotFound
+	// KindConflict is a request that clashes with what is already stored.
+	KindConflict
+	// KindUnprocessable is a well-formed request that breaks a tax rule.
+	KindUnprocessable
+	// KindTooLarge is a request over a size limit, e.g. a huge CSV upload.
+	KindTooLarge
+	// KindForbidden is a request the signed in user's roles do not allow.
+	KindForbidden
+	// KindUnauthorized is a request without valid credentials.
+	KindUnauthorized
+	// KindTooManyRequests is a request over the caller's rate limit.
+	KindTooManyRequests
+)
+
+// Error is an error the caller can act on. Code is stable and meant for
+// programs; Message is meant for people and may be reworded. Field names the
+// request field at fault and Line the CSV line, when either is known.
+//
+// Message is one of the messages in constants and is formatted with args only
+// by Localize, so it can be translated to the client's language.
+type Error struct {
+	Kind    Kind   `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	args    []interface{}
+}
+
+func newError(kind Kind, code, message, field string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message, Field: field}
+}
+
+// Error returns the message in English.
+func (e *Error) Error() string {
+	return cm.Msg(language.English, e.Message, e.args...)
+}
+
+// Localize returns a copy of e with its message formatted in lang.
+func (e *Error) Localize(lang language.Tag) *Error {
+	c := *e
+	c.Message = cm.Msg(lang, e.Message, e.args...)
+	c.args = nil
+	return &c
+}
+
+// Is reports whether target has the same code, so that errors.Is matches a
+// copy made by WithMessage, WithField or AtLine against the original.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithMessage returns a copy of e with a different message.
+func (e *Error) WithMessage(message string, args ...interface{}) *Error {
+	c := *e
+	c.Message = message
+	c.args = args
+	return &c
+}
+
+// WithArgs returns a copy of e with args for the verbs in its message.
+func (e *Error) WithArgs(args ...interface{}) *Error {
+	c := *e
+	c.args = args
+	return &c
+}
+
+// WithField returns a copy of e that names field as the one at fault.
+func (e *Error) WithField(field string) *Error {
+	c := *e
+	c.Field = field
+	return &c
+}
+
+// AtLine returns a copy of e for line of an uploaded file.
+func (e *Error) AtLine(line int) *Error {
+	c := *e
+	c.Line = line
+	return &c
+}
+
+var (
+	ErrInternal  = newError(KindInternal, "internal", ct.ErrMessageInternal, "")
+	ErrForbidden = newError(KindForbidden, "forbidden", ct.ErrMsgForbidden, "")
+
+	ErrInvalidRequest     = newError(KindInvalid, "invalid_request", ct.ErrInvalidFormatReq, "")
+	ErrInvalidField       = newError(KindInvalid, "invalid_field", ct.ErrInvalidFormatReq, "")
+	ErrInvalidPathParam   = newError(KindInvalid, "invalid_path_param", ct.ErrMsgInvalidPathParam, "")
+	ErrFileNoUpload       = newError(KindInvalid, "file_not_uploaded", ct.ErrMsgFileNoUpload, "taxFile")
+	ErrReadCsvFailed      = newError(KindInvalid, "csv_read_failed", ct.ErrMsgReadCsvFailed, "taxFile")
+	ErrCsvFormat          = newError(KindInvalid, "csv_invalid_format", ct.ErrMsgCsvInvaildFormat, "taxFile")
+	ErrCsvIncome          = newError(KindInvalid, "csv_invalid_income", ct.ErrInvalidIncomeCsv, "totalIncome")
+	ErrCsvWHT             = newError(KindInvalid, "csv_invalid_wht", ct.ErrInvalidWHTCsv, "wht")
+	ErrCsvAllowance       = newError(KindInvalid, "csv_invalid_allowance", ct.ErrInvalidAllowanceCsv, "")
+	ErrCsvColumn          = newError(KindInvalid, "csv_unknown_column", ct.ErrMsgCsvColumn, "")
+	ErrCsvColumnMissing   = newError(KindInvalid, "csv_missing_column", ct.ErrMsgCsvColumnMissing, "")
+	ErrCsvDuplicateColumn = newError(KindInvalid, "csv_duplicate_column", ct.ErrMsgCsvDuplicateColumn, "")
+	ErrCsvTooLarge        = newError(KindTooLarge, "csv_too_large", ct.ErrMsgCsvTooLarge, "taxFile")
+	ErrCsvTooManyRows     = newError(KindTooLarge, "csv_too_many_rows", ct.ErrMsgCsvTooManyRows, "taxFile")
+	ErrCsvRowErrors       = newError(KindInvalid, "csv_row_errors", ct.ErrMsgTaxJobRowErrors, "taxFile")
+
+	ErrIncomeNotPositive = newError(KindUnprocessable, "income_not_positive", ct.ErrMessageThenZero, "totalIncome")
+	ErrWHTInvalid        = newError(KindUnprocessable, "wht_invalid", ct.ErrMesssageWhtInvalid, "wht")
+	ErrTaxYearInvalid    = newError(KindUnprocessable, "tax_year_invalid", ct.ErrMsgTaxYearInvalid, "taxYear")
+	ErrTaxRatesNotFound  = newError(KindUnprocessable, "tax_rates_not_found", ct.ErrMsgTaxRatesNotFound, "taxYear")
+	ErrSnapshotUnknown   = newError(KindUnprocessable, "config_snapshot_unknown", ct.ErrMsgSnapshotNotFound, "snapshotId")
+
+	ErrAllowanceNegative = newError(KindUnprocessable, "allowance_negative", ct.ErrMsgAllowanceThenZero, "amount")
+	ErrAllowanceType     = newError(KindUnprocessable, "allowance_type_unknown", ct.ErrMsgAllowanceType, "allowanceType")
+	ErrAllowanceBelowMin = newError(KindUnprocessable, "allowance_below_minimum", ct.ErrMsgAllowanceThenMin, "amount")
+
+	ErrDeductionInvalid      = newError(KindInvalid, "deduction_type_invalid", ct.ErrMsgInvalidDeduct, "type")
+	ErrDeductionNotFound     = newError(KindNotFound, "deduction_type_not_found", ct.ErrMsgDeductNotFound, "type")
+	ErrDeductionNotSupported = newError(KindUnprocessable, "deduction_type_not_supported", ct.ErrMsgNotDeductSupport, "type")
+	ErrDeductionBelowMin     = newError(KindUnprocessable, "deduction_below_minimum", ct.ErrMsgValidateMinAmt, "amount")
+	ErrDeductionAboveMax     = newError(KindUnprocessable, "deduction_above_maximum", ct.ErrMsgValidateMaxAmt, "amount")
+
+	ErrTaxRateInvalidID = newError(KindInvalid, "tax_rate_id_invalid", ct.ErrMsgTaxRateInvalidID, "id")
+	ErrTaxRateNotFound  = newError(KindNotFound, "tax_rate_not_found", ct.ErrMsgTaxRateNotFound, "id")
+	ErrTaxRateLevel     = newError(KindUnprocessable, "tax_rate_level_required", ct.ErrMsgTaxRateLevel, "level")
+	ErrTaxRateInvalid   = newError(KindUnprocessable, "tax_rate_out_of_range", ct.ErrMsgTaxRateInvalid, "taxRate")
+	ErrTaxRateSplit     = newError(KindUnprocessable, "tax_rate_split_mismatch", ct.ErrMsgTaxRateSplit, "maxIncome")
+	ErrTaxRatesFirstMin = newError(KindUnprocessable, "tax_rates_first_min", ct.ErrMsgTaxRatesFirstMin, "minIncome")
+	ErrTaxRatesRange    = newError(KindUnprocessable, "tax_rates_range", ct.ErrMsgTaxRatesRange, "maxIncome")
+	ErrTaxRatesOverlap  = newError(KindUnprocessable, "tax_rates_overlap", ct.ErrMsgTaxRatesOverlap, "minIncome")
+	ErrTaxRatesGap      = newError(KindUnprocessable, "tax_rates_gap", ct.ErrMsgTaxRatesGap, "minIncome")
+	ErrTaxRatesOrder    = newError(KindUnprocessable, "tax_rates_order", ct.ErrMsgTaxRatesOrder, "taxRate")
+	ErrTaxRatesOpen     = newError(KindUnprocessable, "tax_rates_not_open_ended", ct.ErrMsgTaxRatesOpenEnded, "maxIncome")
+	ErrTaxRatesChanged  = newError(KindConflict, "tax_rates_changed", ct.ErrMsgTaxRatesChanged, "taxYear")
+
+	ErrAllowanceExists   = newError(KindConflict, "allowance_exists", ct.ErrMsgAllowanceExists, "allowanceType")
+	ErrAllowanceName     = newError(KindUnprocessable, "allowance_type_invalid", ct.ErrMsgAllowanceName, "allowanceType")
+	ErrAllowanceRespName = newError(KindUnprocessable, "allowance_response_name_invalid", ct.ErrMsgAllowanceRespName, "responseName")
+	ErrAllowanceLimits   = newError(KindUnprocessable, "allowance_limits_invalid", ct.ErrMsgAllowanceLimits, "limitAmount")
+	ErrAllowanceCapRule  = newError(KindUnprocessable, "allowance_cap_rule_invalid", ct.ErrMsgAllowanceCapRule, "capRule")
+	ErrAllowanceCapPct   = newError(KindUnprocessable, "allowance_cap_percent_invalid", ct.ErrMsgAllowanceCapPct, "capPercent")
+
+	ErrTaxJobNotFound    = newError(KindNotFound, "tax_job_not_found", ct.ErrMsgTaxJobNotFound, "id")
+	ErrTaxJobNotFinished = newError(KindConflict, "tax_job_not_finished", ct.ErrMsgTaxJobNotFinished, "id")
+	ErrTaxJobFailed      = newError(KindConflict, "tax_job_failed", ct.ErrMsgTaxJobFailed, "id")
+
+	ErrCalculationInvalidID = newError(KindInvalid, "calculation_id_invalid", ct.ErrMsgCalculationInvalidID, "id")
+	ErrCalculationNotFound  = newError(KindNotFound, "calculation_not_found", ct.ErrMsgCalculationNotFound, "id")
+
+	ErrSnapshotInvalidID = newError(KindInvalid, "config_snapshot_id_invalid", ct.ErrMsgSnapshotInvalidID, "id")
+	ErrSnapshotNotFound  = newError(KindNotFound, "config_snapshot_not_found", ct.ErrMsgSnapshotNotFound, "id")
+	ErrPageLimit         = newError(KindInvalid, "page_limit_invalid", ct.ErrMsgPageLimit, "limit")
+	ErrPageOffset        = newError(KindInvalid, "page_offset_invalid", ct.ErrMsgPageOffset, "offset")
+	ErrDateRange         = newError(KindInvalid, "date_range_invalid", ct.ErrMsgDateRange, "to")
+	ErrIncomeRange       = newError(KindInvalid, "income_range_invalid", ct.ErrMsgIncomeRange, "maxIncome")
+
+	ErrAdminUsername     = newError(KindUnprocessable, "admin_username_invalid", ct.ErrMsgAdminUsername, "username")
+	ErrAdminPassword     = newError(KindUnprocessable, "admin_password_invalid", ct.ErrMsgAdminPassword, "password")
+	ErrAdminUserExists   = newError(KindConflict, "admin_user_exists", ct.ErrMsgAdminUserExists, "username")
+	ErrAdminUserNotFound = newError(KindNotFound, "admin_user_not_found", ct.ErrMsgAdminUserNotFound, "username")
+	ErrAdminUserSelf     = newError(KindConflict, "admin_user_self", ct.ErrMsgAdminUserSelf, "username")
+	ErrAdminRole         = newError(KindUnprocessable, "admin_role_unknown", ct.ErrMsgAdminRole, "roles")
+
+	ErrCredentials        = newError(KindUnauthorized, "credentials_invalid", ct.ErrMsgCredentials, "")
+	ErrCredentialsMissing = newError(KindUnauthorized, "credentials_missing", ct.ErrMsgCredentialsMissing, "")
+	ErrScope              = newError(KindForbidden, "scope_missing", ct.ErrMsgScope, "")
+	ErrAPIKeyClient       = newError(KindUnprocessable, "api_key_client_invalid", ct.ErrMsgAPIKeyClient, "client")
+	ErrAPIKeyScopes       = newError(KindUnprocessable, "api_key_scopes_invalid", ct.ErrMsgAPIKeyScopes, "scopes")
+	ErrAPIKeyInvalidID    = newError(KindInvalid, "api_key_id_invalid", ct.ErrMsgAPIKeyInvalidID, "id")
+	ErrAPIKeyNotFound     = newError(KindNotFound, "api_key_not_found", ct.ErrMsgAPIKeyNotFound, "id")
+
+	ErrRateLimited = newError(KindTooManyRequests, "rate_limited", ct.ErrMsgRateLimited, "")
+)
@@ -0,0 +1,19 @@
+package services
+
+import (
+	"io"
+
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/repository"
+)
+
+// ParseTaxCsv lets the tests read a CSV file the way TaxCalFromCsv does, with
+// the allowance columns of the current tax year in the latest snapshot of
+// repo, and see the requests before they are calculated.
+func ParseTaxCsv(repo repository.TaxRepository, r io.Reader, maxRows int, yield func(models.TaxRequest, *Error) error) error {
+	cfg, err := NewServices(repo).taxConfig(taxYearOrCurrent(0), 0)
+	if err != nil {
+		return err
+	}
+	return parseTaxCsv(r, maxRows, cfg, yield)
+}
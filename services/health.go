@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/repository"
+)
+
+type HealthService interface {
+	Ready(ctx context.Context) models.Health
+}
+
+// healthService tells whether the service can calculate taxes: the database
+// answers and the tax configuration can be loaded from it.
+type healthService struct {
+	db     repository.HealthRepository
+	config repository.TaxRepository
+}
+
+// readyTimeout bounds the checks of a readiness probe, which is given up on
+// after a few seconds anyway.
+const readyTimeout = 2 * time.Second
+
+func NewHealthService(db repository.HealthRepository, config repository.TaxRepository) *healthService {
+	return &healthService{db: db, config: config}
+}
+
+// Ready runs every check and is ready only when all of them pass. A check
+// that fails reports ct.HealthUnavailable rather than its error, as probes
+// are not authenticated.
+func (hs *healthService) Ready(ctx context.Context) models.Health {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	res := models.Health{Status: ct.HealthOK, Checks: map[string]string{}}
+	check := func(name string, ok bool) {
+		res.Checks[name] = ct.HealthOK
+		if !ok {
+			res.Checks[name] = ct.HealthUnavailable
+			res.Status = ct.HealthUnavailable
+		}
+	}
+
+	check(ct.CheckDatabase, hs.db.Ping(ctx) == nil)
+	// the latest snapshot is cached, so this only reaches the database on the
+	// first probe and after a config change
+	s, err := hs.config.GetConfigSnapshot(0)
+	check(ct.CheckConfig, err == nil && s != nil && len(s.TaxRates) > 0)
+	return res
+}
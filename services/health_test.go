@@ -0,0 +1,58 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockHealthRepository struct {
+	err error
+}
+
+func (m *MockHealthRepository) Ping(ctx context.Context) error {
+	return m.err
+}
+
+func TestReady(t *testing.T) {
+	rates := []*repository.IncomeTaxRates{{ID: 1, TaxYear: 2024}}
+	down := errors.New("connection refused")
+
+	cases := []struct {
+		name     string
+		pingErr  error
+		config   *MockTaxRepository
+		expected md.Health
+	}{
+		{
+			name:     "given database up with config should be ready",
+			config:   &MockTaxRepository{taxRates: rates},
+			expected: md.Health{Status: ct.HealthOK, Checks: map[string]string{ct.CheckDatabase: ct.HealthOK, ct.CheckConfig: ct.HealthOK}},
+		},
+		{
+			name:     "given database down should not be ready",
+			pingErr:  down,
+			config:   &MockTaxRepository{taxErr: down},
+			expected: md.Health{Status: ct.HealthUnavailable, Checks: map[string]string{ct.CheckDatabase: ct.HealthUnavailable, ct.CheckConfig: ct.HealthUnavailable}},
+		},
+		{
+			name:     "given no tax rates should not be ready",
+			config:   &MockTaxRepository{},
+			expected: md.Health{Status: ct.HealthUnavailable, Checks: map[string]string{ct.CheckDatabase: ct.HealthOK, ct.CheckConfig: ct.HealthUnavailable}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := services.NewHealthService(&MockHealthRepository{err: tc.pingErr}, tc.config).Ready(context.Background())
+
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+}
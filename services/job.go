@@ -0,0 +1,338 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"regexp"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"golang.org/x/text/language"
+)
+
+const (
+	// jobLease is how long a claimed job stays with its worker without
+	// progress before another replica may take it over.
+	jobLease = time.Minute
+	// jobPollInterval is how often an idle worker looks for queued jobs.
+	jobPollInterval = time.Second
+	// jobBatchSize is the number of rows stored at a time.
+	jobBatchSize = 500
+)
+
+var jobIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+type JobService interface {
+	SubmitTaxJob(file io.Reader, strict bool, lang language.Tag) (models.TaxJob, error)
+	GetTaxJob(id string) (models.TaxJob, error)
+	TaxJobResults(id string, yield func(models.Taxes, *Error) error) error
+}
+
+// jobService runs CSV uploads in the background. Jobs are kept in Postgres,
+// so every replica can pick up a queued job and a job outlives the replica
+// it was submitted to.
+type jobService struct {
+	repo    repository.JobRepository
+	taxes   TaxService
+	workers int
+	maxRows int
+
+	wake   chan struct{}
+	stop   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewJobService returns a job service that runs jobs on workers goroutines
+// once started. A job may have at most maxRows rows; zero means no limit.
+func NewJobService(r repository.JobRepository, taxes TaxService, workers, maxRows int) *jobService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobService{
+		repo:    r,
+		taxes:   taxes,
+		workers: workers,
+		maxRows: maxRows,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+func (js *jobService) SubmitTaxJob(file io.Reader, strict bool, lang language.Tag) (models.TaxJob, error) {
+	job, err := js.repo.CreateTaxJob(repository.TaxJob{Strict: strict, Lang: langTag(lang)}, file)
+	if err != nil {
+		return models.TaxJob{}, ErrInternal
+	}
+
+	select {
+	case js.wake <- struct{}{}:
+	default:
+	}
+	return toTaxJob(*job), nil
+}
+
+func (js *jobService) GetTaxJob(id string) (models.TaxJob, error) {
+	job, err := js.getTaxJob(id)
+	if err != nil {
+		return models.TaxJob{}, err
+	}
+	return toTaxJob(*job), nil
+}
+
+// TaxJobResults calls yield with the result of each row of a finished job in
+// file order, with everything the synchronous upload yields for it, so the
+// CSV and XLSX exports of a job are the same as those of the upload. A job
+// that failed in strict mode only has its row errors.
+func (js *jobService) TaxJobResults(id string, yield func(models.Taxes, *Error) error) error {
+	job, err := js.getTaxJob(id)
+	if err != nil {
+		return err
+	}
+	switch job.Status {
+	case ct.JobQueued, ct.JobRunning:
+		return ErrTaxJobNotFinished
+	case ct.JobFailed:
+		var jobErr Error
+		if json.Unmarshal(job.Error, &jobErr) != nil || !jobErr.Is(ErrCsvRowErrors) {
+			return ErrTaxJobFailed
+		}
+	}
+
+	return js.repo.TaxJobRows(job.ID, func(r repository.TaxJobRow) error {
+		var input *models.CsvRow
+		if job.InputHeader != nil && r.Input != nil {
+			input = &models.CsvRow{Header: job.InputHeader, Cells: r.Input}
+		}
+		if r.Error != nil {
+			rowErr := &Error{}
+			if err := json.Unmarshal(r.Error, rowErr); err != nil {
+				return ErrInternal
+			}
+			return yield(models.Taxes{ID: r.RowID, Input: input}, rowErr)
+		}
+		if job.Status == ct.JobFailed {
+			return nil
+		}
+		tax := models.Taxes{ID: r.RowID, TotalIncome: r.TotalIncome, Tax: r.Tax, TaxRefund: r.TaxRefund, TaxableIncome: r.TaxableIncome, Input: input}
+		if r.TaxLevels != nil {
+			if err := json.Unmarshal(r.TaxLevels, &tax.TaxLevels); err != nil {
+				return ErrInternal
+			}
+		}
+		return yield(tax, nil)
+	})
+}
+
+func (js *jobService) getTaxJob(id string) (*repository.TaxJob, error) {
+	if !jobIDPattern.MatchString(id) {
+		return nil, ErrTaxJobNotFound
+	}
+	job, err := js.repo.GetTaxJob(id)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	if job == nil {
+		return nil, ErrTaxJobNotFound
+	}
+	return job, nil
+}
+
+// Start starts the workers.
+func (js *jobService) Start() {
+	for i := 0; i < js.workers; i++ {
+		js.wg.Add(1)
+		go js.work()
+	}
+}
+
+// Shutdown stops the workers from taking new jobs and waits for the running
+// ones to finish. Jobs still running when ctx is done are stopped and queued
+// again for another replica.
+func (js *jobService) Shutdown(ctx context.Context) error {
+	close(js.stop)
+	done := make(chan struct{})
+	go func() {
+		js.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		js.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (js *jobService) work() {
+	defer js.wg.Done()
+	for {
+		select {
+		case <-js.stop:
+			return
+		default:
+		}
+
+		job, err := js.repo.ClaimTaxJob(jobLease)
+		if err != nil {
+			log.Printf("claim tax job: %v", err)
+		}
+		if job != nil {
+			js.run(*job)
+			continue
+		}
+
+		select {
+		case <-js.stop:
+			return
+		case <-js.wake:
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// run calculates every row of job, storing the results in batches.
+func (js *jobService) run(job repository.TaxJob) {
+	lang := language.Make(job.Lang)
+	file := &countingReader{r: js.repo.TaxJobFile(job.ID)}
+	var batch []repository.TaxJobRow
+
+	// a panic would take the replica down and leave the job running, to be
+	// claimed again and crash the next one, so the job fails instead
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("tax job %s: panic: %v\n%s", job.ID, r, debug.Stack())
+			job.Status = ct.JobFailed
+			job.Error, _ = json.Marshal(ErrInternal.Localize(lang))
+			if err := js.repo.FinishTaxJob(job); err != nil {
+				log.Printf("finish tax job %s: %v", job.ID, err)
+			}
+		}
+	}()
+
+	flush := func() error {
+		job.ReadBytes = file.n
+		if err := js.repo.SaveTaxJobRows(job, batch, jobLease); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	err := js.taxes.TaxCalFromCsv(file, js.maxRows, 0, func(tax models.Taxes, rowErr *Error) error {
+		if err := js.ctx.Err(); err != nil {
+			return err
+		}
+		job.ProcessedRows++
+		row := repository.TaxJobRow{Seq: job.ProcessedRows, RowID: tax.ID, TotalIncome: tax.TotalIncome, Tax: tax.Tax, TaxRefund: tax.TaxRefund, TaxableIncome: tax.TaxableIncome}
+		if tax.Input != nil {
+			if job.InputHeader == nil {
+				job.InputHeader = tax.Input.Header
+			}
+			row.Input = tax.Input.Cells
+		}
+		if tax.TaxLevels != nil {
+			row.TaxLevels, _ = json.Marshal(tax.TaxLevels)
+		}
+		if rowErr != nil {
+			job.ErrorRows++
+			row.Error, _ = json.Marshal(rowErr.Localize(lang))
+		}
+		batch = append(batch, row)
+		if len(batch) >= jobBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+
+	// another replica took the job over after the lease ran out; the job and
+	// its results are now that run's
+	if errors.Is(err, repository.ErrTaxJobClaimLost) {
+		log.Printf("tax job %s: %v", job.ID, err)
+		return
+	}
+	if js.ctx.Err() != nil {
+		if err := js.repo.ReleaseTaxJob(job); err != nil {
+			log.Printf("release tax job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	job.Status = ct.JobDone
+	var jobErr *Error
+	switch {
+	case errors.As(err, &jobErr):
+	case err != nil:
+		log.Printf("tax job %s: %v", job.ID, err)
+		jobErr = ErrInternal
+	case job.Strict && job.ErrorRows > 0:
+		jobErr = ErrCsvRowErrors.WithArgs(job.ErrorRows)
+	}
+	if jobErr != nil {
+		job.Status = ct.JobFailed
+		job.Error, _ = json.Marshal(jobErr.Localize(lang))
+	}
+
+	if err := js.repo.FinishTaxJob(job); err != nil {
+		log.Printf("finish tax job %s: %v", job.ID, err)
+	}
+}
+
+func toTaxJob(j repository.TaxJob) models.TaxJob {
+	mode := ct.CsvModeLenient
+	if j.Strict {
+		mode = ct.CsvModeStrict
+	}
+	progress := 0
+	switch {
+	case j.Status == ct.JobDone || j.Status == ct.JobFailed:
+		progress = 100
+	case j.FileSize > 0:
+		progress = int(j.ReadBytes * 100 / j.FileSize)
+	}
+	return models.TaxJob{
+		ID:            j.ID,
+		Status:        j.Status,
+		Mode:          mode,
+		Progress:      progress,
+		ProcessedRows: j.ProcessedRows,
+		ErrorRows:     j.ErrorRows,
+		Error:         j.Error,
+		CreatedAt:     j.CreatedAt,
+		StartedAt:     j.StartedAt,
+		FinishedAt:    j.FinishedAt,
+	}
+}
+
+func langTag(lang language.Tag) string {
+	if lang == language.Und {
+		return ""
+	}
+	return lang.String()
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
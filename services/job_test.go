@@ -0,0 +1,309 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+const jobID = "6f1c2a8e-3b4d-4e5f-8a9b-0c1d2e3f4a5b"
+
+// MockJobRepository keeps a single job in memory.
+type MockJobRepository struct {
+	mu       sync.Mutex
+	job      *repository.TaxJob
+	file     []byte
+	rows     []repository.TaxJobRow
+	fileRead io.Reader
+	released bool
+	claims   int
+}
+
+func (m *MockJobRepository) CreateTaxJob(job repository.TaxJob, file io.Reader) (*repository.TaxJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.file, _ = io.ReadAll(file)
+	job.ID = jobID
+	job.Status = ct.JobQueued
+	job.FileSize = int64(len(m.file))
+	m.job = &job
+	return &job, nil
+}
+
+func (m *MockJobRepository) GetTaxJob(id string) (*repository.TaxJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.job == nil || m.job.ID != id {
+		return nil, nil
+	}
+	job := *m.job
+	return &job, nil
+}
+
+func (m *MockJobRepository) ClaimTaxJob(lease time.Duration) (*repository.TaxJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.job == nil || m.job.Status != ct.JobQueued {
+		return nil, nil
+	}
+	m.job.Status = ct.JobRunning
+	m.claims++
+	m.job.Claim = fmt.Sprintf("claim-%d", m.claims)
+	m.rows = nil
+	job := *m.job
+	return &job, nil
+}
+
+func (m *MockJobRepository) TaxJobFile(id string) io.Reader {
+	if m.fileRead != nil {
+		return m.fileRead
+	}
+	return bytes.NewReader(m.file)
+}
+
+// claimLost tells whether job was claimed again since it was claimed.
+func (m *MockJobRepository) claimLost(job repository.TaxJob) bool {
+	return m.job.Status != ct.JobRunning || m.job.Claim != job.Claim
+}
+
+func (m *MockJobRepository) SaveTaxJobRows(job repository.TaxJob, rows []repository.TaxJobRow, lease time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.claimLost(job) {
+		return repository.ErrTaxJobClaimLost
+	}
+	m.rows = append(m.rows, rows...)
+	m.job.ReadBytes = job.ReadBytes
+	m.job.ProcessedRows = job.ProcessedRows
+	m.job.InputHeader = job.InputHeader
+	return nil
+}
+
+func (m *MockJobRepository) FinishTaxJob(job repository.TaxJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.claimLost(job) {
+		return repository.ErrTaxJobClaimLost
+	}
+	m.job = &job
+	return nil
+}
+
+func (m *MockJobRepository) ReleaseTaxJob(job repository.TaxJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.claimLost(job) {
+		return repository.ErrTaxJobClaimLost
+	}
+	m.job.Status = ct.JobQueued
+	m.released = true
+	return nil
+}
+
+func (m *MockJobRepository) TaxJobRows(id string, yield func(repository.TaxJobRow) error) error {
+	for _, r := range m.rows {
+		if err := yield(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runJob submits csv and runs it to the end on a single worker.
+func runJob(t *testing.T, csv string, strict bool) (*MockJobRepository, services.JobService) {
+	repo := &MockJobRepository{}
+	js := services.NewJobService(repo, services.NewServices(_mockRepo), 1, 0)
+
+	_, err := js.SubmitTaxJob(strings.NewReader(csv), strict, language.Thai)
+	assert.Nil(t, err)
+
+	js.Start()
+	assert.Eventually(t, func() bool {
+		job, _ := js.GetTaxJob(jobID)
+		return job.Status == ct.JobDone || job.Status == ct.JobFailed
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Nil(t, js.Shutdown(context.Background()))
+	return repo, js
+}
+
+func jobResults(js services.JobService) ([]md.Taxes, []*services.Error, error) {
+	var taxes []md.Taxes
+	var rowErrs []*services.Error
+	err := js.TaxJobResults(jobID, func(tax md.Taxes, rowErr *services.Error) error {
+		if rowErr != nil {
+			rowErrs = append(rowErrs, rowErr)
+			return nil
+		}
+		taxes = append(taxes, tax)
+		return nil
+	})
+	return taxes, rowErrs, err
+}
+
+func TestTaxJob_Lenient(t *testing.T) {
+	_, js := runJob(t, "id,totalIncome,wht\nE-01,500000,0\nE-02,500000,600000\n", false)
+
+	job, err := js.GetTaxJob(jobID)
+	assert.Nil(t, err)
+	assert.Equal(t, ct.JobDone, job.Status)
+	assert.Equal(t, ct.CsvModeLenient, job.Mode)
+	assert.Equal(t, 100, job.Progress)
+	assert.Equal(t, 2, job.ProcessedRows)
+	assert.Equal(t, 1, job.ErrorRows)
+
+	taxes, rowErrs, err := jobResults(js)
+	assert.Nil(t, err)
+	uploaded, _, _ := calFromCsv(_mockRepo, "id,totalIncome,wht\nE-01,500000,0\nE-02,500000,600000\n")
+	assert.Equal(t, uploaded, taxes, "A job should keep all the upload yields, for the CSV and XLSX exports")
+	if assert.Len(t, taxes, 1) {
+		assert.Equal(t, money.Baht(29000), taxes[0].Tax)
+	}
+	if assert.Len(t, rowErrs, 1) {
+		assert.ErrorIs(t, rowErrs[0], services.ErrWHTInvalid)
+		assert.Equal(t, 3, rowErrs[0].Line)
+		assert.Equal(t, "ภาษีหัก ณ ที่จ่ายไม่ถูกต้อง ต้องอยู่ระหว่าง 0 ถึงรายได้ทั้งหมด", rowErrs[0].Message, "Row errors should be in the language of the upload")
+	}
+}
+
+func TestTaxJob_StrictWithRowErrors(t *testing.T) {
+	_, js := runJob(t, "id,totalIncome,wht\nE-01,500000,0\nE-02,500000,600000\n", true)
+
+	job, _ := js.GetTaxJob(jobID)
+	assert.Equal(t, ct.JobFailed, job.Status)
+	assert.Contains(t, string(job.Error), `"code":"csv_row_errors"`)
+
+	taxes, rowErrs, err := jobResults(js)
+	assert.Nil(t, err)
+	assert.Nil(t, taxes, "A failed strict job should only return its row errors")
+	assert.Len(t, rowErrs, 1)
+}
+
+func TestTaxJob_FileError(t *testing.T) {
+	_, js := runJob(t, "wht\n0\n", false)
+
+	job, _ := js.GetTaxJob(jobID)
+	assert.Equal(t, ct.JobFailed, job.Status)
+	assert.Contains(t, string(job.Error), `"code":"csv_missing_column"`)
+
+	_, _, err := jobResults(js)
+	assert.ErrorIs(t, err, services.ErrTaxJobFailed)
+}
+
+func TestTaxJob_Lookup(t *testing.T) {
+	repo := &MockJobRepository{}
+	js := services.NewJobService(repo, services.NewServices(_mockRepo), 0, 0)
+
+	_, err := js.GetTaxJob("not-a-uuid")
+	assert.ErrorIs(t, err, services.ErrTaxJobNotFound)
+	_, err = js.GetTaxJob(jobID)
+	assert.ErrorIs(t, err, services.ErrTaxJobNotFound)
+
+	job, err := js.SubmitTaxJob(strings.NewReader("totalIncome\n500000\n"), true, language.Und)
+	assert.Nil(t, err)
+	assert.Equal(t, ct.JobQueued, job.Status)
+	assert.Equal(t, ct.CsvModeStrict, job.Mode)
+	assert.Equal(t, "", repo.job.Lang)
+
+	_, _, err = jobResults(js)
+	assert.ErrorIs(t, err, services.ErrTaxJobNotFinished)
+}
+
+// blockingReader holds up a job until release is closed.
+type blockingReader struct {
+	started chan struct{}
+	release chan struct{}
+	r       io.Reader
+}
+
+func (b *blockingReader) Read(p []byte) (int, error) {
+	select {
+	case <-b.started:
+	default:
+		close(b.started)
+	}
+	<-b.release
+	return b.r.Read(p)
+}
+
+func TestTaxJob_ShutdownRequeuesRunningJob(t *testing.T) {
+	reader := &blockingReader{started: make(chan struct{}), release: make(chan struct{}), r: strings.NewReader("totalIncome\n500000\n")}
+	repo := &MockJobRepository{fileRead: reader}
+	js := services.NewJobService(repo, services.NewServices(_mockRepo), 1, 0)
+	js.SubmitTaxJob(strings.NewReader(""), false, language.Und)
+	js.Start()
+	<-reader.started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	shutdown := make(chan error)
+	go func() { shutdown <- js.Shutdown(ctx) }()
+	time.Sleep(20 * time.Millisecond)
+	close(reader.release)
+
+	assert.ErrorIs(t, <-shutdown, context.Canceled)
+	assert.True(t, repo.released, "A job cut short should be queued again")
+	assert.Equal(t, ct.JobQueued, repo.job.Status)
+}
+
+func TestTaxJob_StaleWorkerStopsWhenTakenOver(t *testing.T) {
+	reader := &blockingReader{started: make(chan struct{}), release: make(chan struct{}), r: strings.NewReader("totalIncome\n500000\n")}
+	repo := &MockJobRepository{fileRead: reader}
+	js := services.NewJobService(repo, services.NewServices(_mockRepo), 1, 0)
+	js.SubmitTaxJob(strings.NewReader(""), false, language.Und)
+	js.Start()
+	<-reader.started
+
+	// the lease ran out and another replica claimed the job
+	repo.mu.Lock()
+	repo.job.Claim = "claim-other"
+	repo.mu.Unlock()
+	close(reader.release)
+	assert.Nil(t, js.Shutdown(context.Background()))
+
+	assert.Equal(t, ct.JobRunning, repo.job.Status, "The stale worker should leave the job to its new run")
+	assert.Empty(t, repo.rows, "The stale worker should store no results")
+	assert.False(t, repo.released)
+}
+
+// panicReader panics on the first read, as a bug in the calculation would.
+type panicReader struct{}
+
+func (panicReader) Read([]byte) (int, error) {
+	panic("boom")
+}
+
+func TestTaxJob_PanicFailsJob(t *testing.T) {
+	repo := &MockJobRepository{fileRead: panicReader{}}
+	js := services.NewJobService(repo, services.NewServices(_mockRepo), 1, 0)
+	js.SubmitTaxJob(strings.NewReader(""), false, language.Und)
+	js.Start()
+	assert.Eventually(t, func() bool {
+		job, _ := js.GetTaxJob(jobID)
+		return job.Status == ct.JobFailed
+	}, 5*time.Second, 10*time.Millisecond, "A panic should fail the job instead of leaving it running")
+	assert.Nil(t, js.Shutdown(context.Background()))
+
+	job, _ := js.GetTaxJob(jobID)
+	assert.Contains(t, string(job.Error), `"code":"internal"`)
+}
+
+func TestTaxJob_UnterminatedQuote(t *testing.T) {
+	_, js := runJob(t, "totalIncome,wht\n\"500000,0\n", false)
+
+	job, _ := js.GetTaxJob(jobID)
+	assert.Equal(t, ct.JobDone, job.Status)
+	assert.Equal(t, 1, job.ErrorRows)
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/repository"
+)
+
+type RateLimitService interface {
+	Take(class, key string) (*models.RateLimit, error)
+	Peek(class, key string) (*models.RateLimit, error)
+}
+
+// rateLimitService limits each class of requests per caller with a token
+// bucket kept in store, and caps some classes with a quota: a number of
+// requests per fixed window, e.g. a day, counted in store as well.
+type rateLimitService struct {
+	store     repository.RateLimitStore
+	limits    map[string]repository.RateLimit
+	quotas    map[string]repository.RateLimit
+	window    time.Duration
+	lastPrune atomic.Int64
+}
+
+// rateLimitPruneEvery is how often buckets left alone are dropped.
+const rateLimitPruneEvery = time.Minute
+
+// NewRateLimitService limits the classes in limits and caps those in quotas.
+// A quota window starts on a multiple of its length since the Unix epoch, so
+// a 24h quota starts over at midnight UTC. A class in neither is not limited.
+func NewRateLimitService(store repository.RateLimitStore, limits, quotas map[string]repository.RateLimit) *rateLimitService {
+	rs := &rateLimitService{store: store, limits: limits, quotas: quotas}
+	for _, l := range limits {
+		rs.window = max(rs.window, l.Window)
+	}
+	for _, q := range quotas {
+		rs.window = max(rs.window, q.Window)
+	}
+	rs.lastPrune.Store(time.Now().UnixNano())
+	return rs
+}
+
+// Take takes a request of class from the bucket of key and, when the bucket
+// lets it through, counts it against the quota of key. It returns nil when
+// class is neither limited nor capped.
+func (rs *rateLimitService) Take(class, key string) (*models.RateLimit, error) {
+	l, limited := rs.limits[class]
+	q, capped := rs.quotas[class]
+	if !limited && !capped {
+		return nil, nil
+	}
+	now := time.Now()
+	rs.prune(now)
+
+	rl := &models.RateLimit{Allowed: true}
+	if limited {
+		st, err := rs.store.TakeToken(class+":"+key, l, now)
+		if err != nil {
+			return nil, ErrInternal
+		}
+		rl = rateLimit(l, st)
+		if !rl.Allowed {
+			return rl, nil
+		}
+	}
+	if capped {
+		start := now.Truncate(q.Window)
+		n, err := rs.store.CountRequest(class+":"+key, start)
+		if err != nil {
+			return nil, ErrInternal
+		}
+		rl.Quota = &models.RateLimit{
+			Allowed:   n <= q.Requests,
+			Limit:     q.Requests,
+			Window:    q.Window,
+			Remaining: max(0, q.Requests-n),
+			Reset:     start.Add(q.Window).Sub(now),
+		}
+		if !rl.Quota.Allowed {
+			rl.Quota.RetryAfter = rl.Quota.Reset
+			rl.Allowed, rl.RetryAfter = false, rl.Quota.RetryAfter
+		}
+	}
+	return rl, nil
+}
+
+// Peek returns what key has left of the limit of class without using any of
+// it. It returns nil when class is not limited.
+func (rs *rateLimitService) Peek(class, key string) (*models.RateLimit, error) {
+	l, ok := rs.limits[class]
+	if !ok {
+		return nil, nil
+	}
+	st, err := rs.store.PeekToken(class+":"+key, l, time.Now())
+	if err != nil {
+		return nil, ErrInternal
+	}
+	return rateLimit(l, st), nil
+}
+
+func rateLimit(l repository.RateLimit, st repository.RateLimitState) *models.RateLimit {
+	return &models.RateLimit{
+		Allowed:    st.Allowed,
+		Limit:      l.Requests,
+		Window:     l.Window,
+		Remaining:  st.Remaining,
+		Reset:      st.Reset,
+		RetryAfter: st.RetryAfter,
+	}
+}
+
+// prune drops the buckets no one has used for the longest window and the
+// quota counters of windows long over, at most once every
+// rateLimitPruneEvery and without holding up the request.
+func (rs *rateLimitService) prune(now time.Time) {
+	last := rs.lastPrune.Load()
+	if now.UnixNano()-last < int64(rateLimitPruneEvery) || !rs.lastPrune.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	go func() {
+		if err := rs.store.PruneRateLimits(now.Add(-rs.window)); err != nil {
+			log.Printf("cannot prune rate limits: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,127 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockRateLimitStore struct {
+	state repository.RateLimitState
+	err   error
+	key   string
+	limit repository.RateLimit
+	count int
+	start time.Time
+}
+
+func (m *MockRateLimitStore) TakeToken(key string, l repository.RateLimit, now time.Time) (repository.RateLimitState, error) {
+	m.key, m.limit = key, l
+	return m.state, m.err
+}
+
+func (m *MockRateLimitStore) PeekToken(key string, l repository.RateLimit, now time.Time) (repository.RateLimitState, error) {
+	m.key, m.limit = key, l
+	return m.state, m.err
+}
+
+func (m *MockRateLimitStore) CountRequest(key string, start time.Time) (int, error) {
+	m.key, m.start = key, start
+	return m.count, m.err
+}
+
+func (m *MockRateLimitStore) PruneRateLimits(before time.Time) error {
+	return nil
+}
+
+func TestRateLimitTake(t *testing.T) {
+	limits := map[string]repository.RateLimit{ct.RateLimitBulk: {Requests: 10, Window: time.Minute}}
+
+	t.Run("given limited class should take from the caller's bucket", func(t *testing.T) {
+		store := &MockRateLimitStore{state: repository.RateLimitState{Allowed: false, Reset: time.Minute, RetryAfter: 6 * time.Second}}
+
+		rl, err := services.NewRateLimitService(store, limits, nil).Take(ct.RateLimitBulk, "client:payroll")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "bulk:client:payroll", store.key, "Each class should have its own bucket")
+		assert.Equal(t, limits[ct.RateLimitBulk], store.limit)
+		assert.False(t, rl.Allowed)
+		assert.Equal(t, 10, rl.Limit)
+		assert.Equal(t, time.Minute, rl.Window)
+		assert.Equal(t, 6*time.Second, rl.RetryAfter)
+	})
+
+	t.Run("given class without a limit should not limit", func(t *testing.T) {
+		store := &MockRateLimitStore{}
+
+		rl, err := services.NewRateLimitService(store, limits, nil).Take(ct.RateLimitAdmin, "user:adminTax")
+
+		assert.Nil(t, err)
+		assert.Nil(t, rl)
+		assert.Empty(t, store.key)
+	})
+
+	t.Run("given store error should fail", func(t *testing.T) {
+		_, err := services.NewRateLimitService(&MockRateLimitStore{err: errors.New("db down")}, limits, nil).Take(ct.RateLimitBulk, "ip:10.0.0.1")
+
+		assert.ErrorIs(t, err, services.ErrInternal)
+	})
+}
+
+func TestRateLimitTake_Quota(t *testing.T) {
+	limits := map[string]repository.RateLimit{ct.RateLimitBulk: {Requests: 10, Window: time.Minute}}
+	quotas := map[string]repository.RateLimit{ct.RateLimitBulk: {Requests: 100, Window: 24 * time.Hour}}
+
+	t.Run("given quota left should count the request", func(t *testing.T) {
+		store := &MockRateLimitStore{state: repository.RateLimitState{Allowed: true, Remaining: 9}, count: 40}
+
+		rl, err := services.NewRateLimitService(store, limits, quotas).Take(ct.RateLimitBulk, "client:payroll")
+
+		assert.Nil(t, err)
+		assert.True(t, rl.Allowed)
+		assert.Equal(t, "bulk:client:payroll", store.key)
+		assert.True(t, store.start.Equal(store.start.Truncate(24*time.Hour)), "A day should start at midnight UTC")
+		assert.Equal(t, 100, rl.Quota.Limit)
+		assert.Equal(t, 60, rl.Quota.Remaining)
+	})
+
+	t.Run("given quota used up should refuse until the window is over", func(t *testing.T) {
+		store := &MockRateLimitStore{state: repository.RateLimitState{Allowed: true, Remaining: 9}, count: 101}
+
+		rl, err := services.NewRateLimitService(store, limits, quotas).Take(ct.RateLimitBulk, "client:payroll")
+
+		assert.Nil(t, err)
+		assert.False(t, rl.Allowed)
+		assert.Equal(t, 0, rl.Quota.Remaining)
+		assert.Equal(t, rl.Quota.Reset, rl.RetryAfter)
+		assert.Positive(t, rl.RetryAfter)
+	})
+
+	t.Run("given bucket empty should not count against the quota", func(t *testing.T) {
+		store := &MockRateLimitStore{state: repository.RateLimitState{Allowed: false, RetryAfter: time.Second}}
+
+		rl, err := services.NewRateLimitService(store, limits, quotas).Take(ct.RateLimitBulk, "client:payroll")
+
+		assert.Nil(t, err)
+		assert.False(t, rl.Allowed)
+		assert.Nil(t, rl.Quota)
+		assert.True(t, store.start.IsZero())
+	})
+}
+
+func TestRateLimitPeek(t *testing.T) {
+	limits := map[string]repository.RateLimit{ct.RateLimitAuthFailures: {Requests: 20, Window: 15 * time.Minute}}
+	store := &MockRateLimitStore{state: repository.RateLimitState{Allowed: false, RetryAfter: time.Minute}}
+
+	rl, err := services.NewRateLimitService(store, limits, nil).Peek(ct.RateLimitAuthFailures, "ip:10.0.0.1")
+
+	assert.Nil(t, err)
+	assert.False(t, rl.Allowed)
+	assert.Equal(t, "auth_failures:ip:10.0.0.1", store.key)
+	assert.Equal(t, time.Minute, rl.RetryAfter)
+}
@@ -2,17 +2,21 @@ package services
 
 import (
 	"errors"
-	"math"
+	"io"
 	"strings"
+	"time"
 
 	cm "github.com/kanawat2566/assessment-tax/common"
 	ct "github.com/kanawat2566/assessment-tax/constants"
 	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
 	"github.com/kanawat2566/assessment-tax/repository"
+	"golang.org/x/text/language"
 )
 
 type taxService struct {
-	repo repository.TaxRepository
+	repo    repository.TaxRepository
+	history repository.CalculationRepository
 }
 
 func NewServices(r repository.TaxRepository) *taxService {
@@ -21,132 +25,260 @@ func NewServices(r repository.TaxRepository) *taxService {
 
 type TaxService interface {
 	TaxCalculations(taxRequest models.TaxRequest) (models.TaxResponse, error)
-	SetAdminDeductions(req ct.Deduction) (ct.Deduction, error)
-	TaxCalFromCsv(taxRequest []models.TaxRequest) ([]models.Taxes, error)
+	SetAdminDeductions(req ct.Deduction, by ct.Actor) (ct.Deduction, error)
+	TaxCalFromCsv(r io.Reader, maxRows int, snapshotID int64, yield func(models.Taxes, *Error) error) error
+	ListTaxRates(taxYear int) (models.TaxRatesResponse, error)
+	CreateTaxRate(rate models.TaxRate, by ct.Actor) (models.TaxRatesResponse, error)
+	UpdateTaxRate(rate models.TaxRate, by ct.Actor) (models.TaxRatesResponse, error)
+	DeleteTaxRate(id int, by ct.Actor) (models.TaxRatesResponse, error)
+	ListAllowances(taxYear int) (models.AllowancesResponse, error)
+	CreateAllowance(allowance models.AllowanceConfig, by ct.Actor) (models.AllowanceConfig, error)
+	GetConfigSnapshot(id int64) (models.ConfigSnapshot, error)
 }
 
+// TaxCalculations calculates the tax of taxRequest and, when a history is
+// set, records the calculation and returns it with its CalculationID.
 func (ts *taxService) TaxCalculations(taxRequest models.TaxRequest) (models.TaxResponse, error) {
+	taxResp, cfg, err := ts.calculate(taxRequest)
+	if err != nil || ts.history == nil {
+		return taxResp, err
+	}
+	return ts.saveCalculation(taxRequest, taxResp, cfg)
+}
+
+// calculate returns the tax of taxRequest and the configuration it used.
+func (ts *taxService) calculate(taxRequest models.TaxRequest) (models.TaxResponse, taxConfig, error) {
 	var taxResp models.TaxResponse
-	var tax float64
+	var tax money.Amount
 
 	if err := validateInputs(taxRequest); err != nil {
-		return taxResp, err
+		return taxResp, taxConfig{}, err
 	}
+	taxYear := taxYearOrCurrent(taxRequest.TaxYear)
 
-	rates, err := ts.repo.GetTaxRates()
+	cfg, err := ts.taxConfig(taxYear, taxRequest.SnapshotID)
 	if err != nil {
-		return taxResp, errors.New(ct.ErrMessageInternal)
+		return taxResp, cfg, err
 	}
+	rates := cfg.rates
 
-	allowances, err := ts.allowanceCal(taxRequest.Allowances)
+	allowances, details, err := allowanceCal(taxRequest.TotalIncome, taxRequest.Allowances, cfg)
 	if err != nil {
-		return taxResp, err
+		return taxResp, cfg, err
 	}
 
-	incomeTotal := taxRequest.TotalIncome - allowances
+	if len(rates) == 0 {
+		return taxResp, cfg, ErrTaxRatesNotFound.WithArgs(taxYear)
+	}
+
+	incomeTotal := money.Max(taxRequest.TotalIncome-allowances, 0)
+	taxResp.TaxableIncome = incomeTotal
 
 	for _, v := range rates {
 
 		var tl models.TaxLevel
 		tl.Level = v.IncomeLevel
+		if taxRequest.Lang != language.Und {
+			tl.Level = cm.LevelLabel(taxRequest.Lang, v.MinIncome, v.MaxIncome)
+		}
 
 		if incomeTotal >= v.MinIncome && v.TaxRate > 0 {
 
-			baseCal := math.Min(v.MaxIncome, incomeTotal) - (v.MinIncome - 1)
-			tl.Tax = baseCal * (v.TaxRate / 100)
+			upper := incomeTotal
+			if v.MaxIncome != nil {
+				upper = money.Min(*v.MaxIncome, incomeTotal)
+			}
+			baseCal := upper - (v.MinIncome - money.Baht(1))
+			tl.Tax = baseCal.Percent(v.TaxRate)
 			tax += tl.Tax
 		}
 		taxResp.TaxLevels = append(taxResp.TaxLevels, tl)
 	}
 
+	taxResp.Allowances = details
+	taxResp.SnapshotID = cfg.snapshotID
+
 	tax -= taxRequest.WHT
 	if tax < 0 {
-		taxResp.TaxRefund = math.Abs(tax)
+		taxResp.TaxRefund = tax.Abs()
 	} else {
 		taxResp.Tax = tax
 	}
 
-	return taxResp, nil
+	return taxResp, cfg, nil
 }
 
-func (ts *taxService) TaxCalFromCsv(taxRequests []models.TaxRequest) ([]models.Taxes, error) {
-	var taxes []models.Taxes
+// TaxCalFromCsv reads a CSV file of tax requests, see parseTaxCsv, and calls
+// yield with the tax of each row as soon as it is calculated. A row the tax
+// cannot be calculated for is passed to yield as a row error, with its CSV
+// line, instead. The allowance columns are read and every row is calculated
+// under the config snapshot with the given id, or when it is zero under the
+// one that was the latest when the file was opened, even if the
+// configuration changes while the file is read. The returned error is set
+// when the rest of the file cannot be calculated, e.g. the database is down.
+func (ts *taxService) TaxCalFromCsv(r io.Reader, maxRows int, snapshotID int64, yield func(models.Taxes, *Error) error) error {
+	cfg, err := ts.taxConfig(taxYearOrCurrent(0), snapshotID)
+	if err != nil {
+		return err
+	}
+	return parseTaxCsv(r, maxRows, cfg, func(v models.TaxRequest, rowErr *Error) error {
+		if rowErr != nil {
+			return yield(models.Taxes{ID: v.ID, Input: v.Input}, rowErr)
+		}
 
-	for _, v := range taxRequests {
-		tax, err := ts.TaxCalculations(v)
+		v.SnapshotID = cfg.snapshotID
+		tax, _, err := ts.calculate(v)
+		if errors.As(err, &rowErr) && rowErr.Kind != KindInternal {
+			return yield(models.Taxes{ID: v.ID, Input: v.Input}, rowErr.AtLine(v.Line))
+		}
 		if err != nil {
-			return nil, err
+			return err
 		}
-		taxes = append(taxes, models.Taxes{
-			Tax:         tax.Tax,
-			TaxRefund:   tax.TaxRefund,
-			TotalIncome: v.TotalIncome,
-		})
-	}
-
-	return taxes, nil
+		return yield(models.Taxes{
+			ID:            v.ID,
+			Tax:           tax.Tax,
+			TaxRefund:     tax.TaxRefund,
+			TotalIncome:   v.TotalIncome,
+			TaxableIncome: tax.TaxableIncome,
+			TaxLevels:     tax.TaxLevels,
+			Input:         v.Input,
+		}, nil)
+	})
 }
 
 func validateInputs(v models.TaxRequest) error {
 	if v.TotalIncome <= 0 {
-		return errors.New(ct.ErrMessageThenZero)
+		return ErrIncomeNotPositive
 	}
 	if v.WHT < 0 {
-		return errors.New(ct.ErrMesssageWhtInvalid)
+		return ErrWHTInvalid
 	}
 
 	//เช็คยอด WHT ต้องน้อยกว่าหรือเท่ากับรายได้
 	if v.WHT > v.TotalIncome {
-		return errors.New(ct.ErrMesssageWhtInvalid)
+		return ErrWHTInvalid
+	}
+	if err := validateTaxYear(v.TaxYear); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateTaxYear accepts zero, which means the current tax year.
+func validateTaxYear(taxYear int) error {
+	if taxYear < 0 || taxYear > time.Now().Year() {
+		return ErrTaxYearInvalid
 	}
 	return nil
 }
-func (ts *taxService) allowanceCal(allowances []models.Allowance) (float64, error) {
-	total := 0.00
-	var chkPersonal bool
+
+func taxYearOrCurrent(taxYear int) int {
+	if taxYear == 0 {
+		return time.Now().Year()
+	}
+	return taxYear
+}
+
+// allowanceCal returns the total allowed deduction and how much of each claim,
+// including the auto-claimed ones, was allowed and why. Claims of the same
+// type are added together before limits apply. Each claim is first held to
+// its type's limits, then to the ceiling left in its allowance group, in
+// claim order. Allowances capped by a percentage of net income are applied
+// last, on the income left after all the others.
+func allowanceCal(income money.Amount, allowances []models.Allowance, cfg taxConfig) (money.Amount, []models.AllowanceDetail, error) {
+	var total money.Amount
 
 	for _, v := range allowances {
-		at, ok := ct.AllowanceTypes[strings.ToLower(v.AllowanceType)]
-		if !ok {
-			return total, errors.New(ct.ErrMsgAllowanceType)
-		}
 		if v.Amount < 0 {
-			return total, errors.New(ct.ErrMsgAllowanceThenZero)
+			return total, nil, ErrAllowanceNegative
 		}
+	}
 
-		amt, err := ts.repo.GetLimitAllowances(at)
-		if err != nil {
-			return total, errors.New(ct.ErrMessageInternal)
+	registry := cfg.allowances
+	groupRoom := make(map[string]money.Amount, len(cfg.groups))
+	for g, limit := range cfg.groups {
+		groupRoom[g] = limit
+	}
+
+	var claims []allowanceClaim
+	claimed := map[string]int{}
+	for _, v := range allowances {
+		amt, ok := registry[strings.ToLower(v.AllowanceType)]
+		if !ok {
+			return total, nil, ErrAllowanceType
 		}
 
 		if v.Amount < amt.MinAmt {
-			return total, errors.New(ct.ErrMsgAllowanceThenMin)
+			return total, nil, ErrAllowanceBelowMin
+		}
+
+		if i, ok := claimed[amt.Allowance_name]; ok {
+			claims[i].amount += v.Amount
+			continue
+		}
+		claimed[amt.Allowance_name] = len(claims)
+		claims = append(claims, allowanceClaim{allowance: amt, amount: v.Amount})
+	}
+
+	// auto-claimed allowances, e.g. personal, default to their limit
+	for _, name := range sortedKeys(registry) {
+		amt := registry[name]
+		if _, ok := claimed[name]; amt.AutoClaim && !ok {
+			claims = append(claims, allowanceClaim{allowance: amt, amount: amt.LimitAmt, auto: true})
 		}
+	}
 
-		total += math.Min(v.Amount, amt.LimitAmt)
+	apply := func(c *allowanceClaim, base money.Amount) {
+		c.deducted, c.limit, c.reason = c.allowed(base)
+		if room, ok := groupRoom[c.allowance.GroupName]; ok {
+			if c.deducted > room {
+				c.trimmed = c.deducted - room
+				c.deducted, c.limit, c.reason = room, room, ct.ReasonGroupLimit
+			}
+			groupRoom[c.allowance.GroupName] = room - c.deducted
+		}
+		total += c.deducted
+	}
 
-		if at == ct.Personal {
-			chkPersonal = true
+	for i := range claims {
+		if claims[i].allowance.CapRule != ct.CapPercentOfNet {
+			apply(&claims[i], income)
+		}
+	}
 
+	net := money.Max(income-total, 0)
+	for i := range claims {
+		if claims[i].allowance.CapRule == ct.CapPercentOfNet {
+			apply(&claims[i], net)
 		}
 	}
 
-	// default personal allowance
-	if !chkPersonal {
-		p, _ := ts.repo.GetLimitAllowances(ct.Personal)
-		total += p.LimitAmt
+	details := make([]models.AllowanceDetail, 0, len(claims))
+	for _, c := range claims {
+		details = append(details, models.AllowanceDetail{
+			AllowanceType: c.allowance.Allowance_name,
+			Claimed:       c.amount,
+			Allowed:       c.deducted,
+			Limit:         c.limit,
+			Reason:        c.reason,
+			GroupTrimmed:  c.trimmed,
+		})
 	}
 
-	return total, nil
+	return total, details, nil
 }
 
-func (ts *taxService) SetAdminDeductions(req ct.Deduction) (ct.Deduction, error) {
+func (ts *taxService) SetAdminDeductions(req ct.Deduction, by ct.Actor) (ct.Deduction, error) {
 
 	if err := validateDeductionType(req.Type); err != nil {
 		return ct.Deduction{}, err
 	}
+	if err := validateTaxYear(req.TaxYear); err != nil {
+		return ct.Deduction{}, err
+	}
+	req.TaxYear = taxYearOrCurrent(req.TaxYear)
 
-	d, err := ts.getDeductionDetails(req.Type)
+	d, err := ts.getDeductionDetails(req.Type, req.TaxYear)
 	if err != nil {
 		return ct.Deduction{}, err
 	}
@@ -155,42 +287,41 @@ func (ts *taxService) SetAdminDeductions(req ct.Deduction) (ct.Deduction, error)
 		return ct.Deduction{}, err
 	}
 
-	if err := ts.repo.UpdateConfigDeduct(req); err != nil {
-		return ct.Deduction{}, errors.New(ct.ErrMessageInternal)
+	req.Type = d.Type
+	if err := ts.repo.UpdateConfigDeduct(req, auditEntry(by, ct.AuditDeductionUpdate, req.Type)); err != nil {
+		return ct.Deduction{}, ErrInternal
 	}
 
-	return ct.Deduction{Type: d.Type, Name: d.Name, Amount: req.Amount}, nil
+	return ct.Deduction{Type: d.Type, Name: d.Name, TaxYear: req.TaxYear, Amount: req.Amount}, nil
 }
 
 func validateDeductionType(dtype string) error {
 	if dtype == "" {
-		return errors.New(ct.ErrMsgInvalidDeduct)
+		return ErrDeductionInvalid
 	}
 	return nil
 }
 
-func (ts *taxService) getDeductionDetails(dtype string) (ct.Deduction, error) {
-	dtypeLower := strings.ToLower(dtype)
-	d, ok := ct.Deductions[dtypeLower]
-	if !ok {
-		return ct.Deduction{}, errors.New(ct.ErrMsgNotDeductSupport)
-	}
-	res, err := ts.repo.GetLimitAllowances(d.Type)
+func (ts *taxService) getDeductionDetails(dtype string, taxYear int) (ct.Deduction, error) {
+	res, err := ts.repo.GetLimitAllowances(strings.ToLower(dtype), taxYear)
 	if err != nil {
-		return ct.Deduction{}, errors.New(ct.ErrMessageInternal)
+		return ct.Deduction{}, ErrInternal
 	}
 	if len(res.Allowance_name) == 0 {
-		return ct.Deduction{}, errors.New(ct.ErrMsgDeductNotFound)
+		return ct.Deduction{}, ErrDeductionNotFound
+	}
+	if !res.Configurable {
+		return ct.Deduction{}, ErrDeductionNotSupported
 	}
-	return ct.Deduction{Type: d.Type, Name: d.Name, MinAmt: res.MinAmt, MaxAmt: res.MaxAmt}, nil
+	return ct.Deduction{Type: res.Allowance_name, Name: res.ResponseName, MinAmt: res.MinAmt, MaxAmt: res.MaxAmt}, nil
 }
 
-func validateDeductionAmount(amount float64, d ct.Deduction) error {
+func validateDeductionAmount(amount money.Amount, d ct.Deduction) error {
 	if amount < d.MinAmt {
-		return errors.New(cm.MsgWithNumber(ct.ErrMsgValidateMinAmt, d.MinAmt))
+		return ErrDeductionBelowMin.WithArgs(d.MinAmt)
 	}
 	if amount > d.MaxAmt {
-		return errors.New(cm.MsgWithNumber(ct.ErrMsgValidateMaxAmt, d.MaxAmt))
+		return ErrDeductionAboveMax.WithArgs(d.MaxAmt)
 	}
 	return nil
 }
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/repository"
+)
+
+// ListTaxRates returns the brackets in force for taxYear. Each bracket keeps
+// the tax year it was stored under, which may be earlier than taxYear.
+func (ts *taxService) ListTaxRates(taxYear int) (models.TaxRatesResponse, error) {
+	if err := validateTaxYear(taxYear); err != nil {
+		return models.TaxRatesResponse{}, err
+	}
+	taxYear = taxYearOrCurrent(taxYear)
+
+	rates, err := ts.repo.GetTaxRates(taxYear)
+	if err != nil {
+		return models.TaxRatesResponse{}, ErrInternal
+	}
+	return toTaxRatesResponse(taxYear, rates), nil
+}
+
+// CreateTaxRate adds a bracket to rate.TaxYear. The bracket the new one starts
+// in is split: it now ends 1 baht before the new bracket, which must end where
+// the split bracket used to.
+func (ts *taxService) CreateTaxRate(rate models.TaxRate, by ct.Actor) (models.TaxRatesResponse, error) {
+	if err := validateTaxYear(rate.TaxYear); err != nil {
+		return models.TaxRatesResponse{}, err
+	}
+	rate.TaxYear = taxYearOrCurrent(rate.TaxYear)
+	if err := validateTaxRate(rate); err != nil {
+		return models.TaxRatesResponse{}, err
+	}
+
+	base, rates, err := ts.taxRatesOfYear(rate.TaxYear)
+	if err != nil {
+		return models.TaxRatesResponse{}, err
+	}
+
+	for _, r := range rates {
+		if r.MinIncome < rate.MinIncome && (r.MaxIncome == nil || *r.MaxIncome >= rate.MinIncome) {
+			if !sameMaxIncome(r.MaxIncome, rate.MaxIncome) {
+				return models.TaxRatesResponse{}, ErrTaxRateSplit
+			}
+			end := rate.MinIncome - money.Baht(1)
+			r.MaxIncome = &end
+		}
+	}
+	rate.ID = 0
+	rates = append(rates, toIncomeTaxRate(rate))
+
+	return ts.saveTaxRates(rate.TaxYear, base, rates, auditEntry(by, ct.AuditTaxRateCreate, strconv.Itoa(rate.TaxYear)))
+}
+
+// UpdateTaxRate changes a bracket in place. Its neighbours are moved so the
+// set stays contiguous: the previous bracket ends 1 baht before the new
+// minimum and the next one starts 1 baht after the new maximum.
+func (ts *taxService) UpdateTaxRate(rate models.TaxRate, by ct.Actor) (models.TaxRatesResponse, error) {
+	if err := validateTaxRate(rate); err != nil {
+		return models.TaxRatesResponse{}, err
+	}
+
+	cur, err := ts.getTaxRate(rate.ID)
+	if err != nil {
+		return models.TaxRatesResponse{}, err
+	}
+	rate.TaxYear = cur.TaxYear
+
+	base, rates, err := ts.taxRatesOfYear(cur.TaxYear)
+	if err != nil {
+		return models.TaxRatesResponse{}, err
+	}
+
+	for i, r := range rates {
+		if r.ID != rate.ID {
+			continue
+		}
+		if i > 0 {
+			end := rate.MinIncome - money.Baht(1)
+			rates[i-1].MaxIncome = &end
+		}
+		if i < len(rates)-1 && rate.MaxIncome != nil {
+			rates[i+1].MinIncome = *rate.MaxIncome + money.Baht(1)
+		}
+		rates[i] = toIncomeTaxRate(rate)
+	}
+
+	return ts.saveTaxRates(cur.TaxYear, base, rates, auditEntry(by, ct.AuditTaxRateUpdate, strconv.Itoa(cur.TaxYear)))
+}
+
+// DeleteTaxRate removes a bracket and merges its range into the previous
+// bracket, or into the next one when it was the first bracket.
+func (ts *taxService) DeleteTaxRate(id int, by ct.Actor) (models.TaxRatesResponse, error) {
+	cur, err := ts.getTaxRate(id)
+	if err != nil {
+		return models.TaxRatesResponse{}, err
+	}
+
+	base, rates, err := ts.taxRatesOfYear(cur.TaxYear)
+	if err != nil {
+		return models.TaxRatesResponse{}, err
+	}
+
+	for i, r := range rates {
+		if r.ID != id {
+			continue
+		}
+		if i > 0 {
+			rates[i-1].MaxIncome = r.MaxIncome
+		} else if i < len(rates)-1 {
+			rates[i+1].MinIncome = r.MinIncome
+		}
+		rates = append(rates[:i], rates[i+1:]...)
+		break
+	}
+
+	return ts.saveTaxRates(cur.TaxYear, base, rates, auditEntry(by, ct.AuditTaxRateDelete, strconv.Itoa(cur.TaxYear)))
+}
+
+func (ts *taxService) getTaxRate(id int) (*repository.IncomeTaxRates, error) {
+	if id <= 0 {
+		return nil, ErrTaxRateInvalidID
+	}
+	cur, err := ts.repo.GetTaxRate(id)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	if cur == nil {
+		return nil, ErrTaxRateNotFound
+	}
+	return cur, nil
+}
+
+// taxRatesOfYear returns the brackets stored for taxYear, which saveTaxRates
+// checks are still the stored ones, and a copy of them to change. A year
+// without its own brackets starts from a copy of the set in force for it, the
+// same way UpdateConfigDeduct copies allowances forward.
+func (ts *taxService) taxRatesOfYear(taxYear int) (base, rates []*repository.IncomeTaxRates, err error) {
+	base, err = ts.repo.ListTaxRates(taxYear)
+	if err != nil {
+		return nil, nil, ErrInternal
+	}
+	for _, r := range base {
+		c := *r
+		rates = append(rates, &c)
+	}
+	if len(base) > 0 {
+		return base, rates, nil
+	}
+
+	inForce, err := ts.repo.GetTaxRates(taxYear)
+	if err != nil {
+		return nil, nil, ErrInternal
+	}
+	for _, r := range inForce {
+		c := *r
+		c.ID = 0
+		c.TaxYear = taxYear
+		rates = append(rates, &c)
+	}
+	return base, rates, nil
+}
+
+// saveTaxRates stores rates, made from base, as the brackets of taxYear once
+// they are checked.
+func (ts *taxService) saveTaxRates(taxYear int, base, rates []*repository.IncomeTaxRates, change repository.AuditEntry) (models.TaxRatesResponse, error) {
+	sort.SliceStable(rates, func(i, j int) bool {
+		return rates[i].MinIncome < rates[j].MinIncome
+	})
+	if err := validateTaxRates(rates); err != nil {
+		return models.TaxRatesResponse{}, err
+	}
+
+	saved, err := ts.repo.SaveTaxRates(taxYear, base, rates, change)
+	if errors.Is(err, repository.ErrTaxRatesChanged) {
+		return models.TaxRatesResponse{}, ErrTaxRatesChanged
+	}
+	if err != nil {
+		return models.TaxRatesResponse{}, ErrInternal
+	}
+	return toTaxRatesResponse(taxYear, saved), nil
+}
+
+func validateTaxRate(rate models.TaxRate) error {
+	if strings.TrimSpace(rate.Level) == "" {
+		return ErrTaxRateLevel
+	}
+	if rate.TaxRate < 0 || rate.TaxRate > money.Percentage(100) {
+		return ErrTaxRateInvalid
+	}
+	if rate.MinIncome < 0 || (rate.MaxIncome != nil && *rate.MaxIncome < rate.MinIncome) {
+		return ErrTaxRatesRange
+	}
+	return nil
+}
+
+// validateTaxRates checks a bracket set sorted by minimum income. An empty set
+// is valid: the year then falls back to the previous year's brackets.
+func validateTaxRates(rates []*repository.IncomeTaxRates) error {
+	for i, r := range rates {
+		if i == 0 && r.MinIncome != 0 {
+			return ErrTaxRatesFirstMin
+		}
+		if r.MaxIncome != nil && *r.MaxIncome < r.MinIncome {
+			return ErrTaxRatesRange
+		}
+		if i == 0 {
+			continue
+		}
+		prev := rates[i-1]
+		if prev.MaxIncome == nil || r.MinIncome <= *prev.MaxIncome {
+			return ErrTaxRatesOverlap
+		}
+		if r.MinIncome != *prev.MaxIncome+money.Baht(1) {
+			return ErrTaxRatesGap
+		}
+		if r.TaxRate < prev.TaxRate {
+			return ErrTaxRatesOrder
+		}
+	}
+	if len(rates) > 0 && rates[len(rates)-1].MaxIncome != nil {
+		return ErrTaxRatesOpen
+	}
+	return nil
+}
+
+func sameMaxIncome(a, b *money.Amount) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func toIncomeTaxRate(rate models.TaxRate) *repository.IncomeTaxRates {
+	return &repository.IncomeTaxRates{
+		ID:          rate.ID,
+		TaxYear:     rate.TaxYear,
+		IncomeLevel: strings.TrimSpace(rate.Level),
+		MinIncome:   rate.MinIncome,
+		MaxIncome:   rate.MaxIncome,
+		TaxRate:     rate.TaxRate,
+	}
+}
+
+func toTaxRatesResponse(taxYear int, rates []*repository.IncomeTaxRates) models.TaxRatesResponse {
+	res := models.TaxRatesResponse{TaxYear: taxYear, TaxRates: []models.TaxRate{}}
+	for _, r := range rates {
+		res.TaxRates = append(res.TaxRates, toTaxRate(r))
+	}
+	return res
+}
+
+func toTaxRate(r *repository.IncomeTaxRates) models.TaxRate {
+	return models.TaxRate{
+		ID:        r.ID,
+		TaxYear:   r.TaxYear,
+		Level:     r.IncomeLevel,
+		MinIncome: r.MinIncome,
+		MaxIncome: r.MaxIncome,
+		TaxRate:   r.TaxRate,
+	}
+}
@@ -0,0 +1,281 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func taxRatesRepo() *MockTaxRepository {
+	return &MockTaxRepository{
+		taxRatesByYear: map[int][]*repository.IncomeTaxRates{
+			2024: {
+				{ID: 1, TaxYear: 2024, IncomeLevel: "0-150,000", MinIncome: money.Baht(0), MaxIncome: upTo(150000), TaxRate: money.Percentage(0)},
+				{ID: 2, TaxYear: 2024, IncomeLevel: "150,001-500,000", MinIncome: money.Baht(150001), MaxIncome: upTo(500000), TaxRate: money.Percentage(10)},
+				{ID: 3, TaxYear: 2024, IncomeLevel: "500,001 ขึ้นไป", MinIncome: money.Baht(500001), MaxIncome: nil, TaxRate: money.Percentage(15)},
+			},
+		},
+	}
+}
+
+type bracket struct {
+	id  int
+	min int64
+	max *money.Amount
+}
+
+func brackets(rates []*repository.IncomeTaxRates) []bracket {
+	var res []bracket
+	for _, r := range rates {
+		res = append(res, bracket{id: r.ID, min: int64(r.MinIncome / money.Baht(1)), max: r.MaxIncome})
+	}
+	return res
+}
+
+func TestCreateTaxRate_SplitsBracket(t *testing.T) {
+	repo := taxRatesRepo()
+	serv := services.NewServices(repo)
+
+	res, err := serv.CreateTaxRate(md.TaxRate{TaxYear: 2024, Level: "1,000,001 ขึ้นไป", MinIncome: money.Baht(1000001), TaxRate: money.Percentage(20)}, _admin)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2024, res.TaxYear)
+	assert.Equal(t, []bracket{
+		{id: 1, min: 0, max: upTo(150000)},
+		{id: 2, min: 150001, max: upTo(500000)},
+		{id: 3, min: 500001, max: upTo(1000000)},
+		{id: 0, min: 1000001, max: nil},
+	}, brackets(repo.savedTaxRates))
+	assert.Equal(t, taxRatesRepo().taxRatesByYear[2024], repo.savedBase, "The set read should be passed on unchanged, to check it is still stored")
+	assert.Equal(t, repository.AuditEntry{User: "adminTax", RequestID: "req-1", Action: ct.AuditTaxRateCreate, Target: "2024"}, repo.change)
+}
+
+func TestCreateTaxRate_CopiesBracketsInForce(t *testing.T) {
+	repo := taxRatesRepo()
+	repo.taxRates = repo.taxRatesByYear[2024]
+	repo.taxRatesByYear = nil
+	serv := services.NewServices(repo)
+
+	_, err := serv.CreateTaxRate(md.TaxRate{TaxYear: 2025, Level: "300,001-500,000", MinIncome: money.Baht(300001), MaxIncome: upTo(500000), TaxRate: money.Percentage(12)}, _admin)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []bracket{
+		{id: 0, min: 0, max: upTo(150000)},
+		{id: 0, min: 150001, max: upTo(300000)},
+		{id: 0, min: 300001, max: upTo(500000)},
+		{id: 0, min: 500001, max: nil},
+	}, brackets(repo.savedTaxRates))
+	for _, r := range repo.savedTaxRates {
+		assert.Equal(t, 2025, r.TaxYear)
+	}
+	assert.Empty(t, repo.savedBase, "The year had no brackets of its own")
+}
+
+func TestUpdateTaxRate_MovesNeighbours(t *testing.T) {
+	repo := taxRatesRepo()
+	serv := services.NewServices(repo)
+
+	_, err := serv.UpdateTaxRate(md.TaxRate{ID: 2, Level: "200,001-600,000", MinIncome: money.Baht(200001), MaxIncome: upTo(600000), TaxRate: money.Percentage(10)}, _admin)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []bracket{
+		{id: 1, min: 0, max: upTo(200000)},
+		{id: 2, min: 200001, max: upTo(600000)},
+		{id: 3, min: 600001, max: nil},
+	}, brackets(repo.savedTaxRates))
+}
+
+func TestDeleteTaxRate_MergesBracket(t *testing.T) {
+	cases := []struct {
+		name     string
+		id       int
+		expected []bracket
+	}{
+		{
+			name: "given delete middle bracket should extend previous bracket",
+			id:   2,
+			expected: []bracket{
+				{id: 1, min: 0, max: upTo(500000)},
+				{id: 3, min: 500001, max: nil},
+			},
+		},
+		{
+			name: "given delete top bracket should open previous bracket",
+			id:   3,
+			expected: []bracket{
+				{id: 1, min: 0, max: upTo(150000)},
+				{id: 2, min: 150001, max: nil},
+			},
+		},
+		{
+			name: "given delete first bracket should start next bracket at 0",
+			id:   1,
+			expected: []bracket{
+				{id: 2, min: 0, max: upTo(500000)},
+				{id: 3, min: 500001, max: nil},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := taxRatesRepo()
+			serv := services.NewServices(repo)
+
+			_, err := serv.DeleteTaxRate(tc.id, _admin)
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, brackets(repo.savedTaxRates))
+		})
+	}
+}
+
+type taxRateInvalidCase struct {
+	name     string
+	call     func(serv services.TaxService) error
+	expected error
+}
+
+func TestTaxRate_Invalids(t *testing.T) {
+	cases := []taxRateInvalidCase{
+		{
+			name: "case invalid level is required",
+			call: func(serv services.TaxService) error {
+				_, err := serv.CreateTaxRate(md.TaxRate{TaxYear: 2024, MinIncome: money.Baht(1000001), TaxRate: money.Percentage(20)}, _admin)
+				return err
+			},
+			expected: errors.New(ct.ErrMsgTaxRateLevel),
+		},
+		{
+			name: "case invalid tax rate more than 100",
+			call: func(serv services.TaxService) error {
+				_, err := serv.CreateTaxRate(md.TaxRate{TaxYear: 2024, Level: "x", MinIncome: money.Baht(1000001), TaxRate: money.Percentage(101)}, _admin)
+				return err
+			},
+			expected: errors.New(ct.ErrMsgTaxRateInvalid),
+		},
+		{
+			name: "case invalid new bracket does not end where split bracket ends",
+			call: func(serv services.TaxService) error {
+				_, err := serv.CreateTaxRate(md.TaxRate{TaxYear: 2024, Level: "x", MinIncome: money.Baht(200001), MaxIncome: upTo(300000), TaxRate: money.Percentage(10)}, _admin)
+				return err
+			},
+			expected: errors.New(ct.ErrMsgTaxRateSplit),
+		},
+		{
+			name: "case invalid new bracket starts at existing bracket",
+			call: func(serv services.TaxService) error {
+				_, err := serv.CreateTaxRate(md.TaxRate{TaxYear: 2024, Level: "x", MinIncome: money.Baht(500001), TaxRate: money.Percentage(20)}, _admin)
+				return err
+			},
+			expected: errors.New(ct.ErrMsgTaxRatesOverlap),
+		},
+		{
+			name: "case invalid rate lower than previous bracket",
+			call: func(serv services.TaxService) error {
+				_, err := serv.CreateTaxRate(md.TaxRate{TaxYear: 2024, Level: "x", MinIncome: money.Baht(1000001), TaxRate: money.Percentage(5)}, _admin)
+				return err
+			},
+			expected: errors.New(ct.ErrMsgTaxRatesOrder),
+		},
+		{
+			name: "case invalid first bracket does not start at 0",
+			call: func(serv services.TaxService) error {
+				_, err := serv.UpdateTaxRate(md.TaxRate{ID: 1, Level: "x", MinIncome: money.Baht(1), MaxIncome: upTo(150000), TaxRate: money.Percentage(0)}, _admin)
+				return err
+			},
+			expected: errors.New(ct.ErrMsgTaxRatesFirstMin),
+		},
+		{
+			name: "case invalid top bracket is closed",
+			call: func(serv services.TaxService) error {
+				_, err := serv.UpdateTaxRate(md.TaxRate{ID: 3, Level: "x", MinIncome: money.Baht(500001), MaxIncome: upTo(900000), TaxRate: money.Percentage(15)}, _admin)
+				return err
+			},
+			expected: errors.New(ct.ErrMsgTaxRatesOpenEnded),
+		},
+		{
+			name: "case invalid update swallows next bracket",
+			call: func(serv services.TaxService) error {
+				_, err := serv.UpdateTaxRate(md.TaxRate{ID: 1, Level: "x", MinIncome: money.Baht(0), MaxIncome: upTo(600000), TaxRate: money.Percentage(0)}, _admin)
+				return err
+			},
+			expected: errors.New(ct.ErrMsgTaxRatesOverlap),
+		},
+		{
+			name: "case invalid maximum less than minimum",
+			call: func(serv services.TaxService) error {
+				_, err := serv.UpdateTaxRate(md.TaxRate{ID: 2, Level: "x", MinIncome: money.Baht(150001), MaxIncome: upTo(100), TaxRate: money.Percentage(10)}, _admin)
+				return err
+			},
+			expected: errors.New(ct.ErrMsgTaxRatesRange),
+		},
+		{
+			name: "case invalid update tax rate not found",
+			call: func(serv services.TaxService) error {
+				_, err := serv.UpdateTaxRate(md.TaxRate{ID: 99, Level: "x", TaxRate: money.Percentage(10)}, _admin)
+				return err
+			},
+			expected: errors.New(ct.ErrMsgTaxRateNotFound),
+		},
+		{
+			name: "case invalid delete tax rate id",
+			call: func(serv services.TaxService) error {
+				_, err := serv.DeleteTaxRate(0, _admin)
+				return err
+			},
+			expected: errors.New(ct.ErrMsgTaxRateInvalidID),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := taxRatesRepo()
+			serv := services.NewServices(repo)
+
+			err := tc.call(serv)
+
+			assert.EqualError(t, err, tc.expected.Error())
+			assert.Nil(t, repo.savedTaxRates, "Invalid brackets should not be saved")
+		})
+	}
+}
+
+func TestTaxRate_SaveError(t *testing.T) {
+	repo := taxRatesRepo()
+	repo.saveErr = errors.New("error")
+	serv := services.NewServices(repo)
+
+	res, err := serv.DeleteTaxRate(2, _admin)
+
+	assert.EqualError(t, err, ct.ErrMessageInternal)
+	assert.Zero(t, res)
+}
+
+func TestTaxRate_ChangedMeanwhile(t *testing.T) {
+	repo := taxRatesRepo()
+	repo.saveErr = repository.ErrTaxRatesChanged
+	serv := services.NewServices(repo)
+
+	_, err := serv.UpdateTaxRate(md.TaxRate{ID: 2, Level: "200,001-600,000", MinIncome: money.Baht(200001), MaxIncome: upTo(600000), TaxRate: money.Percentage(10)}, _admin)
+
+	assert.ErrorIs(t, err, services.ErrTaxRatesChanged)
+	assert.Equal(t, services.KindConflict, err.(*services.Error).Kind)
+}
+
+func TestListTaxRates(t *testing.T) {
+	serv := services.NewServices(&MockTaxRepository{taxRates: _taxRates})
+
+	res, err := serv.ListTaxRates(2024)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2024, res.TaxYear)
+	assert.Len(t, res.TaxRates, len(_taxRates))
+	assert.Nil(t, res.TaxRates[len(res.TaxRates)-1].MaxIncome)
+}
@@ -2,35 +2,139 @@ package services_test
 
 import (
 	"errors"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	cm "github.com/kanawat2566/assessment-tax/common"
 	ct "github.com/kanawat2566/assessment-tax/constants"
 	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/money"
 	"github.com/kanawat2566/assessment-tax/repository"
 	"github.com/kanawat2566/assessment-tax/services"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
 )
 
 type MockTaxRepository struct {
-	taxRates   []*repository.IncomeTaxRates
-	allowances map[string]repository.Allowances
-	taxErr     error
-	awcErr     error
-	updateErr  error
+	taxRates       []*repository.IncomeTaxRates
+	taxRatesByYear map[int][]*repository.IncomeTaxRates
+	allowances     map[string]repository.Allowances
+	groups         []repository.AllowanceGroups
+	taxErr         error
+	awcErr         error
+	updateErr      error
+	saveErr        error
+	savedTaxRates  []*repository.IncomeTaxRates
+	savedBase      []*repository.IncomeTaxRates
+	createdAwc     *repository.Allowances
+	snapshots      map[int64]*repository.ConfigSnapshot
+	change         repository.AuditEntry
 }
 
-func (m *MockTaxRepository) GetTaxRates() (res []*repository.IncomeTaxRates, err error) {
+func upTo(baht int64) *money.Amount {
+	m := money.Baht(baht)
+	return &m
+}
+
+func (m *MockTaxRepository) GetTaxRates(taxYear int) (res []*repository.IncomeTaxRates, err error) {
+	if m.taxRatesByYear != nil {
+		effective := 0
+		for y := range m.taxRatesByYear {
+			if y <= taxYear && y > effective {
+				effective = y
+			}
+		}
+		return m.taxRatesByYear[effective], m.taxErr
+	}
 	return m.taxRates, m.taxErr
 }
 
-func (m *MockTaxRepository) GetLimitAllowances(allowanceType string) (r repository.Allowances, err error) {
+func (m *MockTaxRepository) ListTaxRates(taxYear int) ([]*repository.IncomeTaxRates, error) {
+	var res []*repository.IncomeTaxRates
+	for _, r := range m.taxRatesByYear[taxYear] {
+		c := *r
+		res = append(res, &c)
+	}
+	return res, m.taxErr
+}
+
+func (m *MockTaxRepository) GetTaxRate(id int) (*repository.IncomeTaxRates, error) {
+	for _, rates := range m.taxRatesByYear {
+		for _, r := range rates {
+			if r.ID == id {
+				c := *r
+				return &c, m.taxErr
+			}
+		}
+	}
+	return nil, m.taxErr
+}
+
+func (m *MockTaxRepository) SaveTaxRates(taxYear int, base, rates []*repository.IncomeTaxRates, change repository.AuditEntry) ([]*repository.IncomeTaxRates, error) {
+	m.savedTaxRates, m.savedBase, m.change = rates, base, change
+	return rates, m.saveErr
+}
+
+func (m *MockTaxRepository) GetLimitAllowances(allowanceType string, taxYear int) (r repository.Allowances, err error) {
 	return m.allowances[allowanceType], m.awcErr
 }
-func (m *MockTaxRepository) UpdateConfigDeduct(config ct.Deduction) error {
+
+func (m *MockTaxRepository) GetAllowances(taxYear int) ([]repository.Allowances, error) {
+	var res []repository.Allowances
+	for _, a := range m.allowances {
+		res = append(res, a)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Allowance_name < res[j].Allowance_name })
+	return res, m.awcErr
+}
+
+func (m *MockTaxRepository) CreateAllowance(allowance repository.Allowances, change repository.AuditEntry) (bool, error) {
+	m.change = change
+	if _, ok := m.allowances[allowance.Allowance_name]; ok {
+		return false, m.awcErr
+	}
+	m.createdAwc = &allowance
+	return true, m.awcErr
+}
+
+func (m *MockTaxRepository) UpdateConfigDeduct(config ct.Deduction, change repository.AuditEntry) error {
+	m.change = change
 	return m.updateErr
 }
 
+// GetConfigSnapshot returns the snapshots set on m by id, and as the latest,
+// snapshot 1, a snapshot of the other fields of m.
+func (m *MockTaxRepository) GetConfigSnapshot(id int64) (*repository.ConfigSnapshot, error) {
+	if s, ok := m.snapshots[id]; ok {
+		return s, nil
+	}
+	if id != 0 && id != 1 {
+		return nil, nil
+	}
+	if m.taxErr != nil {
+		return nil, m.taxErr
+	}
+	if m.awcErr != nil {
+		return nil, m.awcErr
+	}
+
+	s := &repository.ConfigSnapshot{ID: 1, TaxRates: m.taxRates, Groups: m.groups}
+	if m.taxRatesByYear != nil {
+		s.TaxRates = nil
+		for y, rates := range m.taxRatesByYear {
+			for _, r := range rates {
+				c := *r
+				c.TaxYear = y
+				s.TaxRates = append(s.TaxRates, &c)
+			}
+		}
+	}
+	s.Allowances, _ = m.GetAllowances(0)
+	return s, nil
+}
+
 type TaxCase struct {
 	name     string
 	request  md.TaxRequest
@@ -42,16 +146,16 @@ var _mockRepo = &MockTaxRepository{
 	allowances: _allowances,
 }
 var _taxRates = []*repository.IncomeTaxRates{
-	{IncomeLevel: "0-150,000", MinIncome: 0, MaxIncome: 150000, TaxRate: 0},
-	{IncomeLevel: "150,001-500,000", MinIncome: 150001, MaxIncome: 500000, TaxRate: 10},
-	{IncomeLevel: "500,001-1,000,000", MinIncome: 500001.00, MaxIncome: 1000000.00, TaxRate: 15},
-	{IncomeLevel: "1,000,001-2,000,000", MinIncome: 1000001.00, MaxIncome: 2000000.00, TaxRate: 20},
-	{IncomeLevel: "2,000,001 ขึ้นไป", MinIncome: 2000001.00, MaxIncome: 99999999999999.00, TaxRate: 35},
+	{IncomeLevel: "0-150,000", MinIncome: money.Baht(0), MaxIncome: upTo(150000), TaxRate: money.Percentage(0)},
+	{IncomeLevel: "150,001-500,000", MinIncome: money.Baht(150001), MaxIncome: upTo(500000), TaxRate: money.Percentage(10)},
+	{IncomeLevel: "500,001-1,000,000", MinIncome: money.Baht(500001), MaxIncome: upTo(1000000), TaxRate: money.Percentage(15)},
+	{IncomeLevel: "1,000,001-2,000,000", MinIncome: money.Baht(1000001), MaxIncome: upTo(2000000), TaxRate: money.Percentage(20)},
+	{IncomeLevel: "2,000,001 ขึ้นไป", MinIncome: money.Baht(2000001), MaxIncome: nil, TaxRate: money.Percentage(35)},
 }
 var _allowances = map[string]repository.Allowances{
-	ct.Personal:  {Allowance_name: ct.Personal, LimitAmt: 60000, MinAmt: 10001, MaxAmt: 100000},
-	ct.Donation:  {Allowance_name: ct.Donation, LimitAmt: 100000, MinAmt: 0, MaxAmt: 100000},
-	ct.K_Receipt: {Allowance_name: ct.K_Receipt, LimitAmt: 50000, MinAmt: 1, MaxAmt: 100000},
+	ct.Personal:  {Allowance_name: ct.Personal, ResponseName: "personalDeduction", Configurable: true, AutoClaim: true, LimitAmt: money.Baht(60000), MinAmt: money.Baht(10001), MaxAmt: money.Baht(100000)},
+	ct.Donation:  {Allowance_name: ct.Donation, ResponseName: "donation", LimitAmt: money.Baht(100000), MinAmt: money.Baht(0), MaxAmt: money.Baht(100000)},
+	ct.K_Receipt: {Allowance_name: ct.K_Receipt, ResponseName: "kReceipt", Configurable: true, LimitAmt: money.Baht(50000), MinAmt: money.Baht(1), MaxAmt: money.Baht(100000)},
 }
 
 func TestCalculateTax_Valids(t *testing.T) {
@@ -60,130 +164,139 @@ func TestCalculateTax_Valids(t *testing.T) {
 		{
 			name: "given input income total should payment tax",
 			request: md.TaxRequest{
-				TotalIncome: 500000,
-				WHT:         0,
+				TotalIncome: money.Baht(500000),
+				WHT:         money.Baht(0),
 				Allowances: []md.Allowance{
 					{
 						AllowanceType: ct.Donation,
-						Amount:        0,
+						Amount:        money.Baht(0),
 					}}},
 			expected: md.TaxResponse{
-				Tax: 29000,
+				Tax: money.Baht(29000),
+			},
+		},
+		{
+			name: "given input income total with satang should round tax half up to satang",
+			request: md.TaxRequest{
+				TotalIncome: money.MustParse("500000.15"),
+			},
+			expected: md.TaxResponse{
+				Tax: money.MustParse("29000.02"),
 			},
 		},
 		{
 			name: "given input income total and deducting WHT should payment tax",
 			request: md.TaxRequest{
-				TotalIncome: 500000,
-				WHT:         25000.0,
+				TotalIncome: money.Baht(500000),
+				WHT:         money.Baht(25000),
 			},
 			expected: md.TaxResponse{
-				Tax: 4000,
+				Tax: money.Baht(4000),
 			},
 		},
 		{
 			name: "given input income total and deducting WHT should return tax refund",
 			request: md.TaxRequest{
-				TotalIncome: 150000,
-				WHT:         2000,
+				TotalIncome: money.Baht(150000),
+				WHT:         money.Baht(2000),
 			},
 			expected: md.TaxResponse{
-				Tax:       0,
-				TaxRefund: 2000,
+				Tax:       money.Baht(0),
+				TaxRefund: money.Baht(2000),
 			},
 		},
 		{
 			name: "given input income total and allownce donation should payment tax",
 			request: md.TaxRequest{
-				TotalIncome: 500000,
-				WHT:         0,
+				TotalIncome: money.Baht(500000),
+				WHT:         money.Baht(0),
 				Allowances: []md.Allowance{
 					{
 						AllowanceType: ct.Donation,
-						Amount:        200000.0,
+						Amount:        money.Baht(200000),
 					}}},
 			expected: md.TaxResponse{
-				Tax: 19000,
+				Tax: money.Baht(19000),
 			},
 		},
 		{
 			name: "given input income total and allownce fix personal should payment tax",
 			request: md.TaxRequest{
-				TotalIncome: 500000,
-				WHT:         0,
+				TotalIncome: money.Baht(500000),
+				WHT:         money.Baht(0),
 				Allowances: []md.Allowance{
 					{
 						AllowanceType: ct.Personal,
-						Amount:        50000,
+						Amount:        money.Baht(50000),
 					},
 				},
 			},
 			expected: md.TaxResponse{
-				Tax: 30000,
+				Tax: money.Baht(30000),
 			},
 		},
 		{
 			name: "given input income total and deducting WHT with allownce should return tax refund",
 			request: md.TaxRequest{
-				TotalIncome: 500000,
-				WHT:         25000,
+				TotalIncome: money.Baht(500000),
+				WHT:         money.Baht(25000),
 				Allowances: []md.Allowance{
 					{
 						AllowanceType: ct.Donation,
-						Amount:        100000,
+						Amount:        money.Baht(100000),
 					},
 					{
 						AllowanceType: ct.K_Receipt,
-						Amount:        100000,
+						Amount:        money.Baht(100000),
 					},
 				},
 			},
 			expected: md.TaxResponse{
-				Tax:       0,
-				TaxRefund: 11000,
+				Tax:       money.Baht(0),
+				TaxRefund: money.Baht(11000),
 			},
 		},
 		{
 			name: "given input income total and deducting WHT with allownce should return tax level detail",
 			request: md.TaxRequest{
-				TotalIncome: 500000.0,
-				WHT:         0.0,
+				TotalIncome: money.Baht(500000),
+				WHT:         money.Baht(0),
 				Allowances: []md.Allowance{
 					{
 						AllowanceType: ct.Donation,
-						Amount:        200000.0,
+						Amount:        money.Baht(200000),
 					},
 				},
 			},
 			expected: md.TaxResponse{
-				Tax: 19000.0,
+				Tax: money.Baht(19000),
 				TaxLevels: []md.TaxLevel{
-					{Level: "0-150,000", Tax: 0.0},
-					{Level: "150,001-500,000", Tax: 19000.0},
-					{Level: "500,001-1,000,000", Tax: 0.0},
-					{Level: "1,000,001-2,000,000", Tax: 0.0},
-					{Level: "2,000,001 ขึ้นไป", Tax: 0.0},
+					{Level: "0-150,000", Tax: money.Baht(0)},
+					{Level: "150,001-500,000", Tax: money.Baht(19000)},
+					{Level: "500,001-1,000,000", Tax: money.Baht(0)},
+					{Level: "1,000,001-2,000,000", Tax: money.Baht(0)},
+					{Level: "2,000,001 ขึ้นไป", Tax: money.Baht(0)},
 				},
 			},
 		},
 		{
 			name: "given input income total and allownces should payment tax",
 			request: md.TaxRequest{
-				TotalIncome: 500000,
-				WHT:         0,
+				TotalIncome: money.Baht(500000),
+				WHT:         money.Baht(0),
 				Allowances: []md.Allowance{
 					{
 						AllowanceType: ct.K_Receipt,
-						Amount:        200000,
+						Amount:        money.Baht(200000),
 					},
 					{
 						AllowanceType: ct.Donation,
-						Amount:        100000,
+						Amount:        money.Baht(100000),
 					},
 				},
 			},
 			expected: md.TaxResponse{
-				Tax: 14000,
+				Tax: money.Baht(14000),
 			},
 		},
 	}
@@ -208,50 +321,50 @@ func TestCalculateTaxLevel_Valids(t *testing.T) {
 		{
 			name: "given input income total and allownce should return tax level detail",
 			request: md.TaxRequest{
-				TotalIncome: 500000.0,
-				WHT:         0.0,
+				TotalIncome: money.Baht(500000),
+				WHT:         money.Baht(0),
 				Allowances: []md.Allowance{
 					{
 						AllowanceType: ct.Donation,
-						Amount:        200000.0,
+						Amount:        money.Baht(200000),
 					},
 				},
 			},
 			expected: md.TaxResponse{
-				Tax: 19000.0,
+				Tax: money.Baht(19000),
 				TaxLevels: []md.TaxLevel{
-					{Level: "0-150,000", Tax: 0.0},
-					{Level: "150,001-500,000", Tax: 19000.0},
-					{Level: "500,001-1,000,000", Tax: 0.0},
-					{Level: "1,000,001-2,000,000", Tax: 0.0},
-					{Level: "2,000,001 ขึ้นไป", Tax: 0.0},
+					{Level: "0-150,000", Tax: money.Baht(0)},
+					{Level: "150,001-500,000", Tax: money.Baht(19000)},
+					{Level: "500,001-1,000,000", Tax: money.Baht(0)},
+					{Level: "1,000,001-2,000,000", Tax: money.Baht(0)},
+					{Level: "2,000,001 ขึ้นไป", Tax: money.Baht(0)},
 				},
 			},
 		},
 		{
 			name: "given input income total and allownces should return tax level detail",
 			request: md.TaxRequest{
-				TotalIncome: 500000.0,
-				WHT:         0.0,
+				TotalIncome: money.Baht(500000),
+				WHT:         money.Baht(0),
 				Allowances: []md.Allowance{
 					{
 						AllowanceType: ct.Donation,
-						Amount:        100000,
+						Amount:        money.Baht(100000),
 					},
 					{
 						AllowanceType: ct.K_Receipt,
-						Amount:        200000.0,
+						Amount:        money.Baht(200000),
 					},
 				},
 			},
 			expected: md.TaxResponse{
-				Tax: 14000,
+				Tax: money.Baht(14000),
 				TaxLevels: []md.TaxLevel{
-					{Level: "0-150,000", Tax: 0.0},
-					{Level: "150,001-500,000", Tax: 14000.0},
-					{Level: "500,001-1,000,000", Tax: 0.0},
-					{Level: "1,000,001-2,000,000", Tax: 0.0},
-					{Level: "2,000,001 ขึ้นไป", Tax: 0.0},
+					{Level: "0-150,000", Tax: money.Baht(0)},
+					{Level: "150,001-500,000", Tax: money.Baht(14000)},
+					{Level: "500,001-1,000,000", Tax: money.Baht(0)},
+					{Level: "1,000,001-2,000,000", Tax: money.Baht(0)},
+					{Level: "2,000,001 ขึ้นไป", Tax: money.Baht(0)},
 				},
 			},
 		},
@@ -272,6 +385,67 @@ func TestCalculateTaxLevel_Valids(t *testing.T) {
 	}
 }
 
+func TestCalculateTax_AllowanceBreakdown(t *testing.T) {
+	serv := services.NewServices(_mockRepo)
+
+	rep, err := serv.TaxCalculations(md.TaxRequest{
+		TotalIncome: money.Baht(500000),
+		Allowances: []md.Allowance{
+			{AllowanceType: ct.Donation, Amount: money.Baht(200000)},
+			{AllowanceType: ct.K_Receipt, Amount: money.Baht(20000)},
+		},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, money.Baht(320000), rep.TaxableIncome, "Taxable income should be income less allowed deductions")
+	assert.Equal(t, []md.AllowanceDetail{
+		{AllowanceType: ct.Donation, Claimed: money.Baht(200000), Allowed: money.Baht(100000), Limit: money.Baht(100000), Reason: ct.ReasonAllowanceLimit},
+		{AllowanceType: ct.K_Receipt, Claimed: money.Baht(20000), Allowed: money.Baht(20000), Limit: money.Baht(50000), Reason: ct.ReasonClaimed},
+		{AllowanceType: ct.Personal, Claimed: money.Baht(60000), Allowed: money.Baht(60000), Limit: money.Baht(60000), Reason: ct.ReasonAutoClaimed},
+	}, rep.Allowances)
+}
+
+func TestCalculateTax_TaxYears(t *testing.T) {
+	mockRepo := &MockTaxRepository{
+		taxRatesByYear: map[int][]*repository.IncomeTaxRates{
+			2017: _taxRates,
+			2024: {
+				{IncomeLevel: "0-300,000", MinIncome: money.Baht(0), MaxIncome: upTo(300000), TaxRate: money.Percentage(0)},
+				{IncomeLevel: "300,001 ขึ้นไป", MinIncome: money.Baht(300001), MaxIncome: nil, TaxRate: money.Percentage(10)},
+			},
+		},
+		allowances: _allowances,
+	}
+
+	cases := []TaxCase{
+		{
+			name:     "given tax year before new brackets should use previous brackets",
+			request:  md.TaxRequest{TotalIncome: money.Baht(500000), TaxYear: 2023},
+			expected: md.TaxResponse{Tax: money.Baht(29000)},
+		},
+		{
+			name:     "given tax year of new brackets should use new brackets",
+			request:  md.TaxRequest{TotalIncome: money.Baht(500000), TaxYear: 2024},
+			expected: md.TaxResponse{Tax: money.Baht(14000)},
+		},
+		{
+			name:     "given no tax year should use brackets in force for the current year",
+			request:  md.TaxRequest{TotalIncome: money.Baht(500000)},
+			expected: md.TaxResponse{Tax: money.Baht(14000)},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			serv := services.NewServices(mockRepo)
+			rep, err := serv.TaxCalculations(tc.request)
+
+			assert.Nil(t, err, "Error should be nil for valid inputs")
+			assert.Equal(t, tc.expected.Tax, rep.Tax, "Calculated tax should match")
+		})
+	}
+}
+
 type caseInvalids struct {
 	name     string
 	mockRepo *MockTaxRepository
@@ -284,67 +458,85 @@ func TestCalculateTax_Invalids(t *testing.T) {
 		{
 			name:     "case invalid totalIncome less than 0",
 			mockRepo: &MockTaxRepository{},
-			request:  md.TaxRequest{TotalIncome: -100},
+			request:  md.TaxRequest{TotalIncome: money.Baht(-100)},
 			expected: errors.New(ct.ErrMessageThenZero),
 		},
 		{
 			name:     "case invalid WHT less than 0",
 			mockRepo: &MockTaxRepository{},
-			request:  md.TaxRequest{TotalIncome: 500000, WHT: -100},
+			request:  md.TaxRequest{TotalIncome: money.Baht(500000), WHT: money.Baht(-100)},
 			expected: errors.New(ct.ErrMesssageWhtInvalid),
 		},
 		{
 			name:     "case invalid WHT more then total income",
 			mockRepo: &MockTaxRepository{},
-			request:  md.TaxRequest{TotalIncome: 150000, WHT: 150001},
+			request:  md.TaxRequest{TotalIncome: money.Baht(150000), WHT: money.Baht(150001)},
 			expected: errors.New(ct.ErrMesssageWhtInvalid),
 		},
+		{
+			name:     "case invalid tax year less than 0",
+			mockRepo: &MockTaxRepository{},
+			request:  md.TaxRequest{TotalIncome: money.Baht(500000), TaxYear: -1},
+			expected: errors.New(ct.ErrMsgTaxYearInvalid),
+		},
+		{
+			name:     "case invalid tax year later than current year",
+			mockRepo: &MockTaxRepository{},
+			request:  md.TaxRequest{TotalIncome: money.Baht(500000), TaxYear: time.Now().Year() + 1},
+			expected: errors.New(ct.ErrMsgTaxYearInvalid),
+		},
+		{
+			name:     "case invalid tax rates not found for tax year",
+			mockRepo: &MockTaxRepository{allowances: _allowances},
+			request:  md.TaxRequest{TotalIncome: money.Baht(500000), TaxYear: 2010},
+			expected: errors.New(cm.MsgWithInt(ct.ErrMsgTaxRatesNotFound, 2010)),
+		},
 		{
 			name:     "case invalid database error repo get rates",
 			mockRepo: &MockTaxRepository{taxErr: errors.New("")},
 			request: md.TaxRequest{
-				TotalIncome: 150000,
-				Allowances:  []md.Allowance{{AllowanceType: ct.Donation, Amount: 1000}}},
+				TotalIncome: money.Baht(150000),
+				Allowances:  []md.Allowance{{AllowanceType: ct.Donation, Amount: money.Baht(1000)}}},
 			expected: errors.New(ct.ErrMessageInternal),
 		},
 		{
 			name:     "case invalid database error repo get allowances",
 			mockRepo: &MockTaxRepository{awcErr: errors.New("")},
 			request: md.TaxRequest{
-				TotalIncome: 150000,
-				Allowances:  []md.Allowance{{AllowanceType: ct.Donation, Amount: 1000}}},
+				TotalIncome: money.Baht(150000),
+				Allowances:  []md.Allowance{{AllowanceType: ct.Donation, Amount: money.Baht(1000)}}},
 			expected: errors.New(ct.ErrMessageInternal),
 		},
 		{
 			name:     "case invalid AllowanceType not found",
 			mockRepo: &MockTaxRepository{},
 			request: md.TaxRequest{
-				TotalIncome: 500000,
-				Allowances:  []md.Allowance{{AllowanceType: "AllowanceType", Amount: 100}}},
+				TotalIncome: money.Baht(500000),
+				Allowances:  []md.Allowance{{AllowanceType: "AllowanceType", Amount: money.Baht(100)}}},
 			expected: errors.New(ct.ErrMsgAllowanceType),
 		},
 		{
 			name:     "case invalid allowance less than 0",
 			mockRepo: &MockTaxRepository{},
 			request: md.TaxRequest{
-				TotalIncome: 500000,
-				Allowances:  []md.Allowance{{AllowanceType: ct.Donation, Amount: -1}}},
+				TotalIncome: money.Baht(500000),
+				Allowances:  []md.Allowance{{AllowanceType: ct.Donation, Amount: money.Baht(-1)}}},
 			expected: errors.New(ct.ErrMsgAllowanceThenZero),
 		},
 		{
 			name:     "case invalid allowance personal greater than minimum config",
 			mockRepo: _mockRepo,
 			request: md.TaxRequest{
-				TotalIncome: 500000,
-				Allowances:  []md.Allowance{{AllowanceType: ct.Personal, Amount: 10000}}},
+				TotalIncome: money.Baht(500000),
+				Allowances:  []md.Allowance{{AllowanceType: ct.Personal, Amount: money.Baht(10000)}}},
 			expected: errors.New(ct.ErrMsgAllowanceThenMin),
 		},
 		{
 			name:     "case invalid allowance k-receipt more than 0",
 			mockRepo: _mockRepo,
 			request: md.TaxRequest{
-				TotalIncome: 500000,
-				Allowances:  []md.Allowance{{AllowanceType: ct.K_Receipt, Amount: 0}}},
+				TotalIncome: money.Baht(500000),
+				Allowances:  []md.Allowance{{AllowanceType: ct.K_Receipt, Amount: money.Baht(0)}}},
 			expected: errors.New(ct.ErrMsgAllowanceThenMin),
 		},
 	}
@@ -369,21 +561,28 @@ type ConfigCase struct {
 func TestConfigDeduction_Valids(t *testing.T) {
 	cases := []ConfigCase{
 		{name: "given admin set personal deduction amount 70,000 should return 70,000",
-			request:  ct.Deduction{Type: ct.Personal, Amount: 70000},
-			expected: ct.Deduction{Type: ct.Personal, Amount: 70000},
+			request:  ct.Deduction{Type: ct.Personal, Amount: money.Baht(70000)},
+			expected: ct.Deduction{Type: ct.Personal, Amount: money.Baht(70000)},
 		},
 		{name: "given admin set personal deduction amount 10,001 should return 10,001",
-			request:  ct.Deduction{Type: ct.Personal, Amount: 10001},
-			expected: ct.Deduction{Type: ct.Personal, Amount: 10001},
+			request:  ct.Deduction{Type: ct.Personal, Amount: money.Baht(10001)},
+			expected: ct.Deduction{Type: ct.Personal, Amount: money.Baht(10001)},
+		},
+		{name: "given admin set personal deduction for tax year 2023 should return tax year 2023",
+			request:  ct.Deduction{Type: ct.Personal, TaxYear: 2023, Amount: money.Baht(70000)},
+			expected: ct.Deduction{Type: ct.Personal, TaxYear: 2023, Amount: money.Baht(70000)},
 		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			serv := services.NewServices(_mockRepo)
-			rep, err := serv.SetAdminDeductions(tc.request)
+			rep, err := serv.SetAdminDeductions(tc.request, _admin)
 			assert.Nil(t, err, "Error should be nil for valid inputs")
 			assert.Equal(t, tc.expected.Amount, rep.Amount, "Calculated tax should match")
+			if tc.expected.TaxYear != 0 {
+				assert.Equal(t, tc.expected.TaxYear, rep.TaxYear, "Tax year should match")
+			}
 		})
 
 	}
@@ -406,68 +605,74 @@ func TestConfigDeduction_Invalids(t *testing.T) {
 			expected: errors.New(ct.ErrMsgInvalidDeduct),
 		},
 		{
-			name:     "case invalid type should return ErrInvalid Not Supported",
+			name:     "case invalid tax year later than current year should return error",
 			mockRepo: &MockTaxRepository{},
+			request:  ct.Deduction{Type: ct.Personal, TaxYear: time.Now().Year() + 1, Amount: money.Baht(50000)},
+			expected: errors.New(ct.ErrMsgTaxYearInvalid),
+		},
+		{
+			name:     "case invalid type should return ErrInvalid Not Supported",
+			mockRepo: _mockRepo,
 			request:  ct.Deduction{Type: ct.Donation},
 			expected: errors.New(ct.ErrMsgNotDeductSupport),
 		},
 		{
 			name:     "case invalid get deductions from database error should return error",
 			mockRepo: &MockTaxRepository{awcErr: errors.New("error")},
-			request:  ct.Deduction{Type: ct.Personal, Amount: 50000},
+			request:  ct.Deduction{Type: ct.Personal, Amount: money.Baht(50000)},
 			expected: errors.New(ct.ErrMessageInternal),
 		},
 		{
 			name: "case invalid get deduction personal from database not found",
 			mockRepo: &MockTaxRepository{allowances: map[string]repository.Allowances{
-				ct.Donation: {Allowance_name: ct.Donation, LimitAmt: 100000, MinAmt: 0, MaxAmt: 100000},
+				ct.Donation: {Allowance_name: ct.Donation, ResponseName: "donation", LimitAmt: money.Baht(100000), MinAmt: money.Baht(0), MaxAmt: money.Baht(100000)},
 			}},
-			request:  ct.Deduction{Type: ct.Personal, Amount: 50000},
+			request:  ct.Deduction{Type: ct.Personal, Amount: money.Baht(50000)},
 			expected: errors.New(ct.ErrMsgDeductNotFound),
 		},
 		{
 			name:     "case invalid deductions amount must be greater minimum should return error",
 			mockRepo: _mockRepo,
-			request:  ct.Deduction{Type: ct.Personal, Amount: 10000},
-			expected: errors.New(cm.MsgWithNumber(ct.ErrMsgValidateMinAmt, 10001)),
+			request:  ct.Deduction{Type: ct.Personal, Amount: money.Baht(10000)},
+			expected: errors.New(cm.MsgWithAmount(ct.ErrMsgValidateMinAmt, money.Baht(10001))),
 		},
 		{
 			name:     "case invalid deductions less than maximum should return error",
 			mockRepo: _mockRepo,
-			request:  ct.Deduction{Type: ct.Personal, Amount: 100001},
-			expected: errors.New(cm.MsgWithNumber(ct.ErrMsgValidateMaxAmt, 100000)),
+			request:  ct.Deduction{Type: ct.Personal, Amount: money.Baht(100001)},
+			expected: errors.New(cm.MsgWithAmount(ct.ErrMsgValidateMaxAmt, money.Baht(100000))),
 		},
 		{
 			name:     "case invalid set deductions from database error should return error",
 			mockRepo: &MockTaxRepository{allowances: _allowances, updateErr: errors.New("error")},
-			request:  ct.Deduction{Type: ct.Personal, Amount: 50000},
+			request:  ct.Deduction{Type: ct.Personal, Amount: money.Baht(50000)},
 			expected: errors.New(ct.ErrMessageInternal),
 		},
 		{
 			name: "case invalid get deduction k-receipt from database not found",
 			mockRepo: &MockTaxRepository{allowances: map[string]repository.Allowances{
-				ct.Donation: {Allowance_name: ct.Donation, LimitAmt: 100000, MinAmt: 0, MaxAmt: 100000},
+				ct.Donation: {Allowance_name: ct.Donation, ResponseName: "donation", LimitAmt: money.Baht(100000), MinAmt: money.Baht(0), MaxAmt: money.Baht(100000)},
 			}},
-			request:  ct.Deduction{Type: ct.K_Receipt, Amount: 50000},
+			request:  ct.Deduction{Type: ct.K_Receipt, Amount: money.Baht(50000)},
 			expected: errors.New(ct.ErrMsgDeductNotFound),
 		},
 		{
 			name:     "case invalid deduction k-receipt amount must be greater minimum should return error",
 			mockRepo: _mockRepo,
-			request:  ct.Deduction{Type: ct.K_Receipt, Amount: 0},
-			expected: errors.New(cm.MsgWithNumber(ct.ErrMsgValidateMinAmt, 1)),
+			request:  ct.Deduction{Type: ct.K_Receipt, Amount: money.Baht(0)},
+			expected: errors.New(cm.MsgWithAmount(ct.ErrMsgValidateMinAmt, money.Baht(1))),
 		},
 		{
 			name:     "case invalid deduction k-receipt less than maximum should return error",
 			mockRepo: _mockRepo,
-			request:  ct.Deduction{Type: ct.K_Receipt, Amount: 100001},
-			expected: errors.New(cm.MsgWithNumber(ct.ErrMsgValidateMaxAmt, 100000)),
+			request:  ct.Deduction{Type: ct.K_Receipt, Amount: money.Baht(100001)},
+			expected: errors.New(cm.MsgWithAmount(ct.ErrMsgValidateMaxAmt, money.Baht(100000))),
 		},
 	}
 	for _, tc := range invalids {
 		t.Run(tc.name, func(t *testing.T) {
 			serv := services.NewServices(tc.mockRepo)
-			rep, err := serv.SetAdminDeductions(tc.request)
+			rep, err := serv.SetAdminDeductions(tc.request, _admin)
 
 			assert.NotNil(t, err, "Error should not be nil for invalid")
 			assert.EqualError(t, err, tc.expected.Error(), "Error message should match")
@@ -475,3 +680,122 @@ func TestConfigDeduction_Invalids(t *testing.T) {
 		})
 	}
 }
+
+// calFromCsv collects the taxes and row errors TaxCalFromCsv yields.
+func calFromCsv(repo *MockTaxRepository, csv string) ([]md.Taxes, []*services.Error, error) {
+	var taxes []md.Taxes
+	var rowErrs []*services.Error
+	err := services.NewServices(repo).TaxCalFromCsv(strings.NewReader(csv), 0, 0, func(tax md.Taxes, rowErr *services.Error) error {
+		if rowErr != nil {
+			rowErrs = append(rowErrs, rowErr)
+			return nil
+		}
+		taxes = append(taxes, tax)
+		return nil
+	})
+	return taxes, rowErrs, err
+}
+
+func TestTaxCalFromCsv_RowErrors(t *testing.T) {
+	taxes, rowErrs, err := calFromCsv(_mockRepo, "id,totalIncome,wht\nE-01,500000,0\nE-02,500000,600000\n")
+
+	assert.Nil(t, err)
+	if assert.Len(t, taxes, 1) {
+		assert.Equal(t, "E-01", taxes[0].ID)
+		assert.Equal(t, money.Baht(500000), taxes[0].TotalIncome)
+		assert.Equal(t, money.Baht(29000), taxes[0].Tax)
+		assert.Equal(t, money.Baht(440000), taxes[0].TaxableIncome, "Exports should get the taxable income")
+		assert.Len(t, taxes[0].TaxLevels, 5, "Exports should get the tax levels")
+		assert.Equal(t, []string{"E-01", "500000", "0"}, taxes[0].Input.Cells)
+	}
+	if assert.Len(t, rowErrs, 1) {
+		assert.ErrorIs(t, rowErrs[0], services.ErrWHTInvalid)
+		assert.Equal(t, 3, rowErrs[0].Line)
+	}
+}
+
+func TestTaxCalFromCsv_InternalError(t *testing.T) {
+	taxes, rowErrs, err := calFromCsv(&MockTaxRepository{taxErr: errors.New("error")}, "totalIncome\n500000\n")
+
+	assert.EqualError(t, err, ct.ErrMessageInternal)
+	assert.Nil(t, taxes)
+	assert.Nil(t, rowErrs)
+}
+
+func TestTaxCalFromCsv_ColumnsFromSnapshot(t *testing.T) {
+	latest := &repository.ConfigSnapshot{ID: 3, TaxRates: _taxRates}
+	for _, a := range _allowances {
+		if a.Allowance_name != ct.K_Receipt {
+			latest.Allowances = append(latest.Allowances, a)
+		}
+	}
+	repo := &MockTaxRepository{taxRates: _taxRates, allowances: _allowances, snapshots: map[int64]*repository.ConfigSnapshot{0: latest}}
+
+	_, _, err := calFromCsv(repo, "totalIncome,kReceipt\n500000,1000\n")
+
+	assert.ErrorIs(t, err, services.ErrCsvColumn, "The columns should be the allowances of the snapshot the rows are calculated with")
+}
+
+func TestTaxCalFromCsv_PinnedSnapshot(t *testing.T) {
+	old := &repository.ConfigSnapshot{ID: 7, TaxRates: _taxRates}
+	for _, a := range _allowances {
+		if a.Allowance_name == ct.Personal {
+			a.LimitAmt = money.Baht(50000)
+		}
+		old.Allowances = append(old.Allowances, a)
+	}
+	repo := &MockTaxRepository{taxRates: _taxRates, allowances: _allowances, snapshots: map[int64]*repository.ConfigSnapshot{7: old}}
+	serv := services.NewServices(repo)
+
+	var taxes []md.Taxes
+	err := serv.TaxCalFromCsv(strings.NewReader("totalIncome\n500000\n"), 0, 7, func(tax md.Taxes, _ *services.Error) error {
+		taxes = append(taxes, tax)
+		return nil
+	})
+	assert.Nil(t, err)
+	if assert.Len(t, taxes, 1) {
+		assert.Equal(t, money.Baht(30000), taxes[0].Tax, "The personal allowance of snapshot 7 should apply")
+	}
+
+	err = serv.TaxCalFromCsv(strings.NewReader("totalIncome\n500000\n"), 0, 9, func(md.Taxes, *services.Error) error { return nil })
+	assert.ErrorIs(t, err, services.ErrSnapshotUnknown)
+}
+
+func TestCalculateTax_LevelLabels(t *testing.T) {
+	cases := []struct {
+		name     string
+		lang     language.Tag
+		expected []string
+	}{
+		{
+			name:     "given no language should keep stored labels",
+			lang:     language.Und,
+			expected: []string{"0-150,000", "150,001-500,000", "500,001-1,000,000", "1,000,001-2,000,000", "2,000,001 ขึ้นไป"},
+		},
+		{
+			name:     "given english should label top bracket in english",
+			lang:     language.English,
+			expected: []string{"0-150,000", "150,001-500,000", "500,001-1,000,000", "1,000,001-2,000,000", "2,000,001 and above"},
+		},
+		{
+			name:     "given thai should label top bracket in thai",
+			lang:     language.Thai,
+			expected: []string{"0-150,000", "150,001-500,000", "500,001-1,000,000", "1,000,001-2,000,000", "2,000,001 ขึ้นไป"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			serv := services.NewServices(_mockRepo)
+
+			rep, err := serv.TaxCalculations(md.TaxRequest{TotalIncome: money.Baht(500000), Lang: tc.lang})
+
+			assert.Nil(t, err)
+			var labels []string
+			for _, l := range rep.TaxLevels {
+				labels = append(labels, l.Level)
+			}
+			assert.Equal(t, tc.expected, labels)
+		})
+	}
+}
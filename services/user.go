@@ -0,0 +1,234 @@
+package services
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	models "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UserService interface {
+	Authenticate(username, password string) (*models.AdminUser, error)
+	BootstrapAdmin(username, password string) (bool, error)
+	ListAdminUsers() (models.AdminUsersResponse, error)
+	CreateAdminUser(req models.AdminUserRequest, by ct.Actor) (models.AdminUser, error)
+	UpdateAdminUser(username string, req models.AdminUserUpdate, by ct.Actor) (models.AdminUser, error)
+	DeleteAdminUser(username string, by ct.Actor) error
+}
+
+type userService struct {
+	repo repository.UserRepository
+	cost int
+}
+
+func NewUserService(r repository.UserRepository) *userService {
+	return &userService{repo: r, cost: bcrypt.DefaultCost}
+}
+
+// WithHashCost sets the bcrypt cost of new password hashes. Tests use
+// bcrypt.MinCost to stay fast.
+func (us *userService) WithHashCost(cost int) *userService {
+	us.cost = cost
+	return us
+}
+
+var adminUsernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,50}$`)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// Authenticate returns the enabled user with the given username when password
+// is theirs, and nil otherwise. An unknown user costs as much time as a wrong
+// password, so the answer does not tell which usernames exist.
+func (us *userService) Authenticate(username, password string) (*models.AdminUser, error) {
+	u, err := us.repo.GetAdminUser(username)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	if u == nil {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), us.cost)
+		})
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil || u.Disabled {
+		return nil, nil
+	}
+	res := toAdminUser(*u)
+	return &res, nil
+}
+
+// BootstrapAdmin creates the first admin user with every role. It does
+// nothing and returns false when there is any user already.
+func (us *userService) BootstrapAdmin(username, password string) (bool, error) {
+	hash, err := us.newAdminUser(username, password)
+	if err != nil {
+		return false, err
+	}
+	u, err := us.repo.BootstrapAdminUser(repository.AdminUser{Username: username, PasswordHash: hash, Roles: ct.Roles},
+		auditEntry(ct.Actor{User: ct.AuditSystem}, ct.AuditUserCreate, username))
+	if err != nil {
+		return false, ErrInternal
+	}
+	return u != nil, nil
+}
+
+func (us *userService) ListAdminUsers() (models.AdminUsersResponse, error) {
+	users, err := us.repo.ListAdminUsers()
+	if err != nil {
+		return models.AdminUsersResponse{}, ErrInternal
+	}
+	res := models.AdminUsersResponse{Users: make([]models.AdminUser, 0, len(users))}
+	for _, u := range users {
+		res.Users = append(res.Users, toAdminUser(u))
+	}
+	return res, nil
+}
+
+func (us *userService) CreateAdminUser(req models.AdminUserRequest, by ct.Actor) (models.AdminUser, error) {
+	hash, err := us.newAdminUser(req.Username, req.Password)
+	if err != nil {
+		return models.AdminUser{}, err
+	}
+	roles, err := adminRoles(req.Roles)
+	if err != nil {
+		return models.AdminUser{}, err
+	}
+	u, err := us.repo.CreateAdminUser(repository.AdminUser{Username: req.Username, PasswordHash: hash, Roles: roles},
+		auditEntry(by, ct.AuditUserCreate, req.Username))
+	if err != nil {
+		return models.AdminUser{}, ErrInternal
+	}
+	if u == nil {
+		return models.AdminUser{}, ErrAdminUserExists
+	}
+	return toAdminUser(*u), nil
+}
+
+// UpdateAdminUser changes the password or the roles of a user, or disables
+// it. No one can disable their own account or take user-admin away from it,
+// so there is always an admin left to manage the users.
+func (us *userService) UpdateAdminUser(username string, req models.AdminUserUpdate, by ct.Actor) (models.AdminUser, error) {
+	if req.Disabled != nil && *req.Disabled && username == by.User {
+		return models.AdminUser{}, ErrAdminUserSelf
+	}
+	var roles []string
+	if req.Roles != nil {
+		var err error
+		if roles, err = adminRoles(*req.Roles); err != nil {
+			return models.AdminUser{}, err
+		}
+		if username == by.User && !slices.Contains(roles, ct.RoleUserAdmin) {
+			return models.AdminUser{}, ErrAdminUserSelf.WithField("roles")
+		}
+	}
+	cur, err := us.repo.GetAdminUser(username)
+	if err != nil {
+		return models.AdminUser{}, ErrInternal
+	}
+	if cur == nil {
+		return models.AdminUser{}, ErrAdminUserNotFound
+	}
+
+	if req.Password != nil {
+		if cur.PasswordHash, err = us.hashPassword(*req.Password); err != nil {
+			return models.AdminUser{}, err
+		}
+	}
+	if req.Disabled != nil {
+		cur.Disabled = *req.Disabled
+	}
+	if req.Roles != nil {
+		cur.Roles = roles
+	}
+
+	u, err := us.repo.UpdateAdminUser(*cur, auditEntry(by, ct.AuditUserUpdate, username))
+	if err != nil {
+		return models.AdminUser{}, ErrInternal
+	}
+	if u == nil {
+		return models.AdminUser{}, ErrAdminUserNotFound
+	}
+	return toAdminUser(*u), nil
+}
+
+// DeleteAdminUser removes a user. No one can remove their own account.
+func (us *userService) DeleteAdminUser(username string, by ct.Actor) error {
+	if username == by.User {
+		return ErrAdminUserSelf
+	}
+	deleted, err := us.repo.DeleteAdminUser(username, auditEntry(by, ct.AuditUserDelete, username))
+	if err != nil {
+		return ErrInternal
+	}
+	if !deleted {
+		return ErrAdminUserNotFound
+	}
+	return nil
+}
+
+// newAdminUser checks the username and password of a new user and returns
+// the password hash.
+func (us *userService) newAdminUser(username, password string) (string, error) {
+	if !adminUsernamePattern.MatchString(username) {
+		return "", ErrAdminUsername
+	}
+	return us.hashPassword(password)
+}
+
+// adminRoles checks roles and returns them without duplicates, in the order
+// of ct.Roles.
+func adminRoles(roles []string) ([]string, error) {
+	res, ok := inOrderOf(ct.Roles, roles)
+	if !ok {
+		return nil, ErrAdminRole.WithArgs(strings.Join(ct.Roles, ", "))
+	}
+	return res, nil
+}
+
+// inOrderOf returns the values of all that are in values, and false when
+// values holds anything else.
+func inOrderOf(all, values []string) ([]string, bool) {
+	res := []string{}
+	for _, v := range all {
+		if slices.Contains(values, v) {
+			res = append(res, v)
+		}
+	}
+	for _, v := range values {
+		if !slices.Contains(all, v) {
+			return res, false
+		}
+	}
+	return res, true
+}
+
+func (us *userService) hashPassword(password string) (string, error) {
+	if len(password) < ct.AdminPasswordMinLength || len(password) > ct.AdminPasswordMaxLength {
+		return "", ErrAdminPassword.WithArgs(ct.AdminPasswordMinLength, ct.AdminPasswordMaxLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), us.cost)
+	if err != nil {
+		return "", ErrInternal
+	}
+	return string(hash), nil
+}
+
+func toAdminUser(u repository.AdminUser) models.AdminUser {
+	return models.AdminUser{
+		Username:          u.Username,
+		Disabled:          u.Disabled,
+		Roles:             u.Roles,
+		CreatedAt:         u.CreatedAt,
+		UpdatedAt:         u.UpdatedAt,
+		PasswordChangedAt: u.PasswordChangedAt,
+	}
+}
@@ -0,0 +1,246 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	ct "github.com/kanawat2566/assessment-tax/constants"
+	md "github.com/kanawat2566/assessment-tax/model"
+	"github.com/kanawat2566/assessment-tax/repository"
+	"github.com/kanawat2566/assessment-tax/services"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type MockUserRepository struct {
+	users  map[string]repository.AdminUser
+	err    error
+	change repository.AuditEntry
+}
+
+func hashOf(password string) string {
+	h, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	return string(h)
+}
+
+func usersRepo() *MockUserRepository {
+	return &MockUserRepository{users: map[string]repository.AdminUser{
+		"adminTax": {ID: 1, Username: "adminTax", PasswordHash: hashOf("correct-horse-battery"), Roles: ct.Roles},
+		"support":  {ID: 2, Username: "support", PasswordHash: hashOf("support-password"), Disabled: true, Roles: []string{ct.RoleViewer}},
+	}}
+}
+
+func (m *MockUserRepository) GetAdminUser(username string) (*repository.AdminUser, error) {
+	u, ok := m.users[username]
+	if !ok {
+		return nil, m.err
+	}
+	return &u, m.err
+}
+
+func (m *MockUserRepository) ListAdminUsers() ([]repository.AdminUser, error) {
+	return []repository.AdminUser{m.users["adminTax"], m.users["support"]}, m.err
+}
+
+func (m *MockUserRepository) CreateAdminUser(u repository.AdminUser, change repository.AuditEntry) (*repository.AdminUser, error) {
+	m.change = change
+	if _, ok := m.users[u.Username]; ok {
+		return nil, m.err
+	}
+	m.users[u.Username] = u
+	return &u, m.err
+}
+
+func (m *MockUserRepository) BootstrapAdminUser(u repository.AdminUser, change repository.AuditEntry) (*repository.AdminUser, error) {
+	if len(m.users) > 0 {
+		return nil, m.err
+	}
+	return m.CreateAdminUser(u, change)
+}
+
+func (m *MockUserRepository) UpdateAdminUser(u repository.AdminUser, change repository.AuditEntry) (*repository.AdminUser, error) {
+	m.change = change
+	if _, ok := m.users[u.Username]; !ok {
+		return nil, m.err
+	}
+	m.users[u.Username] = u
+	return &u, m.err
+}
+
+func (m *MockUserRepository) DeleteAdminUser(username string, change repository.AuditEntry) (bool, error) {
+	m.change = change
+	if _, ok := m.users[username]; !ok {
+		return false, m.err
+	}
+	delete(m.users, username)
+	return true, m.err
+}
+
+func TestAuthenticate(t *testing.T) {
+	cases := []struct {
+		name     string
+		username string
+		password string
+		expected bool
+	}{
+		{name: "given right password should sign in", username: "adminTax", password: "correct-horse-battery", expected: true},
+		{name: "given wrong password should not sign in", username: "adminTax", password: "wrong-horse-battery"},
+		{name: "given unknown user should not sign in", username: "nobody", password: "correct-horse-battery"},
+		{name: "given disabled user should not sign in", username: "support", password: "support-password"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := services.NewUserService(usersRepo()).WithHashCost(bcrypt.MinCost).Authenticate(tc.username, tc.password)
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, u != nil)
+			if tc.expected {
+				assert.Equal(t, ct.Roles, u.Roles)
+			}
+		})
+	}
+
+	t.Run("given database error should fail", func(t *testing.T) {
+		_, err := services.NewUserService(&MockUserRepository{err: errors.New("db down")}).Authenticate("adminTax", "correct-horse-battery")
+
+		assert.ErrorIs(t, err, services.ErrInternal)
+	})
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	t.Run("given no user should create the first admin", func(t *testing.T) {
+		repo := &MockUserRepository{users: map[string]repository.AdminUser{}}
+		us := services.NewUserService(repo).WithHashCost(bcrypt.MinCost)
+
+		created, err := us.BootstrapAdmin("adminTax", "correct-horse-battery")
+
+		assert.Nil(t, err)
+		assert.True(t, created)
+		assert.NotEqual(t, "correct-horse-battery", repo.users["adminTax"].PasswordHash, "Only a hash should be stored")
+		assert.Equal(t, ct.Roles, repo.users["adminTax"].Roles, "The first admin should have every role")
+		assert.Equal(t, repository.AuditEntry{User: ct.AuditSystem, Action: ct.AuditUserCreate, Target: "adminTax"}, repo.change)
+		u, _ := us.Authenticate("adminTax", "correct-horse-battery")
+		assert.NotNil(t, u)
+	})
+
+	t.Run("given existing users should do nothing", func(t *testing.T) {
+		repo := usersRepo()
+
+		created, err := services.NewUserService(repo).WithHashCost(bcrypt.MinCost).BootstrapAdmin("other", "other-password")
+
+		assert.Nil(t, err)
+		assert.False(t, created)
+		assert.NotContains(t, repo.users, "other")
+	})
+}
+
+func TestCreateAdminUser(t *testing.T) {
+	t.Run("given new user should create it", func(t *testing.T) {
+		repo := usersRepo()
+
+		res, err := services.NewUserService(repo).WithHashCost(bcrypt.MinCost).CreateAdminUser(md.AdminUserRequest{
+			Username: "auditor", Password: "s3cret-passphrase", Roles: []string{ct.RoleAuditor, ct.RoleViewer, ct.RoleAuditor},
+		}, _admin)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "auditor", res.Username)
+		assert.Equal(t, []string{ct.RoleViewer, ct.RoleAuditor}, res.Roles, "Roles should be kept once each, in order")
+		assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(repo.users["auditor"].PasswordHash), []byte("s3cret-passphrase")))
+		assert.Equal(t, repository.AuditEntry{User: "adminTax", RequestID: "req-1", Action: ct.AuditUserCreate, Target: "auditor"}, repo.change)
+	})
+
+	cases := []struct {
+		name     string
+		request  md.AdminUserRequest
+		expected error
+	}{
+		{name: "given taken username should fail", request: md.AdminUserRequest{Username: "support", Password: "s3cret-passphrase"}, expected: services.ErrAdminUserExists},
+		{name: "given invalid username should fail", request: md.AdminUserRequest{Username: "a b", Password: "s3cret-passphrase"}, expected: services.ErrAdminUsername},
+		{name: "given short password should fail", request: md.AdminUserRequest{Username: "auditor", Password: "abc"}, expected: services.ErrAdminPassword},
+		{name: "given unknown role should fail", request: md.AdminUserRequest{Username: "auditor", Password: "s3cret-passphrase", Roles: []string{"root"}}, expected: services.ErrAdminRole},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := services.NewUserService(usersRepo()).WithHashCost(bcrypt.MinCost).CreateAdminUser(tc.request, _admin)
+
+			assert.ErrorIs(t, err, tc.expected)
+		})
+	}
+}
+
+func TestUpdateAdminUser(t *testing.T) {
+	t.Run("given new password should change it and keep the rest", func(t *testing.T) {
+		repo := usersRepo()
+		password := "new-password"
+
+		res, err := services.NewUserService(repo).WithHashCost(bcrypt.MinCost).UpdateAdminUser("support", md.AdminUserUpdate{Password: &password}, _admin)
+
+		assert.Nil(t, err)
+		assert.True(t, res.Disabled)
+		assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(repo.users["support"].PasswordHash), []byte(password)))
+		assert.Equal(t, ct.AuditUserUpdate, repo.change.Action)
+	})
+
+	t.Run("given roles should replace them", func(t *testing.T) {
+		repo := usersRepo()
+		roles := []string{ct.RoleAuditor, ct.RoleViewer}
+
+		res, err := services.NewUserService(repo).UpdateAdminUser("support", md.AdminUserUpdate{Roles: &roles}, _admin)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{ct.RoleViewer, ct.RoleAuditor}, res.Roles)
+		assert.Equal(t, []string{ct.RoleViewer, ct.RoleAuditor}, repo.users["support"].Roles)
+	})
+
+	disabled := true
+	noUserAdmin := []string{ct.RoleViewer}
+	unknownRole := []string{"root"}
+	cases := []struct {
+		name     string
+		username string
+		update   md.AdminUserUpdate
+		expected error
+	}{
+		{name: "given own account should not disable it", username: "adminTax", update: md.AdminUserUpdate{Disabled: &disabled}, expected: services.ErrAdminUserSelf},
+		{name: "given own account should keep user-admin", username: "adminTax", update: md.AdminUserUpdate{Roles: &noUserAdmin}, expected: services.ErrAdminUserSelf},
+		{name: "given unknown role should fail", username: "support", update: md.AdminUserUpdate{Roles: &unknownRole}, expected: services.ErrAdminRole},
+		{name: "given unknown user should fail", username: "nobody", update: md.AdminUserUpdate{Disabled: &disabled}, expected: services.ErrAdminUserNotFound},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := services.NewUserService(usersRepo()).UpdateAdminUser(tc.username, tc.update, _admin)
+
+			assert.ErrorIs(t, err, tc.expected)
+		})
+	}
+}
+
+func TestDeleteAdminUser(t *testing.T) {
+	cases := []struct {
+		name     string
+		username string
+		expected error
+	}{
+		{name: "given other user should delete it", username: "support"},
+		{name: "given own account should not delete it", username: "adminTax", expected: services.ErrAdminUserSelf},
+		{name: "given unknown user should fail", username: "nobody", expected: services.ErrAdminUserNotFound},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := usersRepo()
+
+			err := services.NewUserService(repo).DeleteAdminUser(tc.username, _admin)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.NotContains(t, repo.users, tc.username)
+				return
+			}
+			assert.ErrorIs(t, err, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Package xlsx writes single-sheet Office Open XML spreadsheets row by row,
+// so a large sheet never has to be held in memory. Only what a plain data
+// export needs is supported: text and number cells on one worksheet.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// MIMEType is the content type of an .xlsx file.
+const MIMEType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+var ErrClosed = errors.New("xlsx: write to closed writer")
+
+// Cell is a cell of a row. A number cell holds a decimal number in Value, e.g.
+// "500000.00"; an empty number cell is left blank.
+type Cell struct {
+	Value  string
+	Number bool
+}
+
+// Text returns a text cell.
+func Text(s string) Cell {
+	return Cell{Value: s}
+}
+
+// Number returns a number cell of the decimal number s.
+func Number(s string) Cell {
+	return Cell{Value: s, Number: true}
+}
+
+// The parts of the package other than the sheet never change.
+var staticParts = []struct{ name, body string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+const (
+	sheetStart = xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	sheetEnd   = `</sheetData></worksheet>`
+)
+
+// Writer writes the rows of a sheet. Nothing is written to the underlying
+// writer until the first row, and the file is only complete after Close.
+type Writer struct {
+	out    io.Writer
+	zw     *zip.Writer
+	sheet  io.Writer
+	closed bool
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{out: w}
+}
+
+func (w *Writer) start() error {
+	if w.zw != nil {
+		return nil
+	}
+	w.zw = zip.NewWriter(w.out)
+	for _, p := range staticParts {
+		f, err := w.zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return err
+		}
+	}
+	// The sheet is the last part, so it can be streamed.
+	sheet, err := w.zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	w.sheet = sheet
+	_, err = io.WriteString(sheet, sheetStart)
+	return err
+}
+
+// Write writes a row of cells.
+func (w *Writer) Write(row []Cell) error {
+	if w.closed {
+		return ErrClosed
+	}
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("<row>")
+	for _, c := range row {
+		switch {
+		case c.Value == "":
+			b.WriteString("<c/>")
+		case c.Number:
+			b.WriteString("<c><v>")
+			xml.EscapeText(&b, []byte(c.Value))
+			b.WriteString("</v></c>")
+		default:
+			b.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			xml.EscapeText(&b, []byte(c.Value))
+			b.WriteString("</t></is></c>")
+		}
+	}
+	b.WriteString("</row>")
+	_, err := io.WriteString(w.sheet, b.String())
+	return err
+}
+
+// Close finishes the sheet and the file. It does not close the underlying
+// writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	if err := w.start(); err != nil {
+		return err
+	}
+	w.closed = true
+	if _, err := io.WriteString(w.sheet, sheetEnd); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
@@ -0,0 +1,57 @@
+package xlsx_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+
+	"github.com/kanawat2566/assessment-tax/xlsx"
+	"github.com/stretchr/testify/assert"
+)
+
+// readSheet returns the parts of the file and the sheet XML.
+func readSheet(t *testing.T, b []byte) ([]string, string) {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	assert.Nil(t, err)
+	var names []string
+	var sheet string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		r, err := f.Open()
+		assert.Nil(t, err)
+		body, err := io.ReadAll(r)
+		assert.Nil(t, err)
+		assert.Nil(t, xml.Unmarshal(body, new(interface{})), "%v should be well-formed XML", f.Name)
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			sheet = string(body)
+		}
+	}
+	return names, sheet
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := xlsx.NewWriter(&buf)
+
+	assert.Nil(t, w.Write([]xlsx.Cell{xlsx.Text("id"), xlsx.Text("tax")}))
+	assert.Nil(t, w.Write([]xlsx.Cell{xlsx.Text("<E&01>"), xlsx.Number("29000.00"), xlsx.Number("")}))
+	assert.Nil(t, w.Close())
+
+	names, sheet := readSheet(t, buf.Bytes())
+	assert.Equal(t, []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"}, names)
+	assert.Contains(t, sheet, `<sheetData><row><c t="inlineStr"><is><t xml:space="preserve">id</t></is></c>`)
+	assert.Contains(t, sheet, `<row><c t="inlineStr"><is><t xml:space="preserve">&lt;E&amp;01&gt;</t></is></c><c><v>29000.00</v></c><c/></row></sheetData>`)
+}
+
+func TestWriter_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	w := xlsx.NewWriter(&buf)
+
+	assert.Nil(t, w.Close())
+
+	_, sheet := readSheet(t, buf.Bytes())
+	assert.Contains(t, sheet, `<sheetData></sheetData>`)
+	assert.ErrorIs(t, w.Write(nil), xlsx.ErrClosed)
+}